@@ -232,6 +232,7 @@ export default function LogsPage() {
                 <SelectItem value="error">Error</SelectItem>
                 <SelectItem value="timeout">Timeout</SelectItem>
                 <SelectItem value="budget_blocked">Budget blocked</SelectItem>
+                <SelectItem value="partial">Partial</SelectItem>
               </SelectContent>
             </Select>
             <span className="text-sm text-neutral-500">
@@ -31,8 +31,12 @@ export default function ProvidersPage() {
 
   const defaultBaseUrls: Record<string, string> = {
     openrouter: "https://openrouter.ai/api/v1",
-    ollama: "http://localhost:11434/v1",
+    ollama: "http://localhost:11434",
     openai_compatible: "",
+    anthropic: "https://api.anthropic.com/v1",
+    gemini: "https://generativelanguage.googleapis.com/v1beta",
+    azure_openai: "https://<resource>.openai.azure.com",
+    bedrock: "https://bedrock-runtime.us-east-1.amazonaws.com",
   };
 
   return (
@@ -51,7 +55,7 @@ export default function ProvidersPage() {
       <EmptyState
         icon={<Plug className="h-10 w-10" />}
         title="No providers connected"
-        description="Connect OpenRouter, Ollama, or any OpenAI-compatible provider to start routing requests."
+        description="Connect OpenRouter, Anthropic, Gemini, Azure OpenAI, Amazon Bedrock, Ollama, or any OpenAI-compatible provider to start routing requests."
         actionLabel="Connect provider"
         onAction={() => setShowConnect(true)}
       />
@@ -74,6 +78,10 @@ export default function ProvidersPage() {
                 <SelectContent>
                   <SelectItem value="openrouter">OpenRouter</SelectItem>
                   <SelectItem value="ollama">Ollama (Local)</SelectItem>
+                  <SelectItem value="anthropic">Anthropic</SelectItem>
+                  <SelectItem value="gemini">Google Gemini</SelectItem>
+                  <SelectItem value="azure_openai">Azure OpenAI</SelectItem>
+                  <SelectItem value="bedrock">Amazon Bedrock</SelectItem>
                   <SelectItem value="openai_compatible">OpenAI-compatible</SelectItem>
                 </SelectContent>
               </Select>
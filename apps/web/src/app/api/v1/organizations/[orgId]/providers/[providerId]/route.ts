@@ -24,7 +24,7 @@ export async function GET(
 
     const { data, error } = await supabase
       .from("providers")
-      .select("id, organization_id, name, display_name, provider_type, base_url, status, metadata, created_at, updated_at")
+      .select("id, organization_id, name, display_name, provider_type, base_url, status, status_reason, metadata, created_at, updated_at")
       .eq("id", providerId)
       .single();
 
@@ -50,13 +50,18 @@ export async function PATCH(
     if (api_key) {
       (updateData as Record<string, unknown>).api_key_enc = await encrypt(api_key);
     }
+    // A status set here is the admin's; the gateway's circuit breakers
+    // leave it alone unless it is active.
+    if (updateData.status) {
+      (updateData as Record<string, unknown>).status_reason = null;
+    }
 
     const { data, error } = await supabase
       .from("providers")
       .update(updateData)
       .eq("id", providerId)
       // Never return api_key_enc
-      .select("id, organization_id, name, display_name, provider_type, base_url, status, metadata, created_at, updated_at")
+      .select("id, organization_id, name, display_name, provider_type, base_url, status, status_reason, metadata, created_at, updated_at")
       .single();
 
     if (error) throw error;
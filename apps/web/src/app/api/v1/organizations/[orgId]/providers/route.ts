@@ -8,9 +8,11 @@ import { z } from "zod/v4";
 const createProviderSchema = z.object({
   name: z.string().min(1).max(100),
   display_name: z.string().min(1).max(100),
-  provider_type: z.enum(["openrouter", "ollama", "openai_compatible"]),
+  provider_type: z.enum(["openrouter", "ollama", "openai_compatible", "anthropic", "gemini", "azure_openai", "bedrock"]),
   base_url: z.string().url(),
   api_key: z.string().optional(),
+  // Provider type specific settings, e.g. api_version and deployments for Azure OpenAI
+  metadata: z.record(z.string(), z.unknown()).optional(),
 });
 
 export async function GET(
@@ -24,7 +26,7 @@ export async function GET(
 
     const { data, error } = await supabase
       .from("providers")
-      .select("id, organization_id, name, display_name, provider_type, base_url, status, metadata, created_at, updated_at")
+      .select("id, organization_id, name, display_name, provider_type, base_url, status, status_reason, metadata, created_at, updated_at")
       .or(`organization_id.eq.${orgId},organization_id.is.null`)
       .order("created_at", { ascending: false });
 
@@ -60,7 +62,7 @@ export async function POST(
         api_key_enc: encryptedKey,
       })
       // Never return api_key_enc in response
-      .select("id, organization_id, name, display_name, provider_type, base_url, status, metadata, created_at, updated_at")
+      .select("id, organization_id, name, display_name, provider_type, base_url, status, status_reason, metadata, created_at, updated_at")
       .single();
 
     if (error) throw error;
@@ -0,0 +1,60 @@
+-- OpenFive - Batch API (files + batches)
+-- ================================================
+
+-- Uploaded batch inputs and gateway-written outputs
+CREATE TABLE IF NOT EXISTS batch_files (
+  id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+  environment_id uuid NOT NULL REFERENCES environments(id) ON DELETE CASCADE,
+  api_key_id uuid REFERENCES api_keys(id) ON DELETE SET NULL,
+  purpose text NOT NULL, -- 'batch', 'batch_output'
+  filename text NOT NULL,
+  bytes integer NOT NULL,
+  content bytea NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS batches (
+  id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+  environment_id uuid NOT NULL REFERENCES environments(id) ON DELETE CASCADE,
+  api_key_id uuid REFERENCES api_keys(id) ON DELETE SET NULL,
+  route_slug text, -- X-Route-Id sent when the batch was created
+  endpoint text NOT NULL, -- '/v1/chat/completions', '/v1/embeddings'
+  input_file_id uuid NOT NULL REFERENCES batch_files(id),
+  output_file_id uuid REFERENCES batch_files(id) ON DELETE SET NULL,
+  error_file_id uuid REFERENCES batch_files(id) ON DELETE SET NULL,
+  completion_window text NOT NULL DEFAULT '24h',
+  status text NOT NULL DEFAULT 'validating'
+    CHECK (status IN ('validating', 'failed', 'in_progress', 'finalizing', 'completed', 'expired', 'cancelling', 'cancelled')),
+  total_requests integer NOT NULL DEFAULT 0,
+  completed_requests integer NOT NULL DEFAULT 0,
+  failed_requests integer NOT NULL DEFAULT 0,
+  errors jsonb, -- validation errors: [{code, message, line}]
+  metadata jsonb NOT NULL DEFAULT '{}',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  expires_at timestamptz NOT NULL,
+  in_progress_at timestamptz,
+  finalizing_at timestamptz,
+  completed_at timestamptz,
+  failed_at timestamptz,
+  expired_at timestamptz,
+  cancelling_at timestamptz,
+  cancelled_at timestamptz
+);
+
+-- Every line a batch runs is metered as a request tied to the batch
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS batch_id uuid REFERENCES batches(id) ON DELETE SET NULL;
+
+ALTER TABLE batch_files ENABLE ROW LEVEL SECURITY;
+ALTER TABLE batches ENABLE ROW LEVEL SECURITY;
+
+-- Files and batches are written by the gateway via service role
+CREATE POLICY "batch_file_select" ON batch_files FOR SELECT
+  USING (is_org_member(get_org_for_environment(environment_id)));
+CREATE POLICY "batch_select" ON batches FOR SELECT
+  USING (is_org_member(get_org_for_environment(environment_id)));
+
+-- Indexes
+CREATE INDEX idx_batch_files_env ON batch_files (environment_id, created_at DESC);
+CREATE INDEX idx_batches_env ON batches (environment_id, created_at DESC);
+CREATE INDEX idx_batches_status ON batches (status) WHERE status IN ('validating', 'in_progress', 'finalizing', 'cancelling');
+CREATE INDEX idx_requests_batch ON requests (batch_id) WHERE batch_id IS NOT NULL;
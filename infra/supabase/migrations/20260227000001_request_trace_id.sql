@@ -0,0 +1,9 @@
+-- OpenFive - Trace correlation for metered requests
+-- ================================================
+
+-- W3C trace ID of the request, taken from the caller's traceparent or
+-- generated by the gateway. Unlike request_id it is shared by every
+-- request made within one agent trace.
+ALTER TABLE requests ADD COLUMN IF NOT EXISTS trace_id text;
+
+CREATE INDEX idx_requests_trace ON requests (trace_id) WHERE trace_id IS NOT NULL;
@@ -0,0 +1,56 @@
+-- OpenFive - Config change notifications for the gateway
+-- ================================================
+
+-- The gateway keeps api_keys, environments, routes, models and providers
+-- in memory and listens on the gateway_config channel for changes. The
+-- payload names the table, the operation and the row id.
+--
+-- Columns written on the request path (budget_used_usd, last_used_at)
+-- and the updated_at they bump do not count as config changes. A budget
+-- update is sent on its own, with the new total, so gateways can apply it
+-- without a query.
+CREATE OR REPLACE FUNCTION notify_gateway_config()
+RETURNS TRIGGER AS $$
+DECLARE
+  volatile text[] := ARRAY['budget_used_usd', 'last_used_at', 'updated_at'];
+  row_id   uuid;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    row_id := OLD.id;
+  ELSE
+    row_id := NEW.id;
+  END IF;
+
+  IF TG_OP = 'UPDATE' AND (to_jsonb(OLD) - volatile) = (to_jsonb(NEW) - volatile) THEN
+    IF TG_TABLE_NAME = 'environments' THEN
+      IF OLD.budget_used_usd IS DISTINCT FROM NEW.budget_used_usd THEN
+        PERFORM pg_notify('gateway_config', json_build_object(
+          'table', TG_TABLE_NAME,
+          'op', 'BUDGET',
+          'id', row_id,
+          'budget_used_usd', NEW.budget_used_usd
+        )::text);
+      END IF;
+    END IF;
+    RETURN NULL;
+  END IF;
+
+  PERFORM pg_notify('gateway_config', json_build_object(
+    'table', TG_TABLE_NAME,
+    'op', TG_OP,
+    'id', row_id
+  )::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_apikeys_notify AFTER INSERT OR UPDATE OR DELETE ON api_keys
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
+CREATE TRIGGER trg_environments_notify AFTER INSERT OR UPDATE OR DELETE ON environments
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
+CREATE TRIGGER trg_routes_notify AFTER INSERT OR UPDATE OR DELETE ON routes
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
+CREATE TRIGGER trg_models_notify AFTER INSERT OR UPDATE OR DELETE ON models
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
+CREATE TRIGGER trg_providers_notify AFTER INSERT OR UPDATE OR DELETE ON providers
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
@@ -0,0 +1,6 @@
+-- OpenFive - Partial request status
+-- ================================================
+
+-- Streams cut off by a gateway shutdown are metered with the tokens
+-- relayed up to that point and marked partial.
+ALTER TYPE request_status ADD VALUE IF NOT EXISTS 'partial';
@@ -0,0 +1,12 @@
+-- OpenFive - Client certificate identities for API keys
+-- ================================================
+
+-- With mTLS enabled, a request without a bearer key is authenticated by
+-- its client certificate: the gateway looks for the key listing one of the
+-- certificate's identities (a URI, DNS or email SAN, or "CN=<common
+-- name>"). The key then selects the environment and route as usual.
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS client_cert_identities text[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_apikeys_client_certs
+  ON api_keys USING gin (client_cert_identities);
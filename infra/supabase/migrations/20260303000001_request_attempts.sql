@@ -0,0 +1,7 @@
+-- OpenFive - One row per provider attempt
+-- ================================================
+
+-- Retries and fallbacks are metered as their own rows, sharing the
+-- request_id returned to the client and numbered by attempt_number.
+ALTER TABLE requests DROP CONSTRAINT IF EXISTS requests_request_id_key;
+ALTER TABLE requests ADD CONSTRAINT requests_request_id_attempt_key UNIQUE (request_id, attempt_number);
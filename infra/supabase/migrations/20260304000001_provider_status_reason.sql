@@ -0,0 +1,7 @@
+-- OpenFive - Provider status set by the gateway's circuit breakers
+-- ================================================
+
+-- The gateway marks providers degraded or down while their circuits are
+-- open or recovering, and records why. A NULL reason means the status was
+-- set by an administrator, which the gateway leaves alone unless active.
+ALTER TABLE providers ADD COLUMN IF NOT EXISTS status_reason text;
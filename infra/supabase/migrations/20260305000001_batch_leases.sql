@@ -0,0 +1,13 @@
+-- OpenFive - Batch leases, so interrupted batches are resumed
+-- ================================================
+
+-- The gateway running a batch holds a lease on it and renews it with every
+-- progress update. A gateway that shuts down releases the lease of its
+-- batches, which stay in progress; any gateway then claims the unfinished
+-- batches without a current lease and resumes them.
+ALTER TABLE batches ADD COLUMN IF NOT EXISTS lease_expires_at timestamptz;
+
+-- Batches already running keep going on the gateways that run them; give
+-- those an hour before another gateway claims what is left of them.
+UPDATE batches SET lease_expires_at = now() + interval '1 hour'
+  WHERE status IN ('validating', 'in_progress', 'finalizing', 'cancelling');
@@ -0,0 +1,9 @@
+-- OpenFive - Config notifications for project moves
+-- ================================================
+
+-- The gateway caches each environment with its project's organization_id,
+-- which decides the organization-owned providers and models the
+-- environment may use. Moving a project to another organization announces a
+-- change on the projects table, and gateways reload their environments.
+CREATE TRIGGER trg_projects_notify AFTER UPDATE OF organization_id ON projects
+  FOR EACH ROW EXECUTE FUNCTION notify_gateway_config();
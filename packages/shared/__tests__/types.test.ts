@@ -86,16 +86,20 @@ describe("ENVIRONMENT_TIERS", () => {
 });
 
 describe("PROVIDER_TYPES", () => {
-  it("contains exactly three provider types", () => {
+  it("contains exactly seven provider types", () => {
     expect(PROVIDER_TYPES).toEqual([
       "openrouter",
       "ollama",
       "openai_compatible",
+      "anthropic",
+      "gemini",
+      "azure_openai",
+      "bedrock",
     ]);
   });
 
-  it("has length 3", () => {
-    expect(PROVIDER_TYPES).toHaveLength(3);
+  it("has length 7", () => {
+    expect(PROVIDER_TYPES).toHaveLength(7);
   });
 
   it("includes openrouter", () => {
@@ -109,6 +113,22 @@ describe("PROVIDER_TYPES", () => {
   it("includes openai_compatible", () => {
     expect(PROVIDER_TYPES).toContain("openai_compatible");
   });
+
+  it("includes anthropic", () => {
+    expect(PROVIDER_TYPES).toContain("anthropic");
+  });
+
+  it("includes gemini", () => {
+    expect(PROVIDER_TYPES).toContain("gemini");
+  });
+
+  it("includes azure_openai", () => {
+    expect(PROVIDER_TYPES).toContain("azure_openai");
+  });
+
+  it("includes bedrock", () => {
+    expect(PROVIDER_TYPES).toContain("bedrock");
+  });
 });
 
 describe("STATUS_VARIANTS", () => {
@@ -1,7 +1,7 @@
 export const MEMBERSHIP_ROLES = ["owner", "admin", "member", "viewer"] as const;
 export const PROJECT_ROLES = ["admin", "editor", "viewer"] as const;
 export const ENVIRONMENT_TIERS = ["development", "staging", "production"] as const;
-export const PROVIDER_TYPES = ["openrouter", "ollama", "openai_compatible"] as const;
+export const PROVIDER_TYPES = ["openrouter", "ollama", "openai_compatible", "anthropic", "gemini", "azure_openai", "bedrock"] as const;
 
 export const STATUS_VARIANTS = {
   ok: { label: "OK", color: "green" },
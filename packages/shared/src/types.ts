@@ -7,7 +7,7 @@ export type EnvironmentTier = "development" | "staging" | "production";
 export type BudgetMode = "soft" | "hard";
 
 // Provider
-export type ProviderType = "openrouter" | "ollama" | "openai_compatible";
+export type ProviderType = "openrouter" | "ollama" | "openai_compatible" | "anthropic" | "gemini" | "azure_openai" | "bedrock";
 export type ProviderStatus = "active" | "degraded" | "down";
 
 // Request
@@ -16,7 +16,8 @@ export type RequestStatus =
   | "error"
   | "timeout"
   | "budget_blocked"
-  | "killed";
+  | "killed"
+  | "partial";
 
 export type ActionTaken =
   | "none"
@@ -107,6 +108,8 @@ export interface Provider {
   provider_type: ProviderType;
   base_url: string;
   status: ProviderStatus;
+  // Why the gateway set the status; null when an admin set it.
+  status_reason: string | null;
   metadata: Record<string, unknown>;
   created_at: string;
   updated_at: string;
@@ -157,6 +160,14 @@ export interface GuardrailSettings {
     max_attempts: number;
     repair_model: string;
   };
+  cache?: {
+    enabled: boolean;
+  };
+  retry?: {
+    max_retries: number;
+    timeout_ms: number;
+    attempt_timeout_ms?: number;
+  };
 }
 
 export interface Route {
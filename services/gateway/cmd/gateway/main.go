@@ -2,106 +2,364 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/openfive/gateway/internal/anomaly"
+	"github.com/openfive/gateway/internal/auth"
+	"github.com/openfive/gateway/internal/batch"
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/certs"
+	"github.com/openfive/gateway/internal/circuit"
 	"github.com/openfive/gateway/internal/config"
-	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/configcache"
+	"github.com/openfive/gateway/internal/db"
+	"github.com/openfive/gateway/internal/discovery"
+	"github.com/openfive/gateway/internal/filestore"
+	"github.com/openfive/gateway/internal/health"
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/loop"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/metrics"
+	"github.com/openfive/gateway/internal/pipeline"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/router"
+	"github.com/openfive/gateway/internal/schema"
+	"github.com/openfive/gateway/internal/server"
+	"github.com/openfive/gateway/internal/token"
+	"github.com/openfive/gateway/internal/tracing"
+	"github.com/openfive/gateway/internal/upgrade"
 )
 
+// streamStopGrace bounds how long cut-off streams get to send their final
+// event and be metered.
+const streamStopGrace = 5 * time.Second
+
+// upgradeReadyTimeout bounds how long an upgrade waits for the new process
+// to load its configuration and start serving.
+const upgradeReadyTimeout = time.Minute
+
+// certReloadInterval is how often the TLS files are checked for changes.
+const certReloadInterval = 10 * time.Second
+
+// circuitSyncInterval is how often circuit states are persisted to the
+// providers' status.
+const circuitSyncInterval = 5 * time.Second
+
+// batchClaimInterval is how often unfinished batches left by stopped
+// gateways are looked for.
+const batchClaimInterval = 30 * time.Second
+
 func main() {
 	cfg := config.Load()
 
-	mux := http.NewServeMux()
+	logger := logging.New(os.Stderr, cfg.LogLevel, cfg.LogJSON)
+	slog.SetDefault(logger)
 
-	// POST /v1/chat/completions - main proxy endpoint
-	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
-		// Parse request
-		var req model.ChatCompletionRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid_request", "Failed to parse request body")
-			return
+	// Without an OTLP endpoint trace IDs are still generated and propagated,
+	// but no spans are exported.
+	tracer := tracing.NewTracer(nil)
+	if cfg.OTLPEndpoint != "" {
+		exporter := tracing.NewOTLPExporter(tracing.OTLPConfig{
+			Endpoint:    cfg.OTLPEndpoint,
+			Headers:     tracing.ParseHeaders(cfg.OTLPHeaders),
+			ServiceName: cfg.ServiceName,
+		}, &http.Client{Timeout: 10 * time.Second}, logger.With("component", "tracing"))
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			exporter.Shutdown(ctx)
+		}()
+		tracer = tracing.NewTracer(exporter)
+		logger.Info("exporting traces", "endpoint", cfg.OTLPEndpoint)
+	}
+
+	// The gateway runs either against Postgres or, without a database, from
+	// a config file with metering to a local JSONL file.
+	var (
+		store      pipeline.Store
+		configSrc  pipeline.ConfigSource
+		keys       auth.KeyLookup
+		killStore  anomaly.Store
+		batchStore batch.Store
+		batchKeys  batch.KeySource
+		sink       meter.Sink
+		providers  health.ProviderSource
+		statuses   circuit.StatusStore
+		discovered discovery.ModelWriter
+		database   server.Pinger
+		synced     server.Syncer
+	)
+	if cfg.ConfigFile != "" {
+		fileStore, err := filestore.Open(cfg.ConfigFile)
+		if err != nil {
+			fatal(logger, "load config file", "error", err)
+		}
+		jsonl, err := meter.NewJSONLSink(cfg.MeterFile)
+		if err != nil {
+			fatal(logger, "open meter file", "error", err)
 		}
+		defer jsonl.Close()
+		go reloadOnHangup(fileStore, logger.With("component", "config"))
+		logger.Info("running standalone", "config_file", cfg.ConfigFile, "meter_file", cfg.MeterFile)
 
-		// Extract metadata headers
-		routeID := r.Header.Get("X-Route-Id")
-		if routeID == "" {
-			routeID = r.Header.Get("X-Feature")
+		store, configSrc, keys, killStore = fileStore, fileStore, fileStore, fileStore
+		batchStore = batch.NewMemoryStore()
+		sink = jsonl
+		providers, statuses, discovered, synced = fileStore, fileStore, fileStore, fileStore
+	} else {
+		if cfg.DatabaseURL == "" {
+			fatal(logger, "DATABASE_URL or GATEWAY_CONFIG_FILE is required")
+		}
+		pool, err := db.NewPool(context.Background(), cfg.DatabaseURL)
+		if err != nil {
+			fatal(logger, "connect to database", "error", err)
 		}
+		defer pool.Close()
+		logger.Info("database connection pool established")
 
-		// Auth: validate API key
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			writeError(w, http.StatusUnauthorized, "unauthorized", "Missing Authorization header")
-			return
+		queries := db.NewQueries(pool)
+		configCache := configcache.New(queries, logger.With("component", "config"), cfg.ConfigResync)
+		if err := configCache.Load(context.Background()); err != nil {
+			fatal(logger, "load config snapshot", "error", err)
 		}
+		configCtx, stopConfig := context.WithCancel(context.Background())
+		defer stopConfig()
+		go configCache.Run(configCtx)
 
-		// TODO: Full pipeline implementation
-		// For now, return not-implemented
-		writeError(w, http.StatusNotImplemented, "not_implemented",
-			fmt.Sprintf("Gateway pipeline not yet connected. Route: %s, Model: %s", routeID, req.Model))
-	})
+		store, configSrc, keys, killStore, batchStore, batchKeys = queries, configCache, configCache, queries, queries, configCache
+		sink = meter.NewPostgresSink(pool.Inner())
+		providers, statuses, discovered, database, synced = configCache, queries, queries, pool, configCache
+	}
 
-	// GET /v1/models - list virtual models
-	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"object": "list",
-			"data":   []interface{}{},
-		})
-	})
+	meterWriter := meter.NewWriter(sink, cfg.MeterBatchSize, cfg.MeterFlushMs, logger.With("component", "meter"), tracer)
+
+	promptCache := cache.New(cache.DefaultConfig())
+	limiter := budget.NewRateLimiter()
+	detector := anomaly.NewDetector()
+	killSwitch := anomaly.NewKillSwitch(killStore)
+
+	gatewayMetrics := metrics.NewGateway()
+	gatewayMetrics.WatchCache(promptCache)
+	gatewayMetrics.WatchMeter(meterWriter)
+	gatewayMetrics.WatchRateLimiter(limiter)
+	gatewayMetrics.WatchAnomaly(detector, killSwitch)
+
+	httpClient := &http.Client{Transport: &tracing.Transport{}}
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewOpenRouter(httpClient))
+	registry.Register(provider.NewOllama(httpClient))
+	registry.Register(provider.NewGeneric(httpClient))
+	registry.Register(provider.NewAnthropic(httpClient))
+	registry.Register(provider.NewGemini(httpClient))
+	registry.Register(provider.NewAzureOpenAI(httpClient))
+	registry.Register(provider.NewBedrock(httpClient))
+
+	var prober *health.Prober
+	if cfg.ProbeInterval > 0 {
+		prober = health.NewProber(providers, registry, cfg.MasterEncKey, 5*time.Second, logger.With("component", "probe"))
+		probeCtx, stopProbe := context.WithCancel(context.Background())
+		defer stopProbe()
+		go prober.Run(probeCtx, cfg.ProbeInterval)
+	}
+
+	// Self-hosted providers report which models they have loaded, so the
+	// router can try those before models that would first have to load.
+	engine := router.NewEngine()
+	if cfg.ModelSync > 0 {
+		syncer := discovery.NewSyncer(providers, registry, discovered, cfg.MasterEncKey, 5*time.Second, logger.With("component", "discovery"))
+		syncCtx, stopSync := context.WithCancel(context.Background())
+		defer stopSync()
+		go syncer.Run(syncCtx, cfg.ModelSync)
+		engine.PreferLoaded(syncer)
+	}
+
+	// Providers and models whose calls keep failing are skipped until they
+	// recover, and their provider's status is updated for the dashboard
+	// and the other instances.
+	var breakers *circuit.Breakers
+	if cfg.CircuitCooldown > 0 {
+		circuitCfg := circuit.DefaultConfig()
+		circuitCfg.Cooldown = cfg.CircuitCooldown
+		breakers = circuit.New(circuitCfg, providers, statuses, logger.With("component", "circuit"))
+		circuitCtx, stopCircuits := context.WithCancel(context.Background())
+		defer stopCircuits()
+		go breakers.Run(circuitCtx, circuitSyncInterval)
+		engine.SkipOpen(breakers)
+	}
 
-	// POST /internal/health - health check
-	mux.HandleFunc("POST /internal/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	p := pipeline.New(pipeline.Options{
+		Auth:       auth.NewAuthenticator(keys),
+		Store:      store,
+		Config:     configSrc,
+		Estimator:  token.NewEstimator(),
+		Router:     engine,
+		Budget:     budget.NewEnforcer(),
+		Limiter:    limiter,
+		Registry:   registry,
+		Circuits:   breakers,
+		Validator:  schema.NewValidator(),
+		Repairer:   schema.NewRepairer(),
+		Cache:      promptCache,
+		Loops:      loop.NewDetector(),
+		Anomaly:    detector,
+		KillSwitch: killSwitch,
+		Meter:      meterWriter,
+		MasterKey:  cfg.MasterEncKey,
+		Logger:     logger,
+		Metrics:    gatewayMetrics,
+		Tracer:     tracer,
 	})
 
-	// Also support GET for health
-	mux.HandleFunc("GET /internal/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	batches := batch.NewService(batchStore, batchKeys, server.NewBatchExecutor(p, tracer), cfg.BatchConcurrency, logger.With("component", "batch"))
+	batchCtx, stopBatches := context.WithCancel(context.Background())
+	defer stopBatches()
+	go batches.Run(batchCtx, batchClaimInterval)
+
+	api := server.New(server.Options{
+		Pipeline: p,
+		Batches:  batches,
+		Metrics:  gatewayMetrics,
+		Tracer:   tracer,
+		Logger:   logger.With("component", "server"),
+
+		Cache:       promptCache,
+		Limiter:     limiter,
+		Anomaly:     detector,
+		KillSwitch:  killSwitch,
+		Meter:       meterWriter,
+		AdminTokens: []string{cfg.ServiceRoleKey, cfg.AdminToken},
+
+		Database:        database,
+		ConfigState:     synced,
+		Prober:          prober,
+		MeterBacklogMax: cfg.ReadyMeterMax,
 	})
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      mux,
+		Handler:      api.Handler(),
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
 	}
 
+	// With a certificate the gateway terminates TLS itself, picking up
+	// renewed certificates without a restart.
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		clientAuth, err := certs.ParseClientAuth(cfg.TLSClientAuth)
+		if err != nil {
+			fatal(logger, "GATEWAY_TLS_CLIENT_AUTH", "error", err)
+		}
+		reloader, err := certs.NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, logger.With("component", "tls"))
+		if err != nil {
+			fatal(logger, "load TLS certificate", "error", err)
+		}
+		certCtx, stopCerts := context.WithCancel(context.Background())
+		defer stopCerts()
+		go reloader.Run(certCtx, certReloadInterval)
+		srv.TLSConfig = reloader.TLSConfig(clientAuth)
+	}
+
+	upgrader := upgrade.New(cfg.PIDFile, upgradeReadyTimeout)
+	ln, err := upgrader.Listen(srv.Addr)
+	if err != nil {
+		fatal(logger, "listen", "error", err)
+	}
 	go func() {
-		log.Printf("OpenFive gateway listening on :%d", cfg.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen error: %v", err)
+		logger.Info("OpenFive gateway listening", "port", cfg.Port, "tls", srv.TLSConfig != nil,
+			"client_ca", cfg.TLSClientCAFile != "", "inherited", upgrader.Inherited())
+		serve := srv.Serve
+		if srv.TLSConfig != nil {
+			serve = func(ln net.Listener) error { return srv.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && err != http.ErrServerClosed {
+			fatal(logger, "serve", "error", err)
 		}
 	}()
+	if err := upgrader.Ready(); err != nil {
+		fatal(logger, "report ready", "error", err)
+	}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	drainDelay, drainTimeout := waitForShutdown(upgrader, cfg, logger)
 
-	log.Println("shutting down gateway...")
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	// Report not ready and keep serving for the drain delay, so load
+	// balancers and probes see it and move traffic away. Then stop
+	// accepting connections and give requests and streams until the drain
+	// timeout to finish. Streams still running after that are cut off and
+	// metered as partial.
+	logger.Info("shutting down gateway", "active_streams", api.ActiveStreams(), "drain_delay", drainDelay)
+	api.Drain()
+	time.Sleep(drainDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("shutdown error: %v", err)
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), streamStopGrace)
+		cut := api.StopStreams(stopCtx)
+		stopCancel()
+		logger.Warn("shutdown timeout reached", "streams_cut_off", cut, "error", err)
+		srv.Close()
 	}
-	log.Println("gateway stopped")
+
+	// Every request has been metered by now; write out what is buffered.
+	// Running batches record their progress and are left for the next
+	// gateway to resume.
+	stopBatches()
+	batches.Close()
+	p.Close()
+	meterWriter.Close()
+	logger.Info("gateway stopped", "metered", meterWriter.Written(), "meter_errors", meterWriter.FlushErrors())
 }
 
-func writeError(w http.ResponseWriter, status int, errType, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(model.ErrorResponse{
-		Error: model.ErrorDetail{
-			Message: message,
-			Type:    errType,
-		},
-	})
+// waitForShutdown blocks until the gateway should stop and returns how long
+// to keep serving while reporting not ready, and how long in-flight
+// requests then get to finish. SIGINT and SIGTERM stop it after the drain
+// delay, with the shutdown timeout. SIGUSR2 starts a new process on the
+// same listener and, once it is ready, stops this one right away, as the
+// new process takes over the listener, with the longer upgrade drain
+// timeout so that long streams can complete; a failed upgrade keeps
+// serving.
+func waitForShutdown(upgrader *upgrade.Upgrader, cfg *config.Config, logger *slog.Logger) (time.Duration, time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2)
+	for sig := range signals {
+		if sig != syscall.SIGUSR2 {
+			return cfg.DrainDelay, cfg.ShutdownTimeout
+		}
+		logger.Info("upgrading gateway")
+		pid, err := upgrader.Upgrade()
+		if err != nil {
+			logger.Error("upgrade failed, still serving", "error", err)
+			continue
+		}
+		logger.Info("new gateway process ready, draining", "pid", pid, "drain_timeout", cfg.UpgradeDrain)
+		return 0, cfg.UpgradeDrain
+	}
+	return cfg.DrainDelay, cfg.ShutdownTimeout
+}
+
+// reloadOnHangup re-reads the config file on SIGHUP. A file that fails to
+// load is logged and the previous configuration is kept.
+func reloadOnHangup(fileStore *filestore.Store, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := fileStore.Reload(); err != nil {
+			logger.Error("reload config file", "path", fileStore.Path(), "error", err)
+			continue
+		}
+		logger.Info("config file reloaded", "path", fileStore.Path())
+	}
+}
+
+func fatal(logger *slog.Logger, msg string, args ...interface{}) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
@@ -7,6 +7,7 @@ toolchain go1.23.6
 require (
 	github.com/jackc/pgx/v5 v5.7.4
 	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
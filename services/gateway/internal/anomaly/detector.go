@@ -1,6 +1,7 @@
 package anomaly
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -107,3 +108,47 @@ func (d *Detector) Observe(
 
 	return false, windowTotal
 }
+
+// WindowTotals returns the current cost window total per environment.
+func (d *Detector) WindowTotals() map[string]float64 {
+	// Total evicts expired samples, so this takes the write lock.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	totals := make(map[string]float64, len(d.windows))
+	for envID, w := range d.windows {
+		totals[envID] = w.Total()
+	}
+	return totals
+}
+
+// WindowState is a point-in-time view of an environment's cost window.
+type WindowState struct {
+	EnvironmentID string
+	Duration      time.Duration
+	Samples       int
+	TotalUSD      float64
+	// BaselineUSD is nil until a baseline has been set.
+	BaselineUSD *float64
+}
+
+// Windows returns the cost window of every observed environment, sorted
+// by environment ID.
+func (d *Detector) Windows() []WindowState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]WindowState, 0, len(d.windows))
+	for envID, w := range d.windows {
+		state := WindowState{
+			EnvironmentID: envID,
+			Duration:      w.duration,
+			TotalUSD:      w.Total(),
+			Samples:       len(w.samples),
+		}
+		if baseline, ok := d.baselines[envID]; ok {
+			state.BaselineUSD = &baseline
+		}
+		out = append(out, state)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EnvironmentID < out[j].EnvironmentID })
+	return out
+}
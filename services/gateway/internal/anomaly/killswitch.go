@@ -2,66 +2,73 @@ package anomaly
 
 import (
 	"context"
-	"fmt"
-	"time"
-
-	"github.com/jackc/pgx/v5/pgxpool"
+	"sync"
 )
 
-// KillSwitch manages the kill-switch state for environments.
+// Store persists kill-switch state.
+type Store interface {
+	ActivateKillSwitch(ctx context.Context, envID, reason string, triggerData map[string]interface{}) error
+	DeactivateKillSwitch(ctx context.Context, envID string) error
+}
+
+// KillSwitch manages the kill-switch state for environments. The state
+// lives in the store; the last state seen per environment is kept for
+// metrics.
 type KillSwitch struct {
-	pool *pgxpool.Pool
+	store Store
+
+	mu          sync.Mutex
+	active      map[string]bool
+	activations int64
 }
 
-func NewKillSwitch(pool *pgxpool.Pool) *KillSwitch {
-	return &KillSwitch{pool: pool}
+func NewKillSwitch(store Store) *KillSwitch {
+	return &KillSwitch{store: store, active: make(map[string]bool)}
 }
 
-// Activate turns on the kill switch for an environment.
-func (ks *KillSwitch) Activate(ctx context.Context, envID, reason string, triggerData map[string]interface{}) error {
-	tx, err := ks.pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	defer tx.Rollback(ctx)
+// Observe records the kill-switch state of an environment as loaded from
+// the store.
+func (ks *KillSwitch) Observe(envID string, active bool) {
+	ks.mu.Lock()
+	ks.active[envID] = active
+	ks.mu.Unlock()
+}
 
-	// Update environment
-	_, err = tx.Exec(ctx, `
-		UPDATE environments
-		SET killswitch_active = true,
-		    killswitch_reason = $2,
-		    killswitch_at = now()
-		WHERE id = $1
-	`, envID, reason)
-	if err != nil {
-		return fmt.Errorf("update environment: %w", err)
+// States returns the last seen kill-switch state per environment.
+func (ks *KillSwitch) States() map[string]bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	out := make(map[string]bool, len(ks.active))
+	for k, v := range ks.active {
+		out[k] = v
 	}
+	return out
+}
 
-	// Create incident
-	_, err = tx.Exec(ctx, `
-		INSERT INTO incidents (environment_id, severity, status, incident_type,
-		                       title, description, trigger_data, killswitch_activated)
-		VALUES ($1, 'critical', 'open', 'killswitch_activated',
-		        $2, $3, $4, true)
-	`, envID, "Kill switch activated: "+reason, reason, triggerData)
-	if err != nil {
-		return fmt.Errorf("create incident: %w", err)
-	}
+// Activations returns the number of activations made by this process.
+func (ks *KillSwitch) Activations() int64 {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.activations
+}
 
-	return tx.Commit(ctx)
+// Activate turns on the kill switch for an environment.
+func (ks *KillSwitch) Activate(ctx context.Context, envID, reason string, triggerData map[string]interface{}) error {
+	if err := ks.store.ActivateKillSwitch(ctx, envID, reason, triggerData); err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	ks.active[envID] = true
+	ks.activations++
+	ks.mu.Unlock()
+	return nil
 }
 
 // Deactivate turns off the kill switch for an environment.
 func (ks *KillSwitch) Deactivate(ctx context.Context, envID string) error {
-	_, err := ks.pool.Exec(ctx, `
-		UPDATE environments
-		SET killswitch_active = false,
-		    killswitch_reason = NULL,
-		    killswitch_at = NULL
-		WHERE id = $1
-	`, envID)
-	return err
+	if err := ks.store.DeactivateKillSwitch(ctx, envID); err != nil {
+		return err
+	}
+	ks.Observe(envID, false)
+	return nil
 }
-
-// ensure time is used
-var _ = time.Now
@@ -0,0 +1,208 @@
+package anthropic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfive/gateway/internal/chat"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// ToChatRequest translates an Anthropic Messages request into the
+// OpenAI-compatible request the pipeline runs on.
+func ToChatRequest(req *MessagesRequest) (*model.ChatCompletionRequest, error) {
+	if req.MaxTokens <= 0 {
+		return nil, fmt.Errorf("max_tokens is required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages must not be empty")
+	}
+
+	maxTokens := req.MaxTokens
+	out := &model.ChatCompletionRequest{
+		Model:       req.Model,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   &maxTokens,
+	}
+	if len(req.StopSequences) > 0 {
+		out.Stop = req.StopSequences
+	}
+	if req.Metadata != nil {
+		out.User = req.Metadata.UserID
+	}
+
+	if system := textOf(req.System); system != "" {
+		out.Messages = append(out.Messages, model.Message{Role: "system", Content: system})
+	}
+	for _, m := range req.Messages {
+		msgs, err := toChatMessages(m)
+		if err != nil {
+			return nil, err
+		}
+		out.Messages = append(out.Messages, msgs...)
+	}
+
+	for _, t := range req.Tools {
+		out.Tools = append(out.Tools, model.Tool{
+			Type: "function",
+			Function: model.FunctionDef{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.InputSchema,
+			},
+		})
+	}
+	if req.ToolChoice != nil {
+		out.ToolChoice = toChatToolChoice(req.ToolChoice)
+	}
+
+	return out, nil
+}
+
+// toChatMessages converts one Anthropic message. Tool results in a user
+// turn become separate "tool" messages, emitted before any remaining user
+// content so they directly follow the assistant's tool calls.
+func toChatMessages(m Message) ([]model.Message, error) {
+	switch m.Role {
+	case "assistant":
+		msg := model.Message{Role: "assistant"}
+		var text strings.Builder
+		for _, b := range m.Content {
+			switch b.Type {
+			case "text":
+				text.WriteString(b.Text)
+			case "tool_use":
+				args := string(b.Input)
+				if args == "" {
+					args = "{}"
+				}
+				msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+					ID:       b.ID,
+					Type:     "function",
+					Function: model.FunctionCall{Name: b.Name, Arguments: args},
+				})
+			}
+		}
+		if text.Len() > 0 {
+			msg.Content = text.String()
+		}
+		return []model.Message{msg}, nil
+
+	case "user":
+		var out []model.Message
+		var parts []interface{}
+		for _, b := range m.Content {
+			switch b.Type {
+			case "tool_result":
+				content := textOf(b.Content)
+				if b.IsError && content == "" {
+					content = "error"
+				}
+				out = append(out, model.Message{Role: "tool", ToolCallID: b.ToolUseID, Content: content})
+			case "text":
+				parts = append(parts, map[string]interface{}{"type": "text", "text": b.Text})
+			case "image":
+				if url := imageURL(b.Source); url != "" {
+					parts = append(parts, map[string]interface{}{
+						"type":      "image_url",
+						"image_url": map[string]interface{}{"url": url},
+					})
+				}
+			}
+		}
+		if len(parts) > 0 {
+			out = append(out, model.Message{Role: "user", Content: chat.PartsContent(parts)})
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported message role %q", m.Role)
+}
+
+func imageURL(src *ImageSource) string {
+	if src == nil {
+		return ""
+	}
+	if src.Type == "url" {
+		return src.URL
+	}
+	return "data:" + src.MediaType + ";base64," + src.Data
+}
+
+func toChatToolChoice(tc *ToolChoice) interface{} {
+	switch tc.Type {
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": tc.Name},
+		}
+	}
+	return "auto"
+}
+
+// textOf concatenates the text blocks of a content list.
+func textOf(c Content) string {
+	var b strings.Builder
+	for _, block := range c {
+		if block.Type == "text" {
+			b.WriteString(block.Text)
+		}
+	}
+	return b.String()
+}
+
+// FromChatResponse translates a chat completion into an Anthropic
+// Messages response.
+func FromChatResponse(resp *model.ChatCompletionResponse) *MessagesResponse {
+	out := &MessagesResponse{
+		ID:      resp.ID,
+		Type:    "message",
+		Role:    "assistant",
+		Model:   resp.Model,
+		Content: []ContentBlock{},
+	}
+
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if msg := choice.Message; msg != nil {
+			if text, ok := msg.Content.(string); ok && text != "" {
+				out.Content = append(out.Content, ContentBlock{Type: "text", Text: text})
+			}
+			for _, tc := range msg.ToolCalls {
+				out.Content = append(out.Content, ContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: chat.JSONObject(tc.Function.Arguments),
+				})
+			}
+		}
+		if choice.FinishReason != nil {
+			reason := StopReason(*choice.FinishReason)
+			out.StopReason = &reason
+		}
+	}
+
+	if resp.Usage != nil {
+		out.Usage = messagesUsage(resp.Usage)
+	}
+	return out
+}
+
+// StopReason maps an OpenAI finish_reason onto an Anthropic stop_reason.
+func StopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	}
+	return "end_turn"
+}
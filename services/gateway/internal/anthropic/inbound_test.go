@@ -0,0 +1,178 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestToChatRequest_SystemAndStringContent(t *testing.T) {
+	var req MessagesRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "claude-sonnet",
+		"max_tokens": 256,
+		"system": "You are terse.",
+		"messages": [{"role": "user", "content": "Hello"}],
+		"stop_sequences": ["END"]
+	}`), &req)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out, err := ToChatRequest(&req)
+	if err != nil {
+		t.Fatalf("ToChatRequest: %v", err)
+	}
+	if len(out.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(out.Messages))
+	}
+	if out.Messages[0].Role != "system" || out.Messages[0].Content != "You are terse." {
+		t.Errorf("unexpected system message: %+v", out.Messages[0])
+	}
+	if out.Messages[1].Role != "user" || out.Messages[1].Content != "Hello" {
+		t.Errorf("unexpected user message: %+v", out.Messages[1])
+	}
+	if out.MaxTokens == nil || *out.MaxTokens != 256 {
+		t.Errorf("MaxTokens = %v, want 256", out.MaxTokens)
+	}
+	if stop, ok := out.Stop.([]string); !ok || stop[0] != "END" {
+		t.Errorf("Stop = %v, want [END]", out.Stop)
+	}
+}
+
+func TestToChatRequest_ToolUseAndToolResult(t *testing.T) {
+	var req MessagesRequest
+	err := json.Unmarshal([]byte(`{
+		"model": "claude-sonnet",
+		"max_tokens": 256,
+		"tools": [{"name": "get_weather", "description": "Weather", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"},
+		"messages": [
+			{"role": "user", "content": [{"type": "text", "text": "Weather in Paris?"}]},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "18C"},
+				{"type": "text", "text": "Thanks"}
+			]}
+		]
+	}`), &req)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	out, err := ToChatRequest(&req)
+	if err != nil {
+		t.Fatalf("ToChatRequest: %v", err)
+	}
+	if len(out.Messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(out.Messages))
+	}
+
+	assistant := out.Messages[1]
+	if assistant.Content != "Checking." || len(assistant.ToolCalls) != 1 {
+		t.Fatalf("unexpected assistant message: %+v", assistant)
+	}
+	if tc := assistant.ToolCalls[0]; tc.ID != "toolu_1" || tc.Function.Name != "get_weather" || tc.Function.Arguments != `{"city": "Paris"}` {
+		t.Errorf("unexpected tool call: %+v", tc)
+	}
+
+	tool := out.Messages[2]
+	if tool.Role != "tool" || tool.ToolCallID != "toolu_1" || tool.Content != "18C" {
+		t.Errorf("unexpected tool message: %+v", tool)
+	}
+	if out.Messages[3].Role != "user" || out.Messages[3].Content != "Thanks" {
+		t.Errorf("unexpected trailing user message: %+v", out.Messages[3])
+	}
+
+	if len(out.Tools) != 1 || out.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("unexpected tools: %+v", out.Tools)
+	}
+	if out.ToolChoice != "required" {
+		t.Errorf("ToolChoice = %v, want required", out.ToolChoice)
+	}
+}
+
+func TestToChatRequest_ImageBlock(t *testing.T) {
+	req := &MessagesRequest{
+		MaxTokens: 10,
+		Messages: []Message{{Role: "user", Content: Content{
+			{Type: "text", Text: "What is this?"},
+			{Type: "image", Source: &ImageSource{Type: "base64", MediaType: "image/png", Data: "AAAA"}},
+		}}},
+	}
+
+	out, err := ToChatRequest(req)
+	if err != nil {
+		t.Fatalf("ToChatRequest: %v", err)
+	}
+	parts, ok := out.Messages[0].Content.([]interface{})
+	if !ok || len(parts) != 2 {
+		t.Fatalf("expected two content parts, got %#v", out.Messages[0].Content)
+	}
+	image := parts[1].(map[string]interface{})["image_url"].(map[string]interface{})
+	if image["url"] != "data:image/png;base64,AAAA" {
+		t.Errorf("unexpected image url: %v", image["url"])
+	}
+}
+
+func TestToChatRequest_RequiresMaxTokens(t *testing.T) {
+	_, err := ToChatRequest(&MessagesRequest{Messages: []Message{{Role: "user", Content: Content{{Type: "text", Text: "hi"}}}}})
+	if err == nil {
+		t.Error("expected error without max_tokens")
+	}
+}
+
+func TestFromChatResponse(t *testing.T) {
+	finish := "tool_calls"
+	resp := &model.ChatCompletionResponse{
+		ID:    "chatcmpl-1",
+		Model: "anthropic/claude-sonnet",
+		Choices: []model.Choice{{
+			Message: &model.Message{
+				Role:    "assistant",
+				Content: "Let me check.",
+				ToolCalls: []model.ToolCall{{
+					ID: "call_1", Type: "function",
+					Function: model.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+				}},
+			},
+			FinishReason: &finish,
+		}},
+		Usage: &model.Usage{PromptTokens: 20, CompletionTokens: 7},
+	}
+
+	out := FromChatResponse(resp)
+	if out.Type != "message" || out.Role != "assistant" {
+		t.Errorf("unexpected envelope: %+v", out)
+	}
+	if len(out.Content) != 2 || out.Content[0].Text != "Let me check." || out.Content[1].Type != "tool_use" {
+		t.Fatalf("unexpected content: %+v", out.Content)
+	}
+	if string(out.Content[1].Input) != `{"city":"Paris"}` {
+		t.Errorf("tool input = %s", out.Content[1].Input)
+	}
+	if out.StopReason == nil || *out.StopReason != "tool_use" {
+		t.Errorf("StopReason = %v, want tool_use", out.StopReason)
+	}
+	if out.Usage.InputTokens != 20 || out.Usage.OutputTokens != 7 {
+		t.Errorf("unexpected usage: %+v", out.Usage)
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           "end_turn",
+		"length":         "max_tokens",
+		"tool_calls":     "tool_use",
+		"content_filter": "refusal",
+	}
+	for in, want := range tests {
+		if got := StopReason(in); got != want {
+			t.Errorf("StopReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package anthropic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openfive/gateway/internal/chat"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// DefaultMaxTokens is sent when a chat request sets no max_tokens, which
+// the Messages API requires.
+const DefaultMaxTokens = 4096
+
+// FromChatRequest translates an OpenAI-compatible chat request into a
+// Messages API request. System and developer messages become the system
+// prompt and tool messages become tool_result blocks in a user turn.
+func FromChatRequest(req *model.ChatCompletionRequest) (*MessagesRequest, error) {
+	out := &MessagesRequest{
+		Model:       req.Model,
+		MaxTokens:   DefaultMaxTokens,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+	}
+	if req.MaxTokens != nil && *req.MaxTokens > 0 {
+		out.MaxTokens = *req.MaxTokens
+	}
+	out.StopSequences = chat.StopList(req.Stop)
+	if req.User != "" {
+		out.Metadata = &Metadata{UserID: req.User}
+	}
+
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			out.System = append(out.System, contentBlocks(m.Content, false)...)
+		case "user":
+			out.Messages = appendTurn(out.Messages, "user", contentBlocks(m.Content, true))
+		case "assistant":
+			blocks := contentBlocks(m.Content, false)
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, ContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: chat.JSONObject(tc.Function.Arguments),
+				})
+			}
+			out.Messages = appendTurn(out.Messages, "assistant", blocks)
+		case "tool":
+			out.Messages = appendTurn(out.Messages, "user", []ContentBlock{{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   contentBlocks(m.Content, false),
+			}})
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", m.Role)
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, fmt.Errorf("messages must include a user or assistant turn")
+	}
+
+	for _, t := range req.Tools {
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object"}
+		}
+		out.Tools = append(out.Tools, Tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	if req.ToolChoice != nil {
+		out.ToolChoice = fromChatToolChoice(req.ToolChoice)
+	}
+	return out, nil
+}
+
+// appendTurn adds blocks to the conversation, merging them into the last
+// message when it has the same role, as the Messages API expects user and
+// assistant turns to alternate.
+func appendTurn(msgs []Message, role string, blocks []ContentBlock) []Message {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Content = append(msgs[n-1].Content, blocks...)
+		return msgs
+	}
+	return append(msgs, Message{Role: role, Content: blocks})
+}
+
+// contentBlocks converts chat content, a string or a list of parts, into
+// text blocks, and image blocks when withImages is set. Inline images
+// become base64 sources, others URL sources.
+func contentBlocks(content interface{}, withImages bool) Content {
+	var out Content
+	for _, p := range chat.Parts(content, withImages) {
+		switch {
+		case p.Text != "":
+			out = append(out, ContentBlock{Type: "text", Text: p.Text})
+		case p.Data != "":
+			out = append(out, ContentBlock{Type: "image", Source: &ImageSource{Type: "base64", MediaType: p.MimeType, Data: p.Data}})
+		case p.URL != "":
+			out = append(out, ContentBlock{Type: "image", Source: &ImageSource{Type: "url", URL: p.URL}})
+		}
+	}
+	return out
+}
+
+// fromChatToolChoice is the inverse of toChatToolChoice.
+func fromChatToolChoice(choice interface{}) *ToolChoice {
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "required":
+			return &ToolChoice{Type: "any"}
+		case "none":
+			return &ToolChoice{Type: "none"}
+		}
+		return &ToolChoice{Type: "auto"}
+	case map[string]interface{}:
+		fn, _ := c["function"].(map[string]interface{})
+		if name, _ := fn["name"].(string); name != "" {
+			return &ToolChoice{Type: "tool", Name: name}
+		}
+	}
+	return &ToolChoice{Type: "auto"}
+}
+
+// ToChatResponse translates a Messages API response into a chat
+// completion.
+func ToChatResponse(resp *MessagesResponse) *model.ChatCompletionResponse {
+	msg := &model.Message{Role: "assistant"}
+	var text strings.Builder
+	for _, b := range resp.Content {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case "tool_use":
+			args := string(b.Input)
+			if args == "" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+				ID:       b.ID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: b.Name, Arguments: args},
+			})
+		}
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		msg.Content = text.String()
+	}
+
+	stopReason := ""
+	if resp.StopReason != nil {
+		stopReason = *resp.StopReason
+	}
+	finishReason := FinishReason(stopReason)
+	return &model.ChatCompletionResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []model.Choice{{Index: 0, Message: msg, FinishReason: &finishReason}},
+		Usage:   ChatUsage(resp.Usage),
+	}
+}
+
+// FinishReason maps an Anthropic stop_reason onto an OpenAI
+// finish_reason. It is the inverse of StopReason.
+func FinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens", "model_context_window_exceeded":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// ChatUsage converts Messages API usage. Anthropic counts cached prompt
+// tokens separately from input_tokens; OpenAI includes them in
+// prompt_tokens and breaks them down in prompt_tokens_details.
+func ChatUsage(u Usage) *model.Usage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	usage := &model.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens > 0 || u.CacheCreationInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:     u.CacheReadInputTokens,
+			CacheWriteTokens: u.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// messagesUsage is the inverse of ChatUsage.
+func messagesUsage(u *model.Usage) Usage {
+	out := Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+	if d := u.PromptTokensDetails; d != nil {
+		out.InputTokens -= d.CachedTokens + d.CacheWriteTokens
+		out.CacheReadInputTokens = d.CachedTokens
+		out.CacheCreationInputTokens = d.CacheWriteTokens
+	}
+	return out
+}
+
+// StreamEvent is the data of one Messages API server-sent event.
+type StreamEvent struct {
+	Type         string            `json:"type"`
+	Message      *MessagesResponse `json:"message,omitempty"`
+	Index        int               `json:"index"`
+	ContentBlock *ContentBlock     `json:"content_block,omitempty"`
+	Delta        *StreamDelta      `json:"delta,omitempty"`
+	Usage        *Usage            `json:"usage,omitempty"`
+	Error        *ErrorDetail      `json:"error,omitempty"`
+}
+
+// StreamDelta is the delta of a content_block_delta or message_delta
+// event.
+type StreamDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+	StopReason  string `json:"stop_reason,omitempty"`
+}
+
+// ChunkTranslator converts Messages API streaming events into chat
+// completion chunks. It is the inverse of StreamTranslator.
+type ChunkTranslator struct {
+	id      string
+	model   string
+	created int64
+	usage   Usage
+
+	toolIndex chat.ToolCallIndex
+}
+
+func NewChunkTranslator() *ChunkTranslator {
+	return &ChunkTranslator{created: time.Now().Unix(), toolIndex: make(chat.ToolCallIndex)}
+}
+
+// Translate returns the chunk for one event, or nil for events that carry
+// nothing to relay (pings, block stops, thinking deltas). An error event
+// is returned as an error.
+func (t *ChunkTranslator) Translate(ev *StreamEvent) (*model.ChatCompletionChunk, error) {
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			t.id = ev.Message.ID
+			t.model = ev.Message.Model
+			t.usage = ev.Message.Usage
+		}
+		return t.chunk(&model.Message{Role: "assistant", Content: ""}, nil), nil
+
+	case "content_block_start":
+		if ev.ContentBlock == nil || ev.ContentBlock.Type != "tool_use" {
+			return nil, nil
+		}
+		return t.chunk(t.toolIndex.Start(ev.Index, ev.ContentBlock.ID, ev.ContentBlock.Name), nil), nil
+
+	case "content_block_delta":
+		if ev.Delta == nil {
+			return nil, nil
+		}
+		switch ev.Delta.Type {
+		case "text_delta":
+			return t.chunk(&model.Message{Content: ev.Delta.Text}, nil), nil
+		case "input_json_delta":
+			delta := t.toolIndex.Arguments(ev.Index, ev.Delta.PartialJSON)
+			if delta == nil {
+				return nil, nil
+			}
+			return t.chunk(delta, nil), nil
+		}
+		return nil, nil
+
+	case "message_delta":
+		// message_delta usage is cumulative and may restate the input
+		// counts.
+		if u := ev.Usage; u != nil {
+			t.usage.OutputTokens = u.OutputTokens
+			if u.InputTokens > 0 {
+				t.usage.InputTokens = u.InputTokens
+			}
+			if u.CacheReadInputTokens > 0 {
+				t.usage.CacheReadInputTokens = u.CacheReadInputTokens
+			}
+			if u.CacheCreationInputTokens > 0 {
+				t.usage.CacheCreationInputTokens = u.CacheCreationInputTokens
+			}
+		}
+		stopReason := ""
+		if ev.Delta != nil {
+			stopReason = ev.Delta.StopReason
+		}
+		finishReason := FinishReason(stopReason)
+		chunk := t.chunk(&model.Message{}, &finishReason)
+		chunk.Usage = ChatUsage(t.usage)
+		return chunk, nil
+
+	case "error":
+		if ev.Error != nil {
+			return nil, fmt.Errorf("stream error %s: %s", ev.Error.Type, ev.Error.Message)
+		}
+		return nil, fmt.Errorf("stream error")
+	}
+	return nil, nil
+}
+
+func (t *ChunkTranslator) chunk(delta *model.Message, finishReason *string) *model.ChatCompletionChunk {
+	return &model.ChatCompletionChunk{
+		ID:      t.id,
+		Object:  "chat.completion.chunk",
+		Created: t.created,
+		Model:   t.model,
+		Choices: []model.Choice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
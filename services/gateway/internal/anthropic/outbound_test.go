@@ -0,0 +1,222 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestFromChatRequest_Conversation(t *testing.T) {
+	maxTokens := 256
+	req := &model.ChatCompletionRequest{
+		Model:     "claude-sonnet",
+		MaxTokens: &maxTokens,
+		Stop:      "END",
+		Messages: []model.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "What is this?"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,iVBOR"}},
+			}},
+			{Role: "assistant", Content: nil, ToolCalls: []model.ToolCall{
+				{ID: "toolu_1", Type: "function", Function: model.FunctionCall{Name: "lookup", Arguments: `{"q":"x"}`}},
+				{ID: "toolu_2", Type: "function", Function: model.FunctionCall{Name: "lookup", Arguments: `{"q":"y"}`}},
+			}},
+			{Role: "tool", ToolCallID: "toolu_1", Content: "first"},
+			{Role: "tool", ToolCallID: "toolu_2", Content: "second"},
+			{Role: "user", Content: "Thanks"},
+		},
+		Tools: []model.Tool{{Type: "function", Function: model.FunctionDef{Name: "lookup", Description: "Look up"}}},
+		ToolChoice: map[string]interface{}{
+			"type": "function", "function": map[string]interface{}{"name": "lookup"},
+		},
+	}
+
+	out, err := FromChatRequest(req)
+	if err != nil {
+		t.Fatalf("FromChatRequest: %v", err)
+	}
+	if out.MaxTokens != 256 {
+		t.Errorf("max_tokens = %d, want 256", out.MaxTokens)
+	}
+	if len(out.StopSequences) != 1 || out.StopSequences[0] != "END" {
+		t.Errorf("stop_sequences = %v, want [END]", out.StopSequences)
+	}
+	if textOf(out.System) != "Be brief." {
+		t.Errorf("system = %q, want the system message", textOf(out.System))
+	}
+
+	// The tool results and the following user text merge into one turn.
+	if len(out.Messages) != 3 {
+		t.Fatalf("got %d messages, want 3: %+v", len(out.Messages), out.Messages)
+	}
+	user := out.Messages[0].Content
+	if len(user) != 2 || user[1].Type != "image" || user[1].Source.MediaType != "image/png" || user[1].Source.Data != "iVBOR" {
+		t.Errorf("user content = %+v, want text and a base64 image", user)
+	}
+	assistant := out.Messages[1].Content
+	if len(assistant) != 2 || assistant[0].Type != "tool_use" || string(assistant[0].Input) != `{"q":"x"}` {
+		t.Errorf("assistant content = %+v, want two tool_use blocks", assistant)
+	}
+	results := out.Messages[2]
+	if results.Role != "user" || len(results.Content) != 3 {
+		t.Fatalf("last message = %+v, want a user turn with two results and text", results)
+	}
+	if results.Content[1].ToolUseID != "toolu_2" || textOf(results.Content[1].Content) != "second" {
+		t.Errorf("second tool result = %+v", results.Content[1])
+	}
+
+	if len(out.Tools) != 1 || out.Tools[0].InputSchema == nil {
+		t.Errorf("tools = %+v, want lookup with a default schema", out.Tools)
+	}
+	if out.ToolChoice == nil || out.ToolChoice.Type != "tool" || out.ToolChoice.Name != "lookup" {
+		t.Errorf("tool_choice = %+v, want tool lookup", out.ToolChoice)
+	}
+}
+
+func TestFromChatRequest_Defaults(t *testing.T) {
+	out, err := FromChatRequest(&model.ChatCompletionRequest{
+		Messages:   []model.Message{{Role: "user", Content: "Hi"}},
+		ToolChoice: "required",
+	})
+	if err != nil {
+		t.Fatalf("FromChatRequest: %v", err)
+	}
+	if out.MaxTokens != DefaultMaxTokens {
+		t.Errorf("max_tokens = %d, want %d", out.MaxTokens, DefaultMaxTokens)
+	}
+	if out.ToolChoice.Type != "any" {
+		t.Errorf("tool_choice = %q, want any", out.ToolChoice.Type)
+	}
+
+	if _, err := FromChatRequest(&model.ChatCompletionRequest{
+		Messages: []model.Message{{Role: "system", Content: "Only a system prompt"}},
+	}); err == nil {
+		t.Error("expected an error for a request without user or assistant turns")
+	}
+}
+
+func TestToChatResponse(t *testing.T) {
+	var resp MessagesResponse
+	body := `{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude-sonnet",
+		"content": [
+			{"type": "text", "text": "Let me check."},
+			{"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"q": "x"}}
+		],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "output_tokens": 7, "cache_read_input_tokens": 100, "cache_creation_input_tokens": 20}
+	}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	out := ToChatResponse(&resp)
+	choice := out.Choices[0]
+	if *choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", *choice.FinishReason)
+	}
+	if choice.Message.Content != "Let me check." {
+		t.Errorf("content = %v", choice.Message.Content)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"q": "x"}` {
+		t.Errorf("tool_calls = %+v", choice.Message.ToolCalls)
+	}
+
+	u := out.Usage
+	if u.PromptTokens != 130 || u.CompletionTokens != 7 || u.TotalTokens != 137 {
+		t.Errorf("usage = %+v, want 130 prompt tokens including the cache", u)
+	}
+	if u.PromptTokensDetails == nil || u.PromptTokensDetails.CachedTokens != 100 || u.PromptTokensDetails.CacheWriteTokens != 20 {
+		t.Errorf("prompt_tokens_details = %+v, want 100 read and 20 written", u.PromptTokensDetails)
+	}
+
+	// The Messages endpoint reports the same split back.
+	if back := messagesUsage(u); back != resp.Usage {
+		t.Errorf("messagesUsage = %+v, want %+v", back, resp.Usage)
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	cases := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"max_tokens":    "length",
+		"tool_use":      "tool_calls",
+		"refusal":       "content_filter",
+		"":              "stop",
+	}
+	for in, want := range cases {
+		if got := FinishReason(in); got != want {
+			t.Errorf("FinishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestChunkTranslator(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet","usage":{"input_tokens":12,"cache_read_input_tokens":40,"output_tokens":1}}}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"x\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+	}
+
+	tr := NewChunkTranslator()
+	var chunks []*model.ChatCompletionChunk
+	for _, data := range events {
+		var ev StreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := tr.Translate(&ev)
+		if err != nil {
+			t.Fatalf("Translate(%s): %v", data, err)
+		}
+		if chunk != nil {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	if len(chunks) != 6 {
+		t.Fatalf("got %d chunks, want 6", len(chunks))
+	}
+	if chunks[0].ID != "msg_1" || chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Errorf("first chunk = %+v, want the assistant role", chunks[0])
+	}
+	if chunks[1].Choices[0].Delta.Content != "Checking" {
+		t.Errorf("text chunk = %+v", chunks[1].Choices[0].Delta)
+	}
+
+	var args string
+	for _, c := range chunks[2:5] {
+		tc := c.Choices[0].Delta.ToolCalls[0]
+		if tc.Index == nil || *tc.Index != 0 {
+			t.Errorf("tool call index = %v, want 0", tc.Index)
+		}
+		args += tc.Function.Arguments
+	}
+	if args != `{"q":"x"}` {
+		t.Errorf("arguments = %q", args)
+	}
+
+	last := chunks[5]
+	if *last.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", *last.Choices[0].FinishReason)
+	}
+	if last.Usage == nil || last.Usage.PromptTokens != 52 || last.Usage.CompletionTokens != 9 || last.Usage.PromptTokensDetails.CachedTokens != 40 {
+		t.Errorf("usage = %+v, want 52 prompt (40 cached) and 9 completion tokens", last.Usage)
+	}
+
+	var ev StreamEvent
+	json.Unmarshal([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`), &ev)
+	if _, err := tr.Translate(&ev); err == nil {
+		t.Error("expected an error for an error event")
+	}
+}
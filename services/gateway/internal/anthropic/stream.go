@@ -0,0 +1,161 @@
+package anthropic
+
+import (
+	"fmt"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// StreamTranslator converts chat completion chunks into Messages API
+// streaming events: message_start, content_block_start/delta/stop for
+// each text or tool_use block, message_delta and message_stop.
+type StreamTranslator struct {
+	id          string
+	model       string
+	inputTokens int
+
+	started    bool
+	blockOpen  bool
+	blockKey   string
+	blockIndex int
+	nextIndex  int
+
+	stopReason string
+	usage      *model.Usage
+}
+
+// NewStreamTranslator creates a translator for one message. inputTokens is
+// reported in message_start until the provider's usage arrives.
+func NewStreamTranslator(id, modelName string, inputTokens int) *StreamTranslator {
+	return &StreamTranslator{id: id, model: modelName, inputTokens: inputTokens}
+}
+
+// Translate returns the events for one chunk. Only the first choice is
+// relayed, as the Messages API has no notion of n > 1.
+func (t *StreamTranslator) Translate(chunk *model.ChatCompletionChunk) []Event {
+	events := t.start()
+	if chunk.Usage != nil {
+		usage := *chunk.Usage
+		t.usage = &usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if d := choice.Delta; d != nil {
+			if text, ok := d.Content.(string); ok && text != "" {
+				events = append(events, t.open("text", map[string]interface{}{"type": "text", "text": ""})...)
+				events = append(events, t.delta(map[string]interface{}{"type": "text_delta", "text": text}))
+			}
+			for i, tc := range d.ToolCalls {
+				idx := i
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				id := tc.ID
+				if id == "" {
+					id = fmt.Sprintf("toolu_%s_%d", t.id, idx)
+				}
+				events = append(events, t.open(fmt.Sprintf("tool:%d", idx), map[string]interface{}{
+					"type":  "tool_use",
+					"id":    id,
+					"name":  tc.Function.Name,
+					"input": map[string]interface{}{},
+				})...)
+				if tc.Function.Arguments != "" {
+					events = append(events, t.delta(map[string]interface{}{
+						"type":         "input_json_delta",
+						"partial_json": tc.Function.Arguments,
+					}))
+				}
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.stopReason = StopReason(*choice.FinishReason)
+		}
+	}
+	return events
+}
+
+// Finish closes any open block and returns the closing message events.
+func (t *StreamTranslator) Finish() []Event {
+	events := t.start()
+	events = append(events, t.closeBlock()...)
+
+	stopReason := t.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	usage := Usage{InputTokens: t.inputTokens}
+	if t.usage != nil {
+		usage = messagesUsage(t.usage)
+	}
+
+	events = append(events,
+		Event{Type: "message_delta", Data: map[string]interface{}{
+			"type":  "message_delta",
+			"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+			"usage": usage,
+		}},
+		Event{Type: "message_stop", Data: map[string]interface{}{"type": "message_stop"}},
+	)
+	return events
+}
+
+func (t *StreamTranslator) start() []Event {
+	if t.started {
+		return nil
+	}
+	t.started = true
+	return []Event{
+		{Type: "message_start", Data: map[string]interface{}{
+			"type": "message_start",
+			"message": MessagesResponse{
+				ID:      t.id,
+				Type:    "message",
+				Role:    "assistant",
+				Model:   t.model,
+				Content: []ContentBlock{},
+				Usage:   Usage{InputTokens: t.inputTokens},
+			},
+		}},
+		{Type: "ping", Data: map[string]interface{}{"type": "ping"}},
+	}
+}
+
+// open starts a new content block unless key is already the open block.
+func (t *StreamTranslator) open(key string, block map[string]interface{}) []Event {
+	if t.blockOpen && t.blockKey == key {
+		return nil
+	}
+	events := t.closeBlock()
+	t.blockOpen = true
+	t.blockKey = key
+	t.blockIndex = t.nextIndex
+	t.nextIndex++
+	return append(events, Event{Type: "content_block_start", Data: map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         t.blockIndex,
+		"content_block": block,
+	}})
+}
+
+func (t *StreamTranslator) delta(delta map[string]interface{}) Event {
+	return Event{Type: "content_block_delta", Data: map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": t.blockIndex,
+		"delta": delta,
+	}}
+}
+
+func (t *StreamTranslator) closeBlock() []Event {
+	if !t.blockOpen {
+		return nil
+	}
+	t.blockOpen = false
+	return []Event{{Type: "content_block_stop", Data: map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": t.blockIndex,
+	}}}
+}
@@ -0,0 +1,82 @@
+package anthropic
+
+import (
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func eventTypes(events []Event) []string {
+	types := make([]string, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	return types
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamTranslator_TextThenToolUse(t *testing.T) {
+	tr := NewStreamTranslator("msg_1", "claude-sonnet", 12)
+	idx := 0
+	finish := "tool_calls"
+
+	var events []Event
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Role: "assistant", Content: "Checking"}},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{ToolCalls: []model.ToolCall{{Index: &idx, ID: "call_1", Function: model.FunctionCall{Name: "get_weather"}}}}},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{ToolCalls: []model.ToolCall{{Index: &idx, Function: model.FunctionCall{Arguments: `{"city":"Paris"}`}}}}, FinishReason: &finish},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Usage: &model.Usage{PromptTokens: 15, CompletionTokens: 9}})...)
+	events = append(events, tr.Finish()...)
+
+	want := []string{
+		"message_start", "ping",
+		"content_block_start", "content_block_delta",
+		"content_block_stop", "content_block_start",
+		"content_block_delta",
+		"content_block_stop", "message_delta", "message_stop",
+	}
+	if got := eventTypes(events); !equal(got, want) {
+		t.Fatalf("event sequence:\n got  %v\n want %v", got, want)
+	}
+
+	toolStart := events[5].Data.(map[string]interface{})
+	if toolStart["index"] != 1 {
+		t.Errorf("tool block index = %v, want 1", toolStart["index"])
+	}
+	block := toolStart["content_block"].(map[string]interface{})
+	if block["type"] != "tool_use" || block["id"] != "call_1" || block["name"] != "get_weather" {
+		t.Errorf("unexpected tool block: %v", block)
+	}
+
+	msgDelta := events[8].Data.(map[string]interface{})
+	if msgDelta["delta"].(map[string]interface{})["stop_reason"] != "tool_use" {
+		t.Errorf("unexpected message_delta: %v", msgDelta)
+	}
+	if usage := msgDelta["usage"].(Usage); usage.InputTokens != 15 || usage.OutputTokens != 9 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestStreamTranslator_EmptyStream(t *testing.T) {
+	tr := NewStreamTranslator("msg_1", "claude-sonnet", 5)
+	want := []string{"message_start", "ping", "message_delta", "message_stop"}
+	if got := eventTypes(tr.Finish()); !equal(got, want) {
+		t.Errorf("event sequence: got %v, want %v", got, want)
+	}
+}
@@ -24,8 +24,31 @@ func NewAuthenticator(lookup KeyLookup) *Authenticator {
 	return &Authenticator{lookup: lookup}
 }
 
-// Authenticate extracts and validates the API key from the Authorization header.
+// Authenticate extracts and validates the API key from the Authorization
+// header. Without one, a verified client certificate carried by ctx is
+// mapped to its API key instead.
 func (a *Authenticator) Authenticate(ctx context.Context, authHeader string) (*model.APIKey, error) {
+	var (
+		key *model.APIKey
+		err error
+	)
+	if cert, ok := ClientCertFromContext(ctx); ok && authHeader == "" {
+		key, err = a.authenticateCert(ctx, cert)
+	} else {
+		key, err = a.authenticateBearer(ctx, authHeader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.IsActive {
+		return nil, fmt.Errorf("API key is revoked")
+	}
+
+	return key, nil
+}
+
+func (a *Authenticator) authenticateBearer(ctx context.Context, authHeader string) (*model.APIKey, error) {
 	if authHeader == "" {
 		return nil, fmt.Errorf("missing Authorization header")
 	}
@@ -46,10 +69,6 @@ func (a *Authenticator) Authenticate(ctx context.Context, authHeader string) (*m
 		}
 	}
 
-	if !key.IsActive {
-		return nil, fmt.Errorf("API key is revoked")
-	}
-
 	return key, nil
 }
 
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// CertLookup is implemented by key lookups that can map the identity of a
+// TLS client certificate to an API key, and through it to an environment.
+type CertLookup interface {
+	FindByCertIdentity(ctx context.Context, identity string) (*model.APIKey, error)
+}
+
+type clientCertKey struct{}
+
+// ContextWithClientCert returns ctx carrying the verified client
+// certificate of the connection a request arrived on.
+func ContextWithClientCert(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, cert)
+}
+
+// ClientCertFromContext returns the verified client certificate stored by
+// ContextWithClientCert.
+func ClientCertFromContext(ctx context.Context) (*x509.Certificate, bool) {
+	cert, ok := ctx.Value(clientCertKey{}).(*x509.Certificate)
+	return cert, ok && cert != nil
+}
+
+// CertIdentities returns the identities a certificate can be mapped by, most
+// specific first: URI SANs (such as SPIFFE IDs), DNS SANs, email SANs and
+// the subject common name as "CN=<name>".
+func CertIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, "CN="+cert.Subject.CommonName)
+	}
+	return ids
+}
+
+// authenticateCert maps a verified client certificate to the API key of
+// its first identity that has one.
+func (a *Authenticator) authenticateCert(ctx context.Context, cert *x509.Certificate) (*model.APIKey, error) {
+	lookup, ok := a.lookup.(CertLookup)
+	if !ok {
+		return nil, fmt.Errorf("client certificate authentication is not supported")
+	}
+	for _, id := range CertIdentities(cert) {
+		if key, err := lookup.FindByCertIdentity(ctx, id); err == nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("client certificate is not mapped to an API key")
+}
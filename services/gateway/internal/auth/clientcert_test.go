@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+type certLookup struct {
+	byHash map[string]*model.APIKey
+	byCert map[string]*model.APIKey
+}
+
+var errNotFound = errors.New("not found")
+
+func (l certLookup) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	if k, ok := l.byHash[hash]; ok {
+		return k, nil
+	}
+	return nil, errNotFound
+}
+
+func (l certLookup) FindByPreviousHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return nil, errNotFound
+}
+
+func (l certLookup) FindByCertIdentity(ctx context.Context, identity string) (*model.APIKey, error) {
+	if k, ok := l.byCert[identity]; ok {
+		return k, nil
+	}
+	return nil, errNotFound
+}
+
+func testCert() *x509.Certificate {
+	spiffe, _ := url.Parse("spiffe://corp/agents/billing")
+	return &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing-agent"},
+		URIs:     []*url.URL{spiffe},
+		DNSNames: []string{"billing.internal"},
+	}
+}
+
+func TestCertIdentities(t *testing.T) {
+	want := []string{"spiffe://corp/agents/billing", "billing.internal", "CN=billing-agent"}
+	if got := CertIdentities(testCert()); !reflect.DeepEqual(got, want) {
+		t.Errorf("CertIdentities() = %v, want %v", got, want)
+	}
+}
+
+func TestAuthenticate_ClientCert(t *testing.T) {
+	certKey := &model.APIKey{ID: "cert-key", EnvironmentID: "prod", IsActive: true}
+	bearerKey := &model.APIKey{ID: "bearer-key", EnvironmentID: "dev", IsActive: true}
+	a := NewAuthenticator(certLookup{
+		byHash: map[string]*model.APIKey{HashKey("sk-dev"): bearerKey},
+		byCert: map[string]*model.APIKey{"CN=billing-agent": certKey},
+	})
+	ctx := ContextWithClientCert(context.Background(), testCert())
+
+	key, err := a.Authenticate(ctx, "")
+	if err != nil || key.ID != "cert-key" {
+		t.Errorf("Authenticate with cert = %v, %v; want cert-key", key, err)
+	}
+
+	// A bearer key takes precedence over the certificate.
+	key, err = a.Authenticate(ctx, "Bearer sk-dev")
+	if err != nil || key.ID != "bearer-key" {
+		t.Errorf("Authenticate with cert and bearer = %v, %v; want bearer-key", key, err)
+	}
+
+	if _, err := a.Authenticate(context.Background(), ""); err == nil {
+		t.Error("Authenticate without cert or header succeeded")
+	}
+
+	unmapped := ContextWithClientCert(context.Background(), &x509.Certificate{Subject: pkix.Name{CommonName: "other"}})
+	if _, err := a.Authenticate(unmapped, ""); err == nil {
+		t.Error("Authenticate with an unmapped cert succeeded")
+	}
+}
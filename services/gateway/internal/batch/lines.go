@@ -0,0 +1,152 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// Line is one request of a batch input file.
+type Line struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// OutputLine is one line of a batch output or error file. Lines that ran
+// carry the response; lines that never ran carry an error.
+type OutputLine struct {
+	ID       string        `json:"id"`
+	CustomID string        `json:"custom_id"`
+	Response *LineResponse `json:"response"`
+	Error    *LineError    `json:"error"`
+}
+
+type LineResponse struct {
+	StatusCode int         `json:"status_code"`
+	RequestID  string      `json:"request_id"`
+	Body       interface{} `json:"body"`
+}
+
+type LineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ParseLines parses and validates a JSONL input file. Every line must be a
+// POST to endpoint with a unique custom_id and a JSON object body. All
+// invalid lines are reported, numbered from 1.
+func ParseLines(content []byte, endpoint string) ([]Line, []model.BatchError) {
+	var lines []Line
+	var errs []model.BatchError
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxFileBytes)
+	n := 0
+	for scanner.Scan() {
+		n++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		fail := func(code, format string, args ...interface{}) {
+			lineNo := n
+			errs = append(errs, model.BatchError{Code: code, Message: fmt.Sprintf(format, args...), Line: &lineNo})
+		}
+
+		var line Line
+		if err := json.Unmarshal(raw, &line); err != nil {
+			fail("invalid_json_line", "line is not valid JSON: %v", err)
+			continue
+		}
+		switch {
+		case line.CustomID == "":
+			fail("missing_required_parameter", "custom_id is required")
+		case seen[line.CustomID]:
+			fail("duplicate_custom_id", "custom_id %q is used more than once", line.CustomID)
+		case line.Method != http.MethodPost:
+			fail("invalid_method", "method must be POST")
+		case line.URL != endpoint:
+			fail("mismatched_endpoint", "url %q does not match the batch endpoint %q", line.URL, endpoint)
+		case !bytes.HasPrefix(bytes.TrimSpace(line.Body), []byte("{")):
+			fail("invalid_body", "body must be a JSON object")
+		default:
+			seen[line.CustomID] = true
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, model.BatchError{Code: "invalid_file", Message: err.Error()})
+	}
+
+	if len(errs) == 0 {
+		switch {
+		case len(lines) == 0:
+			errs = append(errs, model.BatchError{Code: "empty_file", Message: "the input file has no requests"})
+		case len(lines) > maxLines:
+			errs = append(errs, model.BatchError{Code: "too_many_requests", Message: fmt.Sprintf("a batch may hold at most %d requests", maxLines)})
+		}
+	}
+	return lines, errs
+}
+
+// newOutputLine records a line's response. Lines rejected before a request
+// ID was assigned are identified by their custom_id.
+func newOutputLine(customID string, res Result) *OutputLine {
+	id := res.RequestID
+	if id == "" {
+		id = customID
+	}
+	return &OutputLine{
+		ID:       "batch_req_" + id,
+		CustomID: customID,
+		Response: &LineResponse{
+			StatusCode: res.StatusCode,
+			RequestID:  res.RequestID,
+			Body:       res.Body,
+		},
+	}
+}
+
+func newErrorLine(customID string, e *LineError) *OutputLine {
+	return &OutputLine{ID: "batch_req_" + customID, CustomID: customID, Error: e}
+}
+
+func (o *OutputLine) succeeded() bool {
+	return o.Error == nil && o.Response != nil && o.Response.StatusCode < 300
+}
+
+func encodeLines(lines []*OutputLine) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeLines parses an output or error file written by encodeLines.
+func decodeLines(content []byte) ([]*OutputLine, error) {
+	var lines []*OutputLine
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxFileBytes)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line OutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, &line)
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,62 @@
+package batch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLines_Valid(t *testing.T) {
+	content := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`,
+		``,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[]}}`,
+	}, "\n")
+
+	lines, errs := ParseLines([]byte(content), "/v1/chat/completions")
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if len(lines) != 2 || lines[0].CustomID != "a" || lines[1].CustomID != "b" {
+		t.Errorf("lines = %+v", lines)
+	}
+}
+
+func TestParseLines_ReportsEveryInvalidLine(t *testing.T) {
+	content := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`not json`,
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"c","method":"GET","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"d","method":"POST","url":"/v1/embeddings","body":{}}`,
+		`{"method":"POST","url":"/v1/chat/completions","body":{}}`,
+		`{"custom_id":"f","method":"POST","url":"/v1/chat/completions","body":"x"}`,
+	}, "\n")
+
+	_, errs := ParseLines([]byte(content), "/v1/chat/completions")
+	want := []struct {
+		code string
+		line int
+	}{
+		{"invalid_json_line", 2},
+		{"duplicate_custom_id", 3},
+		{"invalid_method", 4},
+		{"mismatched_endpoint", 5},
+		{"missing_required_parameter", 6},
+		{"invalid_body", 7},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors, want %d: %+v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		if errs[i].Code != w.code || errs[i].Line == nil || *errs[i].Line != w.line {
+			t.Errorf("error %d = %s on line %v, want %s on line %d", i, errs[i].Code, errs[i].Line, w.code, w.line)
+		}
+	}
+}
+
+func TestParseLines_EmptyFile(t *testing.T) {
+	_, errs := ParseLines([]byte("\n\n"), "/v1/embeddings")
+	if len(errs) != 1 || errs[0].Code != "empty_file" {
+		t.Errorf("errs = %+v, want empty_file", errs)
+	}
+}
@@ -0,0 +1,167 @@
+package batch
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// MemoryStore keeps files and batches in memory, for running without a
+// database. Its contents are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	files   map[string]*model.BatchFile
+	batches map[string]*model.Batch
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		files:   make(map[string]*model.BatchFile),
+		batches: make(map[string]*model.Batch),
+	}
+}
+
+func (m *MemoryStore) InsertBatchFile(_ context.Context, f *model.BatchFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f.ID = newUUID()
+	f.CreatedAt = time.Now()
+	stored := *f
+	m.files[f.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) LoadBatchFile(_ context.Context, envID, fileID string, withContent bool) (*model.BatchFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok || f.EnvironmentID != envID {
+		return nil, fmt.Errorf("batch file %q not found", fileID)
+	}
+	out := *f
+	if !withContent {
+		out.Content = nil
+	}
+	return &out, nil
+}
+
+func (m *MemoryStore) InsertBatch(_ context.Context, b *model.Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b.ID = newUUID()
+	b.CreatedAt = time.Now()
+	stored := *b
+	m.batches[b.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) LoadBatch(_ context.Context, envID, batchID string) (*model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[batchID]
+	if !ok || b.EnvironmentID != envID {
+		return nil, fmt.Errorf("batch %q not found", batchID)
+	}
+	out := *b
+	return &out, nil
+}
+
+// ListBatches returns an environment's batches, newest first, created
+// before the batch named by after.
+func (m *MemoryStore) ListBatches(_ context.Context, envID, after string, limit int) ([]model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var cursor time.Time
+	if after != "" {
+		if b, ok := m.batches[after]; ok {
+			cursor = b.CreatedAt
+		}
+	}
+	var out []model.Batch
+	for _, b := range m.batches {
+		if b.EnvironmentID != envID || (!cursor.IsZero() && !b.CreatedAt.Before(cursor)) {
+			continue
+		}
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) UpdateBatch(_ context.Context, b *model.Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.batches[b.ID]
+	if !ok {
+		return fmt.Errorf("batch %q not found", b.ID)
+	}
+	// Only the columns UpdateBatch writes in Postgres are taken over.
+	stored.Status = b.Status
+	stored.TotalRequests, stored.CompletedRequests, stored.FailedRequests = b.TotalRequests, b.CompletedRequests, b.FailedRequests
+	stored.OutputFileID, stored.ErrorFileID = b.OutputFileID, b.ErrorFileID
+	stored.Errors = b.Errors
+	stored.InProgressAt, stored.FinalizingAt, stored.CompletedAt = b.InProgressAt, b.FinalizingAt, b.CompletedAt
+	stored.FailedAt, stored.ExpiredAt = b.FailedAt, b.ExpiredAt
+	stored.CancellingAt, stored.CancelledAt = b.CancellingAt, b.CancelledAt
+	stored.LeaseExpiresAt = b.LeaseExpiresAt
+	return nil
+}
+
+func (m *MemoryStore) UpdateBatchProgress(_ context.Context, batchID string, completed, failed int, leaseUntil time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[batchID]
+	if !ok {
+		return "", fmt.Errorf("batch %q not found", batchID)
+	}
+	b.CompletedRequests, b.FailedRequests = completed, failed
+	b.LeaseExpiresAt = &leaseUntil
+	return b.Status, nil
+}
+
+// ClaimBatches takes a lease on the unfinished batches no runner holds,
+// oldest first.
+func (m *MemoryStore) ClaimBatches(_ context.Context, leaseUntil time.Time) ([]model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var out []model.Batch
+	for _, b := range m.batches {
+		if !unfinished(b.Status) || (b.LeaseExpiresAt != nil && !b.LeaseExpiresAt.Before(now)) {
+			continue
+		}
+		lease := leaseUntil
+		b.LeaseExpiresAt = &lease
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *MemoryStore) CancelBatch(ctx context.Context, envID, batchID string) (*model.Batch, error) {
+	m.mu.Lock()
+	if b, ok := m.batches[batchID]; ok && b.EnvironmentID == envID &&
+		(b.Status == StatusValidating || b.Status == StatusInProgress) {
+		now := time.Now()
+		b.Status = StatusCancelling
+		b.CancellingAt = &now
+	}
+	m.mu.Unlock()
+	return m.LoadBatch(ctx, envID, batchID)
+}
+
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
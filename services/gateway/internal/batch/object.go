@@ -0,0 +1,128 @@
+package batch
+
+import (
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// Object is the OpenAI batch object.
+type Object struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *ErrorList        `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     *string           `json:"output_file_id"`
+	ErrorFileID      *string           `json:"error_file_id"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     *int64            `json:"in_progress_at"`
+	ExpiresAt        *int64            `json:"expires_at"`
+	FinalizingAt     *int64            `json:"finalizing_at"`
+	CompletedAt      *int64            `json:"completed_at"`
+	FailedAt         *int64            `json:"failed_at"`
+	ExpiredAt        *int64            `json:"expired_at"`
+	CancellingAt     *int64            `json:"cancelling_at"`
+	CancelledAt      *int64            `json:"cancelled_at"`
+	RequestCounts    RequestCounts     `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+type ErrorList struct {
+	Object string             `json:"object"`
+	Data   []model.BatchError `json:"data"`
+}
+
+type RequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// List is a page of batch objects.
+type List struct {
+	Object  string   `json:"object"`
+	Data    []Object `json:"data"`
+	FirstID *string  `json:"first_id"`
+	LastID  *string  `json:"last_id"`
+	HasMore bool     `json:"has_more"`
+}
+
+// FileObject is the OpenAI file object.
+type FileObject struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+// NewObject renders a batch in the OpenAI format.
+func NewObject(b *model.Batch) Object {
+	obj := Object{
+		ID:               b.ID,
+		Object:           "batch",
+		Endpoint:         b.Endpoint,
+		InputFileID:      b.InputFileID,
+		CompletionWindow: b.CompletionWindow,
+		Status:           b.Status,
+		OutputFileID:     b.OutputFileID,
+		ErrorFileID:      b.ErrorFileID,
+		CreatedAt:        b.CreatedAt.Unix(),
+		InProgressAt:     unix(b.InProgressAt),
+		ExpiresAt:        unix(&b.ExpiresAt),
+		FinalizingAt:     unix(b.FinalizingAt),
+		CompletedAt:      unix(b.CompletedAt),
+		FailedAt:         unix(b.FailedAt),
+		ExpiredAt:        unix(b.ExpiredAt),
+		CancellingAt:     unix(b.CancellingAt),
+		CancelledAt:      unix(b.CancelledAt),
+		RequestCounts: RequestCounts{
+			Total:     b.TotalRequests,
+			Completed: b.CompletedRequests,
+			Failed:    b.FailedRequests,
+		},
+		Metadata: b.Metadata,
+	}
+	if len(b.Errors) > 0 {
+		obj.Errors = &ErrorList{Object: "list", Data: b.Errors}
+	}
+	return obj
+}
+
+// NewList renders a page of batches. hasMore reports whether more batches
+// follow the page.
+func NewList(batches []model.Batch, hasMore bool) List {
+	list := List{Object: "list", Data: make([]Object, len(batches)), HasMore: hasMore}
+	for i := range batches {
+		list.Data[i] = NewObject(&batches[i])
+	}
+	if n := len(batches); n > 0 {
+		list.FirstID = &batches[0].ID
+		list.LastID = &batches[n-1].ID
+	}
+	return list
+}
+
+// NewFileObject renders a file in the OpenAI format.
+func NewFileObject(f *model.BatchFile) FileObject {
+	return FileObject{
+		ID:        f.ID,
+		Object:    "file",
+		Bytes:     f.Bytes,
+		CreatedAt: f.CreatedAt.Unix(),
+		Filename:  f.Filename,
+		Purpose:   f.Purpose,
+	}
+}
+
+func unix(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	ts := t.Unix()
+	return &ts
+}
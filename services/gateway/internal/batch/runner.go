@@ -0,0 +1,435 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+const (
+	// progressInterval is how often a running batch saves its counts and
+	// checks whether it was cancelled elsewhere.
+	progressInterval = 2 * time.Second
+	// maxRetryDelay caps the backoff for rate-limited lines.
+	maxRetryDelay = 30 * time.Second
+	// storeTimeout bounds the store reads that load a batch and the writes
+	// that record its outcome.
+	storeTimeout = 30 * time.Second
+	// leaseDuration is how long a gateway holds a batch after claiming it
+	// or saving its progress. Another gateway may resume the batch once
+	// the lease lapses.
+	leaseDuration = 2 * time.Minute
+)
+
+var (
+	errCancelled = errors.New("batch cancelled")
+	errShutdown  = errors.New("gateway shutting down")
+)
+
+// start runs a batch in the background. It returns false, without
+// running it, once the service is closing.
+func (s *Service) start(b *model.Batch, key *model.APIKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return false
+	}
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	s.running[b.ID] = cancel
+	if b.Status == StatusCancelling {
+		cancel(errCancelled)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, b.ID)
+			s.mu.Unlock()
+			cancel(nil)
+		}()
+		s.run(ctx, b, key)
+	}()
+	return true
+}
+
+// run validates the input file, executes the lines that have no result
+// yet and writes the output and error files. ctx is cancelled when the
+// batch is cancelled or the gateway shuts down; the batch's expiry is
+// applied here. A batch stopped by the shutdown is left in progress.
+func (s *Service) run(ctx context.Context, b *model.Batch, key *model.APIKey) {
+	ctx, cancel := context.WithDeadline(ctx, b.ExpiresAt)
+	defer cancel()
+
+	lines, results, lineErrs, err := s.load(b)
+	if s.ctx.Err() != nil {
+		s.release(b)
+		return
+	}
+	if err != nil {
+		lineErrs = []model.BatchError{{Code: "file_unreadable", Message: err.Error()}}
+	}
+	if len(lineErrs) > 0 {
+		now := time.Now()
+		b.Status = StatusFailed
+		b.FailedAt = &now
+		b.Errors = lineErrs
+		b.LeaseExpiresAt = nil
+		s.save(b)
+		return
+	}
+
+	now := time.Now()
+	if b.Status != StatusCancelling {
+		b.Status = StatusInProgress
+	}
+	if b.InProgressAt == nil {
+		b.InProgressAt = &now
+	}
+	b.TotalRequests = len(lines)
+	b.LeaseExpiresAt = leaseFromNow()
+	s.save(b)
+
+	s.execute(ctx, b, key, lines, results)
+
+	// A batch that stopped early only ends cancelled, expired or failed
+	// if some of its lines never ran.
+	var cause error
+	for _, out := range results {
+		if out == nil {
+			cause = context.Cause(ctx)
+			break
+		}
+	}
+	if errors.Is(cause, errShutdown) {
+		s.interrupt(b, results)
+		return
+	}
+
+	now = time.Now()
+	b.Status = StatusFinalizing
+	b.FinalizingAt = &now
+	s.save(b)
+	s.finalize(b, lines, results, cause)
+}
+
+// load reads and validates the batch's input file, and returns the
+// results an earlier run recorded, indexed like the lines; lines without
+// one are nil.
+func (s *Service) load(b *model.Batch) ([]Line, []*OutputLine, []model.BatchError, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, storeTimeout)
+	defer cancel()
+
+	f, err := s.store.LoadBatchFile(ctx, b.EnvironmentID, b.InputFileID, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lines, lineErrs := ParseLines(f.Content, b.Endpoint)
+	if len(lineErrs) > 0 {
+		return nil, nil, lineErrs, nil
+	}
+
+	results := make([]*OutputLine, len(lines))
+	index := make(map[string]int, len(lines))
+	for i := range lines {
+		index[lines[i].CustomID] = i
+	}
+	for _, fileID := range []*string{b.OutputFileID, b.ErrorFileID} {
+		if fileID == nil {
+			continue
+		}
+		f, err := s.store.LoadBatchFile(ctx, b.EnvironmentID, *fileID, true)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("load recorded results: %w", err)
+		}
+		recorded, err := decodeLines(f.Content)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("load recorded results: %w", err)
+		}
+		for _, out := range recorded {
+			if i, ok := index[out.CustomID]; ok {
+				results[i] = out
+			}
+		}
+	}
+	return lines, results, nil, nil
+}
+
+// execute runs the lines whose result is nil with bounded concurrency,
+// filling in results as they complete; those still nil afterwards never
+// ran. Cancelling ctx stops new lines from starting, while lines already
+// running complete unless the gateway is shutting down or the batch
+// expired.
+func (s *Service) execute(ctx context.Context, b *model.Batch, key *model.APIKey, lines []Line, results []*OutputLine) {
+	lineCtx, cancelLines := context.WithDeadline(s.ctx, b.ExpiresAt)
+	defer cancelLines()
+
+	var completed, failed atomic.Int64
+	var pending []int
+	for i, out := range results {
+		switch {
+		case out == nil:
+			pending = append(pending, i)
+		case out.succeeded():
+			completed.Add(1)
+		default:
+			failed.Add(1)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(s.concurrency, len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out := s.executeLine(ctx, lineCtx, key, b, &lines[i])
+				if out == nil {
+					continue
+				}
+				results[i] = out
+				if out.succeeded() {
+					completed.Add(1)
+				} else {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, i := range pending {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			b.CompletedRequests = int(completed.Load())
+			b.FailedRequests = int(failed.Load())
+			return
+		case <-ticker.C:
+			status, err := s.progress(b.ID, int(completed.Load()), int(failed.Load()))
+			if err != nil {
+				s.log(b).Warn("save batch progress", "error", err)
+				continue
+			}
+			if status == StatusCancelling {
+				s.mu.Lock()
+				if cancel, ok := s.running[b.ID]; ok {
+					cancel(errCancelled)
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// executeLine runs one line, retrying it with backoff while it is rate
+// limited. It returns nil if ctx is cancelled before the line completes,
+// or if the shutdown cut it off, so that it runs again when the batch is
+// resumed.
+func (s *Service) executeLine(ctx, lineCtx context.Context, key *model.APIKey, b *model.Batch, line *Line) *OutputLine {
+	for attempt := 0; ; attempt++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		res := s.exec.Execute(lineCtx, key, b, line)
+		if res.StatusCode >= 300 && errors.Is(context.Cause(lineCtx), errShutdown) {
+			return nil
+		}
+		if res.RetryAfter <= 0 {
+			return newOutputLine(line.CustomID, res)
+		}
+
+		delay := res.RetryAfter << min(attempt, 5)
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *Service) progress(batchID string, completed, failed int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	return s.store.UpdateBatchProgress(ctx, batchID, completed, failed, time.Now().Add(leaseDuration))
+}
+
+// interrupt records the lines that ran in the output and error files and
+// leaves the batch in progress without a lease, so that the next gateway
+// to claim it runs only the lines that did not.
+func (s *Service) interrupt(b *model.Batch, results []*OutputLine) {
+	var output, errs []*OutputLine
+	for _, out := range results {
+		switch {
+		case out == nil:
+		case out.succeeded():
+			output = append(output, out)
+		default:
+			errs = append(errs, out)
+		}
+	}
+	s.writeResults(b, output, errs)
+
+	b.LeaseExpiresAt = nil
+	s.log(b).Info("batch interrupted",
+		"completed", b.CompletedRequests, "failed", b.FailedRequests, "total", b.TotalRequests)
+	s.save(b)
+}
+
+// release gives up the lease on a batch this gateway will not run, so
+// that another gateway may claim it at once.
+func (s *Service) release(b *model.Batch) {
+	b.LeaseExpiresAt = nil
+	s.save(b)
+}
+
+// finalize writes the output and error files and records the batch's final
+// status. cause is why the batch stopped early, or nil if every line ran.
+func (s *Service) finalize(b *model.Batch, lines []Line, results []*OutputLine, cause error) {
+	skipped := skippedError(cause)
+	var output, errs []*OutputLine
+	for i, out := range results {
+		switch {
+		case out == nil:
+			errs = append(errs, newErrorLine(lines[i].CustomID, skipped))
+		case out.succeeded():
+			output = append(output, out)
+		default:
+			errs = append(errs, out)
+		}
+	}
+
+	s.writeResults(b, output, errs)
+
+	now := time.Now()
+	switch {
+	case cause == nil:
+		b.Status = StatusCompleted
+		b.CompletedAt = &now
+	case errors.Is(cause, errCancelled):
+		b.Status = StatusCancelled
+		b.CancelledAt = &now
+		if b.CancellingAt == nil {
+			b.CancellingAt = &now
+		}
+	case errors.Is(cause, context.DeadlineExceeded):
+		b.Status = StatusExpired
+		b.ExpiredAt = &now
+	default:
+		b.Status = StatusFailed
+		b.FailedAt = &now
+		b.Errors = []model.BatchError{{Code: "batch_interrupted", Message: cause.Error()}}
+	}
+	b.LeaseExpiresAt = nil
+	s.log(b).Info("batch finished", "status", b.Status,
+		"completed", b.CompletedRequests, "failed", b.FailedRequests, "total", b.TotalRequests)
+	s.save(b)
+}
+
+func (s *Service) log(b *model.Batch) *slog.Logger {
+	return s.logger.With("batch_id", b.ID, "environment_id", b.EnvironmentID)
+}
+
+// writeResults replaces the batch's output and error files with files of
+// the given lines. A file that cannot be written keeps the previous one.
+func (s *Service) writeResults(b *model.Batch, output, errs []*OutputLine) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	if id, err := s.writeFile(ctx, b, "batch_"+b.ID+"_output.jsonl", output); err != nil {
+		s.log(b).Error("write batch output file", "error", err)
+	} else {
+		b.OutputFileID = id
+	}
+	if id, err := s.writeFile(ctx, b, "batch_"+b.ID+"_error.jsonl", errs); err != nil {
+		s.log(b).Error("write batch error file", "error", err)
+	} else {
+		b.ErrorFileID = id
+	}
+}
+
+// writeFile stores the lines as a batch_output file. No file is written
+// for an empty list.
+func (s *Service) writeFile(ctx context.Context, b *model.Batch, filename string, lines []*OutputLine) (*string, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	content, err := encodeLines(lines)
+	if err != nil {
+		return nil, err
+	}
+	f := &model.BatchFile{
+		EnvironmentID: b.EnvironmentID,
+		APIKeyID:      b.APIKeyID,
+		Purpose:       PurposeBatchOutput,
+		Filename:      filename,
+		Bytes:         len(content),
+		Content:       content,
+	}
+	if err := s.store.InsertBatchFile(ctx, f); err != nil {
+		return nil, err
+	}
+	return &f.ID, nil
+}
+
+func (s *Service) save(b *model.Batch) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.store.UpdateBatch(ctx, b); err != nil {
+		s.log(b).Error("save batch", "status", b.Status, "error", err)
+	}
+}
+
+// unfinished reports whether a batch in the given status still has lines
+// to run or results to write.
+func unfinished(status string) bool {
+	switch status {
+	case StatusValidating, StatusInProgress, StatusFinalizing, StatusCancelling:
+		return true
+	}
+	return false
+}
+
+func leaseFromNow() *time.Time {
+	t := time.Now().Add(leaseDuration)
+	return &t
+}
+
+// skippedError describes why a line never ran.
+func skippedError(cause error) *LineError {
+	switch {
+	case errors.Is(cause, errCancelled):
+		return &LineError{Code: "batch_cancelled", Message: "This line was not executed because the batch was cancelled."}
+	case errors.Is(cause, context.DeadlineExceeded):
+		return &LineError{Code: "batch_expired", Message: "This line could not be executed before the batch expired."}
+	}
+	return &LineError{Code: "batch_interrupted", Message: "This line was not executed because the gateway shut down."}
+}
@@ -0,0 +1,377 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	mu      sync.Mutex
+	files   map[string]*model.BatchFile
+	batches map[string]*model.Batch
+	nextID  int
+}
+
+func newMemStore() *memStore {
+	return &memStore{files: map[string]*model.BatchFile{}, batches: map[string]*model.Batch{}}
+}
+
+func (m *memStore) id(prefix string) string {
+	m.nextID++
+	return fmt.Sprintf("%s-%d", prefix, m.nextID)
+}
+
+func (m *memStore) InsertBatchFile(_ context.Context, f *model.BatchFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f.ID = m.id("file")
+	f.CreatedAt = time.Now()
+	stored := *f
+	m.files[f.ID] = &stored
+	return nil
+}
+
+func (m *memStore) LoadBatchFile(_ context.Context, envID, fileID string, _ bool) (*model.BatchFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok || f.EnvironmentID != envID {
+		return nil, errors.New("no rows")
+	}
+	out := *f
+	return &out, nil
+}
+
+func (m *memStore) InsertBatch(_ context.Context, b *model.Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b.ID = m.id("batch")
+	b.CreatedAt = time.Now()
+	stored := *b
+	m.batches[b.ID] = &stored
+	return nil
+}
+
+func (m *memStore) LoadBatch(_ context.Context, envID, batchID string) (*model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.batches[batchID]
+	if !ok || b.EnvironmentID != envID {
+		return nil, errors.New("no rows")
+	}
+	out := *b
+	return &out, nil
+}
+
+func (m *memStore) ListBatches(context.Context, string, string, int) ([]model.Batch, error) {
+	return nil, nil
+}
+
+func (m *memStore) UpdateBatch(_ context.Context, b *model.Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *b
+	m.batches[b.ID] = &stored
+	return nil
+}
+
+func (m *memStore) UpdateBatchProgress(_ context.Context, batchID string, completed, failed int, leaseUntil time.Time) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.batches[batchID]
+	b.CompletedRequests, b.FailedRequests = completed, failed
+	b.LeaseExpiresAt = &leaseUntil
+	return b.Status, nil
+}
+
+func (m *memStore) ClaimBatches(_ context.Context, leaseUntil time.Time) ([]model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.Batch
+	for _, b := range m.batches {
+		if unfinished(b.Status) && (b.LeaseExpiresAt == nil || b.LeaseExpiresAt.Before(time.Now())) {
+			lease := leaseUntil
+			b.LeaseExpiresAt = &lease
+			out = append(out, *b)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) CancelBatch(ctx context.Context, envID, batchID string) (*model.Batch, error) {
+	m.mu.Lock()
+	if b, ok := m.batches[batchID]; ok && (b.Status == StatusValidating || b.Status == StatusInProgress) {
+		now := time.Now()
+		b.Status = StatusCancelling
+		b.CancellingAt = &now
+	}
+	m.mu.Unlock()
+	return m.LoadBatch(ctx, envID, batchID)
+}
+
+func (m *memStore) outputLines(t *testing.T, fileID *string) []OutputLine {
+	t.Helper()
+	if fileID == nil {
+		return nil
+	}
+	var lines []OutputLine
+	scanner := bufio.NewScanner(bytes.NewReader(m.files[*fileID].Content))
+	for scanner.Scan() {
+		var line OutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// funcExecutor adapts a function to the Executor interface.
+type funcExecutor func(ctx context.Context, line *Line) Result
+
+func (f funcExecutor) Execute(ctx context.Context, _ *model.APIKey, _ *model.Batch, line *Line) Result {
+	return f(ctx, line)
+}
+
+var testKey = &model.APIKey{ID: "key-1", EnvironmentID: "env-1"}
+
+// testKeys finds testKey.
+type testKeys struct{}
+
+func (testKeys) FindByID(_ context.Context, keyID string) (*model.APIKey, error) {
+	if keyID != testKey.ID {
+		return nil, errors.New("no such key")
+	}
+	return testKey, nil
+}
+
+func inputFile(ids ...string) []byte {
+	var b strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&b, `{"custom_id":%q,"method":"POST","url":"/v1/chat/completions","body":{"model":"m"}}`+"\n", id)
+	}
+	return []byte(b.String())
+}
+
+func createBatch(t *testing.T, s *Service, content []byte) *model.Batch {
+	t.Helper()
+	f, err := s.CreateFile(context.Background(), testKey, "input.jsonl", PurposeBatch, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Create(context.Background(), testKey, "", f.ID, "/v1/chat/completions", "24h", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestService_RunsLinesAndSplitsOutput(t *testing.T) {
+	store := newMemStore()
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	exec := funcExecutor(func(_ context.Context, line *Line) Result {
+		mu.Lock()
+		attempts[line.CustomID]++
+		n := attempts[line.CustomID]
+		mu.Unlock()
+
+		switch {
+		case line.CustomID == "bad":
+			return Result{StatusCode: 400, RequestID: "req-bad", Body: map[string]string{"error": "bad"}}
+		case line.CustomID == "limited" && n == 1:
+			return Result{StatusCode: 429, RetryAfter: time.Millisecond}
+		}
+		return Result{StatusCode: 200, RequestID: "req-" + line.CustomID, Body: map[string]string{"ok": line.CustomID}}
+	})
+	s := NewService(store, nil, exec, 2, logging.Discard())
+
+	b := createBatch(t, s, inputFile("a", "bad", "limited", "d"))
+	s.wg.Wait()
+
+	got, _ := store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusCompleted || got.CompletedAt == nil {
+		t.Fatalf("status = %q, want completed", got.Status)
+	}
+	if got.TotalRequests != 4 || got.CompletedRequests != 3 || got.FailedRequests != 1 {
+		t.Errorf("counts = %d/%d/%d, want 4/3/1", got.TotalRequests, got.CompletedRequests, got.FailedRequests)
+	}
+	if attempts["limited"] != 2 {
+		t.Errorf("rate limited line ran %d times, want 2", attempts["limited"])
+	}
+
+	output := store.outputLines(t, got.OutputFileID)
+	var ids []string
+	for _, line := range output {
+		ids = append(ids, line.CustomID)
+	}
+	if strings.Join(ids, ",") != "a,limited,d" {
+		t.Errorf("output custom_ids = %v, want input order a,limited,d", ids)
+	}
+	errs := store.outputLines(t, got.ErrorFileID)
+	if len(errs) != 1 || errs[0].CustomID != "bad" || errs[0].Response.StatusCode != 400 || errs[0].ID != "batch_req_req-bad" {
+		t.Errorf("error lines = %+v", errs)
+	}
+}
+
+func TestService_InvalidFileFailsBatch(t *testing.T) {
+	store := newMemStore()
+	s := NewService(store, nil, funcExecutor(func(context.Context, *Line) Result {
+		t.Error("no line should run")
+		return Result{}
+	}), 2, logging.Discard())
+
+	b := createBatch(t, s, []byte(`{"custom_id":"a","method":"GET","url":"/v1/chat/completions","body":{}}`))
+	s.wg.Wait()
+
+	got, _ := store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusFailed || len(got.Errors) != 1 || got.Errors[0].Code != "invalid_method" {
+		t.Errorf("batch = %q %+v, want failed with invalid_method", got.Status, got.Errors)
+	}
+}
+
+func TestService_Cancel(t *testing.T) {
+	store := newMemStore()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	exec := funcExecutor(func(_ context.Context, line *Line) Result {
+		if line.CustomID == "a" {
+			close(started)
+			<-release
+		}
+		return Result{StatusCode: 200, RequestID: "req-" + line.CustomID}
+	})
+	s := NewService(store, nil, exec, 1, logging.Discard())
+
+	b := createBatch(t, s, inputFile("a", "b", "c"))
+	<-started
+	if _, err := s.Cancel(context.Background(), testKey, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	s.wg.Wait()
+
+	got, _ := store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusCancelled || got.CancelledAt == nil {
+		t.Fatalf("status = %q, want cancelled", got.Status)
+	}
+	if output := store.outputLines(t, got.OutputFileID); len(output) != 1 || output[0].CustomID != "a" {
+		t.Errorf("the running line should finish, output = %+v", output)
+	}
+	errs := store.outputLines(t, got.ErrorFileID)
+	if len(errs) != 2 || errs[0].Error == nil || errs[0].Error.Code != "batch_cancelled" {
+		t.Errorf("skipped lines = %+v, want two batch_cancelled errors", errs)
+	}
+}
+
+func TestService_RejectsUnknownEndpointAndFile(t *testing.T) {
+	s := NewService(newMemStore(), nil, funcExecutor(nil), 1, logging.Discard())
+	ctx := context.Background()
+
+	if _, err := s.Create(ctx, testKey, "", "file-1", "/v1/completions", "24h", nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unsupported endpoint: err = %v, want ErrInvalid", err)
+	}
+	if _, err := s.Create(ctx, testKey, "", "file-404", "/v1/embeddings", "24h", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing file: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.CreateFile(ctx, testKey, "x.jsonl", "fine-tune", nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("wrong purpose: err = %v, want ErrInvalid", err)
+	}
+}
+
+func TestService_ShutdownLeavesBatchToResume(t *testing.T) {
+	store := newMemStore()
+	started := make(chan struct{})
+	first := funcExecutor(func(ctx context.Context, line *Line) Result {
+		switch line.CustomID {
+		case "bad":
+			return Result{StatusCode: 400, RequestID: "req-bad"}
+		case "b":
+			close(started)
+			<-ctx.Done()
+			return Result{StatusCode: 502, RequestID: "req-b"}
+		}
+		return Result{StatusCode: 200, RequestID: "req-" + line.CustomID}
+	})
+	s := NewService(store, testKeys{}, first, 1, logging.Discard())
+
+	b := createBatch(t, s, inputFile("a", "bad", "b", "c"))
+	<-started
+	s.Close()
+
+	got, _ := store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusInProgress || got.LeaseExpiresAt != nil {
+		t.Fatalf("interrupted batch = %q with lease %v, want in_progress without a lease", got.Status, got.LeaseExpiresAt)
+	}
+	if got.CompletedRequests != 1 || got.FailedRequests != 1 {
+		t.Errorf("recorded counts = %d/%d, want 1/1", got.CompletedRequests, got.FailedRequests)
+	}
+	if output := store.outputLines(t, got.OutputFileID); len(output) != 1 || output[0].CustomID != "a" {
+		t.Errorf("partial output = %+v, want only a", output)
+	}
+
+	var mu sync.Mutex
+	var ran []string
+	second := funcExecutor(func(_ context.Context, line *Line) Result {
+		mu.Lock()
+		ran = append(ran, line.CustomID)
+		mu.Unlock()
+		return Result{StatusCode: 200, RequestID: "req-" + line.CustomID}
+	})
+	s = NewService(store, testKeys{}, second, 1, logging.Discard())
+	s.Resume(context.Background())
+	s.wg.Wait()
+
+	if strings.Join(ran, ",") != "b,c" {
+		t.Errorf("resumed batch ran %v, want only b,c", ran)
+	}
+	got, _ = store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusCompleted || got.LeaseExpiresAt != nil {
+		t.Fatalf("status = %q with lease %v, want completed without a lease", got.Status, got.LeaseExpiresAt)
+	}
+	if got.TotalRequests != 4 || got.CompletedRequests != 3 || got.FailedRequests != 1 {
+		t.Errorf("counts = %d/%d/%d, want 4/3/1", got.TotalRequests, got.CompletedRequests, got.FailedRequests)
+	}
+	var ids []string
+	for _, line := range store.outputLines(t, got.OutputFileID) {
+		ids = append(ids, line.CustomID)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Errorf("output custom_ids = %v, want a,b,c", ids)
+	}
+	if errs := store.outputLines(t, got.ErrorFileID); len(errs) != 1 || errs[0].CustomID != "bad" {
+		t.Errorf("error lines = %+v, want only bad", errs)
+	}
+}
+
+func TestService_ResumeWithoutKeyFailsBatch(t *testing.T) {
+	store := newMemStore()
+	other := "key-2"
+	b := &model.Batch{EnvironmentID: "env-1", APIKeyID: &other, Status: StatusInProgress}
+	if err := store.InsertBatch(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(store, testKeys{}, funcExecutor(func(context.Context, *Line) Result {
+		t.Error("no line should run")
+		return Result{}
+	}), 1, logging.Discard())
+	s.Resume(context.Background())
+	s.wg.Wait()
+
+	got, _ := store.LoadBatch(context.Background(), "env-1", b.ID)
+	if got.Status != StatusFailed || len(got.Errors) != 1 || got.Errors[0].Code != "api_key_unavailable" {
+		t.Errorf("batch = %q %+v, want failed with api_key_unavailable", got.Status, got.Errors)
+	}
+}
@@ -0,0 +1,300 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// Batch statuses as stored in batches.status.
+const (
+	StatusValidating = "validating"
+	StatusFailed     = "failed"
+	StatusInProgress = "in_progress"
+	StatusFinalizing = "finalizing"
+	StatusCompleted  = "completed"
+	StatusExpired    = "expired"
+	StatusCancelling = "cancelling"
+	StatusCancelled  = "cancelled"
+)
+
+// File purposes.
+const (
+	PurposeBatch       = "batch"
+	PurposeBatchOutput = "batch_output"
+)
+
+const (
+	// MaxFileBytes caps the size of an uploaded input file.
+	MaxFileBytes = 100 << 20
+	// maxLines caps the number of requests in one batch.
+	maxLines = 50000
+	// completionWindow is the only completion window offered.
+	completionWindow = "24h"
+)
+
+// Endpoints that batch lines may target.
+var endpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/embeddings":       true,
+}
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+// Store persists batch files and batches.
+type Store interface {
+	InsertBatchFile(ctx context.Context, f *model.BatchFile) error
+	LoadBatchFile(ctx context.Context, envID, fileID string, withContent bool) (*model.BatchFile, error)
+	InsertBatch(ctx context.Context, b *model.Batch) error
+	LoadBatch(ctx context.Context, envID, batchID string) (*model.Batch, error)
+	ListBatches(ctx context.Context, envID, after string, limit int) ([]model.Batch, error)
+	UpdateBatch(ctx context.Context, b *model.Batch) error
+	UpdateBatchProgress(ctx context.Context, batchID string, completed, failed int, leaseUntil time.Time) (string, error)
+	CancelBatch(ctx context.Context, envID, batchID string) (*model.Batch, error)
+	// ClaimBatches takes a lease until leaseUntil on the validating, in
+	// progress and cancelling batches whose lease has lapsed, and returns
+	// them.
+	ClaimBatches(ctx context.Context, leaseUntil time.Time) ([]model.Batch, error)
+}
+
+// KeySource looks up the API key a batch was created with, to resume it.
+type KeySource interface {
+	FindByID(ctx context.Context, keyID string) (*model.APIKey, error)
+}
+
+// Executor runs a single line of a batch through the gateway, metering it
+// as part of the batch.
+type Executor interface {
+	Execute(ctx context.Context, key *model.APIKey, b *model.Batch, line *Line) Result
+}
+
+// Result is the outcome of one line. RetryAfter is set when the line was
+// turned away by a rate limit and may be retried after that delay.
+type Result struct {
+	StatusCode int
+	RequestID  string
+	Body       interface{}
+	RetryAfter time.Duration
+}
+
+// Service implements the Files and Batches APIs and runs batches in the
+// background, at most concurrency lines at a time per batch. It holds a
+// lease on the batches it runs; batches whose gateway stopped without
+// finishing them are resumed by Run.
+type Service struct {
+	store       Store
+	keys        KeySource
+	exec        Executor
+	concurrency int
+	logger      *slog.Logger
+
+	ctx  context.Context
+	stop context.CancelCauseFunc
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+}
+
+// NewService returns a batch service. keys may be nil when batches are not
+// kept across restarts, in which case none are resumed.
+func NewService(store Store, keys KeySource, exec Executor, concurrency int, logger *slog.Logger) *Service {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, stop := context.WithCancelCause(context.Background())
+	return &Service{
+		store:       store,
+		keys:        keys,
+		exec:        exec,
+		concurrency: concurrency,
+		logger:      logger,
+		ctx:         ctx,
+		stop:        stop,
+		running:     make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// CreateFile stores an uploaded input file.
+func (s *Service) CreateFile(ctx context.Context, key *model.APIKey, filename, purpose string, content []byte) (*model.BatchFile, error) {
+	if purpose != PurposeBatch {
+		return nil, fmt.Errorf("%w: purpose must be %q", ErrInvalid, PurposeBatch)
+	}
+	f := &model.BatchFile{
+		EnvironmentID: key.EnvironmentID,
+		APIKeyID:      &key.ID,
+		Purpose:       purpose,
+		Filename:      filename,
+		Bytes:         len(content),
+		Content:       content,
+	}
+	if err := s.store.InsertBatchFile(ctx, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// File returns a file's metadata, and its content when withContent is set.
+func (s *Service) File(ctx context.Context, key *model.APIKey, fileID string, withContent bool) (*model.BatchFile, error) {
+	f, err := s.store.LoadBatchFile(ctx, key.EnvironmentID, fileID, withContent)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no file with id %q", ErrNotFound, fileID)
+	}
+	return f, nil
+}
+
+// Create creates a batch over an uploaded input file and starts it.
+func (s *Service) Create(ctx context.Context, key *model.APIKey, routeSlug, inputFileID, endpoint, window string, metadata map[string]string) (*model.Batch, error) {
+	if !endpoints[endpoint] {
+		return nil, fmt.Errorf("%w: unsupported endpoint %q", ErrInvalid, endpoint)
+	}
+	if window != completionWindow {
+		return nil, fmt.Errorf("%w: completion_window must be %q", ErrInvalid, completionWindow)
+	}
+	f, err := s.store.LoadBatchFile(ctx, key.EnvironmentID, inputFileID, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no file with id %q", ErrNotFound, inputFileID)
+	}
+	if f.Purpose != PurposeBatch {
+		return nil, fmt.Errorf("%w: file %q does not have purpose %q", ErrInvalid, inputFileID, PurposeBatch)
+	}
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+
+	b := &model.Batch{
+		EnvironmentID:    key.EnvironmentID,
+		APIKeyID:         &key.ID,
+		Endpoint:         endpoint,
+		InputFileID:      f.ID,
+		CompletionWindow: window,
+		Status:           StatusValidating,
+		Metadata:         metadata,
+		ExpiresAt:        time.Now().Add(24 * time.Hour),
+		LeaseExpiresAt:   leaseFromNow(),
+	}
+	if routeSlug != "" {
+		b.RouteSlug = &routeSlug
+	}
+	if err := s.store.InsertBatch(ctx, b); err != nil {
+		return nil, err
+	}
+
+	// The runner works on its own copy; b is returned to the caller.
+	run := *b
+	if !s.start(&run, key) {
+		s.release(&run)
+	}
+	return b, nil
+}
+
+// Get returns a batch.
+func (s *Service) Get(ctx context.Context, key *model.APIKey, batchID string) (*model.Batch, error) {
+	b, err := s.store.LoadBatch(ctx, key.EnvironmentID, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no batch with id %q", ErrNotFound, batchID)
+	}
+	return b, nil
+}
+
+// List returns up to limit batches, newest first, starting after the
+// given batch ID.
+func (s *Service) List(ctx context.Context, key *model.APIKey, after string, limit int) ([]model.Batch, error) {
+	return s.store.ListBatches(ctx, key.EnvironmentID, after, limit)
+}
+
+// Cancel requests cancellation of a batch. Lines already running finish;
+// the rest are reported as cancelled in the error file.
+func (s *Service) Cancel(ctx context.Context, key *model.APIKey, batchID string) (*model.Batch, error) {
+	b, err := s.store.CancelBatch(ctx, key.EnvironmentID, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no batch with id %q", ErrNotFound, batchID)
+	}
+	if b.Status == StatusCancelling {
+		s.mu.Lock()
+		if cancel, ok := s.running[b.ID]; ok {
+			cancel(errCancelled)
+		}
+		s.mu.Unlock()
+	}
+	return b, nil
+}
+
+// Run resumes unfinished batches whose lease has lapsed, at once and then
+// every interval, until ctx is cancelled. Running it on every gateway
+// picks up the batches of gateways that shut down or crashed.
+func (s *Service) Run(ctx context.Context, interval time.Duration) {
+	s.Resume(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Resume(ctx)
+		}
+	}
+}
+
+// Resume claims the unfinished batches no gateway holds and runs them
+// with the API keys that created them, skipping the lines they already
+// have results for. Batches whose key is gone fail.
+func (s *Service) Resume(ctx context.Context) {
+	if s.keys == nil || s.ctx.Err() != nil {
+		return
+	}
+	batches, err := s.store.ClaimBatches(ctx, time.Now().Add(leaseDuration))
+	if err != nil {
+		s.logger.Warn("claim batches", "error", err)
+		return
+	}
+	for i := range batches {
+		b := &batches[i]
+		s.mu.Lock()
+		_, running := s.running[b.ID]
+		s.mu.Unlock()
+		if running {
+			continue
+		}
+
+		var key *model.APIKey
+		if b.APIKeyID != nil {
+			key, err = s.keys.FindByID(ctx, *b.APIKeyID)
+		}
+		if key == nil {
+			s.log(b).Warn("cannot resume batch without its api key", "error", err)
+			now := time.Now()
+			b.Status = StatusFailed
+			b.FailedAt = &now
+			b.Errors = []model.BatchError{{Code: "api_key_unavailable", Message: "the API key that created the batch is no longer active"}}
+			b.LeaseExpiresAt = nil
+			s.save(b)
+			continue
+		}
+
+		s.log(b).Info("resuming batch", "status", b.Status,
+			"completed", b.CompletedRequests, "failed", b.FailedRequests, "total", b.TotalRequests)
+		if !s.start(b, key) {
+			s.release(b)
+		}
+	}
+}
+
+// Close stops all running batches and waits for them to record their
+// progress. They are left in progress, without a lease, for the next
+// gateway to resume.
+func (s *Service) Close() {
+	s.mu.Lock()
+	s.stop(errShutdown)
+	s.mu.Unlock()
+	s.wg.Wait()
+}
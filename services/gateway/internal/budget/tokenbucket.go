@@ -1,6 +1,8 @@
 package budget
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -47,15 +49,39 @@ func (tb *TokenBucket) Allow() bool {
 	return true
 }
 
+// BucketState is a point-in-time view of a token bucket.
+type BucketState struct {
+	Key       string
+	Tokens    float64
+	Capacity  float64
+	PerMinute float64
+}
+
+// state returns the bucket as it would be refilled now, without consuming
+// or updating it.
+func (tb *TokenBucket) state() (tokens, capacity, rate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tokens = tb.tokens + time.Since(tb.lastTime).Seconds()*tb.rate
+	if tokens > tb.capacity {
+		tokens = tb.capacity
+	}
+	return tokens, tb.capacity, tb.rate
+}
+
 // RateLimiter manages token buckets per key.
 type RateLimiter struct {
 	mu      sync.RWMutex
 	buckets map[string]*TokenBucket
+
+	rejectedMu sync.Mutex
+	rejected   map[string]int64
 }
 
 func NewRateLimiter() *RateLimiter {
 	return &RateLimiter{
-		buckets: make(map[string]*TokenBucket),
+		buckets:  make(map[string]*TokenBucket),
+		rejected: make(map[string]int64),
 	}
 }
 
@@ -75,5 +101,50 @@ func (rl *RateLimiter) Allow(key string, maxPerMinute int) bool {
 		rl.mu.Unlock()
 	}
 
-	return bucket.Allow()
+	if bucket.Allow() {
+		return true
+	}
+	rl.rejectedMu.Lock()
+	rl.rejected[scope(key)]++
+	rl.rejectedMu.Unlock()
+	return false
+}
+
+// Rejections returns the number of rejected requests per scope, the part
+// of the bucket key before the first colon ("key", "route").
+func (rl *RateLimiter) Rejections() map[string]int64 {
+	rl.rejectedMu.Lock()
+	defer rl.rejectedMu.Unlock()
+	out := make(map[string]int64, len(rl.rejected))
+	for k, v := range rl.rejected {
+		out[k] = v
+	}
+	return out
+}
+
+// Buckets returns the state of every bucket, sorted by key.
+func (rl *RateLimiter) Buckets() []BucketState {
+	rl.mu.RLock()
+	keys := make([]string, 0, len(rl.buckets))
+	buckets := make(map[string]*TokenBucket, len(rl.buckets))
+	for k, b := range rl.buckets {
+		keys = append(keys, k)
+		buckets[k] = b
+	}
+	rl.mu.RUnlock()
+
+	sort.Strings(keys)
+	out := make([]BucketState, 0, len(keys))
+	for _, k := range keys {
+		tokens, capacity, rate := buckets[k].state()
+		out = append(out, BucketState{Key: k, Tokens: tokens, Capacity: capacity, PerMinute: rate * 60})
+	}
+	return out
+}
+
+func scope(key string) string {
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		return key[:i]
+	}
+	return key
 }
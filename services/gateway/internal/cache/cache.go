@@ -22,6 +22,32 @@ type Entry struct {
 	ExpiresAt     time.Time
 	HitCount      int64
 	LastAccessedAt time.Time
+	// Scope records which environment and route the entry was cached for.
+	Scope Scope
+}
+
+// Scope identifies the environment and route a cached response belongs to.
+type Scope struct {
+	EnvironmentID string
+	RouteID       string
+	RouteSlug     string
+}
+
+// Filter selects cache entries by scope. Empty fields match everything;
+// Route matches either the route ID or its slug.
+type Filter struct {
+	EnvironmentID string
+	Route         string
+}
+
+func (f Filter) matches(s Scope) bool {
+	if f.EnvironmentID != "" && f.EnvironmentID != s.EnvironmentID {
+		return false
+	}
+	if f.Route != "" && f.Route != s.RouteID && f.Route != s.RouteSlug {
+		return false
+	}
+	return true
 }
 
 // Stats tracks cache performance metrics.
@@ -183,6 +209,12 @@ func (c *Cache) Get(key string) (*Entry, bool) {
 
 // Set stores a response in the cache.
 func (c *Cache) Set(key string, response []byte, model string, inputTokens, outputTokens int, costUSD float64) {
+	c.SetScoped(Scope{}, key, response, model, inputTokens, outputTokens, costUSD)
+}
+
+// SetScoped stores a response in the cache, tagged with the environment
+// and route it was produced for so it can be listed and purged by scope.
+func (c *Cache) SetScoped(scope Scope, key string, response []byte, model string, inputTokens, outputTokens int, costUSD float64) {
 	if !c.config.Enabled {
 		return
 	}
@@ -207,6 +239,7 @@ func (c *Cache) Set(key string, response []byte, model string, inputTokens, outp
 		ExpiresAt:      now.Add(c.config.TTL),
 		HitCount:       0,
 		LastAccessedAt: now,
+		Scope:          scope,
 	}
 	c.stats.Entries = int64(len(c.entries))
 }
@@ -229,11 +262,71 @@ func (c *Cache) Clear() {
 	c.stats.Entries = 0
 }
 
+// Entries returns copies of the live entries matching f, most recently
+// accessed first.
+func (c *Cache) Entries(f Filter) []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := time.Now()
+	out := make([]Entry, 0)
+	for _, entry := range c.entries {
+		if now.After(entry.ExpiresAt) || !f.matches(entry.Scope) {
+			continue
+		}
+		out = append(out, *entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LastAccessedAt.After(out[j].LastAccessedAt)
+	})
+	return out
+}
+
+// Purge removes the entries matching f and returns how many were removed.
+func (c *Cache) Purge(f Filter) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, entry := range c.entries {
+		if f.matches(entry.Scope) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	c.stats.Entries = int64(len(c.entries))
+	return removed
+}
+
 // GetStats returns cache performance metrics.
 func (c *Cache) GetStats() map[string]interface{} {
 	return c.stats.Snapshot()
 }
 
+// Counters is a point-in-time copy of the cache statistics.
+type Counters struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int64
+	SavedCost float64
+}
+
+// Counters returns the current cache statistics.
+func (c *Cache) Counters() Counters {
+	// Evictions and Entries are maintained under the cache lock, hits and
+	// misses under the stats lock.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.stats.mu.RLock()
+	defer c.stats.mu.RUnlock()
+	return Counters{
+		Hits:      c.stats.Hits,
+		Misses:    c.stats.Misses,
+		Evictions: c.stats.Evictions,
+		Entries:   c.stats.Entries,
+		SavedCost: c.stats.SavedCost,
+	}
+}
+
 // evictLRU removes the least recently used entry.
 // Must be called with mu held.
 func (c *Cache) evictLRU() {
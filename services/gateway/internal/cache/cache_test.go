@@ -184,3 +184,34 @@ func TestCache_AccessCountIncrements(t *testing.T) {
 		t.Errorf("Expected hit count 3, got %d", entry.HitCount)
 	}
 }
+
+func TestCache_EntriesAndPurgeByScope(t *testing.T) {
+	c := New(Config{MaxEntries: 100, TTL: 5 * time.Minute, Enabled: true})
+
+	c.SetScoped(Scope{EnvironmentID: "env-1", RouteID: "r-1", RouteSlug: "support"}, "a", []byte("r"), "gpt-4", 10, 5, 0.001)
+	c.SetScoped(Scope{EnvironmentID: "env-1", RouteID: "r-2", RouteSlug: "search"}, "b", []byte("r"), "gpt-4", 10, 5, 0.001)
+	c.SetScoped(Scope{EnvironmentID: "env-2", RouteID: "r-3", RouteSlug: "support"}, "c", []byte("r"), "gpt-4", 10, 5, 0.001)
+
+	if got := len(c.Entries(Filter{})); got != 3 {
+		t.Errorf("Expected 3 entries, got %d", got)
+	}
+	if got := len(c.Entries(Filter{EnvironmentID: "env-1"})); got != 2 {
+		t.Errorf("Expected 2 entries in env-1, got %d", got)
+	}
+	if got := len(c.Entries(Filter{Route: "support"})); got != 2 {
+		t.Errorf("Expected 2 entries for route slug support, got %d", got)
+	}
+
+	if removed := c.Purge(Filter{EnvironmentID: "env-1", Route: "r-2"}); removed != 1 {
+		t.Errorf("Expected 1 entry purged, got %d", removed)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected purged entry to miss")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected entry outside the filter to survive")
+	}
+	if entries := c.Counters().Entries; entries != 2 {
+		t.Errorf("Expected 2 entries counted, got %d", entries)
+	}
+}
@@ -0,0 +1,179 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+)
+
+type keyPair struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// issue creates a certificate for cn, signed by parent or self-signed.
+func issue(t *testing.T, cn string, parent *keyPair, isCA bool) *keyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{cn},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return &keyPair{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader_PicksUpNewCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first := issue(t, "first", nil, false)
+	writeFile(t, certFile, first.certPEM)
+	writeFile(t, keyFile, first.keyPEM)
+
+	r, err := NewReloader(certFile, keyFile, "", logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.changed() {
+		t.Error("changed() right after loading")
+	}
+
+	second := issue(t, "second", nil, false)
+	writeFile(t, certFile, second.certPEM)
+	writeFile(t, keyFile, second.keyPEM)
+	// Make the change visible even on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if !r.changed() {
+		t.Fatal("changed() did not notice the new certificate")
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := r.getCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("serving %q, want second", cert.Leaf.Subject.CommonName)
+	}
+
+	// A broken key keeps the previous certificate.
+	writeFile(t, keyFile, []byte("garbage"))
+	if err := r.Reload(); err == nil {
+		t.Error("Reload with a broken key succeeded")
+	}
+	cert, _ = r.getCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("serving %q after failed reload, want second", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestReloader_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "test-ca", nil, true)
+	server := issue(t, "127.0.0.1", ca, false)
+	client := issue(t, "billing-agent", ca, false)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	writeFile(t, certFile, server.certPEM)
+	writeFile(t, keyFile, server.keyPEM)
+	writeFile(t, caFile, ca.certPEM)
+
+	r, err := NewReloader(certFile, keyFile, caFile, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.VerifiedChains) == 0 {
+			io.WriteString(w, "anonymous")
+			return
+		}
+		io.WriteString(w, req.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}))
+	srv.TLS = r.TLSConfig(tls.RequireAndVerifyClientCert)
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs []tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b), nil
+	}
+
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := get([]tls.Certificate{clientCert}); err != nil || got != "billing-agent" {
+		t.Errorf("with client cert: %q, %v; want billing-agent", got, err)
+	}
+	if _, err := get(nil); err == nil {
+		t.Error("request without a client certificate succeeded under require")
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	if v, err := ParseClientAuth("request"); err != nil || v != tls.VerifyClientCertIfGiven {
+		t.Errorf("request = %v, %v", v, err)
+	}
+	if v, err := ParseClientAuth("require"); err != nil || v != tls.RequireAndVerifyClientCert {
+		t.Errorf("require = %v, %v", v, err)
+	}
+	if _, err := ParseClientAuth("optional"); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
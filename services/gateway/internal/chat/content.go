@@ -0,0 +1,120 @@
+// Package chat holds the helpers shared by the adapters that translate
+// chat completion messages to and from other APIs.
+package chat
+
+import (
+	"encoding/json"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Part is a text or image part of chat content, as the adapters for
+// non-OpenAI APIs take it apart. An image is either inline, with base64
+// Data, or referenced by URL.
+type Part struct {
+	Text     string
+	MimeType string
+	Data     string
+	URL      string
+}
+
+// Parts converts chat content, a string or a list of parts, into content
+// parts. Images are kept only when withImages is set.
+func Parts(content interface{}, withImages bool) []Part {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []Part{{Text: c}}
+	case []interface{}:
+		var out []Part
+		for _, p := range c {
+			part, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch part["type"] {
+			case "text":
+				if text, _ := part["text"].(string); text != "" {
+					out = append(out, Part{Text: text})
+				}
+			case "image_url":
+				if !withImages {
+					continue
+				}
+				image, _ := part["image_url"].(map[string]interface{})
+				url, _ := image["url"].(string)
+				if p, ok := ImagePart(url); ok {
+					out = append(out, p)
+				}
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// PartsContent returns content parts as message content, collapsing a
+// single text part into a plain string.
+func PartsContent(parts []interface{}) interface{} {
+	if len(parts) == 1 {
+		if p, ok := parts[0].(map[string]interface{}); ok && p["type"] == "text" {
+			return p["text"]
+		}
+	}
+	return parts
+}
+
+// ImagePart converts an image URL: data URLs become inline data, other
+// URLs keep the URL with the MIME type guessed from the extension.
+func ImagePart(url string) (Part, bool) {
+	if url == "" {
+		return Part{}, false
+	}
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		mimeType, data, ok := strings.Cut(rest, ";base64,")
+		if !ok {
+			return Part{}, false
+		}
+		return Part{MimeType: mimeType, Data: data}, true
+	}
+	mimeType := mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return Part{MimeType: mimeType, URL: url}, true
+}
+
+// JSONObject returns tool call arguments as a JSON object, substituting an
+// empty object when they are not one.
+func JSONObject(args string) json.RawMessage {
+	trimmed := strings.TrimSpace(args)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	return json.RawMessage("{}")
+}
+
+// StopList returns the stop parameter, a string or a list of them, as a
+// list.
+func StopList(stop interface{}) []string {
+	switch s := stop.(type) {
+	case string:
+		if s != "" {
+			return []string{s}
+		}
+	case []string:
+		return s
+	case []interface{}:
+		var out []string
+		for _, v := range s {
+			if str, ok := v.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
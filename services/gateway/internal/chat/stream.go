@@ -0,0 +1,34 @@
+package chat
+
+import "github.com/openfive/gateway/internal/model"
+
+// ToolCallIndex numbers the tool calls of a streamed message in the order
+// they start, keyed by the index of the content block carrying each, for
+// upstreams that stream tool calls as content blocks.
+type ToolCallIndex map[int]int
+
+// Start numbers the tool call starting in a content block and returns the
+// delta announcing it.
+func (x ToolCallIndex) Start(block int, id, name string) *model.Message {
+	idx := len(x)
+	x[block] = idx
+	return &model.Message{ToolCalls: []model.ToolCall{{
+		Index:    &idx,
+		ID:       id,
+		Type:     "function",
+		Function: model.FunctionCall{Name: name},
+	}}}
+}
+
+// Arguments returns the delta adding arguments to the tool call in a
+// content block, or nil when none started there or arguments is empty.
+func (x ToolCallIndex) Arguments(block int, arguments string) *model.Message {
+	idx, ok := x[block]
+	if !ok || arguments == "" {
+		return nil
+	}
+	return &model.Message{ToolCalls: []model.ToolCall{{
+		Index:    &idx,
+		Function: model.FunctionCall{Arguments: arguments},
+	}}}
+}
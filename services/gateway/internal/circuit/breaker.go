@@ -0,0 +1,417 @@
+// Package circuit trips breakers on the providers and models whose calls
+// keep failing, so requests skip them while they recover, and keeps the
+// providers' status in step with what the gateway sees.
+package circuit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+// State is the state of a circuit.
+type State int
+
+const (
+	// Closed lets calls through and counts their outcomes.
+	Closed State = iota
+	// HalfOpen lets calls through again after the cooldown. The first
+	// failure opens the circuit again; enough successes close it.
+	HalfOpen
+	// Open keeps calls away until the cooldown has passed.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// Provider statuses, as stored in providers.status.
+const (
+	StatusActive   = "active"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// windowBuckets is how many buckets the rolling window is counted in.
+const windowBuckets = 10
+
+// ProviderSource lists the configured providers.
+type ProviderSource interface {
+	LoadProviders(ctx context.Context) ([]model.Provider, error)
+}
+
+// StatusStore persists provider status changes.
+type StatusStore interface {
+	// SetProviderStatus changes the status of a provider from `from` to
+	// `to`, with reason as its status reason, and reports whether it did.
+	// It leaves the provider as it is when its status is no longer from,
+	// or when an administrator set it to something other than active.
+	SetProviderStatus(ctx context.Context, providerID, from, to string, reason *string) (bool, error)
+}
+
+// Config holds the breaker thresholds.
+type Config struct {
+	// Window is how far back failure rates are computed.
+	Window time.Duration
+	// MinCalls is how many calls a window needs before a circuit can open.
+	MinCalls int
+	// FailureRate is the share of failed calls in the window, timeouts
+	// included, that opens a circuit.
+	FailureRate float64
+	// Cooldown is how long a circuit stays open before calls are tried
+	// again.
+	Cooldown time.Duration
+	// HalfOpenSuccesses is how many successful calls close a half-open
+	// circuit.
+	HalfOpenSuccesses int
+}
+
+// DefaultConfig returns sensible defaults.
+func DefaultConfig() Config {
+	return Config{
+		Window:            time.Minute,
+		MinCalls:          10,
+		FailureRate:       0.5,
+		Cooldown:          30 * time.Second,
+		HalfOpenSuccesses: 3,
+	}
+}
+
+// counts are the outcomes of calls in a window.
+type counts struct {
+	calls, failures, timeouts int
+}
+
+// window counts call outcomes over a rolling period, in buckets so old
+// outcomes expire without being stored one by one.
+type window struct {
+	width   time.Duration
+	buckets [windowBuckets]bucket
+}
+
+// bucket counts the outcomes of one slice of a window, numbered by epoch.
+type bucket struct {
+	epoch int64
+	counts
+}
+
+func (w *window) add(now time.Time, failed, timedOut bool) {
+	epoch := now.UnixNano() / int64(w.width)
+	b := &w.buckets[epoch%windowBuckets]
+	if b.epoch != epoch {
+		b.epoch, b.counts = epoch, counts{}
+	}
+	b.calls++
+	if failed {
+		b.failures++
+	}
+	if timedOut {
+		b.timeouts++
+	}
+}
+
+func (w *window) sum(now time.Time) counts {
+	epoch := now.UnixNano() / int64(w.width)
+	var total counts
+	for _, b := range w.buckets {
+		if epoch-b.epoch < windowBuckets {
+			total.calls += b.calls
+			total.failures += b.failures
+			total.timeouts += b.timeouts
+		}
+	}
+	return total
+}
+
+// breaker is the circuit of a provider or of one model on it.
+type breaker struct {
+	state     State
+	openedAt  time.Time
+	successes int // successful calls since the circuit half-opened
+	reason    string
+	window    window
+}
+
+// modelKey identifies a model circuit.
+type modelKey struct {
+	providerID, modelID string
+}
+
+// Breakers tracks a circuit per provider and per model. A provider's
+// circuit counts the calls on all of its models, so an outage opens it
+// whichever models the traffic goes to; a model's circuit catches a
+// model failing on a provider that otherwise answers.
+//
+// Breakers only see this instance's calls. The status of the providers
+// is where instances meet: Sync persists each provider's status as down
+// while its circuit is open, degraded while it or one of its models is
+// recovering or open, and active otherwise, and adopts the outages other
+// instances persisted.
+type Breakers struct {
+	cfg       Config
+	providers ProviderSource
+	store     StatusStore
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*breaker
+	models   map[modelKey]*breaker
+	// persisted is the status each provider had when last synced, or was
+	// last set to.
+	persisted map[string]string
+}
+
+func New(cfg Config, providers ProviderSource, store StatusStore, logger *slog.Logger) *Breakers {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	return &Breakers{
+		cfg:       cfg,
+		providers: providers,
+		store:     store,
+		logger:    logger,
+		now:       time.Now,
+		circuits:  make(map[string]*breaker),
+		models:    make(map[modelKey]*breaker),
+		persisted: make(map[string]string),
+	}
+}
+
+// Record counts the outcome of a call on a model, err being nil for a
+// success. Failures that are down to the request, such as a prompt too
+// long for the model, and calls the client abandoned are not counted.
+func (b *Breakers) Record(providerID, modelID string, err error) {
+	if b == nil {
+		return
+	}
+	failed, timedOut, counted := outcome(err)
+	if !counted {
+		return
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.record(b.circuit(providerID), "provider "+providerID, now, failed, timedOut)
+	b.record(b.model(providerID, modelID), "model "+modelID+" on provider "+providerID, now, failed, timedOut)
+}
+
+// Open reports whether calls on a model should be skipped, because its
+// circuit or its provider's is open.
+func (b *Breakers) Open(providerID, modelID string) bool {
+	if b == nil {
+		return false
+	}
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.circuits[providerID]; ok && b.state(c, now) == Open {
+		return true
+	}
+	c, ok := b.models[modelKey{providerID, modelID}]
+	return ok && b.state(c, now) == Open
+}
+
+// Run syncs provider statuses every interval until ctx ends.
+func (b *Breakers) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Sync(ctx)
+		}
+	}
+}
+
+// Sync persists the status of every provider whose circuits changed
+// state, and opens the circuit of providers another instance marked as
+// down. Statuses an administrator set are left alone, except active.
+func (b *Breakers) Sync(ctx context.Context) {
+	providers, err := b.providers.LoadProviders(ctx)
+	if err != nil {
+		b.logger.Warn("load providers for circuit status", "error", err)
+		return
+	}
+	for _, prov := range providers {
+		now := b.now()
+		b.mu.Lock()
+		if prov.Status != b.persisted[prov.ID] {
+			if prov.StatusReason != nil {
+				b.adopt(prov, now)
+			}
+			b.persisted[prov.ID] = prov.Status
+		}
+		to, reason := b.status(prov.ID, now)
+		b.mu.Unlock()
+
+		if to == prov.Status || (prov.Status != StatusActive && prov.StatusReason == nil) {
+			continue
+		}
+		var reasonPtr *string
+		if reason != "" {
+			reasonPtr = &reason
+		}
+		changed, err := b.store.SetProviderStatus(ctx, prov.ID, prov.Status, to, reasonPtr)
+		if err != nil {
+			b.logger.Warn("set provider status", "provider", prov.Name, "status", to, "error", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		b.mu.Lock()
+		b.persisted[prov.ID] = to
+		b.mu.Unlock()
+		b.logger.Info("provider status changed", "provider", prov.Name, "from", prov.Status, "to", to, "reason", reason)
+	}
+}
+
+// adopt brings a provider's circuit in line with a status another
+// instance persisted: down opens it and degraded has it prove itself
+// again. The caller holds b.mu.
+func (b *Breakers) adopt(prov model.Provider, now time.Time) {
+	c := b.circuit(prov.ID)
+	switch state := b.state(c, now); {
+	case prov.Status == StatusDown && state != Open:
+		c.open(now, *prov.StatusReason)
+		b.logger.Warn("circuit opened by provider status", "circuit", "provider "+prov.ID, "reason", c.reason)
+	case prov.Status == StatusDegraded && state == Closed:
+		c.halfOpen()
+	}
+}
+
+// status returns the status a provider should have and why. The caller
+// holds b.mu.
+func (b *Breakers) status(providerID string, now time.Time) (string, string) {
+	if c, ok := b.circuits[providerID]; ok {
+		switch b.state(c, now) {
+		case Open:
+			return StatusDown, c.reason
+		case HalfOpen:
+			return StatusDegraded, "circuit half-open, trying calls again"
+		}
+	}
+	for key, c := range b.models {
+		if key.providerID != providerID {
+			continue
+		}
+		switch b.state(c, now) {
+		case Open:
+			return StatusDegraded, "model " + key.modelID + " " + c.reason
+		case HalfOpen:
+			return StatusDegraded, "model " + key.modelID + " circuit half-open, trying calls again"
+		}
+	}
+	return StatusActive, ""
+}
+
+func (b *Breakers) circuit(providerID string) *breaker {
+	c, ok := b.circuits[providerID]
+	if !ok {
+		c = &breaker{window: window{width: b.cfg.Window / windowBuckets}}
+		b.circuits[providerID] = c
+	}
+	return c
+}
+
+func (b *Breakers) model(providerID, modelID string) *breaker {
+	key := modelKey{providerID, modelID}
+	c, ok := b.models[key]
+	if !ok {
+		c = &breaker{window: window{width: b.cfg.Window / windowBuckets}}
+		b.models[key] = c
+	}
+	return c
+}
+
+// state returns the state of a circuit, half-opening it once its cooldown
+// has passed. The caller holds b.mu.
+func (b *Breakers) state(c *breaker, now time.Time) State {
+	if c.state == Open && now.Sub(c.openedAt) >= b.cfg.Cooldown {
+		c.halfOpen()
+	}
+	return c.state
+}
+
+// record counts a call outcome on a circuit and moves it to the state the
+// outcome calls for. The caller holds b.mu.
+func (b *Breakers) record(c *breaker, name string, now time.Time, failed, timedOut bool) {
+	switch b.state(c, now) {
+	case Open:
+		// Calls that started before the circuit opened.
+	case HalfOpen:
+		if failed {
+			c.open(now, "circuit open: a call failed while half-open")
+			b.logger.Warn("circuit reopened", "circuit", name)
+			return
+		}
+		if c.successes++; c.successes >= b.cfg.HalfOpenSuccesses {
+			c.close()
+			b.logger.Info("circuit closed", "circuit", name)
+		}
+	case Closed:
+		c.window.add(now, failed, timedOut)
+		if !failed {
+			return
+		}
+		n := c.window.sum(now)
+		if n.calls >= b.cfg.MinCalls && float64(n.failures) >= b.cfg.FailureRate*float64(n.calls) {
+			c.open(now, fmt.Sprintf("circuit open: %d of %d calls failed (%d timed out) in the last %v",
+				n.failures, n.calls, n.timeouts, b.cfg.Window))
+			b.logger.Warn("circuit opened", "circuit", name, "reason", c.reason)
+		}
+	}
+}
+
+func (c *breaker) open(now time.Time, reason string) {
+	c.state, c.openedAt, c.reason = Open, now, reason
+	c.successes = 0
+	c.window = window{width: c.window.width}
+}
+
+func (c *breaker) halfOpen() {
+	c.state, c.successes = HalfOpen, 0
+}
+
+func (c *breaker) close() {
+	c.state, c.successes, c.reason = Closed, 0, ""
+}
+
+// outcome classifies the result of a call. counted is false for failures
+// that say nothing about the provider's health.
+func outcome(err error) (failed, timedOut, counted bool) {
+	if err == nil {
+		return false, false, true
+	}
+	if errors.Is(err, context.Canceled) {
+		return false, false, false
+	}
+	var pe *provider.ProviderError
+	if errors.As(err, &pe) {
+		switch pe.Kind {
+		case provider.KindBadRequest, provider.KindContextLength, provider.KindContentFilter:
+			return false, false, false
+		case provider.KindTimeout:
+			return true, true, true
+		}
+	}
+	return true, errors.Is(err, context.DeadlineExceeded), true
+}
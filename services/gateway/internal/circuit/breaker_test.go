@@ -0,0 +1,206 @@
+package circuit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+var (
+	errOverloaded = &provider.ProviderError{Kind: provider.KindOverloaded, Status: 529, Retryable: true}
+	errTimeout    = &provider.ProviderError{Kind: provider.KindTimeout, Retryable: true}
+)
+
+// fakeStore keeps provider statuses in memory, like the database does.
+type fakeStore struct {
+	mu        sync.Mutex
+	providers map[string]*model.Provider
+}
+
+func newFakeStore(providers ...model.Provider) *fakeStore {
+	s := &fakeStore{providers: make(map[string]*model.Provider)}
+	for _, p := range providers {
+		s.providers[p.ID] = &p
+	}
+	return s
+}
+
+func (s *fakeStore) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Provider
+	for _, p := range s.providers {
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
+func (s *fakeStore) SetProviderStatus(ctx context.Context, providerID, from, to string, reason *string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.providers[providerID]
+	if p.Status != from || (p.Status != StatusActive && p.StatusReason == nil) {
+		return false, nil
+	}
+	p.Status, p.StatusReason = to, reason
+	return true, nil
+}
+
+func (s *fakeStore) status(providerID string) (string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.providers[providerID]
+	if p.StatusReason == nil {
+		return p.Status, ""
+	}
+	return p.Status, *p.StatusReason
+}
+
+func newTestBreakers(store *fakeStore) (*Breakers, *time.Time) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	b := New(Config{
+		Window:            time.Minute,
+		MinCalls:          4,
+		FailureRate:       0.5,
+		Cooldown:          30 * time.Second,
+		HalfOpenSuccesses: 2,
+	}, store, store, nil)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func record(b *Breakers, providerID, modelID string, errs ...error) {
+	for _, err := range errs {
+		b.Record(providerID, modelID, err)
+	}
+}
+
+func TestBreakers_OpenHalfOpenClose(t *testing.T) {
+	b, now := newTestBreakers(nil)
+
+	record(b, "openai", "gpt-4o", nil, nil, errOverloaded)
+	if b.Open("openai", "gpt-4o") {
+		t.Fatal("opened below the failure rate")
+	}
+	record(b, "openai", "gpt-4o", errTimeout)
+	if !b.Open("openai", "gpt-4o") || !b.Open("openai", "gpt-4o-mini") {
+		t.Fatal("provider circuit not open at the failure rate")
+	}
+	if b.Open("anthropic", "claude-sonnet") {
+		t.Error("opened another provider's circuit")
+	}
+
+	*now = now.Add(30 * time.Second)
+	if b.Open("openai", "gpt-4o") {
+		t.Fatal("still open after the cooldown")
+	}
+	record(b, "openai", "gpt-4o", nil, errOverloaded)
+	if !b.Open("openai", "gpt-4o") {
+		t.Fatal("half-open circuit not reopened by a failure")
+	}
+
+	*now = now.Add(30 * time.Second)
+	record(b, "openai", "gpt-4o", nil, nil)
+	record(b, "openai", "gpt-4o", errOverloaded, errOverloaded, errOverloaded)
+	if b.Open("openai", "gpt-4o") {
+		t.Error("closed circuit reopened before the minimum number of calls")
+	}
+}
+
+func TestBreakers_ModelCircuit(t *testing.T) {
+	b, _ := newTestBreakers(nil)
+
+	for i := 0; i < 4; i++ {
+		record(b, "openai", "gpt-4o", nil, nil)
+		record(b, "openai", "o1", errOverloaded)
+	}
+	if !b.Open("openai", "o1") {
+		t.Error("failing model's circuit not open")
+	}
+	if b.Open("openai", "gpt-4o") {
+		t.Error("provider circuit opened by one failing model")
+	}
+}
+
+func TestBreakers_WindowExpires(t *testing.T) {
+	b, now := newTestBreakers(nil)
+
+	record(b, "openai", "gpt-4o", errOverloaded, errOverloaded, errOverloaded)
+	*now = now.Add(2 * time.Minute)
+	record(b, "openai", "gpt-4o", nil, nil, nil, errOverloaded)
+	if b.Open("openai", "gpt-4o") {
+		t.Error("counted failures from before the window")
+	}
+}
+
+func TestBreakers_IgnoresRequestFailures(t *testing.T) {
+	b, _ := newTestBreakers(nil)
+
+	for i := 0; i < 10; i++ {
+		record(b, "openai", "gpt-4o",
+			&provider.ProviderError{Kind: provider.KindContextLength, Status: 400},
+			&provider.ProviderError{Kind: provider.KindBadRequest, Status: 400},
+			fmt.Errorf("send request: %w", context.Canceled))
+	}
+	if b.Open("openai", "gpt-4o") {
+		t.Error("opened on failures down to the requests")
+	}
+
+	record(b, "openai", "gpt-4o", errors.New("connection reset"), fmt.Errorf("deadline: %w", context.DeadlineExceeded),
+		errOverloaded, errOverloaded)
+	if !b.Open("openai", "gpt-4o") {
+		t.Error("transport failures and timeouts did not open the circuit")
+	}
+}
+
+func TestBreakers_Sync(t *testing.T) {
+	store := newFakeStore(
+		model.Provider{ID: "openai", Name: "openai", Status: StatusActive},
+		model.Provider{ID: "ollama", Name: "ollama", Status: StatusDegraded},
+	)
+	b, now := newTestBreakers(store)
+	ctx := context.Background()
+
+	record(b, "openai", "gpt-4o", errTimeout, errTimeout, errOverloaded, errOverloaded)
+	record(b, "ollama", "llama3.2", errOverloaded, errOverloaded, errOverloaded, errOverloaded)
+	b.Sync(ctx)
+	status, reason := store.status("openai")
+	if status != StatusDown || !strings.Contains(reason, "4 of 4 calls failed (2 timed out)") {
+		t.Errorf("openai = %s (%s), want down with the failure counts", status, reason)
+	}
+	if status, _ := store.status("ollama"); status != StatusDegraded {
+		t.Errorf("ollama = %s, want the status the administrator set", status)
+	}
+
+	*now = now.Add(30 * time.Second)
+	b.Sync(ctx)
+	if status, _ := store.status("openai"); status != StatusDegraded {
+		t.Errorf("openai = %s after the cooldown, want degraded", status)
+	}
+
+	record(b, "openai", "gpt-4o", nil, nil)
+	b.Sync(ctx)
+	if status, reason := store.status("openai"); status != StatusActive || reason != "" {
+		t.Errorf("openai = %s (%s) after recovering, want active without a reason", status, reason)
+	}
+
+	// Another instance saw the provider go down.
+	reason = "circuit open: 10 of 10 calls failed (10 timed out) in the last 1m0s"
+	if ok, _ := store.SetProviderStatus(ctx, "openai", StatusActive, StatusDown, &reason); !ok {
+		t.Fatal("could not mark openai down")
+	}
+	b.Sync(ctx)
+	if !b.Open("openai", "gpt-4o") {
+		t.Error("did not adopt the outage another instance persisted")
+	}
+	if status, _ := store.status("openai"); status != StatusDown {
+		t.Errorf("openai = %s, want it left down", status)
+	}
+}
@@ -3,39 +3,91 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Port            int
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	ShutdownTimeout time.Duration
-	DatabaseURL     string
-	ServiceRoleKey  string
-	MasterEncKey    string
-	MeterBatchSize  int
-	MeterFlushMs    int
-	LogLevel        string
-	LogJSON         bool
+	Port             int
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+	ShutdownTimeout  time.Duration
+	DrainDelay       time.Duration
+	UpgradeDrain     time.Duration
+	PIDFile          string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSClientCAFile  string
+	TLSClientAuth    string
+	DatabaseURL      string
+	ConfigFile       string
+	MeterFile        string
+	ServiceRoleKey   string
+	AdminToken       string
+	MasterEncKey     string
+	MeterBatchSize   int
+	MeterFlushMs     int
+	LogLevel         string
+	LogJSON          bool
+	BatchConcurrency int
+	ConfigResync     time.Duration
+	ProbeInterval    time.Duration
+	ModelSync        time.Duration
+	CircuitCooldown  time.Duration
+	ReadyMeterMax    int
+	OTLPEndpoint     string
+	OTLPHeaders      string
+	ServiceName      string
 }
 
 func Load() *Config {
 	return &Config{
-		Port:            envInt("GATEWAY_PORT", 8787),
-		ReadTimeout:     time.Duration(envInt("GATEWAY_READ_TIMEOUT_SEC", 30)) * time.Second,
-		WriteTimeout:    time.Duration(envInt("GATEWAY_WRITE_TIMEOUT_SEC", 120)) * time.Second,
-		ShutdownTimeout: time.Duration(envInt("GATEWAY_SHUTDOWN_TIMEOUT_SEC", 15)) * time.Second,
-		DatabaseURL:     envStr("DATABASE_URL", ""),
-		ServiceRoleKey:  envStr("SUPABASE_SERVICE_ROLE_KEY", ""),
-		MasterEncKey:    envStr("MASTER_ENCRYPTION_KEY", ""),
-		MeterBatchSize:  envInt("METER_BATCH_SIZE", 100),
-		MeterFlushMs:    envInt("METER_FLUSH_MS", 5000),
-		LogLevel:        envStr("LOG_LEVEL", "info"),
-		LogJSON:         envBool("LOG_JSON", true),
+		Port:             envInt("GATEWAY_PORT", 8787),
+		ReadTimeout:      time.Duration(envInt("GATEWAY_READ_TIMEOUT_SEC", 30)) * time.Second,
+		WriteTimeout:     time.Duration(envInt("GATEWAY_WRITE_TIMEOUT_SEC", 120)) * time.Second,
+		ShutdownTimeout:  time.Duration(envInt("GATEWAY_SHUTDOWN_TIMEOUT_SEC", 15)) * time.Second,
+		DrainDelay:       time.Duration(envInt("GATEWAY_DRAIN_DELAY_SEC", 5)) * time.Second,
+		UpgradeDrain:     time.Duration(envInt("GATEWAY_UPGRADE_DRAIN_SEC", 600)) * time.Second,
+		PIDFile:          envStr("GATEWAY_PID_FILE", ""),
+		TLSCertFile:      envStr("GATEWAY_TLS_CERT_FILE", ""),
+		TLSKeyFile:       envStr("GATEWAY_TLS_KEY_FILE", ""),
+		TLSClientCAFile:  envStr("GATEWAY_TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:    envStr("GATEWAY_TLS_CLIENT_AUTH", "request"),
+		DatabaseURL:      envStr("DATABASE_URL", ""),
+		ConfigFile:       envStr("GATEWAY_CONFIG_FILE", ""),
+		MeterFile:        envStr("METER_FILE", "requests.jsonl"),
+		ServiceRoleKey:   envStr("SUPABASE_SERVICE_ROLE_KEY", ""),
+		AdminToken:       envStr("GATEWAY_ADMIN_TOKEN", ""),
+		MasterEncKey:     envStr("MASTER_ENCRYPTION_KEY", ""),
+		MeterBatchSize:   envInt("METER_BATCH_SIZE", 100),
+		MeterFlushMs:     envInt("METER_FLUSH_MS", 5000),
+		LogLevel:         envStr("LOG_LEVEL", "info"),
+		LogJSON:          envBool("LOG_JSON", true),
+		BatchConcurrency: envInt("BATCH_CONCURRENCY", 8),
+		ConfigResync:     time.Duration(envInt("CONFIG_RESYNC_SEC", 60)) * time.Second,
+		ProbeInterval:    time.Duration(envInt("PROVIDER_PROBE_SEC", 30)) * time.Second,
+		ModelSync:        time.Duration(envInt("MODEL_SYNC_SEC", 15)) * time.Second,
+		CircuitCooldown:  time.Duration(envInt("CIRCUIT_COOLDOWN_SEC", 30)) * time.Second,
+		ReadyMeterMax:    envInt("READY_METER_BACKLOG", 10000),
+		OTLPEndpoint:     otlpTracesEndpoint(),
+		OTLPHeaders:      envStr("OTEL_EXPORTER_OTLP_HEADERS", ""),
+		ServiceName:      envStr("OTEL_SERVICE_NAME", "openfive-gateway"),
 	}
 }
 
+// otlpTracesEndpoint returns the OTLP/HTTP traces URL. A signal-specific
+// endpoint is used as is; the generic endpoint gets /v1/traces appended,
+// as the OpenTelemetry SDKs do. Empty disables trace export.
+func otlpTracesEndpoint() string {
+	if v := envStr("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""); v != "" {
+		return v
+	}
+	if v := envStr("OTEL_EXPORTER_OTLP_ENDPOINT", ""); v != "" {
+		return strings.TrimRight(v, "/") + "/v1/traces"
+	}
+	return ""
+}
+
 func envStr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -13,13 +13,32 @@ func TestLoad_DefaultValues(t *testing.T) {
 		"GATEWAY_READ_TIMEOUT_SEC",
 		"GATEWAY_WRITE_TIMEOUT_SEC",
 		"GATEWAY_SHUTDOWN_TIMEOUT_SEC",
+		"GATEWAY_DRAIN_DELAY_SEC",
+		"GATEWAY_UPGRADE_DRAIN_SEC",
+		"GATEWAY_PID_FILE",
+		"GATEWAY_TLS_CERT_FILE",
+		"GATEWAY_TLS_KEY_FILE",
+		"GATEWAY_TLS_CLIENT_CA_FILE",
+		"GATEWAY_TLS_CLIENT_AUTH",
 		"DATABASE_URL",
+		"GATEWAY_CONFIG_FILE",
+		"METER_FILE",
 		"SUPABASE_SERVICE_ROLE_KEY",
+		"GATEWAY_ADMIN_TOKEN",
+		"CONFIG_RESYNC_SEC",
+		"PROVIDER_PROBE_SEC",
+		"MODEL_SYNC_SEC",
+		"CIRCUIT_COOLDOWN_SEC",
+		"READY_METER_BACKLOG",
 		"MASTER_ENCRYPTION_KEY",
 		"METER_BATCH_SIZE",
 		"METER_FLUSH_MS",
 		"LOG_LEVEL",
 		"LOG_JSON",
+		"BATCH_CONCURRENCY",
+		"OTEL_EXPORTER_OTLP_ENDPOINT",
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+		"OTEL_SERVICE_NAME",
 	}
 	savedVals := make(map[string]string)
 	for _, key := range envVars {
@@ -48,12 +67,36 @@ func TestLoad_DefaultValues(t *testing.T) {
 	if cfg.ShutdownTimeout != 15*time.Second {
 		t.Errorf("default ShutdownTimeout = %v, want 15s", cfg.ShutdownTimeout)
 	}
+	if cfg.DrainDelay != 5*time.Second {
+		t.Errorf("default DrainDelay = %v, want 5s", cfg.DrainDelay)
+	}
+	if cfg.UpgradeDrain != 600*time.Second {
+		t.Errorf("default UpgradeDrain = %v, want 600s", cfg.UpgradeDrain)
+	}
+	if cfg.PIDFile != "" {
+		t.Errorf("default PIDFile = %q, want \"\"", cfg.PIDFile)
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" || cfg.TLSClientCAFile != "" {
+		t.Errorf("default TLS files = %q, %q, %q, want none", cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+	}
+	if cfg.TLSClientAuth != "request" {
+		t.Errorf("default TLSClientAuth = %q, want \"request\"", cfg.TLSClientAuth)
+	}
 	if cfg.DatabaseURL != "" {
 		t.Errorf("default DatabaseURL = %q, want \"\"", cfg.DatabaseURL)
 	}
+	if cfg.ConfigFile != "" {
+		t.Errorf("default ConfigFile = %q, want \"\"", cfg.ConfigFile)
+	}
+	if cfg.MeterFile != "requests.jsonl" {
+		t.Errorf("default MeterFile = %q, want \"requests.jsonl\"", cfg.MeterFile)
+	}
 	if cfg.ServiceRoleKey != "" {
 		t.Errorf("default ServiceRoleKey = %q, want \"\"", cfg.ServiceRoleKey)
 	}
+	if cfg.AdminToken != "" {
+		t.Errorf("default AdminToken = %q, want \"\"", cfg.AdminToken)
+	}
 	if cfg.MasterEncKey != "" {
 		t.Errorf("default MasterEncKey = %q, want \"\"", cfg.MasterEncKey)
 	}
@@ -69,6 +112,46 @@ func TestLoad_DefaultValues(t *testing.T) {
 	if cfg.LogJSON != true {
 		t.Errorf("default LogJSON = %v, want true", cfg.LogJSON)
 	}
+	if cfg.BatchConcurrency != 8 {
+		t.Errorf("default BatchConcurrency = %d, want 8", cfg.BatchConcurrency)
+	}
+	if cfg.ConfigResync != 60*time.Second {
+		t.Errorf("default ConfigResync = %v, want 60s", cfg.ConfigResync)
+	}
+	if cfg.ProbeInterval != 30*time.Second {
+		t.Errorf("default ProbeInterval = %v, want 30s", cfg.ProbeInterval)
+	}
+	if cfg.ModelSync != 15*time.Second {
+		t.Errorf("default ModelSync = %v, want 15s", cfg.ModelSync)
+	}
+	if cfg.CircuitCooldown != 30*time.Second {
+		t.Errorf("default CircuitCooldown = %v, want 30s", cfg.CircuitCooldown)
+	}
+	if cfg.ReadyMeterMax != 10000 {
+		t.Errorf("default ReadyMeterMax = %d, want 10000", cfg.ReadyMeterMax)
+	}
+	if cfg.OTLPEndpoint != "" {
+		t.Errorf("default OTLPEndpoint = %q, want \"\"", cfg.OTLPEndpoint)
+	}
+	if cfg.ServiceName != "openfive-gateway" {
+		t.Errorf("default ServiceName = %q, want \"openfive-gateway\"", cfg.ServiceName)
+	}
+}
+
+func TestLoad_OTLPEndpoint(t *testing.T) {
+	os.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+
+	if got := Load().OTLPEndpoint; got != "http://collector:4318/v1/traces" {
+		t.Errorf("OTLPEndpoint = %q, want the generic endpoint plus /v1/traces", got)
+	}
+
+	os.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318/custom")
+	defer os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+
+	if got := Load().OTLPEndpoint; got != "http://traces:4318/custom" {
+		t.Errorf("OTLPEndpoint = %q, want the traces endpoint as is", got)
+	}
 }
 
 func TestLoad_OverrideWithEnvVars(t *testing.T) {
@@ -0,0 +1,485 @@
+// Package configcache keeps the gateway's configuration (API keys,
+// environments, routes, models and providers) in memory, so requests are
+// served without per-request queries. Changes arrive through Postgres
+// LISTEN/NOTIFY; a periodic full resync covers missed notifications.
+package configcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// Channel is the NOTIFY channel the config triggers publish on.
+const Channel = "gateway_config"
+
+// Tables tracked by the cache, as named in notification payloads.
+const (
+	tableAPIKeys      = "api_keys"
+	tableEnvironments = "environments"
+	tableRoutes       = "routes"
+	tableModels       = "models"
+	tableProviders    = "providers"
+
+	// tableProjects is not cached, but environments carry their project's
+	// organization, so a project moving organizations reloads them.
+	tableProjects = "projects"
+)
+
+var allTables = []string{tableAPIKeys, tableEnvironments, tableRoutes, tableModels, tableProviders}
+
+const (
+	// coalesceDelay groups notifications from one dashboard save into a
+	// single reload.
+	coalesceDelay = 50 * time.Millisecond
+	loadTimeout   = 10 * time.Second
+	maxBackoff    = 30 * time.Second
+)
+
+// ErrNotFound is returned for entities missing from the snapshot.
+var ErrNotFound = errors.New("not found")
+
+// Source loads whole tables and delivers change notifications.
+type Source interface {
+	LoadAPIKeys(ctx context.Context) ([]model.APIKey, error)
+	LoadEnvironments(ctx context.Context) ([]model.Environment, error)
+	LoadRoutes(ctx context.Context) ([]model.Route, error)
+	LoadModels(ctx context.Context) ([]model.ModelInfo, error)
+	LoadProviders(ctx context.Context) ([]model.Provider, error)
+	Listen(ctx context.Context, channel string, ready func(), notify func(payload string)) error
+}
+
+// Cache is an in-memory snapshot of the gateway configuration. Lookups
+// return shallow copies: callers may set the fields of what they get, but
+// the maps and slices in it (scopes, fallback chains, guardrail settings,
+// metadata and the like) are shared with the snapshot and are read-only.
+type Cache struct {
+	source Source
+	logger *slog.Logger
+	resync time.Duration
+
+	mu           sync.RWMutex
+	keys         map[string]*model.APIKey // by key hash
+	keysByID     map[string]*model.APIKey
+	previousKeys map[string]*model.APIKey // by previous key hash
+	certKeys     map[string]*model.APIKey // by client certificate identity
+	environments map[string]*model.Environment
+	routes       map[string]map[string]*model.Route // by environment ID, then slug
+	routesByID   map[string]*model.Route
+	models       []model.ModelInfo
+	providers    map[string]*model.Provider
+	syncedAt     time.Time
+
+	dirtyMu sync.Mutex
+	dirty   map[string]bool
+	wake    chan struct{}
+}
+
+// New returns an empty cache; call Load before serving and Run to keep it
+// current. resync is the interval between full reloads.
+func New(source Source, logger *slog.Logger, resync time.Duration) *Cache {
+	return &Cache{
+		source:       source,
+		logger:       logger,
+		resync:       resync,
+		keys:         make(map[string]*model.APIKey),
+		keysByID:     make(map[string]*model.APIKey),
+		previousKeys: make(map[string]*model.APIKey),
+		certKeys:     make(map[string]*model.APIKey),
+		environments: make(map[string]*model.Environment),
+		routes:       make(map[string]map[string]*model.Route),
+		routesByID:   make(map[string]*model.Route),
+		providers:    make(map[string]*model.Provider),
+		dirty:        make(map[string]bool),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Load reads every table.
+func (c *Cache) Load(ctx context.Context) error {
+	for _, table := range allTables {
+		if err := c.loadTable(ctx, table); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.syncedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// SyncedAt returns when the last full load completed, or the zero time
+// if none has.
+func (c *Cache) SyncedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.syncedAt
+}
+
+// Run applies change notifications and resyncs periodically until ctx
+// ends.
+func (c *Cache) Run(ctx context.Context) {
+	go c.listen(ctx)
+
+	ticker := time.NewTicker(c.resync)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.sync(ctx)
+		case <-c.wake:
+			select {
+			case <-time.After(coalesceDelay):
+			case <-ctx.Done():
+				return
+			}
+			c.reload(ctx, c.takeDirty())
+		}
+	}
+}
+
+// listen keeps the notification subscription open, reconnecting with
+// backoff. Every (re)connect triggers a full reload, since changes made
+// while disconnected were not announced.
+func (c *Cache) listen(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := c.source.Listen(ctx, Channel, func() {
+			backoff = time.Second
+			c.markDirty(allTables...)
+		}, c.notify)
+		if ctx.Err() != nil {
+			return
+		}
+		c.logger.Warn("config listener disconnected", "error", err, "retry_in", backoff.String())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// notification is the payload sent by the notify_gateway_config trigger.
+type notification struct {
+	Table         string   `json:"table"`
+	Op            string   `json:"op"`
+	ID            string   `json:"id"`
+	BudgetUsedUSD *float64 `json:"budget_used_usd"`
+}
+
+func (c *Cache) notify(payload string) {
+	var n notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil {
+		c.logger.Warn("invalid config notification", "payload", payload, "error", err)
+		return
+	}
+	if n.Op == "BUDGET" && n.BudgetUsedUSD != nil {
+		c.mu.Lock()
+		if env, ok := c.environments[n.ID]; ok {
+			env.BudgetUsedUSD = *n.BudgetUsedUSD
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.logger.Debug("config changed", "table", n.Table, "op", n.Op, "id", n.ID)
+	if n.Table == tableProjects {
+		c.markDirty(tableEnvironments)
+		return
+	}
+	c.markDirty(n.Table)
+}
+
+func (c *Cache) markDirty(tables ...string) {
+	c.dirtyMu.Lock()
+	for _, t := range tables {
+		c.dirty[t] = true
+	}
+	c.dirtyMu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Cache) takeDirty() []string {
+	c.dirtyMu.Lock()
+	defer c.dirtyMu.Unlock()
+	var tables []string
+	for _, t := range allTables {
+		if c.dirty[t] {
+			tables = append(tables, t)
+		}
+	}
+	c.dirty = make(map[string]bool)
+	return tables
+}
+
+// sync reloads every table, keeping the previous data on failure.
+func (c *Cache) sync(ctx context.Context) {
+	if err := c.Load(ctx); err != nil {
+		c.logger.Error("config resync failed", "error", err)
+	}
+}
+
+func (c *Cache) reload(ctx context.Context, tables []string) {
+	for _, table := range tables {
+		if err := c.loadTable(ctx, table); err != nil {
+			c.logger.Error("config reload failed", "table", table, "error", err)
+		}
+	}
+}
+
+func (c *Cache) loadTable(ctx context.Context, table string) error {
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	switch table {
+	case tableAPIKeys:
+		keys, err := c.source.LoadAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		c.setAPIKeys(keys)
+	case tableEnvironments:
+		envs, err := c.source.LoadEnvironments(ctx)
+		if err != nil {
+			return err
+		}
+		c.setEnvironments(envs)
+	case tableRoutes:
+		routes, err := c.source.LoadRoutes(ctx)
+		if err != nil {
+			return err
+		}
+		c.setRoutes(routes)
+	case tableModels:
+		models, err := c.source.LoadModels(ctx)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.models = models
+		c.mu.Unlock()
+	case tableProviders:
+		providers, err := c.source.LoadProviders(ctx)
+		if err != nil {
+			return err
+		}
+		c.setProviders(providers)
+	default:
+		return fmt.Errorf("unknown config table %q", table)
+	}
+	return nil
+}
+
+func (c *Cache) setAPIKeys(keys []model.APIKey) {
+	byHash := make(map[string]*model.APIKey, len(keys))
+	byID := make(map[string]*model.APIKey, len(keys))
+	byPrevious := make(map[string]*model.APIKey)
+	byCert := make(map[string]*model.APIKey)
+	for i := range keys {
+		key := &keys[i]
+		byHash[key.KeyHash] = key
+		byID[key.ID] = key
+		if key.PreviousHash != nil {
+			byPrevious[*key.PreviousHash] = key
+		}
+		for _, id := range key.CertIdentities {
+			byCert[id] = key
+		}
+	}
+	c.mu.Lock()
+	c.keys, c.keysByID, c.previousKeys, c.certKeys = byHash, byID, byPrevious, byCert
+	c.mu.Unlock()
+}
+
+func (c *Cache) setEnvironments(envs []model.Environment) {
+	byID := make(map[string]*model.Environment, len(envs))
+	for i := range envs {
+		byID[envs[i].ID] = &envs[i]
+	}
+	c.mu.Lock()
+	c.environments = byID
+	c.mu.Unlock()
+}
+
+func (c *Cache) setRoutes(routes []model.Route) {
+	bySlug := make(map[string]map[string]*model.Route)
+	byID := make(map[string]*model.Route, len(routes))
+	for i := range routes {
+		route := &routes[i]
+		if bySlug[route.EnvironmentID] == nil {
+			bySlug[route.EnvironmentID] = make(map[string]*model.Route)
+		}
+		bySlug[route.EnvironmentID][route.Slug] = route
+		byID[route.ID] = route
+	}
+	c.mu.Lock()
+	c.routes, c.routesByID = bySlug, byID
+	c.mu.Unlock()
+}
+
+func (c *Cache) setProviders(providers []model.Provider) {
+	byID := make(map[string]*model.Provider, len(providers))
+	for i := range providers {
+		byID[providers[i].ID] = &providers[i]
+	}
+	c.mu.Lock()
+	c.providers = byID
+	c.mu.Unlock()
+}
+
+// FindByHash looks up an active API key by its hash.
+func (c *Cache) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[hash]
+	if !ok {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// FindByID looks up an active API key by its ID.
+func (c *Cache) FindByID(ctx context.Context, keyID string) (*model.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keysByID[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// FindByPreviousHash looks up a key by its previous hash while the
+// rotation grace period lasts.
+func (c *Cache) FindByPreviousHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.previousKeys[hash]
+	if !ok || key.PreviousValidUntil == nil || !time.Now().Before(*key.PreviousValidUntil) {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// FindByCertIdentity looks up an active API key by a client certificate
+// identity.
+func (c *Cache) FindByCertIdentity(ctx context.Context, identity string) (*model.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.certKeys[identity]
+	if !ok {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// LoadEnvironment returns an environment by ID.
+func (c *Cache) LoadEnvironment(ctx context.Context, envID string) (*model.Environment, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	env, ok := c.environments[envID]
+	if !ok {
+		return nil, fmt.Errorf("environment %w", ErrNotFound)
+	}
+	e := *env
+	return &e, nil
+}
+
+// LoadRoute returns an active route by environment and slug.
+func (c *Cache) LoadRoute(ctx context.Context, envID, slug string) (*model.Route, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	route, ok := c.routes[envID][slug]
+	if !ok {
+		return nil, fmt.Errorf("route %w", ErrNotFound)
+	}
+	r := *route
+	return &r, nil
+}
+
+// LoadRouteByID returns an active route by ID, scoped to an environment.
+func (c *Cache) LoadRouteByID(ctx context.Context, envID, routeID string) (*model.Route, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	route, ok := c.routesByID[routeID]
+	if !ok || route.EnvironmentID != envID {
+		return nil, fmt.Errorf("route %w", ErrNotFound)
+	}
+	r := *route
+	return &r, nil
+}
+
+// LoadRoutesForEnv returns the active routes of an environment, sorted by
+// slug.
+func (c *Cache) LoadRoutesForEnv(ctx context.Context, envID string) ([]model.Route, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var routes []model.Route
+	for _, route := range c.routesByID {
+		if route.EnvironmentID == envID {
+			routes = append(routes, *route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Slug < routes[j].Slug })
+	return routes, nil
+}
+
+// LoadModelsForEnv returns the active models of providers that are not
+// down and belong to the organization or are shared.
+func (c *Cache) LoadModelsForEnv(ctx context.Context, orgID string) ([]model.ModelInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var models []model.ModelInfo
+	for _, m := range c.models {
+		prov, ok := c.providers[m.ProviderID]
+		if !ok || prov.Status == "down" {
+			continue
+		}
+		if prov.OrganizationID != nil && *prov.OrganizationID != orgID {
+			continue
+		}
+		models = append(models, m)
+	}
+	return models, nil
+}
+
+// LoadProvider returns a provider by ID.
+func (c *Cache) LoadProvider(ctx context.Context, providerID string) (*model.Provider, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	prov, ok := c.providers[providerID]
+	if !ok {
+		return nil, fmt.Errorf("provider %w", ErrNotFound)
+	}
+	p := *prov
+	return &p, nil
+}
+
+// LoadProviders returns every provider, sorted by ID.
+func (c *Cache) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	providers := make([]model.Provider, 0, len(c.providers))
+	for _, prov := range c.providers {
+		providers = append(providers, *prov)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+	return providers, nil
+}
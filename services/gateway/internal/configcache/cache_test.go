@@ -0,0 +1,221 @@
+package configcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/model"
+)
+
+type fakeSource struct {
+	mu        sync.Mutex
+	keys      []model.APIKey
+	envs      []model.Environment
+	routes    []model.Route
+	models    []model.ModelInfo
+	providers []model.Provider
+	loads     map[string]int
+
+	notifications chan string
+}
+
+func newFakeSource() *fakeSource {
+	org := "org-1"
+	other := "org-2"
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	prevLive, prevExpired := "prev-live", "prev-expired"
+	return &fakeSource{
+		keys: []model.APIKey{
+			{ID: "k1", EnvironmentID: "env-1", KeyHash: "h1", PreviousHash: &prevLive, PreviousValidUntil: &future, IsActive: true},
+			{ID: "k2", EnvironmentID: "env-1", KeyHash: "h2", PreviousHash: &prevExpired, PreviousValidUntil: &past, IsActive: true, CertIdentities: []string{"CN=agent"}},
+		},
+		envs: []model.Environment{{ID: "env-1", OrganizationID: org, BudgetUsedUSD: 1}},
+		routes: []model.Route{
+			{ID: "r2", EnvironmentID: "env-1", Slug: "support"},
+			{ID: "r1", EnvironmentID: "env-1", Slug: "default"},
+			{ID: "r3", EnvironmentID: "env-2", Slug: "default"},
+		},
+		models: []model.ModelInfo{
+			{ID: "m1", ProviderID: "shared", ModelID: "gpt-4o"},
+			{ID: "m2", ProviderID: "own", ModelID: "llama"},
+			{ID: "m3", ProviderID: "foreign", ModelID: "mistral"},
+			{ID: "m4", ProviderID: "down", ModelID: "claude"},
+		},
+		providers: []model.Provider{
+			{ID: "shared", Status: "active"},
+			{ID: "own", OrganizationID: &org, Status: "active"},
+			{ID: "foreign", OrganizationID: &other, Status: "active"},
+			{ID: "down", Status: "down"},
+		},
+		loads:         make(map[string]int),
+		notifications: make(chan string, 10),
+	}
+}
+
+func (f *fakeSource) count(table string) {
+	f.mu.Lock()
+	f.loads[table]++
+	f.mu.Unlock()
+}
+
+func (f *fakeSource) loadCount(table string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.loads[table]
+}
+
+func (f *fakeSource) LoadAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	f.count(tableAPIKeys)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.APIKey(nil), f.keys...), nil
+}
+
+func (f *fakeSource) LoadEnvironments(ctx context.Context) ([]model.Environment, error) {
+	f.count(tableEnvironments)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.Environment(nil), f.envs...), nil
+}
+
+func (f *fakeSource) LoadRoutes(ctx context.Context) ([]model.Route, error) {
+	f.count(tableRoutes)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.Route(nil), f.routes...), nil
+}
+
+func (f *fakeSource) LoadModels(ctx context.Context) ([]model.ModelInfo, error) {
+	f.count(tableModels)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.ModelInfo(nil), f.models...), nil
+}
+
+func (f *fakeSource) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	f.count(tableProviders)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.Provider(nil), f.providers...), nil
+}
+
+func (f *fakeSource) Listen(ctx context.Context, channel string, ready func(), notify func(payload string)) error {
+	ready()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case payload := <-f.notifications:
+			notify(payload)
+		}
+	}
+}
+
+func loaded(t *testing.T, src *fakeSource) *Cache {
+	t.Helper()
+	c := New(src, logging.Discard(), time.Hour)
+	if err := c.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCache_Lookups(t *testing.T) {
+	c := loaded(t, newFakeSource())
+	ctx := context.Background()
+
+	if key, err := c.FindByHash(ctx, "h1"); err != nil || key.ID != "k1" {
+		t.Errorf("FindByHash = %v, %v", key, err)
+	}
+	if _, err := c.FindByHash(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FindByHash(unknown) error = %v", err)
+	}
+	if key, err := c.FindByPreviousHash(ctx, "prev-live"); err != nil || key.ID != "k1" {
+		t.Errorf("FindByPreviousHash within grace = %v, %v", key, err)
+	}
+	if _, err := c.FindByPreviousHash(ctx, "prev-expired"); err == nil {
+		t.Error("previous hash accepted after the grace period")
+	}
+	if key, err := c.FindByCertIdentity(ctx, "CN=agent"); err != nil || key.ID != "k2" {
+		t.Errorf("FindByCertIdentity = %v, %v", key, err)
+	}
+
+	if route, err := c.LoadRoute(ctx, "env-1", "support"); err != nil || route.ID != "r2" {
+		t.Errorf("LoadRoute = %v, %v", route, err)
+	}
+	if _, err := c.LoadRouteByID(ctx, "env-1", "r3"); err == nil {
+		t.Error("LoadRouteByID returned a route of another environment")
+	}
+	routes, _ := c.LoadRoutesForEnv(ctx, "env-1")
+	if len(routes) != 2 || routes[0].Slug != "default" || routes[1].Slug != "support" {
+		t.Errorf("LoadRoutesForEnv = %+v", routes)
+	}
+
+	models, _ := c.LoadModelsForEnv(ctx, "org-1")
+	if len(models) != 2 || models[0].ID != "m1" || models[1].ID != "m2" {
+		t.Errorf("LoadModelsForEnv = %+v, want shared and own active providers only", models)
+	}
+
+	env, _ := c.LoadEnvironment(ctx, "env-1")
+	env.KillswitchActive = true
+	if again, _ := c.LoadEnvironment(ctx, "env-1"); again.KillswitchActive {
+		t.Error("caller modified the cached environment")
+	}
+}
+
+func TestCache_AppliesNotifications(t *testing.T) {
+	src := newFakeSource()
+	c := loaded(t, src)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// Connecting triggers a full reload.
+	waitFor(t, func() bool { return src.loadCount(tableRoutes) == 2 })
+
+	src.mu.Lock()
+	src.routes = append(src.routes, model.Route{ID: "r4", EnvironmentID: "env-1", Slug: "search"})
+	src.mu.Unlock()
+	src.notifications <- `{"table":"routes","op":"INSERT","id":"r4"}`
+	waitFor(t, func() bool {
+		_, err := c.LoadRoute(context.Background(), "env-1", "search")
+		return err == nil
+	})
+	if n := src.loadCount(tableAPIKeys); n != 2 {
+		t.Errorf("api_keys loaded %d times, want 2: a route change must not reload keys", n)
+	}
+
+	src.notifications <- `{"table":"environments","op":"BUDGET","id":"env-1","budget_used_usd":12.5}`
+	waitFor(t, func() bool {
+		env, _ := c.LoadEnvironment(context.Background(), "env-1")
+		return env.BudgetUsedUSD == 12.5
+	})
+	if n := src.loadCount(tableEnvironments); n != 2 {
+		t.Errorf("environments loaded %d times, want 2: budget updates apply without a query", n)
+	}
+
+	src.mu.Lock()
+	src.envs[0].OrganizationID = "org-2"
+	src.mu.Unlock()
+	src.notifications <- `{"table":"projects","op":"UPDATE","id":"proj-1"}`
+	waitFor(t, func() bool {
+		env, _ := c.LoadEnvironment(context.Background(), "env-1")
+		return env.OrganizationID == "org-2"
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
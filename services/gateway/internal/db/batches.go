@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// InsertBatchFile stores a file and fills in its ID and creation time.
+func (q *Queries) InsertBatchFile(ctx context.Context, f *model.BatchFile) error {
+	err := q.pool.QueryRow(ctx, `
+		INSERT INTO batch_files (environment_id, api_key_id, purpose, filename, bytes, content)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, f.EnvironmentID, f.APIKeyID, f.Purpose, f.Filename, f.Bytes, f.Content).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert batch file: %w", err)
+	}
+	return nil
+}
+
+// LoadBatchFile loads a file, scoped to an environment. The content is
+// only read when withContent is set.
+func (q *Queries) LoadBatchFile(ctx context.Context, envID, fileID string, withContent bool) (*model.BatchFile, error) {
+	row := q.pool.QueryRow(ctx, `
+		SELECT id, environment_id, api_key_id, purpose, filename, bytes,
+		       CASE WHEN $3 THEN content ELSE NULL END, created_at
+		FROM batch_files
+		WHERE environment_id = $1 AND id::text = $2
+	`, envID, fileID, withContent)
+
+	var f model.BatchFile
+	err := row.Scan(
+		&f.ID, &f.EnvironmentID, &f.APIKeyID, &f.Purpose, &f.Filename, &f.Bytes,
+		&f.Content, &f.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("batch file not found: %w", err)
+	}
+	return &f, nil
+}
+
+const batchColumns = `
+	id, environment_id, api_key_id, route_slug, endpoint,
+	input_file_id, output_file_id, error_file_id,
+	completion_window, status,
+	total_requests, completed_requests, failed_requests,
+	errors, metadata, created_at, expires_at,
+	in_progress_at, finalizing_at, completed_at, failed_at,
+	expired_at, cancelling_at, cancelled_at, lease_expires_at`
+
+func scanBatch(row pgx.Row) (*model.Batch, error) {
+	var b model.Batch
+	err := row.Scan(
+		&b.ID, &b.EnvironmentID, &b.APIKeyID, &b.RouteSlug, &b.Endpoint,
+		&b.InputFileID, &b.OutputFileID, &b.ErrorFileID,
+		&b.CompletionWindow, &b.Status,
+		&b.TotalRequests, &b.CompletedRequests, &b.FailedRequests,
+		&b.Errors, &b.Metadata, &b.CreatedAt, &b.ExpiresAt,
+		&b.InProgressAt, &b.FinalizingAt, &b.CompletedAt, &b.FailedAt,
+		&b.ExpiredAt, &b.CancellingAt, &b.CancelledAt, &b.LeaseExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// InsertBatch creates a batch and fills in its ID and creation time.
+func (q *Queries) InsertBatch(ctx context.Context, b *model.Batch) error {
+	err := q.pool.QueryRow(ctx, `
+		INSERT INTO batches (
+			environment_id, api_key_id, route_slug, endpoint, input_file_id,
+			completion_window, status, metadata, expires_at, lease_expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`,
+		b.EnvironmentID, b.APIKeyID, b.RouteSlug, b.Endpoint, b.InputFileID,
+		b.CompletionWindow, b.Status, b.Metadata, b.ExpiresAt, b.LeaseExpiresAt,
+	).Scan(&b.ID, &b.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert batch: %w", err)
+	}
+	return nil
+}
+
+// LoadBatch loads a batch, scoped to an environment.
+func (q *Queries) LoadBatch(ctx context.Context, envID, batchID string) (*model.Batch, error) {
+	b, err := scanBatch(q.pool.QueryRow(ctx, `
+		SELECT `+batchColumns+`
+		FROM batches
+		WHERE environment_id = $1 AND id::text = $2
+	`, envID, batchID))
+	if err != nil {
+		return nil, fmt.Errorf("batch not found: %w", err)
+	}
+	return b, nil
+}
+
+// ListBatches lists an environment's batches, newest first. When after is
+// set, listing starts after that batch.
+func (q *Queries) ListBatches(ctx context.Context, envID, after string, limit int) ([]model.Batch, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT `+batchColumns+`
+		FROM batches
+		WHERE environment_id = $1
+		  AND ($2 = '' OR created_at < (SELECT created_at FROM batches WHERE id::text = $2))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, envID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []model.Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan batch: %w", err)
+		}
+		batches = append(batches, *b)
+	}
+	return batches, rows.Err()
+}
+
+// UpdateBatch saves a batch's status, counts, output files, errors,
+// status timestamps and lease.
+func (q *Queries) UpdateBatch(ctx context.Context, b *model.Batch) error {
+	_, err := q.pool.Exec(ctx, `
+		UPDATE batches SET
+			status = $2,
+			total_requests = $3, completed_requests = $4, failed_requests = $5,
+			output_file_id = $6, error_file_id = $7, errors = $8,
+			in_progress_at = $9, finalizing_at = $10, completed_at = $11,
+			failed_at = $12, expired_at = $13, cancelling_at = $14, cancelled_at = $15,
+			lease_expires_at = $16
+		WHERE id = $1
+	`,
+		b.ID, b.Status,
+		b.TotalRequests, b.CompletedRequests, b.FailedRequests,
+		b.OutputFileID, b.ErrorFileID, b.Errors,
+		b.InProgressAt, b.FinalizingAt, b.CompletedAt,
+		b.FailedAt, b.ExpiredAt, b.CancellingAt, b.CancelledAt,
+		b.LeaseExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("update batch: %w", err)
+	}
+	return nil
+}
+
+// UpdateBatchProgress saves the request counts of a running batch, renews
+// its lease until leaseUntil and returns its current status, so that the
+// runner notices cancellations requested through another gateway instance.
+func (q *Queries) UpdateBatchProgress(ctx context.Context, batchID string, completed, failed int, leaseUntil time.Time) (string, error) {
+	var status string
+	err := q.pool.QueryRow(ctx, `
+		UPDATE batches SET completed_requests = $2, failed_requests = $3, lease_expires_at = $4
+		WHERE id = $1
+		RETURNING status
+	`, batchID, completed, failed, leaseUntil).Scan(&status)
+	if err != nil {
+		return "", fmt.Errorf("update batch progress: %w", err)
+	}
+	return status, nil
+}
+
+// ClaimBatches takes a lease until leaseUntil on the unfinished batches no
+// gateway holds, oldest first, and returns them. Rows another gateway is
+// claiming at the same time are skipped.
+func (q *Queries) ClaimBatches(ctx context.Context, leaseUntil time.Time) ([]model.Batch, error) {
+	rows, err := q.pool.Query(ctx, `
+		UPDATE batches SET lease_expires_at = $1
+		WHERE id IN (
+			SELECT id FROM batches
+			WHERE status IN ('validating', 'in_progress', 'finalizing', 'cancelling')
+			  AND (lease_expires_at IS NULL OR lease_expires_at < now())
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+batchColumns, leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("claim batches: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []model.Batch
+	for rows.Next() {
+		b, err := scanBatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan batch: %w", err)
+		}
+		batches = append(batches, *b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].CreatedAt.Before(batches[j].CreatedAt) })
+	return batches, nil
+}
+
+// CancelBatch moves a validating or running batch to cancelling. Batches
+// in any other status are returned unchanged.
+func (q *Queries) CancelBatch(ctx context.Context, envID, batchID string) (*model.Batch, error) {
+	b, err := scanBatch(q.pool.QueryRow(ctx, `
+		UPDATE batches SET status = 'cancelling', cancelling_at = now()
+		WHERE environment_id = $1 AND id::text = $2
+		  AND status IN ('validating', 'in_progress')
+		RETURNING `+batchColumns, envID, batchID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return q.LoadBatch(ctx, envID, batchID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cancel batch: %w", err)
+	}
+	return b, nil
+}
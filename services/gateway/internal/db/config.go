@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// The loaders below read whole tables for the gateway's in-memory config
+// snapshot. They apply the same filters as the per-request queries.
+
+// LoadAPIKeys loads every active API key.
+func (q *Queries) LoadAPIKeys(ctx context.Context) ([]model.APIKey, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, environment_id, route_id, key_hash, previous_key_hash,
+		       rotated_at + grace_period, scopes, rate_limit_rpm, is_active,
+		       client_cert_identities
+		FROM api_keys
+		WHERE is_active = true
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		var key model.APIKey
+		err := rows.Scan(
+			&key.ID, &key.EnvironmentID, &key.RouteID, &key.KeyHash, &key.PreviousHash,
+			&key.PreviousValidUntil, &key.Scopes, &key.RateLimitRPM, &key.IsActive,
+			&key.CertIdentities,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// LoadEnvironments loads every environment with its organization.
+func (q *Queries) LoadEnvironments(ctx context.Context) ([]model.Environment, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT e.id, e.project_id, p.organization_id, e.tier,
+		       e.budget_mode, e.budget_limit_usd, e.budget_used_usd,
+		       e.killswitch_active, e.killswitch_reason,
+		       e.anomaly_multiplier, e.anomaly_window
+		FROM environments e
+		JOIN projects p ON e.project_id = p.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query environments: %w", err)
+	}
+	defer rows.Close()
+
+	var envs []model.Environment
+	for rows.Next() {
+		var env model.Environment
+		var anomalyWindow time.Duration
+		err := rows.Scan(
+			&env.ID, &env.ProjectID, &env.OrganizationID, &env.Tier,
+			&env.BudgetMode, &env.BudgetLimitUSD, &env.BudgetUsedUSD,
+			&env.KillswitchActive, &env.KillswitchReason,
+			&env.AnomalyMultiplier, &anomalyWindow,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan environment: %w", err)
+		}
+		env.AnomalyWindow = anomalyWindow
+		envs = append(envs, env)
+	}
+	return envs, rows.Err()
+}
+
+// LoadRoutes loads every active route.
+func (q *Queries) LoadRoutes(ctx context.Context) ([]model.Route, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, environment_id, slug, name, is_active,
+		       allowed_models, preferred_model, fallback_chain,
+		       constraints, weight_cost, weight_latency, weight_reliability,
+		       output_schema, schema_strict,
+		       max_tokens_per_request, max_requests_per_min,
+		       guardrail_settings, budget_limit_usd
+		FROM routes
+		WHERE is_active = true
+		ORDER BY environment_id, slug
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []model.Route
+	for rows.Next() {
+		var route model.Route
+		err := rows.Scan(
+			&route.ID, &route.EnvironmentID, &route.Slug, &route.Name, &route.IsActive,
+			&route.AllowedModels, &route.PreferredModel, &route.FallbackChain,
+			&route.Constraints, &route.WeightCost, &route.WeightLatency, &route.WeightReliability,
+			&route.OutputSchema, &route.SchemaStrict,
+			&route.MaxTokensPerRequest, &route.MaxRequestsPerMin,
+			&route.GuardrailSettings, &route.BudgetLimitUSD,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan route: %w", err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, rows.Err()
+}
+
+// LoadModels loads every active model, whatever its provider's status.
+func (q *Queries) LoadModels(ctx context.Context) ([]model.ModelInfo, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, provider_id, model_id, display_name,
+		       context_window, max_output_tokens,
+		       input_price_per_m, output_price_per_m,
+		       supports_streaming, supports_tools,
+		       supports_vision, supports_json_mode,
+		       avg_latency_ms, p99_latency_ms, reliability_pct
+		FROM models
+		WHERE is_active = true
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query models: %w", err)
+	}
+	defer rows.Close()
+
+	var models []model.ModelInfo
+	for rows.Next() {
+		var m model.ModelInfo
+		err := rows.Scan(
+			&m.ID, &m.ProviderID, &m.ModelID, &m.DisplayName,
+			&m.ContextWindow, &m.MaxOutputTokens,
+			&m.InputPricePerM, &m.OutputPricePerM,
+			&m.SupportsStreaming, &m.SupportsTools,
+			&m.SupportsVision, &m.SupportsJSONMode,
+			&m.AvgLatencyMs, &m.P99LatencyMs, &m.ReliabilityPct,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan model: %w", err)
+		}
+		m.IsActive = true
+		models = append(models, m)
+	}
+	return models, rows.Err()
+}
+
+// LoadProviders loads every provider.
+func (q *Queries) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, organization_id, name, provider_type, base_url, api_key_enc, status, status_reason, metadata
+		FROM providers
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query providers: %w", err)
+	}
+	defer rows.Close()
+
+	var providers []model.Provider
+	for rows.Next() {
+		var p model.Provider
+		if err := rows.Scan(&p.ID, &p.OrganizationID, &p.Name, &p.ProviderType, &p.BaseURL, &p.APIKeyEnc, &p.Status, &p.StatusReason, &p.Metadata); err != nil {
+			return nil, fmt.Errorf("scan provider: %w", err)
+		}
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
+
+// Listen holds a connection subscribed to a NOTIFY channel and passes
+// each payload to notify. ready is called once the subscription is in
+// place. It returns when ctx ends or the connection fails.
+func (q *Queries) Listen(ctx context.Context, channel string, ready func(), notify func(payload string)) error {
+	pooled, err := q.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire listen connection: %w", err)
+	}
+	// The subscription lives as long as the connection, so it is taken
+	// out of the pool and closed rather than released.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("listen %s: %w", channel, err)
+	}
+	ready()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		notify(n.Payload)
+	}
+}
+
+// AddDiscoveredModels inserts models found installed on a provider. Models
+// already in the catalog, including ones an admin deactivated, are left as
+// they are. It returns how many models were added.
+func (q *Queries) AddDiscoveredModels(ctx context.Context, providerID string, models []model.ModelInfo) (int, error) {
+	added := 0
+	for _, m := range models {
+		tag, err := q.pool.Exec(ctx, `
+			INSERT INTO models (provider_id, model_id, display_name, context_window,
+			                    supports_streaming, supports_tools, supports_vision, supports_json_mode,
+			                    metadata)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, '{"discovered": true}')
+			ON CONFLICT (provider_id, model_id) DO NOTHING
+		`, providerID, m.ModelID, m.DisplayName, m.ContextWindow,
+			m.SupportsStreaming, m.SupportsTools, m.SupportsVision, m.SupportsJSONMode)
+		if err != nil {
+			return added, fmt.Errorf("insert model %s: %w", m.ModelID, err)
+		}
+		added += int(tag.RowsAffected())
+	}
+	return added, nil
+}
+
+// SetProviderStatus changes the status of a provider from `from` to `to`,
+// unless it has changed since or an administrator set it to something
+// other than active, and reports whether it did.
+func (q *Queries) SetProviderStatus(ctx context.Context, providerID, from, to string, reason *string) (bool, error) {
+	tag, err := q.pool.Exec(ctx, `
+		UPDATE providers
+		SET status = $3, status_reason = $4
+		WHERE id = $1 AND status = $2
+		  AND (status = 'active' OR status_reason IS NOT NULL)
+	`, providerID, from, to, reason)
+	if err != nil {
+		return false, fmt.Errorf("update provider status: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
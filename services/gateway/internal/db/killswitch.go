@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// ActivateKillSwitch turns on the kill switch of an environment and opens
+// an incident for it.
+func (q *Queries) ActivateKillSwitch(ctx context.Context, envID, reason string, triggerData map[string]interface{}) error {
+	tx, err := q.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Update environment
+	_, err = tx.Exec(ctx, `
+		UPDATE environments
+		SET killswitch_active = true,
+		    killswitch_reason = $2,
+		    killswitch_at = now()
+		WHERE id = $1
+	`, envID, reason)
+	if err != nil {
+		return fmt.Errorf("update environment: %w", err)
+	}
+
+	// Create incident
+	_, err = tx.Exec(ctx, `
+		INSERT INTO incidents (environment_id, severity, status, incident_type,
+		                       title, description, trigger_data, killswitch_activated)
+		VALUES ($1, 'critical', 'open', 'killswitch_activated',
+		        $2, $3, $4, true)
+	`, envID, "Kill switch activated: "+reason, reason, triggerData)
+	if err != nil {
+		return fmt.Errorf("create incident: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeactivateKillSwitch turns off the kill switch of an environment.
+func (q *Queries) DeactivateKillSwitch(ctx context.Context, envID string) error {
+	_, err := q.pool.Exec(ctx, `
+		UPDATE environments
+		SET killswitch_active = false,
+		    killswitch_reason = NULL,
+		    killswitch_at = NULL
+		WHERE id = $1
+	`, envID)
+	return err
+}
@@ -3,7 +3,6 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -32,7 +31,6 @@ func NewPool(ctx context.Context, databaseURL string) (*Pool, error) {
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
 
-	log.Println("database connection pool established")
 	return &Pool{pool: pool}, nil
 }
 
@@ -41,6 +39,11 @@ func (p *Pool) Close() {
 	p.pool.Close()
 }
 
+// Ping checks that a connection can be acquired and answers.
+func (p *Pool) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
 // Inner returns the underlying pgxpool for direct queries.
 func (p *Pool) Inner() *pgxpool.Pool {
 	return p.pool
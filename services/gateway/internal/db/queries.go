@@ -114,7 +114,73 @@ func (q *Queries) LoadRoute(ctx context.Context, envID, slug string) (*model.Rou
 	return &route, nil
 }
 
-// LoadModelsForEnv loads all active models available for an environment's org.
+// LoadRouteByID loads an active route by ID, scoped to an environment.
+func (q *Queries) LoadRouteByID(ctx context.Context, envID, routeID string) (*model.Route, error) {
+	row := q.pool.QueryRow(ctx, `
+		SELECT id, environment_id, slug, name, is_active,
+		       allowed_models, preferred_model, fallback_chain,
+		       constraints, weight_cost, weight_latency, weight_reliability,
+		       output_schema, schema_strict,
+		       max_tokens_per_request, max_requests_per_min,
+		       guardrail_settings, budget_limit_usd
+		FROM routes
+		WHERE environment_id = $1 AND id = $2 AND is_active = true
+	`, envID, routeID)
+
+	var route model.Route
+	err := row.Scan(
+		&route.ID, &route.EnvironmentID, &route.Slug, &route.Name, &route.IsActive,
+		&route.AllowedModels, &route.PreferredModel, &route.FallbackChain,
+		&route.Constraints, &route.WeightCost, &route.WeightLatency, &route.WeightReliability,
+		&route.OutputSchema, &route.SchemaStrict,
+		&route.MaxTokensPerRequest, &route.MaxRequestsPerMin,
+		&route.GuardrailSettings, &route.BudgetLimitUSD,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("route not found: %w", err)
+	}
+	return &route, nil
+}
+
+// LoadRoutesForEnv loads all active routes of an environment.
+func (q *Queries) LoadRoutesForEnv(ctx context.Context, envID string) ([]model.Route, error) {
+	rows, err := q.pool.Query(ctx, `
+		SELECT id, environment_id, slug, name, is_active,
+		       allowed_models, preferred_model, fallback_chain,
+		       constraints, weight_cost, weight_latency, weight_reliability,
+		       output_schema, schema_strict,
+		       max_tokens_per_request, max_requests_per_min,
+		       guardrail_settings, budget_limit_usd
+		FROM routes
+		WHERE environment_id = $1 AND is_active = true
+		ORDER BY slug
+	`, envID)
+	if err != nil {
+		return nil, fmt.Errorf("query routes: %w", err)
+	}
+	defer rows.Close()
+
+	var routes []model.Route
+	for rows.Next() {
+		var route model.Route
+		err := rows.Scan(
+			&route.ID, &route.EnvironmentID, &route.Slug, &route.Name, &route.IsActive,
+			&route.AllowedModels, &route.PreferredModel, &route.FallbackChain,
+			&route.Constraints, &route.WeightCost, &route.WeightLatency, &route.WeightReliability,
+			&route.OutputSchema, &route.SchemaStrict,
+			&route.MaxTokensPerRequest, &route.MaxRequestsPerMin,
+			&route.GuardrailSettings, &route.BudgetLimitUSD,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan route: %w", err)
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// LoadModelsForEnv loads all active models available for an environment's
+// org, leaving out the models of providers that are down.
 func (q *Queries) LoadModelsForEnv(ctx context.Context, orgID string) ([]model.ModelInfo, error) {
 	rows, err := q.pool.Query(ctx, `
 		SELECT m.id, m.provider_id, m.model_id, m.display_name,
@@ -127,7 +193,7 @@ func (q *Queries) LoadModelsForEnv(ctx context.Context, orgID string) ([]model.M
 		JOIN providers p ON m.provider_id = p.id
 		WHERE m.is_active = true
 		  AND (p.organization_id = $1 OR p.organization_id IS NULL)
-		  AND p.status = 'active'
+		  AND p.status <> 'down'
 	`, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("query models: %w", err)
@@ -157,12 +223,12 @@ func (q *Queries) LoadModelsForEnv(ctx context.Context, orgID string) ([]model.M
 // LoadProvider loads a provider by ID.
 func (q *Queries) LoadProvider(ctx context.Context, providerID string) (*model.Provider, error) {
 	row := q.pool.QueryRow(ctx, `
-		SELECT id, name, provider_type, base_url, api_key_enc, status
+		SELECT id, name, provider_type, base_url, api_key_enc, status, metadata
 		FROM providers WHERE id = $1
 	`, providerID)
 
 	var p model.Provider
-	err := row.Scan(&p.ID, &p.Name, &p.ProviderType, &p.BaseURL, &p.APIKeyEnc, &p.Status)
+	err := row.Scan(&p.ID, &p.Name, &p.ProviderType, &p.BaseURL, &p.APIKeyEnc, &p.Status, &p.Metadata)
 	if err != nil {
 		return nil, fmt.Errorf("provider not found: %w", err)
 	}
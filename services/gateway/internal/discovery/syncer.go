@@ -0,0 +1,202 @@
+// Package discovery keeps track of the models on self-hosted providers:
+// it adds installed models to the catalog and records which models are
+// loaded in memory, so the router can avoid cold starts.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/crypto"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+// discoverInterval is how often installed models are listed. Loaded
+// models are checked on every round, as they come and go within minutes.
+const discoverInterval = 5 * time.Minute
+
+// ProviderSource lists the configured providers.
+type ProviderSource interface {
+	LoadProviders(ctx context.Context) ([]model.Provider, error)
+}
+
+// ModelWriter adds discovered models to the catalog, leaving models it
+// already has as they are. It returns how many models were added.
+type ModelWriter interface {
+	AddDiscoveredModels(ctx context.Context, providerID string, models []model.ModelInfo) (int, error)
+}
+
+// Syncer periodically lists installed models on the providers that are
+// not down and whose metadata sets discover_models, and the loaded models
+// on every such provider that reports them.
+type Syncer struct {
+	providers ProviderSource
+	registry  *provider.Registry
+	writer    ModelWriter
+	masterKey string
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	// discovered is when each provider's models were last listed. It is
+	// only used by SyncAll, which does not run concurrently with itself.
+	discovered map[string]time.Time
+
+	mu     sync.RWMutex
+	loaded map[string]map[string]bool // provider ID -> loaded model IDs
+}
+
+func NewSyncer(providers ProviderSource, registry *provider.Registry, writer ModelWriter, masterKey string, timeout time.Duration, logger *slog.Logger) *Syncer {
+	return &Syncer{
+		providers:  providers,
+		registry:   registry,
+		writer:     writer,
+		masterKey:  masterKey,
+		timeout:    timeout,
+		logger:     logger,
+		discovered: make(map[string]time.Time),
+		loaded:     make(map[string]map[string]bool),
+	}
+}
+
+// Run syncs immediately and then every interval until ctx ends.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.SyncAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll checks every provider that is not down in parallel. Providers
+// whose load state cannot be read are treated as not reporting it, so
+// their models are neither preferred nor avoided.
+func (s *Syncer) SyncAll(ctx context.Context) {
+	providers, err := s.providers.LoadProviders(ctx)
+	if err != nil {
+		s.logger.Warn("load providers for model sync", "error", err)
+		return
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		loaded = make(map[string]map[string]bool)
+	)
+	now := time.Now()
+	for _, prov := range providers {
+		if prov.Status == "down" {
+			continue
+		}
+		impl, ok := s.registry.Get(prov.ProviderType)
+		if !ok {
+			continue
+		}
+		lister, canList := impl.(provider.ModelLister)
+		reporter, canReport := impl.(provider.LoadReporter)
+
+		discover := canList && discoveryEnabled(prov) && now.Sub(s.discovered[prov.ID]) >= discoverInterval
+		if !discover && !canReport {
+			continue
+		}
+		if discover {
+			s.discovered[prov.ID] = now
+		}
+
+		wg.Add(1)
+		go func(prov model.Provider) {
+			defer wg.Done()
+			cfg, err := s.config(prov)
+			if err != nil {
+				s.logger.Warn("model sync", "provider", prov.Name, "error", err)
+				return
+			}
+			ctx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+
+			if discover {
+				s.discover(ctx, lister, prov, cfg)
+			}
+			if canReport {
+				names, err := reporter.LoadedModels(ctx, cfg)
+				if err != nil {
+					s.logger.Debug("read loaded models", "provider", prov.Name, "error", err)
+					return
+				}
+				set := make(map[string]bool, len(names))
+				for _, name := range names {
+					set[name] = true
+				}
+				mu.Lock()
+				loaded[prov.ID] = set
+				mu.Unlock()
+			}
+		}(prov)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.loaded = loaded
+	s.mu.Unlock()
+}
+
+func (s *Syncer) discover(ctx context.Context, lister provider.ModelLister, prov model.Provider, cfg provider.ProviderConfig) {
+	models, err := lister.ListModels(ctx, cfg)
+	if err != nil {
+		s.logger.Warn("list provider models", "provider", prov.Name, "error", err)
+		return
+	}
+	for i := range models {
+		models[i].ProviderID = prov.ID
+	}
+	added, err := s.writer.AddDiscoveredModels(ctx, prov.ID, models)
+	if err != nil {
+		s.logger.Warn("add discovered models", "provider", prov.Name, "error", err)
+		return
+	}
+	if added > 0 {
+		s.logger.Info("discovered provider models", "provider", prov.Name, "added", added)
+	}
+}
+
+// config returns the connection settings of a provider, decrypting its
+// key.
+func (s *Syncer) config(prov model.Provider) (provider.ProviderConfig, error) {
+	apiKey := prov.APIKey
+	if prov.APIKeyEnc != nil {
+		var err error
+		apiKey, err = crypto.Decrypt(*prov.APIKeyEnc, s.masterKey)
+		if err != nil {
+			return provider.ProviderConfig{}, fmt.Errorf("decrypt provider key: %w", err)
+		}
+	}
+	return provider.ProviderConfig{BaseURL: prov.BaseURL, APIKey: apiKey, Metadata: prov.Metadata}, nil
+}
+
+// Loaded reports whether a model is loaded on its provider. known is false
+// until the provider has reported its loaded models.
+func (s *Syncer) Loaded(providerID, modelID string) (loaded, known bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set, ok := s.loaded[providerID]
+	if !ok {
+		return false, false
+	}
+	return set[modelID], true
+}
+
+// discoveryEnabled reports whether a provider's metadata opts it into
+// model discovery. It is off by default, as discovered models join the
+// catalog every route without an allowed list can select from.
+func discoveryEnabled(prov model.Provider) bool {
+	enabled, _ := prov.Metadata["discover_models"].(bool)
+	return enabled
+}
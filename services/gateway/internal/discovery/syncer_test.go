@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+type fakeProviders []model.Provider
+
+func (f fakeProviders) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	return f, nil
+}
+
+type fakeWriter struct {
+	mu     sync.Mutex
+	models map[string][]model.ModelInfo
+}
+
+func (w *fakeWriter) AddDiscoveredModels(ctx context.Context, providerID string, models []model.ModelInfo) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.models[providerID] = append(w.models[providerID], models...)
+	return len(models), nil
+}
+
+func TestSyncAll(t *testing.T) {
+	var mu sync.Mutex
+	tagRequests := 0
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			mu.Lock()
+			tagRequests++
+			mu.Unlock()
+			io.WriteString(w, `{"models":[{"name":"llama3.2:latest"}]}`)
+		case "/api/show":
+			io.WriteString(w, `{"capabilities":["completion"]}`)
+		case "/api/ps":
+			io.WriteString(w, `{"models":[{"name":"llama3.2:latest"}]}`)
+		}
+	}))
+	defer ollama.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewOllama(http.DefaultClient))
+	registry.Register(provider.NewGeneric(http.DefaultClient))
+	providers := fakeProviders{
+		{ID: "p1", Name: "local", ProviderType: "ollama", BaseURL: ollama.URL, Status: "active",
+			Metadata: map[string]interface{}{"discover_models": true}},
+		{ID: "p2", Name: "no-discovery", ProviderType: "ollama", BaseURL: ollama.URL, Status: "active"},
+		{ID: "p3", Name: "down", ProviderType: "ollama", BaseURL: down.URL, Status: "active"},
+		{ID: "p4", Name: "cloud", ProviderType: "openai_compatible", BaseURL: down.URL, Status: "active"},
+	}
+	writer := &fakeWriter{models: make(map[string][]model.ModelInfo)}
+	s := NewSyncer(providers, registry, writer, "", 5*time.Second, logging.Discard())
+
+	s.SyncAll(context.Background())
+	s.SyncAll(context.Background())
+
+	if tagRequests != 1 {
+		t.Errorf("listed installed models %d times, want once per discovery interval", tagRequests)
+	}
+	if len(writer.models) != 1 || len(writer.models["p1"]) != 1 {
+		t.Fatalf("discovered = %+v, want one model on p1 only", writer.models)
+	}
+	if m := writer.models["p1"][0]; m.ModelID != "llama3.2" || m.ProviderID != "p1" {
+		t.Errorf("discovered model = %+v", m)
+	}
+
+	tests := []struct {
+		provider, model string
+		loaded, known   bool
+	}{
+		{"p1", "llama3.2", true, true},
+		{"p2", "llama3.2:latest", true, true},
+		{"p2", "qwen2.5:7b", false, true},
+		{"p3", "llama3.2", false, false},
+		{"p4", "gpt-4o", false, false},
+	}
+	for _, tt := range tests {
+		loaded, known := s.Loaded(tt.provider, tt.model)
+		if loaded != tt.loaded || known != tt.known {
+			t.Errorf("Loaded(%s, %s) = %v, %v, want %v, %v", tt.provider, tt.model, loaded, known, tt.loaded, tt.known)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the config file. JSON and YAML use the
+// same field names.
+type fileConfig struct {
+	// Organization groups the environments; it only matters for the
+	// organization_id columns of metered records.
+	Organization string            `json:"organization" yaml:"organization"`
+	Providers    []providerSpec    `json:"providers" yaml:"providers"`
+	Models       []modelSpec       `json:"models" yaml:"models"`
+	Environments []environmentSpec `json:"environments" yaml:"environments"`
+}
+
+type providerSpec struct {
+	ID      string `json:"id" yaml:"id"`
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	BaseURL string `json:"base_url" yaml:"base_url"`
+	// APIKeyEnv names the environment variable holding the provider key,
+	// so that keys stay out of the file.
+	APIKeyEnv string `json:"api_key_env" yaml:"api_key_env"`
+	Status    string `json:"status" yaml:"status"`
+	// Metadata holds provider type specific settings; see
+	// model.Provider.
+	Metadata map[string]interface{} `json:"metadata" yaml:"metadata"`
+}
+
+type modelSpec struct {
+	ID                string   `json:"id" yaml:"id"`
+	Provider          string   `json:"provider" yaml:"provider"`
+	ModelID           string   `json:"model_id" yaml:"model_id"`
+	DisplayName       string   `json:"display_name" yaml:"display_name"`
+	ContextWindow     int      `json:"context_window" yaml:"context_window"`
+	MaxOutputTokens   *int     `json:"max_output_tokens" yaml:"max_output_tokens"`
+	InputPricePerM    float64  `json:"input_price_per_m" yaml:"input_price_per_m"`
+	OutputPricePerM   float64  `json:"output_price_per_m" yaml:"output_price_per_m"`
+	SupportsStreaming *bool    `json:"supports_streaming" yaml:"supports_streaming"`
+	SupportsTools     bool     `json:"supports_tools" yaml:"supports_tools"`
+	SupportsVision    bool     `json:"supports_vision" yaml:"supports_vision"`
+	SupportsJSONMode  bool     `json:"supports_json_mode" yaml:"supports_json_mode"`
+	AvgLatencyMs      *int     `json:"avg_latency_ms" yaml:"avg_latency_ms"`
+	P99LatencyMs      *int     `json:"p99_latency_ms" yaml:"p99_latency_ms"`
+	ReliabilityPct    *float64 `json:"reliability_pct" yaml:"reliability_pct"`
+}
+
+type environmentSpec struct {
+	ID                string      `json:"id" yaml:"id"`
+	Tier              string      `json:"tier" yaml:"tier"`
+	BudgetMode        string      `json:"budget_mode" yaml:"budget_mode"`
+	BudgetLimitUSD    *float64    `json:"budget_limit_usd" yaml:"budget_limit_usd"`
+	KillswitchActive  bool        `json:"killswitch_active" yaml:"killswitch_active"`
+	KillswitchReason  *string     `json:"killswitch_reason" yaml:"killswitch_reason"`
+	AnomalyMultiplier *float64    `json:"anomaly_multiplier" yaml:"anomaly_multiplier"`
+	AnomalyWindow     *duration   `json:"anomaly_window" yaml:"anomaly_window"`
+	Routes            []routeSpec `json:"routes" yaml:"routes"`
+	APIKeys           []keySpec   `json:"api_keys" yaml:"api_keys"`
+}
+
+type routeSpec struct {
+	ID                  string                 `json:"id" yaml:"id"`
+	Slug                string                 `json:"slug" yaml:"slug"`
+	Name                string                 `json:"name" yaml:"name"`
+	AllowedModels       []string               `json:"allowed_models" yaml:"allowed_models"`
+	PreferredModel      *string                `json:"preferred_model" yaml:"preferred_model"`
+	FallbackChain       []string               `json:"fallback_chain" yaml:"fallback_chain"`
+	Constraints         map[string]interface{} `json:"constraints" yaml:"constraints"`
+	WeightCost          *float64               `json:"weight_cost" yaml:"weight_cost"`
+	WeightLatency       *float64               `json:"weight_latency" yaml:"weight_latency"`
+	WeightReliability   *float64               `json:"weight_reliability" yaml:"weight_reliability"`
+	OutputSchema        interface{}            `json:"output_schema" yaml:"output_schema"`
+	SchemaStrict        bool                   `json:"schema_strict" yaml:"schema_strict"`
+	MaxTokensPerRequest *int                   `json:"max_tokens_per_request" yaml:"max_tokens_per_request"`
+	MaxRequestsPerMin   *int                   `json:"max_requests_per_min" yaml:"max_requests_per_min"`
+	GuardrailSettings   map[string]interface{} `json:"guardrail_settings" yaml:"guardrail_settings"`
+	BudgetLimitUSD      *float64               `json:"budget_limit_usd" yaml:"budget_limit_usd"`
+}
+
+type keySpec struct {
+	ID string `json:"id" yaml:"id"`
+	// KeyHash is the hex SHA-256 of the key; the key itself is never
+	// written to the file.
+	KeyHash string `json:"key_hash" yaml:"key_hash"`
+	// ClientCerts are client certificate identities that authenticate as
+	// this key over mTLS. A key needs a key_hash, client_certs or both.
+	ClientCerts  []string `json:"client_certs" yaml:"client_certs"`
+	Route        string   `json:"route" yaml:"route"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	RateLimitRPM *int     `json:"rate_limit_rpm" yaml:"rate_limit_rpm"`
+}
+
+// duration accepts Go duration strings such as "5m".
+type duration time.Duration
+
+func (d *duration) set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	return d.set(s)
+}
+
+func (d *duration) UnmarshalYAML(n *yaml.Node) error {
+	return d.set(n.Value)
+}
+
+// readFile parses a config file, as JSON when it ends in .json and as
+// YAML otherwise. Unknown fields are rejected so typos do not go unseen.
+func readFile(path string) (*fileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg fileConfig
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,652 @@
+// Package filestore serves the gateway configuration from a YAML or JSON
+// file, for running without a database.
+package filestore
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// ErrNotFound is returned for entities missing from the config file.
+var ErrNotFound = errors.New("not found")
+
+// Defaults for fields left out of the config file, matching the column
+// defaults of the database schema.
+const (
+	defaultOrganization      = "local"
+	defaultTier              = "development"
+	defaultBudgetMode        = "soft"
+	defaultAnomalyMultiplier = 3.0
+	defaultAnomalyWindow     = 5 * time.Minute
+	defaultWeightCost        = 0.4
+	defaultWeightLatency     = 0.3
+	defaultWeightReliability = 0.3
+	defaultReliabilityPct    = 99.0
+)
+
+// snapshot is one parsed and validated version of the config file.
+type snapshot struct {
+	keys         map[string]*model.APIKey // by key hash
+	certKeys     map[string]*model.APIKey // by client certificate identity
+	environments map[string]*model.Environment
+	routes       map[string]map[string]*model.Route // environment ID -> slug
+	routesByID   map[string]*model.Route
+	models       []model.ModelInfo
+	providers    map[string]*model.Provider
+}
+
+// Store holds the configuration declared in a file. Budget spend, kill
+// switch changes and discovered models are kept in memory and survive
+// reloads, but not restarts.
+type Store struct {
+	path string
+
+	mu         sync.RWMutex
+	snap       *snapshot
+	loadedAt   time.Time
+	budgetUsed map[string]float64
+	killSwitch map[string]*string           // environment ID -> reason; nil value when deactivated
+	discovered map[string][]model.ModelInfo // provider ID -> models
+}
+
+// Open reads and validates the config file at path.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:       path,
+		budgetUsed: make(map[string]float64),
+		killSwitch: make(map[string]*string),
+		discovered: make(map[string][]model.ModelInfo),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the config file the store was opened from.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Reload reads the config file again. If the file cannot be read or is
+// invalid, the previous configuration stays in effect.
+func (s *Store) Reload() error {
+	cfg, err := readFile(s.path)
+	if err != nil {
+		return err
+	}
+	snap, err := build(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.mu.Lock()
+	s.snap = snap
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// SyncedAt returns when the config file was last loaded successfully.
+func (s *Store) SyncedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loadedAt
+}
+
+// build validates a parsed file and indexes it the way the pipeline looks
+// entities up.
+func build(cfg *fileConfig) (*snapshot, error) {
+	org := cfg.Organization
+	if org == "" {
+		org = defaultOrganization
+	}
+	snap := &snapshot{
+		keys:         make(map[string]*model.APIKey),
+		certKeys:     make(map[string]*model.APIKey),
+		environments: make(map[string]*model.Environment),
+		routes:       make(map[string]map[string]*model.Route),
+		routesByID:   make(map[string]*model.Route),
+		providers:    make(map[string]*model.Provider),
+	}
+
+	for i, p := range cfg.Providers {
+		prov, err := buildProvider(p)
+		if err != nil {
+			return nil, fmt.Errorf("providers[%d]: %w", i, err)
+		}
+		if _, dup := snap.providers[prov.ID]; dup {
+			return nil, fmt.Errorf("providers[%d]: duplicate id %q", i, prov.ID)
+		}
+		snap.providers[prov.ID] = prov
+	}
+
+	modelIDs := make(map[string]bool)
+	for i, m := range cfg.Models {
+		info, err := buildModel(m)
+		if err != nil {
+			return nil, fmt.Errorf("models[%d]: %w", i, err)
+		}
+		if _, ok := snap.providers[info.ProviderID]; !ok {
+			return nil, fmt.Errorf("models[%d]: unknown provider %q", i, info.ProviderID)
+		}
+		if modelIDs[info.ID] {
+			return nil, fmt.Errorf("models[%d]: duplicate id %q", i, info.ID)
+		}
+		modelIDs[info.ID] = true
+		snap.models = append(snap.models, info)
+	}
+
+	for i, e := range cfg.Environments {
+		env, err := buildEnvironment(e, org)
+		if err != nil {
+			return nil, fmt.Errorf("environments[%d]: %w", i, err)
+		}
+		if _, dup := snap.environments[env.ID]; dup {
+			return nil, fmt.Errorf("environments[%d]: duplicate id %q", i, env.ID)
+		}
+		snap.environments[env.ID] = env
+		snap.routes[env.ID] = make(map[string]*model.Route)
+
+		for j, r := range e.Routes {
+			route, err := buildRoute(r, env.ID, modelIDs)
+			if err != nil {
+				return nil, fmt.Errorf("environments[%d].routes[%d]: %w", i, j, err)
+			}
+			if _, dup := snap.routes[env.ID][route.Slug]; dup {
+				return nil, fmt.Errorf("environments[%d].routes[%d]: duplicate slug %q", i, j, route.Slug)
+			}
+			if _, dup := snap.routesByID[route.ID]; dup {
+				return nil, fmt.Errorf("environments[%d].routes[%d]: duplicate id %q", i, j, route.ID)
+			}
+			snap.routes[env.ID][route.Slug] = route
+			snap.routesByID[route.ID] = route
+		}
+
+		for j, k := range e.APIKeys {
+			key, err := buildKey(k, env.ID, snap.routes[env.ID])
+			if err != nil {
+				return nil, fmt.Errorf("environments[%d].api_keys[%d]: %w", i, j, err)
+			}
+			if key.KeyHash != "" {
+				if _, dup := snap.keys[key.KeyHash]; dup {
+					return nil, fmt.Errorf("environments[%d].api_keys[%d]: duplicate key_hash", i, j)
+				}
+				snap.keys[key.KeyHash] = key
+			}
+			for _, id := range key.CertIdentities {
+				if _, dup := snap.certKeys[id]; dup {
+					return nil, fmt.Errorf("environments[%d].api_keys[%d]: client cert %q mapped twice", i, j, id)
+				}
+				snap.certKeys[id] = key
+			}
+		}
+	}
+	return snap, nil
+}
+
+func buildProvider(p providerSpec) (*model.Provider, error) {
+	if p.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if p.Type == "" {
+		return nil, errors.New("type is required")
+	}
+	prov := &model.Provider{
+		ID:           p.ID,
+		Name:         p.Name,
+		ProviderType: p.Type,
+		BaseURL:      p.BaseURL,
+		Status:       p.Status,
+		Metadata:     p.Metadata,
+	}
+	if prov.ID == "" {
+		prov.ID = p.Name
+	}
+	if prov.Status == "" {
+		prov.Status = "active"
+	}
+	if p.APIKeyEnv != "" {
+		prov.APIKey = os.Getenv(p.APIKeyEnv)
+	}
+	return prov, nil
+}
+
+func buildModel(m modelSpec) (model.ModelInfo, error) {
+	if m.Provider == "" {
+		return model.ModelInfo{}, errors.New("provider is required")
+	}
+	if m.ModelID == "" {
+		return model.ModelInfo{}, errors.New("model_id is required")
+	}
+	if m.ContextWindow <= 0 {
+		return model.ModelInfo{}, errors.New("context_window must be positive")
+	}
+	info := model.ModelInfo{
+		ID:                m.ID,
+		ProviderID:        m.Provider,
+		ModelID:           m.ModelID,
+		DisplayName:       m.DisplayName,
+		ContextWindow:     m.ContextWindow,
+		MaxOutputTokens:   m.MaxOutputTokens,
+		InputPricePerM:    m.InputPricePerM,
+		OutputPricePerM:   m.OutputPricePerM,
+		SupportsStreaming: true,
+		SupportsTools:     m.SupportsTools,
+		SupportsVision:    m.SupportsVision,
+		SupportsJSONMode:  m.SupportsJSONMode,
+		AvgLatencyMs:      m.AvgLatencyMs,
+		P99LatencyMs:      m.P99LatencyMs,
+		ReliabilityPct:    defaultReliabilityPct,
+		IsActive:          true,
+	}
+	if info.ID == "" {
+		info.ID = m.ModelID
+	}
+	if info.DisplayName == "" {
+		info.DisplayName = m.ModelID
+	}
+	if m.SupportsStreaming != nil {
+		info.SupportsStreaming = *m.SupportsStreaming
+	}
+	if m.ReliabilityPct != nil {
+		info.ReliabilityPct = *m.ReliabilityPct
+	}
+	return info, nil
+}
+
+func buildEnvironment(e environmentSpec, org string) (*model.Environment, error) {
+	if e.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	env := &model.Environment{
+		ID:                e.ID,
+		ProjectID:         org,
+		OrganizationID:    org,
+		Tier:              e.Tier,
+		BudgetMode:        e.BudgetMode,
+		BudgetLimitUSD:    e.BudgetLimitUSD,
+		KillswitchActive:  e.KillswitchActive,
+		KillswitchReason:  e.KillswitchReason,
+		AnomalyMultiplier: defaultAnomalyMultiplier,
+		AnomalyWindow:     defaultAnomalyWindow,
+	}
+	if env.Tier == "" {
+		env.Tier = defaultTier
+	}
+	switch env.BudgetMode {
+	case "":
+		env.BudgetMode = defaultBudgetMode
+	case "soft", "hard":
+	default:
+		return nil, fmt.Errorf("budget_mode must be soft or hard, got %q", env.BudgetMode)
+	}
+	if e.AnomalyMultiplier != nil {
+		env.AnomalyMultiplier = *e.AnomalyMultiplier
+	}
+	if e.AnomalyWindow != nil {
+		env.AnomalyWindow = time.Duration(*e.AnomalyWindow)
+	}
+	return env, nil
+}
+
+func buildRoute(r routeSpec, envID string, modelIDs map[string]bool) (*model.Route, error) {
+	if r.Slug == "" {
+		return nil, errors.New("slug is required")
+	}
+	route := &model.Route{
+		ID:                  r.ID,
+		EnvironmentID:       envID,
+		Slug:                r.Slug,
+		Name:                r.Name,
+		IsActive:            true,
+		AllowedModels:       r.AllowedModels,
+		PreferredModel:      r.PreferredModel,
+		FallbackChain:       r.FallbackChain,
+		WeightCost:          defaultWeightCost,
+		WeightLatency:       defaultWeightLatency,
+		WeightReliability:   defaultWeightReliability,
+		SchemaStrict:        r.SchemaStrict,
+		MaxTokensPerRequest: r.MaxTokensPerRequest,
+		MaxRequestsPerMin:   r.MaxRequestsPerMin,
+		BudgetLimitUSD:      r.BudgetLimitUSD,
+	}
+	if route.ID == "" {
+		route.ID = envID + "/" + r.Slug
+	}
+	if route.Name == "" {
+		route.Name = r.Slug
+	}
+	if r.WeightCost != nil {
+		route.WeightCost = *r.WeightCost
+	}
+	if r.WeightLatency != nil {
+		route.WeightLatency = *r.WeightLatency
+	}
+	if r.WeightReliability != nil {
+		route.WeightReliability = *r.WeightReliability
+	}
+
+	refs := append(append([]string{}, r.AllowedModels...), r.FallbackChain...)
+	if r.PreferredModel != nil {
+		refs = append(refs, *r.PreferredModel)
+	}
+	for _, id := range refs {
+		if !modelIDs[id] {
+			return nil, fmt.Errorf("unknown model %q", id)
+		}
+	}
+
+	// The pipeline reads these as decoded JSONB, where every number is a
+	// float64; YAML would hand it ints.
+	if err := normalize(r.Constraints, &route.Constraints); err != nil {
+		return nil, fmt.Errorf("constraints: %w", err)
+	}
+	if err := normalize(r.GuardrailSettings, &route.GuardrailSettings); err != nil {
+		return nil, fmt.Errorf("guardrail_settings: %w", err)
+	}
+	if err := normalize(r.OutputSchema, &route.OutputSchema); err != nil {
+		return nil, fmt.Errorf("output_schema: %w", err)
+	}
+	return route, nil
+}
+
+func buildKey(k keySpec, envID string, routes map[string]*model.Route) (*model.APIKey, error) {
+	if k.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	if k.KeyHash == "" && len(k.ClientCerts) == 0 {
+		return nil, errors.New("key_hash or client_certs is required")
+	}
+	hash := strings.ToLower(k.KeyHash)
+	if b, err := hex.DecodeString(hash); hash != "" && (err != nil || len(b) != 32) {
+		return nil, errors.New("key_hash must be a hex SHA-256 digest")
+	}
+	key := &model.APIKey{
+		ID:             k.ID,
+		EnvironmentID:  envID,
+		KeyHash:        hash,
+		Scopes:         k.Scopes,
+		RateLimitRPM:   k.RateLimitRPM,
+		IsActive:       true,
+		CertIdentities: k.ClientCerts,
+	}
+	if len(key.Scopes) == 0 {
+		key.Scopes = []string{"chat.completions"}
+	}
+	if k.Route != "" {
+		route, ok := routes[k.Route]
+		if !ok {
+			return nil, fmt.Errorf("unknown route %q", k.Route)
+		}
+		key.RouteID = &route.ID
+	}
+	return key, nil
+}
+
+// normalize round-trips v through JSON into out. A nil v leaves out
+// untouched.
+func normalize[T any](v interface{}, out *T) error {
+	if v == nil {
+		return nil
+	}
+	if m, ok := v.(map[string]interface{}); ok && m == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// FindByHash looks up an API key by its hash.
+func (s *Store) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.snap.keys[hash]
+	if !ok {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// FindByCertIdentity looks up an API key by a client certificate identity.
+func (s *Store) FindByCertIdentity(ctx context.Context, identity string) (*model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.snap.certKeys[identity]
+	if !ok {
+		return nil, fmt.Errorf("key %w", ErrNotFound)
+	}
+	k := *key
+	return &k, nil
+}
+
+// FindByPreviousHash always fails: keys declared in a file are rotated by
+// editing the file, without a grace period.
+func (s *Store) FindByPreviousHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return nil, fmt.Errorf("key %w", ErrNotFound)
+}
+
+// LoadEnvironment returns an environment by ID, with the spend and kill
+// switch state accumulated since start.
+func (s *Store) LoadEnvironment(ctx context.Context, envID string) (*model.Environment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	env, ok := s.snap.environments[envID]
+	if !ok {
+		return nil, fmt.Errorf("environment %w", ErrNotFound)
+	}
+	e := *env
+	e.BudgetUsedUSD = s.budgetUsed[envID]
+	if reason, ok := s.killSwitch[envID]; ok {
+		e.KillswitchActive = reason != nil
+		e.KillswitchReason = reason
+	}
+	return &e, nil
+}
+
+// LoadRoute returns a route by environment and slug.
+func (s *Store) LoadRoute(ctx context.Context, envID, slug string) (*model.Route, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	route, ok := s.snap.routes[envID][slug]
+	if !ok {
+		return nil, fmt.Errorf("route %w", ErrNotFound)
+	}
+	r := *route
+	return &r, nil
+}
+
+// LoadRouteByID returns a route by ID, scoped to an environment.
+func (s *Store) LoadRouteByID(ctx context.Context, envID, routeID string) (*model.Route, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	route, ok := s.snap.routesByID[routeID]
+	if !ok || route.EnvironmentID != envID {
+		return nil, fmt.Errorf("route %w", ErrNotFound)
+	}
+	r := *route
+	return &r, nil
+}
+
+// LoadRoutesForEnv returns the routes of an environment, sorted by slug.
+func (s *Store) LoadRoutesForEnv(ctx context.Context, envID string) ([]model.Route, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var routes []model.Route
+	for _, route := range s.snap.routes[envID] {
+		routes = append(routes, *route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Slug < routes[j].Slug })
+	return routes, nil
+}
+
+// LoadModelsForEnv returns the models of providers that are not down,
+// followed by the models discovered on them that the file does not
+// declare. Every model is shared by the single organization the file
+// declares.
+func (s *Store) LoadModelsForEnv(ctx context.Context, orgID string) ([]model.ModelInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var models []model.ModelInfo
+	declared := make(map[string]bool, len(s.snap.models))
+	for _, m := range s.snap.models {
+		declared[m.ProviderID+"/"+m.ModelID] = true
+		if s.snap.providers[m.ProviderID].Status == "down" {
+			continue
+		}
+		models = append(models, m)
+	}
+
+	providerIDs := make([]string, 0, len(s.discovered))
+	for id := range s.discovered {
+		providerIDs = append(providerIDs, id)
+	}
+	sort.Strings(providerIDs)
+	for _, id := range providerIDs {
+		prov, ok := s.snap.providers[id]
+		if !ok || prov.Status == "down" {
+			continue
+		}
+		for _, m := range s.discovered[id] {
+			if !declared[id+"/"+m.ModelID] {
+				models = append(models, m)
+			}
+		}
+	}
+	return models, nil
+}
+
+// AddDiscoveredModels records models found installed on a provider. They
+// are served alongside the models in the file until the gateway restarts;
+// models the file declares take precedence. Discovered models get their
+// model ID as ID, or "<provider ID>/<model ID>" when that is taken.
+func (s *Store) AddDiscoveredModels(ctx context.Context, providerID string, models []model.ModelInfo) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	taken := make(map[string]bool)
+	known := make(map[string]bool)
+	for _, m := range s.snap.models {
+		taken[m.ID] = true
+		known[m.ProviderID+"/"+m.ModelID] = true
+	}
+	for _, list := range s.discovered {
+		for _, m := range list {
+			taken[m.ID] = true
+			known[m.ProviderID+"/"+m.ModelID] = true
+		}
+	}
+
+	added := 0
+	for _, m := range models {
+		if known[providerID+"/"+m.ModelID] {
+			continue
+		}
+		m.ProviderID = providerID
+		m.ID = m.ModelID
+		if taken[m.ID] {
+			m.ID = providerID + "/" + m.ModelID
+		}
+		if m.ReliabilityPct == 0 {
+			m.ReliabilityPct = defaultReliabilityPct
+		}
+		m.IsActive = true
+		taken[m.ID] = true
+		known[providerID+"/"+m.ModelID] = true
+		s.discovered[providerID] = append(s.discovered[providerID], m)
+		added++
+	}
+	return added, nil
+}
+
+// LoadProvider returns a provider by ID.
+func (s *Store) LoadProvider(ctx context.Context, providerID string) (*model.Provider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	prov, ok := s.snap.providers[providerID]
+	if !ok {
+		return nil, fmt.Errorf("provider %w", ErrNotFound)
+	}
+	p := *prov
+	return &p, nil
+}
+
+// LoadProviders returns every provider, sorted by ID.
+func (s *Store) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	providers := make([]model.Provider, 0, len(s.snap.providers))
+	for _, prov := range s.snap.providers {
+		providers = append(providers, *prov)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+	return providers, nil
+}
+
+// SetProviderStatus changes the status of a provider from `from` to `to`
+// until the file is reloaded, unless it has changed since or the file
+// sets it to something other than active.
+func (s *Store) SetProviderStatus(ctx context.Context, providerID, from, to string, reason *string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prov, ok := s.snap.providers[providerID]
+	if !ok {
+		return false, fmt.Errorf("provider %w", ErrNotFound)
+	}
+	if prov.Status != from || (prov.Status != "active" && prov.StatusReason == nil) {
+		return false, nil
+	}
+	p := *prov
+	p.Status, p.StatusReason = to, reason
+	s.snap.providers[providerID] = &p
+	return true, nil
+}
+
+// UpdateLastUsed is a no-op; key usage is not tracked without a database.
+func (s *Store) UpdateLastUsed(ctx context.Context, keyID string) error {
+	return nil
+}
+
+// IncrementBudgetUsed adds cost to the in-memory spend of an environment.
+func (s *Store) IncrementBudgetUsed(ctx context.Context, envID string, costUSD float64) error {
+	s.mu.Lock()
+	s.budgetUsed[envID] += costUSD
+	s.mu.Unlock()
+	return nil
+}
+
+// ActivateKillSwitch blocks an environment until it is deactivated or the
+// gateway restarts. triggerData is only persisted by the database store.
+func (s *Store) ActivateKillSwitch(ctx context.Context, envID, reason string, triggerData map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snap.environments[envID]; !ok {
+		return fmt.Errorf("environment %w", ErrNotFound)
+	}
+	s.killSwitch[envID] = &reason
+	return nil
+}
+
+// DeactivateKillSwitch unblocks an environment, including one declared
+// with killswitch_active in the file.
+func (s *Store) DeactivateKillSwitch(ctx context.Context, envID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snap.environments[envID]; !ok {
+		return fmt.Errorf("environment %w", ErrNotFound)
+	}
+	s.killSwitch[envID] = nil
+	return nil
+}
@@ -0,0 +1,312 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/auth"
+	"github.com/openfive/gateway/internal/model"
+)
+
+const testYAML = `
+providers:
+  - name: openai
+    type: openai_compatible
+    base_url: https://api.openai.com/v1
+    api_key_env: FILESTORE_TEST_OPENAI_KEY
+    metadata:
+      deployments:
+        gpt-4o-mini: mini-prod
+models:
+  - provider: openai
+    model_id: gpt-4o-mini
+    context_window: 128000
+    input_price_per_m: 0.15
+    output_price_per_m: 0.6
+environments:
+  - id: dev
+    budget_limit_usd: 10
+    anomaly_window: 10m
+    routes:
+      - slug: support
+        allowed_models: [gpt-4o-mini]
+        constraints:
+          max_cost_per_request: 1
+        guardrail_settings:
+          max_input_tokens: 4000
+    api_keys:
+      - id: local
+        key_hash: ` + "%s" + `
+        route: support
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func yamlWithKey(key string) string {
+	return strings.Replace(testYAML, "%s", auth.HashKey(key), 1)
+}
+
+func TestOpen_YAML(t *testing.T) {
+	t.Setenv("FILESTORE_TEST_OPENAI_KEY", "sk-test")
+	s, err := Open(writeFile(t, "gateway.yaml", yamlWithKey("of-secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	key, err := s.FindByHash(ctx, auth.HashKey("of-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.EnvironmentID != "dev" || key.RouteID == nil || *key.RouteID != "dev/support" {
+		t.Errorf("key = %+v, want env dev and route dev/support", key)
+	}
+	if !key.IsActive || len(key.Scopes) != 1 || key.Scopes[0] != "chat.completions" {
+		t.Errorf("key = %+v, want an active key with the default scope", key)
+	}
+
+	env, err := s.LoadEnvironment(ctx, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.BudgetMode != "soft" || env.AnomalyWindow != 10*time.Minute || env.AnomalyMultiplier != 3 {
+		t.Errorf("env = %+v, want defaults with a 10m window", env)
+	}
+
+	route, err := s.LoadRoute(ctx, "dev", "support")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Numbers must decode as they would from JSONB.
+	if v, ok := route.GuardrailSettings["max_input_tokens"].(float64); !ok || v != 4000 {
+		t.Errorf("guardrail max_input_tokens = %#v, want float64 4000", route.GuardrailSettings["max_input_tokens"])
+	}
+	if route.WeightCost != 0.4 {
+		t.Errorf("WeightCost = %v, want 0.4", route.WeightCost)
+	}
+
+	prov, err := s.LoadProvider(ctx, "openai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prov.APIKey != "sk-test" || prov.Status != "active" {
+		t.Errorf("provider = %+v, want key from env and active status", prov)
+	}
+	if deployments, _ := prov.Metadata["deployments"].(map[string]interface{}); deployments["gpt-4o-mini"] != "mini-prod" {
+		t.Errorf("provider metadata = %#v, want the deployments map", prov.Metadata)
+	}
+
+	models, _ := s.LoadModelsForEnv(ctx, env.OrganizationID)
+	if len(models) != 1 || models[0].ID != "gpt-4o-mini" || !models[0].SupportsStreaming {
+		t.Errorf("models = %+v, want gpt-4o-mini with streaming", models)
+	}
+}
+
+func TestOpen_JSON(t *testing.T) {
+	path := writeFile(t, "gateway.json", `{
+		"providers": [{"name": "ollama", "type": "ollama", "base_url": "http://localhost:11434/v1"}],
+		"models": [{"provider": "ollama", "model_id": "llama3.2", "context_window": 8192}],
+		"environments": [{"id": "dev", "routes": [{"slug": "default", "preferred_model": "llama3.2"}]}]
+	}`)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, _ := s.LoadRoutesForEnv(context.Background(), "dev")
+	if len(routes) != 1 || *routes[0].PreferredModel != "llama3.2" {
+		t.Errorf("routes = %+v, want one route preferring llama3.2", routes)
+	}
+}
+
+func TestAddDiscoveredModels(t *testing.T) {
+	path := writeFile(t, "gateway.json", `{
+		"providers": [{"name": "ollama", "type": "ollama", "base_url": "http://localhost:11434"},
+		              {"name": "gpu", "type": "ollama", "base_url": "http://gpu:11434"}],
+		"models": [{"provider": "ollama", "model_id": "llama3.2", "context_window": 8192}]
+	}`)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	added, err := s.AddDiscoveredModels(ctx, "gpu", []model.ModelInfo{
+		{ModelID: "llama3.2", ContextWindow: 131072},
+		{ModelID: "qwen2.5:7b", ContextWindow: 32768},
+	})
+	if err != nil || added != 2 {
+		t.Fatalf("AddDiscoveredModels = %d, %v, want 2 added", added, err)
+	}
+	if added, _ := s.AddDiscoveredModels(ctx, "ollama", []model.ModelInfo{{ModelID: "llama3.2", ContextWindow: 131072}}); added != 0 {
+		t.Errorf("added %d models already declared in the file", added)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	models, _ := s.LoadModelsForEnv(ctx, defaultOrganization)
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	if want := []string{"llama3.2", "gpu/llama3.2", "qwen2.5:7b"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("model IDs = %v, want %v", ids, want)
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown field", "providers:\n  - name: a\n    type: openai\n    apikey: x\n", "apikey"},
+		{"unknown provider", "models:\n  - provider: nope\n    model_id: m\n    context_window: 1\n", `unknown provider "nope"`},
+		{"unknown model", "environments:\n  - id: dev\n    routes:\n      - slug: s\n        allowed_models: [nope]\n", `unknown model "nope"`},
+		{"no credential", "environments:\n  - id: dev\n    api_keys:\n      - id: k\n", "key_hash or client_certs"},
+		{"bad hash", "environments:\n  - id: dev\n    api_keys:\n      - id: k\n        key_hash: plaintext\n", "key_hash"},
+		{"unknown route", "environments:\n  - id: dev\n    api_keys:\n      - id: k\n        key_hash: " + auth.HashKey("x") + "\n        route: nope\n", `unknown route "nope"`},
+		{"duplicate environment", "environments:\n  - id: dev\n  - id: dev\n", `duplicate id "dev"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(writeFile(t, "gateway.yaml", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Open error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeFile(t, "gateway.yaml", yamlWithKey("old"))
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s.IncrementBudgetUsed(ctx, "dev", 2.5)
+
+	// An invalid file keeps the previous configuration.
+	os.WriteFile(path, []byte("providers: [\n"), 0o600)
+	if err := s.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded")
+	}
+	if _, err := s.FindByHash(ctx, auth.HashKey("old")); err != nil {
+		t.Errorf("old key lost after failed reload: %v", err)
+	}
+
+	os.WriteFile(path, []byte(yamlWithKey("new")), 0o600)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FindByHash(ctx, auth.HashKey("old")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("old key after reload: err = %v, want ErrNotFound", err)
+	}
+	if _, err := s.FindByHash(ctx, auth.HashKey("new")); err != nil {
+		t.Errorf("new key after reload: %v", err)
+	}
+	env, _ := s.LoadEnvironment(ctx, "dev")
+	if env.BudgetUsedUSD != 2.5 {
+		t.Errorf("BudgetUsedUSD after reload = %v, want 2.5", env.BudgetUsedUSD)
+	}
+}
+
+func TestKillSwitch(t *testing.T) {
+	s, err := Open(writeFile(t, "gateway.yaml", yamlWithKey("k")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := s.ActivateKillSwitch(ctx, "dev", "runaway loop", nil); err != nil {
+		t.Fatal(err)
+	}
+	env, _ := s.LoadEnvironment(ctx, "dev")
+	if !env.KillswitchActive || env.KillswitchReason == nil || *env.KillswitchReason != "runaway loop" {
+		t.Errorf("env = %+v, want kill switch active with reason", env)
+	}
+
+	if err := s.DeactivateKillSwitch(ctx, "dev"); err != nil {
+		t.Fatal(err)
+	}
+	env, _ = s.LoadEnvironment(ctx, "dev")
+	if env.KillswitchActive {
+		t.Error("kill switch still active after deactivation")
+	}
+
+	if err := s.ActivateKillSwitch(ctx, "missing", "x", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ActivateKillSwitch(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetProviderStatus(t *testing.T) {
+	s, err := Open(writeFile(t, "gateway.yaml", yamlWithKey("k")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	reason := "circuit open"
+
+	for _, tt := range []struct {
+		from, to  string
+		changed   bool
+		available int
+	}{
+		{"degraded", "down", false, 1},
+		{"active", "degraded", true, 1},
+		{"degraded", "down", true, 0},
+		{"down", "active", true, 1},
+	} {
+		changed, err := s.SetProviderStatus(ctx, "openai", tt.from, tt.to, &reason)
+		if err != nil || changed != tt.changed {
+			t.Errorf("%s -> %s = %v, %v, want %v", tt.from, tt.to, changed, err, tt.changed)
+		}
+		if models, _ := s.LoadModelsForEnv(ctx, ""); len(models) != tt.available {
+			t.Errorf("after %s -> %s: %d models available, want %d", tt.from, tt.to, len(models), tt.available)
+		}
+	}
+
+	// A status the file sets is the administrator's.
+	s, err = Open(writeFile(t, "gateway.yaml", strings.Replace(yamlWithKey("k"),
+		"type: openai_compatible", "type: openai_compatible\n    status: degraded", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := s.SetProviderStatus(ctx, "openai", "degraded", "active", nil); changed {
+		t.Error("overrode the status the file sets")
+	}
+}
+
+func TestFindByCertIdentity(t *testing.T) {
+	s, err := Open(writeFile(t, "gateway.yaml", `
+environments:
+  - id: prod
+    api_keys:
+      - id: billing
+        client_certs: ["spiffe://corp/agents/billing", "CN=billing-agent"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.FindByCertIdentity(context.Background(), "CN=billing-agent")
+	if err != nil || key.ID != "billing" || key.EnvironmentID != "prod" {
+		t.Errorf("FindByCertIdentity = %+v, %v; want billing in prod", key, err)
+	}
+	if _, err := s.FindByCertIdentity(context.Background(), "CN=other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unmapped identity: err = %v, want ErrNotFound", err)
+	}
+}
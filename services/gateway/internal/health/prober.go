@@ -0,0 +1,162 @@
+// Package health probes the upstream providers so readiness can report
+// whether this instance can reach them.
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/crypto"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+// ProviderSource lists the configured providers.
+type ProviderSource interface {
+	LoadProviders(ctx context.Context) ([]model.Provider, error)
+}
+
+// ProviderStatus is the outcome of the last probe of a provider.
+type ProviderStatus struct {
+	ID        string
+	Name      string
+	Type      string
+	OK        bool
+	Error     string
+	Latency   time.Duration
+	CheckedAt time.Time
+}
+
+// Prober periodically checks that every provider that is not down
+// answers.
+type Prober struct {
+	providers ProviderSource
+	registry  *provider.Registry
+	masterKey string
+	timeout   time.Duration
+	logger    *slog.Logger
+
+	mu       sync.RWMutex
+	statuses map[string]ProviderStatus
+}
+
+func NewProber(providers ProviderSource, registry *provider.Registry, masterKey string, timeout time.Duration, logger *slog.Logger) *Prober {
+	return &Prober{
+		providers: providers,
+		registry:  registry,
+		masterKey: masterKey,
+		timeout:   timeout,
+		logger:    logger,
+		statuses:  make(map[string]ProviderStatus),
+	}
+}
+
+// Run probes all providers immediately and then every interval until ctx
+// ends.
+func (p *Prober) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes every provider that is not down and whose adapter
+// supports probing, in parallel. Providers that are gone or down are
+// dropped from the statuses.
+func (p *Prober) ProbeAll(ctx context.Context) {
+	providers, err := p.providers.LoadProviders(ctx)
+	if err != nil {
+		p.logger.Warn("load providers for probing", "error", err)
+		return
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]ProviderStatus)
+	)
+	for _, prov := range providers {
+		if prov.Status == "down" {
+			continue
+		}
+		impl, ok := p.registry.Get(prov.ProviderType)
+		if !ok {
+			continue
+		}
+		prober, ok := impl.(provider.Prober)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(prov model.Provider) {
+			defer wg.Done()
+			status := p.probe(ctx, prober, prov)
+			mu.Lock()
+			results[prov.ID] = status
+			mu.Unlock()
+		}(prov)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for id, status := range results {
+		if prev, ok := p.statuses[id]; ok && prev.OK != status.OK {
+			if status.OK {
+				p.logger.Info("provider probe recovered", "provider", status.Name)
+			} else {
+				p.logger.Warn("provider probe failed", "provider", status.Name, "error", status.Error)
+			}
+		}
+	}
+	p.statuses = results
+	p.mu.Unlock()
+}
+
+func (p *Prober) probe(ctx context.Context, prober provider.Prober, prov model.Provider) ProviderStatus {
+	status := ProviderStatus{ID: prov.ID, Name: prov.Name, Type: prov.ProviderType}
+
+	apiKey := prov.APIKey
+	if prov.APIKeyEnc != nil {
+		var err error
+		apiKey, err = crypto.Decrypt(*prov.APIKeyEnc, p.masterKey)
+		if err != nil {
+			status.Error = fmt.Sprintf("decrypt provider key: %v", err)
+			status.CheckedAt = time.Now()
+			return status
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	err := prober.Probe(ctx, provider.ProviderConfig{BaseURL: prov.BaseURL, APIKey: apiKey, Metadata: prov.Metadata})
+	status.Latency = time.Since(start)
+	status.CheckedAt = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.OK = true
+	return status
+}
+
+// Statuses returns the last probe result of each provider, keyed by
+// provider ID. It is empty until the first round completes.
+func (p *Prober) Statuses() map[string]ProviderStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make(map[string]ProviderStatus, len(p.statuses))
+	for id, s := range p.statuses {
+		out[id] = s
+	}
+	return out
+}
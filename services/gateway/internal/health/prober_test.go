@@ -0,0 +1,59 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+type fakeProviders []model.Provider
+
+func (f fakeProviders) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	return f, nil
+}
+
+func TestProbeAll(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer sk-up" {
+			t.Errorf("probe request = %s %s auth %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"data":[]}`))
+	}))
+	defer up.Close()
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewGeneric(http.DefaultClient))
+	providers := fakeProviders{
+		{ID: "p1", Name: "up", ProviderType: "openai_compatible", BaseURL: up.URL + "/v1", APIKey: "sk-up", Status: "active"},
+		{ID: "p2", Name: "bad-key", ProviderType: "openai_compatible", BaseURL: unauthorized.URL, Status: "active"},
+		{ID: "p3", Name: "disabled", ProviderType: "openai_compatible", BaseURL: unauthorized.URL, Status: "down"},
+		{ID: "p4", Name: "unknown", ProviderType: "bedrock", Status: "active"},
+	}
+
+	p := NewProber(providers, registry, "", time.Second, logging.Discard())
+	if len(p.Statuses()) != 0 {
+		t.Fatal("statuses before the first probe should be empty")
+	}
+	p.ProbeAll(context.Background())
+
+	statuses := p.Statuses()
+	if len(statuses) != 2 {
+		t.Fatalf("statuses = %+v, want p1 and p2 only", statuses)
+	}
+	if s := statuses["p1"]; !s.OK || s.CheckedAt.IsZero() {
+		t.Errorf("p1 = %+v, want ok", s)
+	}
+	if s := statuses["p2"]; s.OK || s.Error == "" {
+		t.Errorf("p2 = %+v, want a failure", s)
+	}
+}
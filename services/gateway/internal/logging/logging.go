@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Attribute keys shared by every request-scoped log line.
+const (
+	KeyTraceID       = "trace_id"
+	KeyEnvironmentID = "environment_id"
+	KeyRoute         = "route"
+	KeyModel         = "model"
+	KeyProvider      = "provider"
+)
+
+// New returns a logger writing to w at the given level ("debug", "info",
+// "warn" or "error"), as JSON lines or as logfmt-style text.
+func New(w io.Writer, level string, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+	if json {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// ParseLevel maps a LOG_LEVEL value to a slog level. Unknown values fall
+// back to info.
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Request returns a logger carrying the request attributes. Empty values
+// are kept so every request line has the same shape.
+func Request(l *slog.Logger, traceID, environmentID, route, model, provider string) *slog.Logger {
+	return l.With(
+		slog.String(KeyTraceID, traceID),
+		slog.String(KeyEnvironmentID, environmentID),
+		slog.String(KeyRoute, route),
+		slog.String(KeyModel, model),
+		slog.String(KeyProvider, provider),
+	)
+}
+
+// Discard returns a logger that drops everything.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+		"":        slog.LevelInfo,
+		"verbose": slog.LevelInfo,
+	}
+	for in, want := range tests {
+		if got := ParseLevel(in); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestNew_JSONCarriesRequestAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "warn", true)
+
+	Request(l, "abc", "env-1", "support", "gpt-4o", "openrouter").Info("dropped")
+	if buf.Len() != 0 {
+		t.Fatalf("info line written at warn level: %s", buf.String())
+	}
+
+	Request(l, "abc", "env-1", "support", "gpt-4o", "").Warn("provider failed")
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("not a JSON line: %v: %s", err, buf.String())
+	}
+	want := map[string]string{
+		"level":          "WARN",
+		"msg":            "provider failed",
+		"trace_id":       "abc",
+		"environment_id": "env-1",
+		"route":          "support",
+		"model":          "gpt-4o",
+		"provider":       "",
+	}
+	for k, v := range want {
+		if got, ok := line[k]; !ok || got != v {
+			t.Errorf("%s = %v, want %q", k, got, v)
+		}
+	}
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, "debug", false).Debug("hello", "k", "v")
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "k=v") {
+		t.Errorf("text output = %q", out)
+	}
+}
@@ -0,0 +1,42 @@
+package meter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// JSONLSink appends request records to a file, one JSON object per line,
+// for running without a database.
+type JSONLSink struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewJSONLSink opens path for appending, creating it if needed.
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open meter file: %w", err)
+	}
+	return &JSONLSink{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *JSONLSink) Write(ctx context.Context, rec *model.RequestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+// Close closes the file. Close the Writer first so the last records are
+// written.
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
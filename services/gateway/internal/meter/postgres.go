@@ -0,0 +1,57 @@
+package meter
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// PostgresSink inserts request records into the requests table.
+type PostgresSink struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSink(pool *pgxpool.Pool) *PostgresSink {
+	return &PostgresSink{pool: pool}
+}
+
+func (s *PostgresSink) Write(ctx context.Context, rec *model.RequestRecord) error {
+	tracing.SpanFromContext(ctx).SetAttributes(
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.operation.name", "INSERT"),
+		tracing.String("db.collection.name", "requests"))
+
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO requests (
+			environment_id, route_id, api_key_id, request_id,
+			started_at, completed_at, duration_ms, status,
+			model_id, provider_id, model_identifier,
+			input_tokens, output_tokens, estimated_tokens,
+			input_cost_usd, output_cost_usd, total_cost_usd,
+			prompt_hash, is_streaming, tool_call_count,
+			attempt_number, fallback_reason,
+			schema_valid, schema_repair_attempts,
+			error_code, error_message, action_taken,
+			batch_id, trace_id
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+			$11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28,
+			$29
+		)
+	`,
+		rec.EnvironmentID, rec.RouteID, rec.APIKeyID, rec.RequestID,
+		rec.StartedAt, rec.CompletedAt, rec.DurationMs, rec.Status,
+		rec.ModelID, rec.ProviderID, rec.ModelIdentifier,
+		rec.InputTokens, rec.OutputTokens, rec.EstimatedTokens,
+		rec.InputCostUSD, rec.OutputCostUSD, rec.TotalCostUSD,
+		rec.PromptHash, rec.IsStreaming, rec.ToolCallCount,
+		rec.AttemptNumber, rec.FallbackReason,
+		rec.SchemaValid, rec.SchemaRepairAttempts,
+		rec.ErrorCode, rec.ErrorMessage, rec.ActionTaken,
+		rec.BatchID, rec.TraceID,
+	)
+	return err
+}
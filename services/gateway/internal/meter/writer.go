@@ -2,31 +2,59 @@ package meter
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/openfive/gateway/internal/logging"
 	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/tracing"
 )
 
-// Writer batches request records and flushes them to the database.
+// Sink stores request records.
+type Sink interface {
+	Write(ctx context.Context, rec *model.RequestRecord) error
+}
+
+// maxRetained bounds the records kept for retry after failed writes; the
+// oldest are dropped beyond it.
+const maxRetained = 100000
+
+// Writer batches request records and flushes them to a sink. Records whose
+// write failed are kept and written again with the next flush.
 type Writer struct {
-	pool      *pgxpool.Pool
-	buffer    []model.RequestRecord
+	sink   Sink
+	buffer []model.RequestRecord
+	// retry holds the records whose write failed, and inFlight counts
+	// those being written.
+	retry     []model.RequestRecord
+	inFlight  int
 	mu        sync.Mutex
 	batchSize int
 	flushMs   int
 	done      chan struct{}
+	stopped   chan struct{}
+	logger    *slog.Logger
+	tracer    *tracing.Tracer
+
+	written     atomic.Int64
+	flushErrors atomic.Int64
 }
 
-func NewWriter(pool *pgxpool.Pool, batchSize, flushMs int) *Writer {
+func NewWriter(sink Sink, batchSize, flushMs int, logger *slog.Logger, tracer *tracing.Tracer) *Writer {
+	if logger == nil {
+		logger = logging.Discard()
+	}
 	w := &Writer{
-		pool:      pool,
+		sink:      sink,
 		buffer:    make([]model.RequestRecord, 0, batchSize),
 		batchSize: batchSize,
 		flushMs:   flushMs,
 		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		logger:    logger,
+		tracer:    tracer,
 	}
 	go w.flushLoop()
 	return w
@@ -44,55 +72,96 @@ func (w *Writer) Record(rec model.RequestRecord) {
 	}
 }
 
-// Flush writes all buffered records to the database.
+// Flush writes all buffered records, and those kept from failed writes,
+// to the sink. Records that fail again are kept for the next flush.
 func (w *Writer) Flush() {
 	w.mu.Lock()
-	if len(w.buffer) == 0 {
+	if len(w.buffer) == 0 && len(w.retry) == 0 {
 		w.mu.Unlock()
 		return
 	}
-	batch := w.buffer
+	retried := len(w.retry)
+	batch := append(w.retry, w.buffer...)
+	w.retry = nil
 	w.buffer = make([]model.RequestRecord, 0, w.batchSize)
+	w.inFlight += len(batch)
 	w.mu.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	for _, rec := range batch {
-		_, err := w.pool.Exec(ctx, `
-			INSERT INTO requests (
-				environment_id, route_id, api_key_id, request_id,
-				started_at, completed_at, duration_ms, status,
-				model_id, provider_id, model_identifier,
-				input_tokens, output_tokens, estimated_tokens,
-				input_cost_usd, output_cost_usd, total_cost_usd,
-				prompt_hash, is_streaming, tool_call_count,
-				attempt_number, fallback_reason,
-				schema_valid, schema_repair_attempts,
-				error_code, error_message, action_taken
-			) VALUES (
-				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
-				$11, $12, $13, $14, $15, $16, $17, $18, $19,
-				$20, $21, $22, $23, $24, $25, $26, $27
-			)
-		`,
-			rec.EnvironmentID, rec.RouteID, rec.APIKeyID, rec.RequestID,
-			rec.StartedAt, rec.CompletedAt, rec.DurationMs, rec.Status,
-			rec.ModelID, rec.ProviderID, rec.ModelIdentifier,
-			rec.InputTokens, rec.OutputTokens, rec.EstimatedTokens,
-			rec.InputCostUSD, rec.OutputCostUSD, rec.TotalCostUSD,
-			rec.PromptHash, rec.IsStreaming, rec.ToolCallCount,
-			rec.AttemptNumber, rec.FallbackReason,
-			rec.SchemaValid, rec.SchemaRepairAttempts,
-			rec.ErrorCode, rec.ErrorMessage, rec.ActionTaken,
-		)
-		if err != nil {
-			log.Printf("meter write error: %v", err)
+	var failed []model.RequestRecord
+	var lastErr error
+	for i, rec := range batch {
+		if err := w.write(ctx, &rec); err != nil {
+			w.flushErrors.Add(1)
+			failed, lastErr = append(failed, rec), err
+			// Records carry IDs only, so route and provider are logged by
+			// ID. Retried records were logged when they first failed.
+			if i >= retried {
+				logging.Request(w.logger, deref(rec.TraceID), rec.EnvironmentID, deref(rec.RouteID), rec.ModelIdentifier, deref(rec.ProviderID)).
+					Error("meter write failed", "request_id", rec.RequestID, "status", rec.Status, "cost_usd", rec.TotalCostUSD, "error", err)
+			}
+			continue
 		}
+		w.written.Add(1)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight -= len(batch)
+	w.retry = append(failed, w.retry...)
+	if dropped := len(w.retry) - maxRetained; dropped > 0 {
+		w.retry = w.retry[dropped:]
+		w.logger.Error("meter records dropped after failed writes", "records", dropped, "error", lastErr)
+	}
+}
+
+// write hands one record to the sink, traced as a child of the span that
+// produced it.
+func (w *Writer) write(ctx context.Context, rec *model.RequestRecord) error {
+	if parent, ok := tracing.ParseTraceparent(rec.TraceParent); ok {
+		ctx = tracing.ContextWithSpanContext(ctx, parent)
+	}
+	ctx, span := w.tracer.Start(ctx, "gateway.meter.write", tracing.KindClient,
+		tracing.String("gateway.request_id", rec.RequestID))
+	defer span.End()
+
+	err := w.sink.Write(ctx, rec)
+	if err != nil {
+		span.SetError("write_error", err.Error())
+	}
+	return err
+}
+
+// Pending returns the number of records not yet written: buffered, being
+// written, or kept for retry after a failed write.
+func (w *Writer) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.buffer) + w.inFlight + len(w.retry)
+}
+
+// Written returns the number of records written since start.
+func (w *Writer) Written() int64 {
+	return w.written.Load()
+}
+
+// FlushErrors returns the number of failed record writes since start. A
+// record kept for retry counts once for every write that failed.
+func (w *Writer) FlushErrors() int64 {
+	return w.flushErrors.Load()
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
 	}
+	return *s
 }
 
 func (w *Writer) flushLoop() {
+	defer close(w.stopped)
 	ticker := time.NewTicker(time.Duration(w.flushMs) * time.Millisecond)
 	defer ticker.Stop()
 	for {
@@ -106,7 +175,9 @@ func (w *Writer) flushLoop() {
 	}
 }
 
-// Close stops the flush loop and writes remaining records.
+// Close stops the flush loop and returns once the remaining records are
+// written.
 func (w *Writer) Close() {
 	close(w.done)
+	<-w.stopped
 }
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/openfive/gateway/internal/anomaly"
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/meter"
+)
+
+// Gateway holds the gateway's metrics. A nil *Gateway records nothing.
+type Gateway struct {
+	registry *Registry
+
+	requests *Counter
+	duration *Histogram
+	tokens   *Counter
+	cost     *Counter
+}
+
+func NewGateway() *Gateway {
+	r := NewRegistry()
+	return &Gateway{
+		registry: r,
+		requests: r.NewCounter("gateway_requests_total",
+			"Metered gateway requests.", "route", "model", "provider", "status"),
+		duration: r.NewHistogram("gateway_request_duration_seconds",
+			"Gateway request latency, from admission until the response or stream completed.",
+			DefaultBuckets, "route", "model", "provider", "status"),
+		tokens: r.NewCounter("gateway_tokens_total",
+			"Tokens metered, by direction (input or output).", "route", "model", "provider", "direction"),
+		cost: r.NewCounter("gateway_cost_usd_total",
+			"Cost metered in US dollars.", "route", "model", "provider"),
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (g *Gateway) Handler() http.Handler {
+	if g == nil {
+		return http.NotFoundHandler()
+	}
+	return g.registry.Handler()
+}
+
+// ObserveRequest records a metered request.
+func (g *Gateway) ObserveRequest(route, model, provider, status string, d time.Duration, inputTokens, outputTokens int, costUSD float64) {
+	if g == nil {
+		return
+	}
+	g.requests.Inc(route, model, provider, status)
+	g.duration.Observe(d.Seconds(), route, model, provider, status)
+	g.tokens.Add(float64(inputTokens), route, model, provider, "input")
+	g.tokens.Add(float64(outputTokens), route, model, provider, "output")
+	g.cost.Add(costUSD, route, model, provider)
+}
+
+// WatchCache exports the prompt cache statistics.
+func (g *Gateway) WatchCache(c *cache.Cache) {
+	counter := func(name, help string, value func(cache.Counters) float64) {
+		g.registry.NewCounterFunc(name, help, nil, func(emit Emit) {
+			emit(value(c.Counters()))
+		})
+	}
+	counter("gateway_cache_hits_total", "Prompt cache hits.",
+		func(s cache.Counters) float64 { return float64(s.Hits) })
+	counter("gateway_cache_misses_total", "Prompt cache misses.",
+		func(s cache.Counters) float64 { return float64(s.Misses) })
+	counter("gateway_cache_evictions_total", "Prompt cache entries evicted or expired.",
+		func(s cache.Counters) float64 { return float64(s.Evictions) })
+	counter("gateway_cache_saved_cost_usd_total", "Provider cost avoided by prompt cache hits, in US dollars.",
+		func(s cache.Counters) float64 { return s.SavedCost })
+	g.registry.NewGaugeFunc("gateway_cache_entries", "Entries in the prompt cache.", nil, func(emit Emit) {
+		emit(float64(c.Counters().Entries))
+	})
+}
+
+// WatchMeter exports the meter writer's buffer depth and write outcomes.
+func (g *Gateway) WatchMeter(w *meter.Writer) {
+	g.registry.NewGaugeFunc("gateway_meter_buffer_depth", "Request records not yet written, including those kept for retry.", nil, func(emit Emit) {
+		emit(float64(w.Pending()))
+	})
+	g.registry.NewCounterFunc("gateway_meter_records_written_total", "Request records written to the database.", nil, func(emit Emit) {
+		emit(float64(w.Written()))
+	})
+	g.registry.NewCounterFunc("gateway_meter_flush_errors_total", "Failed request record writes, retries included.", nil, func(emit Emit) {
+		emit(float64(w.FlushErrors()))
+	})
+}
+
+// WatchRateLimiter exports rate limit rejections by scope (key or route).
+func (g *Gateway) WatchRateLimiter(rl *budget.RateLimiter) {
+	g.registry.NewCounterFunc("gateway_rate_limit_rejections_total", "Requests rejected by a key or route rate limit.",
+		[]string{"scope"}, func(emit Emit) {
+			for scope, n := range rl.Rejections() {
+				emit(float64(n), scope)
+			}
+		})
+}
+
+// WatchAnomaly exports the anomaly detector's cost window totals and the
+// kill-switch state per environment.
+func (g *Gateway) WatchAnomaly(d *anomaly.Detector, ks *anomaly.KillSwitch) {
+	g.registry.NewGaugeFunc("gateway_anomaly_window_cost_usd", "Cost in the current anomaly detection window, in US dollars.",
+		[]string{"environment_id"}, func(emit Emit) {
+			for envID, total := range d.WindowTotals() {
+				emit(total, envID)
+			}
+		})
+	g.registry.NewGaugeFunc("gateway_killswitch_active", "Whether the kill switch is active (1) for an environment, as last seen.",
+		[]string{"environment_id"}, func(emit Emit) {
+			for envID, active := range ks.States() {
+				v := 0.0
+				if active {
+					v = 1
+				}
+				emit(v, envID)
+			}
+		})
+	g.registry.NewCounterFunc("gateway_killswitch_activations_total", "Kill switches activated by this process.", nil, func(emit Emit) {
+		emit(float64(ks.Activations()))
+	})
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestRegistry_Counter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests.", "route", "status")
+	c.Inc("b", "ok")
+	c.Inc("a", "ok")
+	c.Add(2, "a", "ok")
+	c.Add(-1, "a", "ok")
+	c.Inc(`q"uo\te`, "err")
+
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="a",status="ok"} 3
+requests_total{route="b",status="ok"} 1
+requests_total{route="q\"uo\\te",status="err"} 1
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="a",le="0.1"} 1
+latency_seconds_bucket{route="a",le="1"} 2
+latency_seconds_bucket{route="a",le="+Inf"} 3
+latency_seconds_sum{route="a"} 3.55
+latency_seconds_count{route="a"} 3
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_GaugeFunc(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("depth", "Depth.", nil, func(emit Emit) { emit(7) })
+	r.NewGaugeFunc("window_usd", "Window.", []string{"environment_id"}, func(emit Emit) {
+		emit(2.5, "env-b")
+		emit(1, "env-a")
+	})
+
+	want := `# HELP depth Depth.
+# TYPE depth gauge
+depth 7
+# HELP window_usd Window.
+# TYPE window_usd gauge
+window_usd{environment_id="env-a"} 1
+window_usd{environment_id="env-b"} 2.5
+`
+	if got := render(t, r); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistry_LabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	NewRegistry().NewCounter("c", "C.", "route").Inc()
+}
+
+func TestGateway_Handler(t *testing.T) {
+	g := NewGateway()
+	g.ObserveRequest("support", "gpt-4o", "openrouter", "success", 300*time.Millisecond, 10, 20, 0.5)
+
+	c := cache.New(cache.DefaultConfig())
+	c.Set("k", []byte("{}"), "gpt-4o", 1, 1, 0.25)
+	c.Get("k")
+	c.Get("missing")
+	g.WatchCache(c)
+
+	rl := budget.NewRateLimiter()
+	rl.Allow("route:r1", 1)
+	rl.Allow("route:r1", 1)
+	g.WatchRateLimiter(rl)
+
+	rec := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`gateway_requests_total{route="support",model="gpt-4o",provider="openrouter",status="success"} 1`,
+		`gateway_request_duration_seconds_bucket{route="support",model="gpt-4o",provider="openrouter",status="success",le="0.5"} 1`,
+		`gateway_tokens_total{route="support",model="gpt-4o",provider="openrouter",direction="output"} 20`,
+		`gateway_cost_usd_total{route="support",model="gpt-4o",provider="openrouter"} 0.5`,
+		"gateway_cache_hits_total 1",
+		"gateway_cache_misses_total 1",
+		"gateway_cache_saved_cost_usd_total 0.25",
+		"gateway_cache_entries 1",
+		`gateway_rate_limit_rejections_total{scope="route"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestGateway_NilRecordsNothing(t *testing.T) {
+	var g *Gateway
+	g.ObserveRequest("r", "m", "p", "success", time.Second, 1, 1, 1)
+	rec := httptest.NewRecorder()
+	g.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 404 {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
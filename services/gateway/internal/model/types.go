@@ -9,6 +9,7 @@ type ChatCompletionRequest struct {
 	Model          string          `json:"model"`
 	Messages       []Message       `json:"messages"`
 	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *StreamOptions  `json:"stream_options,omitempty"`
 	Temperature    *float64        `json:"temperature,omitempty"`
 	MaxTokens      *int            `json:"max_tokens,omitempty"`
 	Tools          []Tool          `json:"tools,omitempty"`
@@ -20,6 +21,11 @@ type ChatCompletionRequest struct {
 	User           string          `json:"user,omitempty"`
 }
 
+// StreamOptions controls what a streamed response includes.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
 type Message struct {
 	Role       string      `json:"role"`
 	Content    interface{} `json:"content"`
@@ -40,13 +46,14 @@ type FunctionDef struct {
 }
 
 type ToolCall struct {
-	ID       string       `json:"id"`
-	Type     string       `json:"type"`
+	Index    *int         `json:"index,omitempty"` // set on streamed deltas
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
 	Function FunctionCall `json:"function"`
 }
 
 type FunctionCall struct {
-	Name      string `json:"name"`
+	Name      string `json:"name,omitempty"`
 	Arguments string `json:"arguments"`
 }
 
@@ -76,6 +83,15 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// PromptTokensDetails breaks down the prompt tokens served from or
+	// written to the provider's prompt cache; both are included in
+	// PromptTokens.
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens     int `json:"cached_tokens"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 // ChatCompletionChunk is an SSE streaming chunk.
@@ -88,6 +104,69 @@ type ChatCompletionChunk struct {
 	Usage   *Usage   `json:"usage,omitempty"`
 }
 
+// EmbeddingRequest is the OpenAI-compatible embeddings request body.
+// Input is a string, an array of strings, or token arrays.
+type EmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat string      `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
+
+// EmbeddingResponse is the OpenAI-compatible embeddings response.
+type EmbeddingResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  *Usage      `json:"usage,omitempty"`
+}
+
+// Embedding holds a float array, or a base64 string when
+// encoding_format is "base64".
+type Embedding struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+// ModelList is the OpenAI-compatible /v1/models response.
+type ModelList struct {
+	Object string        `json:"object"`
+	Data   []ModelObject `json:"data"`
+}
+
+type ModelObject struct {
+	ID       string           `json:"id"`
+	Object   string           `json:"object"`
+	Created  int64            `json:"created"`
+	OwnedBy  string           `json:"owned_by"`
+	OpenFive *ModelExtensions `json:"openfive,omitempty"`
+}
+
+// ModelExtensions carries OpenFive details on /v1/models entries.
+type ModelExtensions struct {
+	Kind            string             `json:"kind"` // "route" or "model"
+	DisplayName     string             `json:"display_name,omitempty"`
+	ContextWindow   int                `json:"context_window,omitempty"`
+	MaxOutputTokens *int               `json:"max_output_tokens,omitempty"`
+	Pricing         *ModelPricing      `json:"pricing,omitempty"`
+	Capabilities    *ModelCapabilities `json:"capabilities,omitempty"`
+	Models          []string           `json:"models,omitempty"` // models reachable through a route
+}
+
+type ModelPricing struct {
+	InputPerM  float64 `json:"input_per_m"`
+	OutputPerM float64 `json:"output_per_m"`
+}
+
+type ModelCapabilities struct {
+	Streaming bool `json:"streaming"`
+	Tools     bool `json:"tools"`
+	Vision    bool `json:"vision"`
+	JSONMode  bool `json:"json_mode"`
+}
+
 // ErrorResponse is the OpenAI-compatible error format.
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
@@ -156,12 +235,22 @@ type ModelInfo struct {
 }
 
 type Provider struct {
-	ID           string
-	Name         string
-	ProviderType string
-	BaseURL      string
-	APIKeyEnc    *string
-	Status       string
+	ID             string
+	OrganizationID *string // nil for providers shared by every organization
+	Name           string
+	ProviderType   string
+	BaseURL        string
+	APIKeyEnc      *string
+	// APIKey is a plaintext key for providers declared in a config file;
+	// keys stored in the database are always encrypted.
+	APIKey string
+	Status string
+	// StatusReason says why the gateway set the status; nil when an
+	// administrator set it.
+	StatusReason *string
+	// Metadata holds provider type specific settings, such as the API
+	// version and deployment names of an Azure OpenAI resource.
+	Metadata map[string]interface{}
 }
 
 type APIKey struct {
@@ -170,44 +259,108 @@ type APIKey struct {
 	RouteID       *string
 	KeyHash       string
 	PreviousHash  *string
-	Scopes        []string
-	RateLimitRPM  *int
-	IsActive      bool
+	// PreviousValidUntil ends the rotation grace period of PreviousHash.
+	PreviousValidUntil *time.Time
+	Scopes             []string
+	RateLimitRPM       *int
+	IsActive           bool
+	// CertIdentities are the client certificate identities that
+	// authenticate as this key; see auth.CertIdentities.
+	CertIdentities []string
 }
 
+// RequestRecord is one metered request. The JSON names match the
+// columns of the requests table.
 type RequestRecord struct {
-	ID                   string
-	EnvironmentID        string
-	RouteID              *string
-	APIKeyID             string
-	RequestID            string
-	StartedAt            time.Time
-	CompletedAt          *time.Time
-	DurationMs           *int
-	Status               string
-	ModelID              *string
-	ProviderID           *string
-	ModelIdentifier      string
-	InputTokens          int
-	OutputTokens         int
-	EstimatedTokens      bool
-	InputCostUSD         float64
-	OutputCostUSD        float64
-	TotalCostUSD         float64
-	PromptHash           *string
-	IsStreaming          bool
-	ToolCallCount        int
-	AttemptNumber        int
-	FallbackReason       *string
-	SchemaValid          *bool
-	SchemaRepairAttempts int
-	ErrorCode            *string
-	ErrorMessage         *string
-	ActionTaken          string
+	ID                   string     `json:"id,omitempty"`
+	EnvironmentID        string     `json:"environment_id"`
+	RouteID              *string    `json:"route_id"`
+	APIKeyID             string     `json:"api_key_id"`
+	RequestID            string     `json:"request_id"`
+	StartedAt            time.Time  `json:"started_at"`
+	CompletedAt          *time.Time `json:"completed_at"`
+	DurationMs           *int       `json:"duration_ms"`
+	Status               string     `json:"status"`
+	ModelID              *string    `json:"model_id"`
+	ProviderID           *string    `json:"provider_id"`
+	ModelIdentifier      string     `json:"model_identifier"`
+	InputTokens          int        `json:"input_tokens"`
+	OutputTokens         int        `json:"output_tokens"`
+	EstimatedTokens      bool       `json:"estimated_tokens"`
+	InputCostUSD         float64    `json:"input_cost_usd"`
+	OutputCostUSD        float64    `json:"output_cost_usd"`
+	TotalCostUSD         float64    `json:"total_cost_usd"`
+	PromptHash           *string    `json:"prompt_hash"`
+	IsStreaming          bool       `json:"is_streaming"`
+	ToolCallCount        int        `json:"tool_call_count"`
+	AttemptNumber        int        `json:"attempt_number"`
+	FallbackReason       *string    `json:"fallback_reason"`
+	SchemaValid          *bool      `json:"schema_valid"`
+	SchemaRepairAttempts int        `json:"schema_repair_attempts"`
+	ErrorCode            *string    `json:"error_code"`
+	ErrorMessage         *string    `json:"error_message"`
+	ActionTaken          string     `json:"action_taken"`
+	BatchID              *string    `json:"batch_id"`
+	TraceID              *string    `json:"trace_id"`
+	// TraceParent identifies the span that produced the record, so the
+	// meter write can be traced as its child. It is not stored.
+	TraceParent string `json:"-"`
+}
+
+// BatchFile is an uploaded batch input file or a batch output file.
+type BatchFile struct {
+	ID            string
+	EnvironmentID string
+	APIKeyID      *string
+	Purpose       string
+	Filename      string
+	Bytes         int
+	Content       []byte
+	CreatedAt     time.Time
+}
+
+// Batch is a background job running the lines of a JSONL file through
+// the pipeline.
+type Batch struct {
+	ID                string
+	EnvironmentID     string
+	APIKeyID          *string
+	RouteSlug         *string
+	Endpoint          string
+	InputFileID       string
+	OutputFileID      *string
+	ErrorFileID       *string
+	CompletionWindow  string
+	Status            string
+	TotalRequests     int
+	CompletedRequests int
+	FailedRequests    int
+	Errors            []BatchError
+	Metadata          map[string]string
+	CreatedAt         time.Time
+	ExpiresAt         time.Time
+	InProgressAt      *time.Time
+	FinalizingAt      *time.Time
+	CompletedAt       *time.Time
+	FailedAt          *time.Time
+	ExpiredAt         *time.Time
+	CancellingAt      *time.Time
+	CancelledAt       *time.Time
+	// LeaseExpiresAt is when the gateway running the batch stops holding
+	// it, unless it renews the lease; nil while no gateway holds it.
+	LeaseExpiresAt *time.Time
+}
+
+// BatchError describes an input line that failed validation.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line"`
 }
 
 // RequestContext carries state through the pipeline.
 type RequestContext struct {
+	RequestID       string
 	TraceID         string
 	APIKey          *APIKey
 	Environment     *Environment
@@ -221,4 +374,5 @@ type RequestContext struct {
 	ActionTaken     string
 	AttemptNumber   int
 	FallbackReason  *string
+	BatchID         string
 }
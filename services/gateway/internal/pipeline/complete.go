@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/crypto"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/schema"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// Complete sends a resolved request to the candidate models until one
+// succeeds, validates the output against the route schema and meters the
+// result.
+func (p *Pipeline) Complete(ctx context.Context, r *Request) (*model.ChatCompletionResponse, error) {
+	rc := r.RC
+
+	cacheKey := ""
+	if r.guards.CacheEnabled && p.cache != nil {
+		cacheKey = cache.CacheKey(rc.Route.ID+":"+r.Body.Model, r.Body.Messages, r.Body.Temperature, r.Body.MaxTokens, r.Body.Tools)
+		if entry, ok := p.cache.Get(cacheKey); ok {
+			var cached model.ChatCompletionResponse
+			if err := json.Unmarshal(entry.Response, &cached); err == nil {
+				p.recordCacheHit(r, entry)
+				return &cached, nil
+			}
+		}
+	}
+
+	var (
+		resp   *model.ChatCompletionResponse
+		served *attempt
+	)
+	err := p.execute(ctx, r, func(a *attempt) *failure {
+		upstream := *r.Body
+		upstream.Model = a.model.ModelID
+		upstream.Stream = false
+
+		attemptCtx, span := p.startAttempt(a.ctx, r, operationChat, a.model, a.cfg)
+		res, err := a.impl.Send(attemptCtx, &upstream, a.cfg)
+		if err != nil {
+			return p.failAttempt(r, span, a.err(err))
+		}
+		endAttempt(span, nil, res.ID, res.Model, finishReasons(res.Choices), res.Usage)
+		resp, served = res, a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := rc.SelectedModel
+	rec := p.newRecord(r, statusSuccess)
+	p.applyUsage(&rec, r, m, resp.Usage, responseText(resp))
+	rec.ToolCallCount = countToolCalls(resp.Choices)
+
+	if rc.Route.OutputSchema != nil {
+		valid, attempts := p.enforceSchema(ctx, r, resp, served)
+		rec.SchemaValid = &valid
+		rec.SchemaRepairAttempts = attempts
+		rec.ActionTaken = rc.ActionTaken
+		if !valid && rc.Route.SchemaStrict {
+			e := newError(http.StatusBadGateway, "api_error", "schema_validation_failed", "model output does not match the route output schema")
+			p.logFailure(r, e)
+			p.finish(r, withError(rec, statusError, e))
+			return nil, e
+		}
+	}
+
+	if r.guards.MaxToolCalls > 0 && p.loops.CheckToolCalls(rec.ToolCallCount, r.guards.MaxToolCalls) {
+		e := errRateLimited("loop_detected", "response requested %d tool calls, limit is %d", rec.ToolCallCount, r.guards.MaxToolCalls)
+		p.logFailure(r, e)
+		p.finish(r, withError(rec, statusError, e))
+		return nil, e
+	}
+
+	p.finish(r, rec)
+
+	if cacheKey != "" {
+		if raw, err := json.Marshal(resp); err == nil {
+			scope := cache.Scope{EnvironmentID: rc.Environment.ID, RouteID: rc.Route.ID, RouteSlug: rc.Route.Slug}
+			p.cache.SetScoped(scope, cacheKey, raw, m.ModelID, rec.InputTokens, rec.OutputTokens, rec.TotalCostUSD)
+		}
+	}
+
+	return resp, nil
+}
+
+// connect loads the provider of a model and builds the per-request
+// provider configuration, decrypting the stored API key.
+func (p *Pipeline) connect(ctx context.Context, r *Request, m *model.ModelInfo) (provider.Provider, provider.ProviderConfig, error) {
+	prov, err := p.config.LoadProvider(ctx, m.ProviderID)
+	if err != nil {
+		return nil, provider.ProviderConfig{}, fmt.Errorf("load provider: %w", err)
+	}
+	r.RC.Provider = prov
+
+	impl, ok := p.registry.Get(prov.ProviderType)
+	if !ok {
+		return nil, provider.ProviderConfig{}, fmt.Errorf("provider type %q is not supported", prov.ProviderType)
+	}
+
+	apiKey := prov.APIKey
+	if prov.APIKeyEnc != nil {
+		apiKey, err = crypto.Decrypt(*prov.APIKeyEnc, p.masterKey)
+		if err != nil {
+			return nil, provider.ProviderConfig{}, fmt.Errorf("decrypt provider key: %w", err)
+		}
+	}
+
+	return impl, provider.ProviderConfig{
+		BaseURL:   prov.BaseURL,
+		APIKey:    apiKey,
+		ModelID:   m.ModelID,
+		TimeoutMs: int(r.guards.AttemptTimeout.Milliseconds()),
+		Metadata:  prov.Metadata,
+	}, nil
+}
+
+// enforceSchema validates the first choice against the route output schema
+// and runs auto-repair when the route enables it, through the connection
+// of the attempt that produced resp. The repaired content replaces the
+// original in resp.
+func (p *Pipeline) enforceSchema(ctx context.Context, r *Request, resp *model.ChatCompletionResponse, served *attempt) (bool, int) {
+	if len(resp.Choices) == 0 || resp.Choices[0].Message == nil {
+		return false, 0
+	}
+	content, _ := resp.Choices[0].Message.Content.(string)
+	outputSchema := r.RC.Route.OutputSchema
+
+	result := p.validate(ctx, content, outputSchema)
+	if result.Valid || !r.guards.AutoRepair {
+		return result.Valid, 0
+	}
+
+	repairModel := p.repairModel(r)
+	cfg := served.cfg
+	cfg.ModelID = repairModel.ModelID
+	attempts := 0
+	for attempts < r.guards.RepairMaxAttempts {
+		attempts++
+		repairCtx, span := p.startSpan(ctx, "gateway.schema.repair",
+			tracing.Int("gateway.repair_attempt", attempts),
+			tracing.String("gen_ai.request.model", repairModel.ModelID))
+		repaired, err := p.repairer.Repair(repairCtx, served.impl, cfg, content, result.Errors, outputSchema)
+		if err != nil {
+			span.SetError("repair_failed", err.Error())
+			span.End()
+			r.log(p.logger).Warn("schema repair failed", "attempt", attempts, "error", err)
+			continue
+		}
+		span.End()
+		content = repaired
+		result = p.validate(ctx, content, outputSchema)
+		if result.Valid {
+			break
+		}
+	}
+
+	r.RC.ActionTaken = "repair"
+	resp.Choices[0].Message.Content = content
+	return result.Valid, attempts
+}
+
+// validate checks content against the route output schema.
+func (p *Pipeline) validate(ctx context.Context, content string, outputSchema interface{}) *schema.ValidationResult {
+	_, span := p.startSpan(ctx, "gateway.schema.validate")
+	defer span.End()
+	result := p.validator.Validate(content, outputSchema)
+	span.SetAttributes(
+		tracing.Bool("gateway.schema_valid", result.Valid),
+		tracing.Int("gateway.schema_errors", len(result.Errors)))
+	return result
+}
+
+// repairModel returns the candidate named by auto_repair.repair_model when
+// it shares a provider with the selected model, else the selected model.
+func (p *Pipeline) repairModel(r *Request) *model.ModelInfo {
+	want := r.guards.RepairModel
+	selected := r.RC.SelectedModel
+	if want == "" {
+		return selected
+	}
+	for i := range r.Candidates {
+		m := &r.Candidates[i]
+		if (m.ID == want || m.ModelID == want) && m.ProviderID == selected.ProviderID {
+			return m
+		}
+	}
+	return selected
+}
+
+// responseText concatenates the generated content and tool call payloads.
+func responseText(resp *model.ChatCompletionResponse) string {
+	var b strings.Builder
+	for _, c := range resp.Choices {
+		if c.Message == nil {
+			continue
+		}
+		if text, ok := c.Message.Content.(string); ok {
+			b.WriteString(text)
+		}
+		for _, tc := range c.Message.ToolCalls {
+			b.WriteString(tc.Function.Name)
+			b.WriteString(tc.Function.Arguments)
+		}
+	}
+	return b.String()
+}
+
+func countToolCalls(choices []model.Choice) int {
+	n := 0
+	for _, c := range choices {
+		if c.Message != nil {
+			n += len(c.Message.ToolCalls)
+		}
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/filestore"
+	"github.com/openfive/gateway/internal/loop"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/schema"
+	"github.com/openfive/gateway/internal/token"
+)
+
+func TestComplete_RepairUsesFileProviderKey(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		auths []string
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auths = append(auths, r.Header.Get("Authorization"))
+		content := "not json"
+		if len(auths) > 1 {
+			content = `{"ok": true}`
+		}
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      "resp",
+			"model":   "gpt-4o-mini",
+			"choices": []map[string]interface{}{{"index": 0, "message": map[string]string{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+		})
+	}))
+	defer upstream.Close()
+
+	t.Setenv("PIPELINE_TEST_OPENAI_KEY", "sk-file")
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	config := `
+providers:
+  - name: openai
+    type: openai_compatible
+    base_url: ` + upstream.URL + `
+    api_key_env: PIPELINE_TEST_OPENAI_KEY
+models:
+  - provider: openai
+    model_id: gpt-4o-mini
+    context_window: 128000
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := filestore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewGeneric(upstream.Client()))
+	w := meter.NewWriter(&memorySink{}, 100, 60000, nil, nil)
+	defer w.Close()
+	p := New(Options{
+		Config:    store,
+		Registry:  registry,
+		Estimator: token.NewEstimator(),
+		Loops:     loop.NewDetector(),
+		Validator: schema.NewValidator(),
+		Repairer:  schema.NewRepairer(),
+		Meter:     w,
+	})
+
+	r := newScriptedRequest(0, time.Minute, "gpt-4o-mini")
+	r.Candidates[0].ProviderID = "openai"
+	r.RC.Route.OutputSchema = map[string]interface{}{"type": "object", "required": []interface{}{"ok"}}
+	r.guards.AutoRepair = true
+
+	resp, err := p.Complete(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if content, _ := resp.Choices[0].Message.Content.(string); content != `{"ok": true}` {
+		t.Errorf("content = %q, want the repaired output", content)
+	}
+	if len(auths) != 2 {
+		t.Fatalf("upstream called %d times, want the request and one repair", len(auths))
+	}
+	for i, auth := range auths {
+		if auth != "Bearer sk-file" {
+			t.Errorf("call %d Authorization = %q, want the key from the config file", i+1, auth)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// ResolveEmbedding prepares an embeddings request. The requested model must
+// be reachable through the route; without one the route's preferred model,
+// or else its first model, is used.
+func (p *Pipeline) ResolveEmbedding(
+	ctx context.Context,
+	key *model.APIKey,
+	routeSlug string,
+	body *model.EmbeddingRequest,
+) (*Request, error) {
+	if body.Input == nil {
+		return nil, errInvalidRequest("missing_input", "input must not be empty")
+	}
+
+	r := newRequest(ctx, key, body.Model, hashInput(body.Input))
+	r.Embedding = body
+	if err := p.admit(ctx, r, routeSlug); err != nil {
+		return nil, err
+	}
+	rc, env, route := r.RC, r.RC.Environment, r.RC.Route
+
+	catalog, err := p.config.LoadModelsForEnv(ctx, env.OrganizationID)
+	if err != nil {
+		return nil, errInternal("load models: %v", err)
+	}
+	models := routeModels(route, catalog)
+	if route.PreferredModel != nil {
+		models = preferRequested(models, *route.PreferredModel)
+	}
+	models = preferRequested(models, body.Model)
+	if len(models) == 0 {
+		return nil, p.fail(r, statusError, errInvalidRequest("no_eligible_model", "no models are available for this route"))
+	}
+	// No fallback: embeddings of different models are not comparable.
+	r.Candidates = models[:1]
+
+	m := &r.Candidates[0]
+	rc.SelectedModel = m
+	rc.EstInputTokens = p.estimator.EstimateEmbeddingInput(body.Input)
+	rc.EstCostUSD = p.estimator.EstimateCost(rc.EstInputTokens, 0, m.InputPricePerM, 0)
+
+	if _, err := p.enforceBudget(ctx, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Embed sends a resolved embeddings request to the selected provider,
+// retrying retryable failures, and meters the input tokens.
+func (p *Pipeline) Embed(ctx context.Context, r *Request) (*model.EmbeddingResponse, error) {
+	var resp *model.EmbeddingResponse
+	err := p.execute(ctx, r, func(a *attempt) *failure {
+		upstream := *r.Embedding
+		upstream.Model = a.model.ModelID
+
+		attemptCtx, span := p.startAttempt(a.ctx, r, operationEmbeddings, a.model, a.cfg)
+		res, err := a.impl.Embed(attemptCtx, &upstream, a.cfg)
+		if err != nil {
+			return p.failAttempt(r, span, a.err(err))
+		}
+		endAttempt(span, nil, "", res.Model, nil, res.Usage)
+		resp = res
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rec := p.newRecord(r, statusSuccess)
+	p.applyUsage(&rec, r, r.RC.SelectedModel, resp.Usage, "")
+	p.finish(r, rec)
+	return resp, nil
+}
+
+func hashInput(input interface{}) string {
+	b, _ := json.Marshal(input)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/openfive/gateway/internal/provider"
+)
+
+// ErrShutdown is the cancellation cause of a stream cut off because the
+// gateway is shutting down. Such streams end with a final error event and
+// are metered as partial.
+var ErrShutdown = errors.New("gateway shutting down")
+
+// Error is a pipeline failure that maps onto an OpenAI-compatible error response.
+type Error struct {
+	Status  int
+	Type    string
+	Code    string
+	Message string
+	// RetryAfter is relayed to the client as the Retry-After header when
+	// set.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(status int, errType, code, format string, args ...interface{}) *Error {
+	return &Error{
+		Status:  status,
+		Type:    errType,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func errInvalidRequest(code, format string, args ...interface{}) *Error {
+	return newError(http.StatusBadRequest, "invalid_request_error", code, format, args...)
+}
+
+func errUnauthorized(format string, args ...interface{}) *Error {
+	return newError(http.StatusUnauthorized, "authentication_error", "invalid_api_key", format, args...)
+}
+
+func errForbidden(code, format string, args ...interface{}) *Error {
+	return newError(http.StatusForbidden, "permission_error", code, format, args...)
+}
+
+func errNotFound(code, format string, args ...interface{}) *Error {
+	return newError(http.StatusNotFound, "not_found_error", code, format, args...)
+}
+
+func errRateLimited(code, format string, args ...interface{}) *Error {
+	return newError(http.StatusTooManyRequests, "rate_limit_error", code, format, args...)
+}
+
+func errBudget(format string, args ...interface{}) *Error {
+	return newError(http.StatusPaymentRequired, "insufficient_quota", "budget_exceeded", format, args...)
+}
+
+func errUpstream(format string, args ...interface{}) *Error {
+	return newError(http.StatusBadGateway, "api_error", "provider_error", format, args...)
+}
+
+func errInternal(format string, args ...interface{}) *Error {
+	return newError(http.StatusInternalServerError, "api_error", "internal_error", format, args...)
+}
+
+// providerError maps a failed provider call onto the request status and
+// the error returned to the client. Failures the client has to fix, such
+// as an overlong prompt or filtered content, are invalid requests; rate
+// limits and overload keep their status and wait so clients back off;
+// anything else is an upstream failure.
+func providerError(err error) (string, *Error) {
+	var pe *provider.ProviderError
+	var filtered *provider.ContentFilterError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return statusTimeout, newError(http.StatusGatewayTimeout, "api_error", "provider_timeout", "provider request timed out")
+	case errors.As(err, &filtered):
+		return statusError, errInvalidRequest("content_filter", "%s", filtered.Error())
+	case !errors.As(err, &pe):
+		return statusError, errUpstream("%v", err)
+	}
+
+	var e *Error
+	switch pe.Kind {
+	case provider.KindTimeout:
+		return statusTimeout, newError(http.StatusGatewayTimeout, "api_error", "provider_timeout", "provider request timed out")
+	case provider.KindRateLimited:
+		code := "rate_limit_exceeded"
+		if !pe.Retryable {
+			code = "insufficient_quota"
+		}
+		e = errRateLimited(code, "%v", err)
+	case provider.KindOverloaded:
+		e = newError(http.StatusServiceUnavailable, "api_error", "provider_overloaded", "%v", err)
+	case provider.KindContextLength:
+		e = errInvalidRequest("context_length_exceeded", "%v", err)
+	case provider.KindBadRequest:
+		e = errInvalidRequest("provider_bad_request", "%v", err)
+	case provider.KindAuth:
+		// The provider rejected the gateway's credentials, not the client's.
+		e = errUpstream("%v", err)
+		e.Code = "provider_auth_error"
+	default:
+		e = errUpstream("%v", err)
+	}
+	e.RetryAfter = pe.RetryAfter
+	return statusError, e
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+const (
+	// retryBaseDelay is the backoff bound of the first retry; it doubles
+	// with every retry on the same model.
+	retryBaseDelay = 250 * time.Millisecond
+	// maxRetryDelay is the longest wait for a retry on the same model. A
+	// provider asking for a longer wait is left for the next candidate.
+	maxRetryDelay = 5 * time.Second
+)
+
+// errAttemptTimeout is the cancellation cause of an attempt whose response
+// did not start within cfg.TimeoutMs.
+var errAttemptTimeout = errors.New("provider did not respond in time")
+
+// attempt is one provider call on a candidate model.
+type attempt struct {
+	ctx   context.Context
+	impl  provider.Provider
+	cfg   provider.ProviderConfig
+	model *model.ModelInfo
+	timer *time.Timer
+}
+
+// responding lifts the timeout off an attempt whose response has started
+// arriving, as streams may run past it.
+func (a *attempt) responding() {
+	a.timer.Stop()
+}
+
+// err returns the error of a failed call, as a retryable timeout when the
+// attempt's timeout cut it off, so the request moves on to another try.
+func (a *attempt) err(err error) error {
+	if cause := context.Cause(a.ctx); errors.Is(cause, errAttemptTimeout) {
+		return &provider.ProviderError{
+			Kind:      provider.KindTimeout,
+			Retryable: true,
+			Err:       fmt.Errorf("%w after %dms", cause, a.cfg.TimeoutMs),
+		}
+	}
+	return err
+}
+
+// failure is a failed attempt, already metered.
+type failure struct {
+	err *Error
+	// cause is the provider error, nil for failures in the gateway.
+	cause error
+	// final ends the request without further attempts, as when a stream
+	// failed after reaching the client.
+	final bool
+}
+
+// execute calls the candidates in order until one succeeds, and returns
+// the error of the last attempt when none does. Retryable provider
+// failures are retried on the same model, up to the route's max_retries,
+// after a jittered exponential backoff or the wait the provider asked
+// for; other failures move on to the next candidate. No attempt starts,
+// and no retry is waited for, past the route's retry deadline. An attempt
+// in flight is bounded by its own timeout instead, so a long response is
+// not cut off by the deadline but a provider that never answers is.
+//
+// The outcome of every provider call is recorded on the circuit breakers.
+//
+// call makes and meters one attempt on r.RC.SelectedModel. Each attempt
+// is metered as its own record under the request ID, numbered by
+// AttemptNumber, with the code of the failure that led to it as
+// FallbackReason.
+func (p *Pipeline) execute(ctx context.Context, r *Request, call func(a *attempt) *failure) error {
+	rc := r.RC
+	deadline := time.Now().Add(r.guards.RetryTimeout)
+
+	var last *failure
+	for i := range r.Candidates {
+		m := &r.Candidates[i]
+		for retries := 0; ; retries++ {
+			if last != nil {
+				reason := last.err.Code
+				rc.AttemptNumber++
+				rc.FallbackReason = &reason
+				rc.StartedAt = time.Now()
+			}
+			rc.SelectedModel = m
+
+			last = p.attempt(ctx, r, m, call)
+			if last == nil {
+				p.circuits.Record(m.ProviderID, m.ModelID, nil)
+				return nil
+			}
+			if last.cause != nil {
+				p.circuits.Record(m.ProviderID, m.ModelID, last.cause)
+			}
+			if last.final || ctx.Err() != nil || !time.Now().Before(deadline) {
+				p.logFailure(r, last.err)
+				return last.err
+			}
+
+			wait, retry := retryDelay(last.cause, retries, r.guards.MaxRetries)
+			if !retry || time.Now().Add(wait).After(deadline) {
+				r.log(p.logger).Warn("provider attempt failed, trying the next model",
+					"attempt", rc.AttemptNumber, "code", last.err.Code, "error", last.err.Message)
+				break
+			}
+			r.log(p.logger).Warn("provider attempt failed, retrying",
+				"attempt", rc.AttemptNumber, "code", last.err.Code, "error", last.err.Message, "wait", wait)
+			select {
+			case <-ctx.Done():
+				p.logFailure(r, last.err)
+				return last.err
+			case <-time.After(wait):
+			}
+		}
+	}
+	p.logFailure(r, last.err)
+	return last.err
+}
+
+// attempt connects to the provider of m and runs call on it, cancelling
+// the call when its response has not started within cfg.TimeoutMs.
+func (p *Pipeline) attempt(ctx context.Context, r *Request, m *model.ModelInfo, call func(a *attempt) *failure) *failure {
+	impl, cfg, err := p.connect(ctx, r, m)
+	if err != nil {
+		e := errInternal("%v", err)
+		p.finish(r, withError(p.newRecord(r, statusError), statusError, e))
+		return &failure{err: e}
+	}
+
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	a := &attempt{ctx: attemptCtx, impl: impl, cfg: cfg, model: m}
+	a.timer = time.AfterFunc(time.Duration(cfg.TimeoutMs)*time.Millisecond, func() { cancel(errAttemptTimeout) })
+	defer a.timer.Stop()
+
+	return call(a)
+}
+
+// failAttempt ends the span of a provider call that returned err and
+// meters the attempt.
+func (p *Pipeline) failAttempt(r *Request, span *tracing.Span, err error) *failure {
+	status, e := providerError(err)
+	endAttempt(span, e, "", "", nil, nil)
+	p.finish(r, withError(p.newRecord(r, status), status, e))
+	return &failure{err: e, cause: err}
+}
+
+// retryDelay returns how long to wait before calling the same model
+// again, and false when the failure is not worth retrying on it. The
+// backoff is drawn at random up to an exponential bound, so requests
+// failing together do not retry together.
+func retryDelay(cause error, retries, maxRetries int) (time.Duration, bool) {
+	var pe *provider.ProviderError
+	if retries >= maxRetries || !errors.As(cause, &pe) || !pe.Retryable {
+		return 0, false
+	}
+	if pe.RetryAfter > 0 {
+		return pe.RetryAfter, pe.RetryAfter <= maxRetryDelay
+	}
+	bound := min(retryBaseDelay<<retries, maxRetryDelay)
+	return time.Duration(rand.Int64N(int64(bound))) + time.Millisecond, true
+}
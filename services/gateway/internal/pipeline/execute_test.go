@@ -0,0 +1,390 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/circuit"
+	"github.com/openfive/gateway/internal/loop"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/token"
+)
+
+// errHang makes a scripted call block until its context ends.
+var errHang = errors.New("hang")
+
+// scriptedProvider answers each call on a model with the next error
+// scripted for it, nil meaning success, after the model's delay. Streams
+// relay the model's chunks and then fail with its stream error, if any.
+type scriptedProvider struct {
+	mu        sync.Mutex
+	results   map[string][]error
+	delays    map[string]time.Duration
+	chunks    map[string][]string
+	streamErr map[string]error
+	calls     []string
+}
+
+func (s *scriptedProvider) Name() string { return "scripted" }
+
+func (s *scriptedProvider) next(ctx context.Context, modelID string) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, modelID)
+	var err error
+	if results := s.results[modelID]; len(results) > 0 {
+		err, s.results[modelID] = results[0], results[1:]
+	}
+	delay := s.delays[modelID]
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("send request: %w", ctx.Err())
+	case <-time.After(delay):
+	}
+	if err == errHang {
+		<-ctx.Done()
+		return fmt.Errorf("send request: %w", ctx.Err())
+	}
+	return err
+}
+
+func (s *scriptedProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg provider.ProviderConfig) (*model.ChatCompletionResponse, error) {
+	if err := s.next(ctx, req.Model); err != nil {
+		return nil, err
+	}
+	return &model.ChatCompletionResponse{
+		ID:      "resp-" + req.Model,
+		Model:   req.Model,
+		Choices: []model.Choice{{Message: &model.Message{Role: "assistant", Content: "ok"}, FinishReason: strPtr("stop")}},
+		Usage:   &model.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}, nil
+}
+
+func (s *scriptedProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg provider.ProviderConfig) (provider.StreamReader, error) {
+	if err := s.next(ctx, req.Model); err != nil {
+		return nil, err
+	}
+	return &scriptedStream{chunks: s.chunks[req.Model], err: s.streamErr[req.Model]}, nil
+}
+
+func (s *scriptedProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg provider.ProviderConfig) (*model.EmbeddingResponse, error) {
+	return nil, errors.New("not scripted")
+}
+
+type scriptedStream struct {
+	chunks []string
+	err    error
+}
+
+func (s *scriptedStream) Next() (*model.ChatCompletionChunk, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	text := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return &model.ChatCompletionChunk{Choices: []model.Choice{{Delta: &model.Message{Content: text}}}}, nil
+}
+
+func (s *scriptedStream) Close() error { return nil }
+
+type scriptedConfig struct{ ConfigSource }
+
+func (scriptedConfig) LoadProvider(ctx context.Context, providerID string) (*model.Provider, error) {
+	return &model.Provider{ID: providerID, Name: providerID, ProviderType: "scripted"}, nil
+}
+
+type memorySink struct {
+	mu   sync.Mutex
+	recs []model.RequestRecord
+}
+
+func (s *memorySink) Write(ctx context.Context, rec *model.RequestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs = append(s.recs, *rec)
+	return nil
+}
+
+func newScriptedPipeline(t *testing.T, prov *scriptedProvider) (*Pipeline, func() []model.RequestRecord) {
+	registry := provider.NewRegistry()
+	registry.Register(prov)
+	sink := &memorySink{}
+	w := meter.NewWriter(sink, 100, 60000, nil, nil)
+	t.Cleanup(w.Close)
+	p := New(Options{
+		Config:    scriptedConfig{},
+		Registry:  registry,
+		Estimator: token.NewEstimator(),
+		Loops:     loop.NewDetector(),
+		Meter:     w,
+	})
+	return p, func() []model.RequestRecord {
+		w.Flush()
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		return append([]model.RequestRecord(nil), sink.recs...)
+	}
+}
+
+func newScriptedRequest(maxRetries int, timeout time.Duration, models ...string) *Request {
+	r := newRequest(context.Background(), &model.APIKey{ID: "key", EnvironmentID: "env"}, models[0], "hash")
+	r.RC.Environment = &model.Environment{ID: "env"}
+	r.RC.Route = &model.Route{ID: "route", Slug: "default"}
+	r.Body = &model.ChatCompletionRequest{Model: models[0], Messages: []model.Message{{Role: "user", Content: "Hi"}}}
+	r.guards = parseGuardrails(nil)
+	r.guards.MaxRetries = maxRetries
+	r.guards.RetryTimeout = timeout
+	for _, id := range models {
+		r.Candidates = append(r.Candidates, model.ModelInfo{ID: id, ProviderID: "provider-" + id, ModelID: id})
+	}
+	r.RC.SelectedModel = &r.Candidates[0]
+	return r
+}
+
+type attemptWant struct {
+	model, status, reason string
+}
+
+func checkAttempts(t *testing.T, recs []model.RequestRecord, want []attemptWant) {
+	t.Helper()
+	if len(recs) != len(want) {
+		t.Fatalf("metered %d attempts, want %d: %+v", len(recs), len(want), recs)
+	}
+	for i, rec := range recs {
+		reason := ""
+		if rec.FallbackReason != nil {
+			reason = *rec.FallbackReason
+		}
+		if rec.AttemptNumber != i+1 || rec.ModelIdentifier != want[i].model || rec.Status != want[i].status || reason != want[i].reason {
+			t.Errorf("attempt %d = #%d %s %s reason %q, want %+v", i+1, rec.AttemptNumber, rec.ModelIdentifier, rec.Status, reason, want[i])
+		}
+		if rec.RequestID != recs[0].RequestID {
+			t.Errorf("attempt %d has request ID %s, want %s", i+1, rec.RequestID, recs[0].RequestID)
+		}
+	}
+}
+
+func TestComplete_RetriesThenFallsBack(t *testing.T) {
+	overloaded := &provider.ProviderError{Kind: provider.KindOverloaded, Status: 529, Retryable: true}
+	prov := &scriptedProvider{results: map[string][]error{"primary": {overloaded, overloaded}}}
+	p, records := newScriptedPipeline(t, prov)
+	r := newScriptedRequest(1, time.Minute, "primary", "backup")
+
+	resp, err := p.Complete(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Model != "backup" || r.RC.SelectedModel.ModelID != "backup" {
+		t.Errorf("served by %s, want backup", resp.Model)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"primary", statusError, ""},
+		{"primary", statusError, "provider_overloaded"},
+		{"backup", statusSuccess, "provider_overloaded"},
+	})
+}
+
+func TestComplete_HardFailureFallsThrough(t *testing.T) {
+	tooLong := &provider.ProviderError{Kind: provider.KindContextLength, Status: 400}
+	prov := &scriptedProvider{results: map[string][]error{"small": {tooLong}}}
+	p, records := newScriptedPipeline(t, prov)
+
+	if _, err := p.Complete(context.Background(), newScriptedRequest(2, time.Minute, "small", "large")); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"small", statusError, ""},
+		{"large", statusSuccess, "context_length_exceeded"},
+	})
+}
+
+func TestComplete_AllCandidatesFail(t *testing.T) {
+	rejected := &provider.ProviderError{Kind: provider.KindBadRequest, Status: 400}
+	denied := &provider.ProviderError{Kind: provider.KindAuth, Status: 401}
+	prov := &scriptedProvider{results: map[string][]error{"a": {rejected}, "b": {denied}}}
+	p, records := newScriptedPipeline(t, prov)
+
+	_, err := p.Complete(context.Background(), newScriptedRequest(2, time.Minute, "a", "b"))
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "provider_auth_error" {
+		t.Fatalf("err = %v, want the last attempt's error", err)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"a", statusError, ""},
+		{"b", statusError, "provider_bad_request"},
+	})
+}
+
+func TestComplete_Deadline(t *testing.T) {
+	prov := &scriptedProvider{results: map[string][]error{"slow": {errHang}}}
+	p, records := newScriptedPipeline(t, prov)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.Complete(ctx, newScriptedRequest(2, time.Minute, "slow", "fast"))
+	var e *Error
+	if !errors.As(err, &e) || e.Status != http.StatusGatewayTimeout {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	checkAttempts(t, records(), []attemptWant{{"slow", statusTimeout, ""}})
+	if len(prov.calls) != 1 {
+		t.Errorf("calls = %v, want no attempt after the request timed out", prov.calls)
+	}
+}
+
+func TestComplete_RetryDeadline(t *testing.T) {
+	overloaded := &provider.ProviderError{Kind: provider.KindOverloaded, Status: 529, Retryable: true}
+	prov := &scriptedProvider{
+		results: map[string][]error{"a": {overloaded}},
+		delays:  map[string]time.Duration{"a": 100 * time.Millisecond, "b": 100 * time.Millisecond},
+	}
+	p, records := newScriptedPipeline(t, prov)
+
+	// The call outlives the retry deadline, and is not cut off by it.
+	resp, err := p.Complete(context.Background(), newScriptedRequest(2, 50*time.Millisecond, "b"))
+	if err != nil || resp.Model != "b" {
+		t.Fatalf("Complete = %v, %v; want the slow response", resp, err)
+	}
+
+	// A call failing past the deadline is not retried or fallen back from.
+	_, err = p.Complete(context.Background(), newScriptedRequest(2, 50*time.Millisecond, "a", "b"))
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "provider_overloaded" {
+		t.Fatalf("err = %v, want the failed attempt's error", err)
+	}
+	checkAttempts(t, records()[1:], []attemptWant{{"a", statusError, ""}})
+	if len(prov.calls) != 2 {
+		t.Errorf("calls = %v, want no attempt after the deadline", prov.calls)
+	}
+}
+
+func TestComplete_AttemptTimeout(t *testing.T) {
+	prov := &scriptedProvider{results: map[string][]error{"hung": {errHang}}}
+	p, records := newScriptedPipeline(t, prov)
+	r := newScriptedRequest(0, time.Minute, "hung", "backup")
+	r.guards.AttemptTimeout = 50 * time.Millisecond
+
+	resp, err := p.Complete(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if resp.Model != "backup" {
+		t.Errorf("served by %s, want backup", resp.Model)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"hung", statusTimeout, ""},
+		{"backup", statusSuccess, "provider_timeout"},
+	})
+}
+
+func TestStream_AttemptTimeout(t *testing.T) {
+	prov := &scriptedProvider{
+		results: map[string][]error{"hung": {errHang}},
+		chunks:  map[string][]string{"backup": {"Hi"}},
+	}
+	p, records := newScriptedPipeline(t, prov)
+	r := newScriptedRequest(0, time.Minute, "hung", "backup")
+	r.guards.AttemptTimeout = 50 * time.Millisecond
+	r.Body.Stream = true
+
+	err := p.Stream(context.Background(), r, func(chunk *model.ChatCompletionChunk) error { return nil })
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"hung", statusTimeout, ""},
+		{"backup", statusSuccess, "provider_timeout"},
+	})
+}
+
+func TestComplete_RecordsCircuitOutcomes(t *testing.T) {
+	overloaded := &provider.ProviderError{Kind: provider.KindOverloaded, Status: 529, Retryable: true}
+	tooLong := &provider.ProviderError{Kind: provider.KindContextLength, Status: 400}
+	prov := &scriptedProvider{results: map[string][]error{"primary": {overloaded, overloaded}, "small": {tooLong, tooLong}}}
+	p, _ := newScriptedPipeline(t, prov)
+	cfg := circuit.DefaultConfig()
+	cfg.MinCalls = 2
+	p.circuits = circuit.New(cfg, nil, nil, nil)
+
+	if _, err := p.Complete(context.Background(), newScriptedRequest(1, time.Minute, "primary", "backup")); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, err := p.Complete(context.Background(), newScriptedRequest(1, time.Minute, "small", "backup")); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if !p.circuits.Open("provider-primary", "primary") {
+		t.Error("failed attempts did not open the circuit")
+	}
+	if p.circuits.Open("provider-backup", "backup") || p.circuits.Open("provider-small", "small") {
+		t.Error("opened the circuit of a model that answered or rejected the request")
+	}
+}
+
+func TestStream_FallsBackOnlyBeforeFirstChunk(t *testing.T) {
+	overloaded := &provider.ProviderError{Kind: provider.KindOverloaded, Retryable: true}
+	prov := &scriptedProvider{
+		chunks:    map[string][]string{"a": nil, "b": {"Hel", "lo"}},
+		streamErr: map[string]error{"a": overloaded, "b": overloaded},
+	}
+	p, records := newScriptedPipeline(t, prov)
+	r := newScriptedRequest(0, time.Minute, "a", "b", "c")
+	r.Body.Stream = true
+
+	var relayed string
+	err := p.Stream(context.Background(), r, func(chunk *model.ChatCompletionChunk) error {
+		relayed += chunk.Choices[0].Delta.Content.(string)
+		return nil
+	})
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "provider_overloaded" {
+		t.Fatalf("err = %v, want the interrupted stream's error", err)
+	}
+	if relayed != "Hello" {
+		t.Errorf("relayed %q, want Hello", relayed)
+	}
+	checkAttempts(t, records(), []attemptWant{
+		{"a", statusError, ""},
+		{"b", statusError, "provider_overloaded"},
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	retryable := &provider.ProviderError{Kind: provider.KindOverloaded, Retryable: true}
+	for retries := 0; retries < 3; retries++ {
+		wait, ok := retryDelay(retryable, retries, 3)
+		if bound := retryBaseDelay<<retries + time.Millisecond; !ok || wait <= 0 || wait > bound {
+			t.Errorf("retry %d: wait %v, %v; want up to %v", retries, wait, ok, bound)
+		}
+	}
+	if _, ok := retryDelay(retryable, 3, 3); ok {
+		t.Error("retried past max retries")
+	}
+
+	limited := &provider.ProviderError{Kind: provider.KindRateLimited, Retryable: true, RetryAfter: 2 * time.Second}
+	if wait, ok := retryDelay(limited, 0, 2); !ok || wait != 2*time.Second {
+		t.Errorf("Retry-After: wait %v, %v; want 2s", wait, ok)
+	}
+	limited.RetryAfter = time.Minute
+	if _, ok := retryDelay(limited, 0, 2); ok {
+		t.Error("waited a minute on the same model")
+	}
+
+	if _, ok := retryDelay(&provider.ProviderError{Kind: provider.KindBadRequest}, 0, 2); ok {
+		t.Error("retried a bad request")
+	}
+	if _, ok := retryDelay(errors.New("load provider: not found"), 0, 2); ok {
+		t.Error("retried a gateway failure")
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import "time"
+
+// guardrails is the typed view of a route's guardrail_settings JSON.
+type guardrails struct {
+	LoopDetection       bool
+	MaxIdenticalPrompts int
+	LoopWindowSeconds   int
+	MaxToolCalls        int
+
+	AutoRepair        bool
+	RepairMaxAttempts int
+	RepairModel       string
+
+	CacheEnabled bool
+
+	// MaxRetries is how often a retryable failure is retried on the same
+	// model; RetryTimeout bounds all attempts of a request together, and
+	// AttemptTimeout how long one attempt waits for its response to start.
+	MaxRetries     int
+	RetryTimeout   time.Duration
+	AttemptTimeout time.Duration
+}
+
+func parseGuardrails(settings map[string]interface{}) guardrails {
+	g := guardrails{
+		LoopWindowSeconds: 60,
+		RepairMaxAttempts: 1,
+		MaxRetries:        2,
+		RetryTimeout:      120 * time.Second,
+		AttemptTimeout:    60 * time.Second,
+	}
+
+	if ld := subMap(settings, "loop_detection"); ld != nil {
+		g.LoopDetection = boolField(ld, "enabled")
+		g.MaxIdenticalPrompts = intField(ld, "max_identical_prompts", 0)
+		g.LoopWindowSeconds = intField(ld, "window_seconds", g.LoopWindowSeconds)
+		g.MaxToolCalls = intField(ld, "max_tool_calls_per_request", 0)
+	}
+
+	if ar := subMap(settings, "auto_repair"); ar != nil {
+		g.AutoRepair = boolField(ar, "enabled")
+		g.RepairMaxAttempts = intField(ar, "max_attempts", g.RepairMaxAttempts)
+		g.RepairModel, _ = ar["repair_model"].(string)
+	}
+
+	if c := subMap(settings, "cache"); c != nil {
+		g.CacheEnabled = boolField(c, "enabled")
+	}
+
+	if r := subMap(settings, "retry"); r != nil {
+		g.MaxRetries = max(intField(r, "max_retries", g.MaxRetries), 0)
+		if ms := intField(r, "timeout_ms", 0); ms > 0 {
+			g.RetryTimeout = time.Duration(ms) * time.Millisecond
+		}
+		if ms := intField(r, "attempt_timeout_ms", 0); ms > 0 {
+			g.AttemptTimeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	return g
+}
+
+func subMap(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func boolField(m map[string]interface{}, key string) bool {
+	v, _ := m[key].(bool)
+	return v
+}
+
+func intField(m map[string]interface{}, key string, fallback int) int {
+	switch v := m[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return fallback
+}
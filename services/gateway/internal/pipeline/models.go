@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// RouteModels is a route together with the models it can dispatch to.
+type RouteModels struct {
+	Route  model.Route
+	Models []model.ModelInfo
+}
+
+// Catalog lists the routes an API key may call and the models reachable
+// through each of them. Keys pinned to a route only see that route.
+func (p *Pipeline) Catalog(ctx context.Context, key *model.APIKey) ([]RouteModels, error) {
+	env, err := p.config.LoadEnvironment(ctx, key.EnvironmentID)
+	if err != nil {
+		return nil, errInternal("load environment: %v", err)
+	}
+
+	var routes []model.Route
+	if key.RouteID != nil {
+		route, err := p.config.LoadRouteByID(ctx, env.ID, *key.RouteID)
+		if err != nil {
+			return nil, nil
+		}
+		routes = []model.Route{*route}
+	} else {
+		routes, err = p.config.LoadRoutesForEnv(ctx, env.ID)
+		if err != nil {
+			return nil, errInternal("load routes: %v", err)
+		}
+	}
+
+	catalog, err := p.config.LoadModelsForEnv(ctx, env.OrganizationID)
+	if err != nil {
+		return nil, errInternal("load models: %v", err)
+	}
+
+	result := make([]RouteModels, 0, len(routes))
+	for i := range routes {
+		result = append(result, RouteModels{
+			Route:  routes[i],
+			Models: routeModels(&routes[i], catalog),
+		})
+	}
+	return result, nil
+}
+
+// routeModels returns the catalog models a route can dispatch to, applying
+// the same allowed-models and fallback-chain rules as the router.
+func routeModels(route *model.Route, catalog []model.ModelInfo) []model.ModelInfo {
+	models := catalog
+	if len(route.AllowedModels) > 0 {
+		models = filterByID(models, route.AllowedModels)
+	}
+	if len(route.FallbackChain) > 0 {
+		models = filterByID(models, route.FallbackChain)
+	}
+	return models
+}
+
+func filterByID(models []model.ModelInfo, ids []string) []model.ModelInfo {
+	keep := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	var result []model.ModelInfo
+	for _, m := range models {
+		if keep[m.ID] {
+			result = append(result, m)
+		}
+	}
+	return result
+}
@@ -0,0 +1,459 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/anomaly"
+	"github.com/openfive/gateway/internal/auth"
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/circuit"
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/loop"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/metrics"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/router"
+	"github.com/openfive/gateway/internal/schema"
+	"github.com/openfive/gateway/internal/token"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// defaultRouteSlug is used when neither the key, the headers nor the
+// requested model name a route.
+const defaultRouteSlug = "default"
+
+// Request statuses as stored in requests.status.
+const (
+	statusSuccess       = "success"
+	statusError         = "error"
+	statusTimeout       = "timeout"
+	statusBudgetBlocked = "budget_blocked"
+	statusKilled        = "killed"
+	statusPartial       = "partial"
+)
+
+// ConfigSource loads the configuration a request is served with.
+// *configcache.Cache serves it from memory. Options.Config defaults to
+// Options.Store.
+type ConfigSource interface {
+	LoadEnvironment(ctx context.Context, envID string) (*model.Environment, error)
+	LoadRoute(ctx context.Context, envID, slug string) (*model.Route, error)
+	LoadRouteByID(ctx context.Context, envID, routeID string) (*model.Route, error)
+	LoadRoutesForEnv(ctx context.Context, envID string) ([]model.Route, error)
+	LoadModelsForEnv(ctx context.Context, orgID string) ([]model.ModelInfo, error)
+	LoadProvider(ctx context.Context, providerID string) (*model.Provider, error)
+}
+
+// Store is the gateway's storage: *db.Queries for Postgres or
+// *filestore.Store for a config file.
+type Store interface {
+	ConfigSource
+	UpdateLastUsed(ctx context.Context, keyID string) error
+	IncrementBudgetUsed(ctx context.Context, envID string, costUSD float64) error
+}
+
+// Options holds the components a Pipeline is assembled from.
+type Options struct {
+	Auth       *auth.Authenticator
+	Store      Store
+	Config     ConfigSource
+	Estimator  *token.Estimator
+	Router     *router.Engine
+	Budget     *budget.Enforcer
+	Limiter    *budget.RateLimiter
+	Registry   *provider.Registry
+	Circuits   *circuit.Breakers
+	Validator  *schema.Validator
+	Repairer   *schema.Repairer
+	Cache      *cache.Cache
+	Loops      *loop.Detector
+	Anomaly    *anomaly.Detector
+	KillSwitch *anomaly.KillSwitch
+	Meter      *meter.Writer
+	MasterKey  string
+	Logger     *slog.Logger
+	Metrics    *metrics.Gateway
+	Tracer     *tracing.Tracer
+}
+
+// Pipeline runs gateway requests through authentication, route
+// resolution, model selection, budget enforcement, the provider call,
+// schema validation and metering.
+type Pipeline struct {
+	auth       *auth.Authenticator
+	store      Store
+	config     ConfigSource
+	estimator  *token.Estimator
+	router     *router.Engine
+	budget     *budget.Enforcer
+	limiter    *budget.RateLimiter
+	registry   *provider.Registry
+	circuits   *circuit.Breakers
+	validator  *schema.Validator
+	repairer   *schema.Repairer
+	cache      *cache.Cache
+	loops      *loop.Detector
+	anomaly    *anomaly.Detector
+	killSwitch *anomaly.KillSwitch
+	meter      *meter.Writer
+	masterKey  string
+	logger     *slog.Logger
+	metrics    *metrics.Gateway
+	tracer     *tracing.Tracer
+
+	// background tracks budget and kill switch updates that outlive the
+	// request that triggered them.
+	background sync.WaitGroup
+}
+
+func New(opts Options) *Pipeline {
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	config := opts.Config
+	if config == nil && opts.Store != nil {
+		config = opts.Store
+	}
+	return &Pipeline{
+		auth:       opts.Auth,
+		store:      opts.Store,
+		config:     config,
+		estimator:  opts.Estimator,
+		router:     opts.Router,
+		budget:     opts.Budget,
+		limiter:    opts.Limiter,
+		registry:   opts.Registry,
+		circuits:   opts.Circuits,
+		validator:  opts.Validator,
+		repairer:   opts.Repairer,
+		cache:      opts.Cache,
+		loops:      opts.Loops,
+		anomaly:    opts.Anomaly,
+		killSwitch: opts.KillSwitch,
+		meter:      opts.Meter,
+		masterKey:  opts.MasterKey,
+		logger:     logger,
+		metrics:    opts.Metrics,
+		tracer:     opts.Tracer,
+	}
+}
+
+// Close waits for the budget and kill switch updates of finished requests.
+// Call it after the server has stopped serving requests.
+func (p *Pipeline) Close() {
+	p.background.Wait()
+}
+
+// Request is a request that has passed route resolution and the pre-flight
+// guards and is ready to be sent to a provider. Exactly one of Body and
+// Embedding is set.
+type Request struct {
+	RC         *model.RequestContext
+	Body       *model.ChatCompletionRequest
+	Embedding  *model.EmbeddingRequest
+	Candidates []model.ModelInfo
+	PromptHash string
+
+	requested string
+	guards    guardrails
+	// span is the span the request arrived in; the metered outcome is
+	// recorded on it.
+	span *tracing.Span
+}
+
+// Authenticate validates the Authorization header and returns the API key.
+func (p *Pipeline) Authenticate(ctx context.Context, authHeader string) (*model.APIKey, error) {
+	ctx, span := p.startSpan(ctx, "gateway.auth")
+	defer span.End()
+
+	key, err := p.auth.Authenticate(ctx, authHeader)
+	if err != nil {
+		e := errUnauthorized("%s", err.Error())
+		span.SetError(e.Code, e.Message)
+		return nil, e
+	}
+	span.SetAttributes(
+		tracing.String("gateway.api_key_id", key.ID),
+		tracing.String("gateway.environment_id", key.EnvironmentID))
+
+	go func(keyID string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.store.UpdateLastUsed(ctx, keyID); err != nil {
+			p.logger.Warn("update key last_used_at", "api_key_id", keyID, "error", err)
+		}
+	}(key.ID)
+
+	return key, nil
+}
+
+// Resolve prepares a chat completion: it admits the request, runs loop
+// detection, selects candidate models and evaluates the budget.
+// Rejections are metered before they are returned.
+func (p *Pipeline) Resolve(
+	ctx context.Context,
+	key *model.APIKey,
+	routeSlug string,
+	body *model.ChatCompletionRequest,
+) (*Request, error) {
+	if len(body.Messages) == 0 {
+		return nil, errInvalidRequest("missing_messages", "messages must not be empty")
+	}
+
+	r := newRequest(ctx, key, body.Model, hashPrompt(body.Messages))
+	r.Body = body
+	if err := p.admit(ctx, r, routeSlug); err != nil {
+		return nil, err
+	}
+	rc, env, route := r.RC, r.RC.Environment, r.RC.Route
+
+	if r.guards.LoopDetection && p.loops.CheckPrompt(env.ID, route.ID, r.PromptHash, r.guards.MaxIdenticalPrompts, r.guards.LoopWindowSeconds) {
+		return nil, p.fail(r, statusError, errRateLimited("loop_detected",
+			"identical prompt sent more than %d times in %d seconds", r.guards.MaxIdenticalPrompts, r.guards.LoopWindowSeconds))
+	}
+
+	if limit := route.MaxTokensPerRequest; limit != nil && (body.MaxTokens == nil || *body.MaxTokens > *limit) {
+		maxTokens := *limit
+		body.MaxTokens = &maxTokens
+	}
+
+	rc.EstInputTokens = p.estimator.EstimateInput(body.Messages)
+
+	catalog, err := p.config.LoadModelsForEnv(ctx, env.OrganizationID)
+	if err != nil {
+		return nil, errInternal("load models: %v", err)
+	}
+	_, span := p.startSpan(ctx, "gateway.router.select",
+		tracing.String("gateway.route", route.Slug),
+		tracing.Int("gateway.catalog_size", len(catalog)))
+	selected, err := p.router.Select(body, route, env, catalog, rc.EstInputTokens)
+	if err == nil && len(selected) == 0 {
+		err = fmt.Errorf("no models in the fallback chain are available")
+	}
+	if err != nil {
+		span.SetError("no_eligible_model", err.Error())
+		span.End()
+		return nil, p.fail(r, statusError, errInvalidRequest("no_eligible_model", "%v", err))
+	}
+	r.Candidates = preferRequested(selected, body.Model)
+	span.SetAttributes(
+		tracing.Int("gateway.candidates", len(r.Candidates)),
+		tracing.String("gen_ai.request.model", r.Candidates[0].ModelID))
+	span.End()
+
+	p.estimate(r)
+	action, err := p.enforceBudget(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if action == budget.ActionDowngrade {
+		r.Candidates = cheapestFirst(r.Candidates)
+		p.estimate(r)
+	}
+
+	return r, nil
+}
+
+// newRequest starts a request in the trace carried by ctx, or in a new
+// trace when there is none.
+func newRequest(ctx context.Context, key *model.APIKey, requested, promptHash string) *Request {
+	batchID, _ := ctx.Value(batchIDKey{}).(string)
+	traceID := newID()
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		traceID = sc.TraceID.String()
+	}
+	return &Request{
+		RC: &model.RequestContext{
+			RequestID:     newID(),
+			TraceID:       traceID,
+			APIKey:        key,
+			StartedAt:     time.Now(),
+			ActionTaken:   budget.ActionAllow.String(),
+			AttemptNumber: 1,
+			BatchID:       batchID,
+		},
+		PromptHash: promptHash,
+		requested:  requested,
+		span:       tracing.SpanFromContext(ctx),
+	}
+}
+
+// log returns a logger carrying the request's trace ID, environment,
+// route, model and provider as far as they are known.
+func (r *Request) log(l *slog.Logger) *slog.Logger {
+	rc := r.RC
+	envID := ""
+	if rc.Environment != nil {
+		envID = rc.Environment.ID
+	} else if rc.APIKey != nil {
+		envID = rc.APIKey.EnvironmentID
+	}
+	route, modelID, provider := r.labels()
+	return logging.Request(l, rc.TraceID, envID, route, modelID, provider).With("request_id", rc.RequestID)
+}
+
+// labels returns the route slug, model and provider name of the request,
+// empty when not yet known.
+func (r *Request) labels() (route, modelID, provider string) {
+	rc := r.RC
+	if rc.Route != nil {
+		route = rc.Route.Slug
+	}
+	modelID = r.requested
+	if rc.SelectedModel != nil {
+		modelID = rc.SelectedModel.ModelID
+	}
+	if rc.Provider != nil {
+		provider = rc.Provider.Name
+	}
+	return route, modelID, provider
+}
+
+type batchIDKey struct{}
+
+// WithBatchID returns a context whose requests are metered as part of the
+// given batch.
+func WithBatchID(ctx context.Context, batchID string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, batchID)
+}
+
+// admit loads the environment and route for a request and applies the
+// kill switch and the key and route rate limits.
+func (p *Pipeline) admit(ctx context.Context, r *Request, routeSlug string) error {
+	rc := r.RC
+	key := rc.APIKey
+
+	env, err := p.config.LoadEnvironment(ctx, key.EnvironmentID)
+	if err != nil {
+		return errInternal("load environment: %v", err)
+	}
+	rc.Environment = env
+	p.killSwitch.Observe(env.ID, env.KillswitchActive)
+
+	if env.KillswitchActive {
+		reason := "kill switch is active for this environment"
+		if env.KillswitchReason != nil {
+			reason += ": " + *env.KillswitchReason
+		}
+		return p.fail(r, statusKilled, errForbidden("killswitch_active", "%s", reason))
+	}
+
+	_, span := p.startSpan(ctx, "gateway.route.resolve", tracing.String("gateway.route_requested", routeSlug))
+	route, err := p.resolveRoute(ctx, key, routeSlug, r.requested)
+	if err != nil {
+		span.SetError("route_not_found", err.Error())
+		span.End()
+		return errNotFound("route_not_found", "no active route matches this request")
+	}
+	span.SetAttributes(tracing.String("gateway.route", route.Slug))
+	span.End()
+	rc.Route = route
+	r.guards = parseGuardrails(route.GuardrailSettings)
+
+	if key.RateLimitRPM != nil && !p.limiter.Allow("key:"+key.ID, *key.RateLimitRPM) {
+		return p.fail(r, statusError, errRateLimited("rate_limit_exceeded", "API key rate limit of %d requests per minute exceeded", *key.RateLimitRPM))
+	}
+	if route.MaxRequestsPerMin != nil && !p.limiter.Allow("route:"+route.ID, *route.MaxRequestsPerMin) {
+		return p.fail(r, statusError, errRateLimited("rate_limit_exceeded", "route rate limit of %d requests per minute exceeded", *route.MaxRequestsPerMin))
+	}
+
+	return nil
+}
+
+// enforceBudget evaluates the environment budget against the estimated
+// cost, rejecting blocked and throttled requests.
+func (p *Pipeline) enforceBudget(ctx context.Context, r *Request) (budget.Action, error) {
+	rc := r.RC
+	_, span := p.startSpan(ctx, "gateway.budget", tracing.Float("gateway.estimated_cost_usd", rc.EstCostUSD))
+	decision := p.budget.Evaluate(rc.Environment, rc.Route, rc.EstCostUSD)
+	span.SetAttributes(tracing.String("gateway.budget.action", decision.Action.String()))
+	span.End()
+	rc.ActionTaken = decision.Action.String()
+	switch decision.Action {
+	case budget.ActionBlock:
+		return decision.Action, p.fail(r, statusBudgetBlocked, errBudget("%s", decision.Reason))
+	case budget.ActionThrottle:
+		return decision.Action, p.fail(r, statusBudgetBlocked, errRateLimited("budget_throttled", "%s", decision.Reason))
+	}
+	return decision.Action, nil
+}
+
+// resolveRoute picks the route pinned to the key, then the route named by
+// the X-Route-Id header, then a route whose slug matches the requested
+// model, and finally the environment's default route.
+func (p *Pipeline) resolveRoute(ctx context.Context, key *model.APIKey, routeSlug, requested string) (*model.Route, error) {
+	if key.RouteID != nil {
+		return p.config.LoadRouteByID(ctx, key.EnvironmentID, *key.RouteID)
+	}
+	if routeSlug != "" {
+		return p.config.LoadRoute(ctx, key.EnvironmentID, routeSlug)
+	}
+	if requested != "" {
+		if route, err := p.config.LoadRoute(ctx, key.EnvironmentID, requested); err == nil {
+			return route, nil
+		}
+	}
+	return p.config.LoadRoute(ctx, key.EnvironmentID, defaultRouteSlug)
+}
+
+// estimate fills the token and cost estimates for the primary candidate.
+func (p *Pipeline) estimate(r *Request) {
+	rc := r.RC
+	primary := &r.Candidates[0]
+	rc.SelectedModel = primary
+	rc.EstOutputTokens = p.estimator.EstimateOutput(r.Body, primary.MaxOutputTokens, rc.EstInputTokens)
+	rc.EstCostUSD = p.estimator.EstimateCost(rc.EstInputTokens, rc.EstOutputTokens, primary.InputPricePerM, primary.OutputPricePerM)
+}
+
+// preferRequested moves the model the client asked for to the front of the
+// candidate list when it is one of the selected models.
+func preferRequested(models []model.ModelInfo, requested string) []model.ModelInfo {
+	if requested == "" {
+		return models
+	}
+	for i, m := range models {
+		if m.ModelID == requested || m.ID == requested {
+			result := make([]model.ModelInfo, 0, len(models))
+			result = append(result, models[i])
+			result = append(result, models[:i]...)
+			result = append(result, models[i+1:]...)
+			return result
+		}
+	}
+	return models
+}
+
+// cheapestFirst orders candidates by combined per-token price.
+func cheapestFirst(models []model.ModelInfo) []model.ModelInfo {
+	result := make([]model.ModelInfo, len(models))
+	copy(result, models)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].InputPricePerM+result[i].OutputPricePerM <
+			result[j].InputPricePerM+result[j].OutputPricePerM
+	})
+	return result
+}
+
+func hashPrompt(messages []model.Message) string {
+	b, _ := json.Marshal(messages)
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
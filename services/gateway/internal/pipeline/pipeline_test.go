@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+func TestParseGuardrails_Defaults(t *testing.T) {
+	g := parseGuardrails(nil)
+	if g.LoopDetection || g.AutoRepair || g.CacheEnabled {
+		t.Errorf("expected all guardrails disabled, got %+v", g)
+	}
+	if g.LoopWindowSeconds != 60 {
+		t.Errorf("default LoopWindowSeconds = %d, want 60", g.LoopWindowSeconds)
+	}
+	if g.RepairMaxAttempts != 1 {
+		t.Errorf("default RepairMaxAttempts = %d, want 1", g.RepairMaxAttempts)
+	}
+	if g.MaxRetries != 2 || g.RetryTimeout != 120*time.Second || g.AttemptTimeout != 60*time.Second {
+		t.Errorf("default retry = %d, %v, %v, want 2, 120s, 60s", g.MaxRetries, g.RetryTimeout, g.AttemptTimeout)
+	}
+}
+
+func TestParseGuardrails_FromJSONSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"loop_detection": map[string]interface{}{
+			"enabled":                    true,
+			"max_identical_prompts":      float64(5),
+			"window_seconds":             float64(30),
+			"max_tool_calls_per_request": float64(20),
+		},
+		"auto_repair": map[string]interface{}{
+			"enabled":      true,
+			"max_attempts": float64(2),
+			"repair_model": "gpt-4o-mini",
+		},
+		"cache": map[string]interface{}{"enabled": true},
+		"retry": map[string]interface{}{"max_retries": float64(0), "timeout_ms": float64(30000), "attempt_timeout_ms": float64(10000)},
+	}
+
+	g := parseGuardrails(settings)
+	if !g.LoopDetection || g.MaxIdenticalPrompts != 5 || g.LoopWindowSeconds != 30 || g.MaxToolCalls != 20 {
+		t.Errorf("unexpected loop detection settings: %+v", g)
+	}
+	if !g.AutoRepair || g.RepairMaxAttempts != 2 || g.RepairModel != "gpt-4o-mini" {
+		t.Errorf("unexpected auto repair settings: %+v", g)
+	}
+	if !g.CacheEnabled {
+		t.Error("expected cache enabled")
+	}
+	if g.MaxRetries != 0 || g.RetryTimeout != 30*time.Second || g.AttemptTimeout != 10*time.Second {
+		t.Errorf("unexpected retry settings: %+v", g)
+	}
+}
+
+func TestPreferRequested_MovesMatchToFront(t *testing.T) {
+	models := []model.ModelInfo{
+		{ID: "a", ModelID: "openai/gpt-4o"},
+		{ID: "b", ModelID: "anthropic/claude-sonnet"},
+		{ID: "c", ModelID: "meta/llama"},
+	}
+
+	result := preferRequested(models, "meta/llama")
+	if result[0].ID != "c" || result[1].ID != "a" || result[2].ID != "b" {
+		t.Errorf("unexpected order: %s, %s, %s", result[0].ID, result[1].ID, result[2].ID)
+	}
+}
+
+func TestPreferRequested_NoMatchKeepsOrder(t *testing.T) {
+	models := []model.ModelInfo{{ID: "a"}, {ID: "b"}}
+
+	result := preferRequested(models, "support_summarize")
+	if result[0].ID != "a" || result[1].ID != "b" {
+		t.Errorf("expected order unchanged, got %s, %s", result[0].ID, result[1].ID)
+	}
+}
+
+func TestCheapestFirst(t *testing.T) {
+	models := []model.ModelInfo{
+		{ID: "expensive", InputPricePerM: 10, OutputPricePerM: 30},
+		{ID: "cheap", InputPricePerM: 0.1, OutputPricePerM: 0.4},
+		{ID: "mid", InputPricePerM: 1, OutputPricePerM: 2},
+	}
+
+	result := cheapestFirst(models)
+	if result[0].ID != "cheap" || result[1].ID != "mid" || result[2].ID != "expensive" {
+		t.Errorf("unexpected order: %s, %s, %s", result[0].ID, result[1].ID, result[2].ID)
+	}
+	if models[0].ID != "expensive" {
+		t.Error("cheapestFirst must not reorder its input")
+	}
+}
+
+func TestRouteModels_AppliesAllowedAndChain(t *testing.T) {
+	catalog := []model.ModelInfo{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	all := routeModels(&model.Route{}, catalog)
+	if len(all) != 3 {
+		t.Errorf("unrestricted route: got %d models, want 3", len(all))
+	}
+
+	allowed := routeModels(&model.Route{AllowedModels: []string{"a", "c"}}, catalog)
+	if len(allowed) != 2 || allowed[0].ID != "a" || allowed[1].ID != "c" {
+		t.Errorf("allowed models: got %+v", allowed)
+	}
+
+	chained := routeModels(&model.Route{
+		AllowedModels: []string{"a", "c"},
+		FallbackChain: []string{"b", "c"},
+	}, catalog)
+	if len(chained) != 1 || chained[0].ID != "c" {
+		t.Errorf("fallback chain: got %+v", chained)
+	}
+}
+
+func TestProviderError(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status string
+		http   int
+		code   string
+	}{
+		{"timeout", fmt.Errorf("send request: %w", context.DeadlineExceeded), statusTimeout, http.StatusGatewayTimeout, "provider_timeout"},
+		{"content filter", &provider.ContentFilterError{Status: 400, Source: "prompt"}, statusError, http.StatusBadRequest, "content_filter"},
+		{"other", errors.New("provider error 500: boom"), statusError, http.StatusBadGateway, "provider_error"},
+		{"typed timeout", &provider.ProviderError{Kind: provider.KindTimeout, Status: 504}, statusTimeout, http.StatusGatewayTimeout, "provider_timeout"},
+		{"rate limited", &provider.ProviderError{Kind: provider.KindRateLimited, Status: 429, Retryable: true}, statusError, http.StatusTooManyRequests, "rate_limit_exceeded"},
+		{"quota", &provider.ProviderError{Kind: provider.KindRateLimited, Status: 429}, statusError, http.StatusTooManyRequests, "insufficient_quota"},
+		{"overloaded", &provider.ProviderError{Kind: provider.KindOverloaded, Status: 529}, statusError, http.StatusServiceUnavailable, "provider_overloaded"},
+		{"context length", &provider.ProviderError{Kind: provider.KindContextLength, Status: 400}, statusError, http.StatusBadRequest, "context_length_exceeded"},
+		{"bad request", &provider.ProviderError{Kind: provider.KindBadRequest, Status: 400}, statusError, http.StatusBadRequest, "provider_bad_request"},
+		{"auth", &provider.ProviderError{Kind: provider.KindAuth, Status: 401}, statusError, http.StatusBadGateway, "provider_auth_error"},
+		{"network", &provider.ProviderError{Kind: provider.KindNetwork, Err: errors.New("connection refused")}, statusError, http.StatusBadGateway, "provider_error"},
+		{"wrapped content filter", &provider.ProviderError{Kind: provider.KindContentFilter, Status: 400,
+			Err: &provider.ContentFilterError{Status: 400, Source: "prompt"}}, statusError, http.StatusBadRequest, "content_filter"},
+	}
+	for _, c := range cases {
+		status, e := providerError(c.err)
+		if status != c.status || e.Status != c.http || e.Code != c.code {
+			t.Errorf("%s: got %s, %d %s; want %s, %d %s", c.name, status, e.Status, e.Code, c.status, c.http, c.code)
+		}
+	}
+}
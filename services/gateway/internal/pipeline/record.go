@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// defaultAnomalyWindow applies when an environment has no anomaly window set.
+const defaultAnomalyWindow = 5 * time.Minute
+
+// newRecord builds a request record from the request context.
+func (p *Pipeline) newRecord(r *Request, status string) model.RequestRecord {
+	rc := r.RC
+	now := time.Now()
+	durationMs := int(now.Sub(rc.StartedAt).Milliseconds())
+
+	rec := model.RequestRecord{
+		EnvironmentID:   rc.Environment.ID,
+		APIKeyID:        rc.APIKey.ID,
+		RequestID:       rc.RequestID,
+		StartedAt:       rc.StartedAt,
+		CompletedAt:     &now,
+		DurationMs:      &durationMs,
+		Status:          status,
+		ModelIdentifier: r.requested,
+		IsStreaming:     r.Body != nil && r.Body.Stream,
+		AttemptNumber:   rc.AttemptNumber,
+		FallbackReason:  rc.FallbackReason,
+		ActionTaken:     rc.ActionTaken,
+	}
+	if r.PromptHash != "" {
+		rec.PromptHash = &r.PromptHash
+	}
+	if rc.Route != nil {
+		rec.RouteID = &rc.Route.ID
+	}
+	if rc.BatchID != "" {
+		rec.BatchID = &rc.BatchID
+	}
+	if rc.TraceID != "" {
+		rec.TraceID = &rc.TraceID
+	}
+	if sc := r.span.SpanContext(); sc.IsValid() {
+		rec.TraceParent = sc.Traceparent()
+	}
+	if m := rc.SelectedModel; m != nil {
+		rec.ModelID = &m.ID
+		rec.ProviderID = &m.ProviderID
+		rec.ModelIdentifier = m.ModelID
+	}
+	return rec
+}
+
+// applyUsage sets token counts and costs on a record. When the provider
+// reported no usage, tokens are estimated from the prompt and the generated
+// output and the record is flagged as estimated.
+func (p *Pipeline) applyUsage(rec *model.RequestRecord, r *Request, m *model.ModelInfo, usage *model.Usage, output string) {
+	if usage != nil {
+		rec.InputTokens = usage.PromptTokens
+		rec.OutputTokens = usage.CompletionTokens
+	} else {
+		rec.InputTokens = r.RC.EstInputTokens
+		rec.OutputTokens = p.estimator.EstimateText(output)
+		rec.EstimatedTokens = true
+	}
+	rec.InputCostUSD = p.estimator.EstimateCost(rec.InputTokens, 0, m.InputPricePerM, 0)
+	rec.OutputCostUSD = p.estimator.EstimateCost(0, rec.OutputTokens, 0, m.OutputPricePerM)
+	rec.TotalCostUSD = rec.InputCostUSD + rec.OutputCostUSD
+}
+
+func withError(rec model.RequestRecord, status string, e *Error) model.RequestRecord {
+	rec.Status = status
+	rec.ErrorCode = &e.Code
+	rec.ErrorMessage = &e.Message
+	return rec
+}
+
+// fail meters a failed request and returns the error for the client.
+func (p *Pipeline) fail(r *Request, status string, e *Error) error {
+	p.logFailure(r, e)
+	p.finish(r, withError(p.newRecord(r, status), status, e))
+	return e
+}
+
+// logFailure logs a failed request. Provider and gateway faults are
+// errors; rejections by the gateway's own guards are warnings and other
+// client errors are informational.
+func (p *Pipeline) logFailure(r *Request, e *Error) {
+	level := slog.LevelInfo
+	switch {
+	case e.Status >= 500:
+		level = slog.LevelError
+	case e.Status == http.StatusPaymentRequired, e.Status == http.StatusForbidden, e.Status == http.StatusTooManyRequests:
+		level = slog.LevelWarn
+	}
+	r.log(p.logger).Log(context.Background(), level, "request failed",
+		"status", e.Status, "code", e.Code, "error", e.Message)
+}
+
+// recordCacheHit meters a request served from the prompt cache. The
+// tokens are recorded for visibility but no cost is charged.
+func (p *Pipeline) recordCacheHit(r *Request, entry *cache.Entry) {
+	rec := p.newRecord(r, statusSuccess)
+	rec.ModelIdentifier = entry.Model
+	rec.InputTokens = entry.InputTokens
+	rec.OutputTokens = entry.OutputTokens
+	rec.ActionTaken = "cache_hit"
+	p.finish(r, rec)
+}
+
+// finish hands the record to the meter writer and, for billable requests,
+// charges the environment budget and feeds the anomaly detector.
+func (p *Pipeline) finish(r *Request, rec model.RequestRecord) {
+	traceOutcome(r, &rec)
+	p.meter.Record(rec)
+	route, modelID, provider := r.labels()
+	p.metrics.ObserveRequest(route, modelID, provider, rec.Status,
+		time.Since(r.RC.StartedAt), rec.InputTokens, rec.OutputTokens, rec.TotalCostUSD)
+	if rec.ErrorCode == nil && rec.DurationMs != nil {
+		r.log(p.logger).Debug("request completed",
+			"action", rec.ActionTaken, "input_tokens", rec.InputTokens, "output_tokens", rec.OutputTokens,
+			"cost_usd", rec.TotalCostUSD, "duration_ms", *rec.DurationMs)
+	}
+	if rec.TotalCostUSD <= 0 {
+		return
+	}
+
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.store.IncrementBudgetUsed(ctx, rec.EnvironmentID, rec.TotalCostUSD); err != nil {
+			r.log(p.logger).Error("increment budget", "cost_usd", rec.TotalCostUSD, "error", err)
+		}
+	}()
+
+	p.observeCost(r, rec.TotalCostUSD)
+}
+
+// observeCost records spend in the anomaly detector and trips the kill
+// switch when the window total exceeds the baseline times the multiplier.
+func (p *Pipeline) observeCost(r *Request, costUSD float64) {
+	env := r.RC.Environment
+	window := env.AnomalyWindow
+	if window <= 0 {
+		window = defaultAnomalyWindow
+	}
+
+	detected, total := p.anomaly.Observe(env.ID, costUSD, env.AnomalyMultiplier, window)
+	if !detected || env.KillswitchActive {
+		return
+	}
+
+	reason := fmt.Sprintf("cost anomaly: $%.4f spent in the last %s", total, window)
+	trigger := map[string]interface{}{
+		"window_total_usd": total,
+		"window":           window.String(),
+		"multiplier":       env.AnomalyMultiplier,
+	}
+	logger := r.log(p.logger).With("window_total_usd", total, "window", window.String(), "multiplier", env.AnomalyMultiplier)
+	p.background.Add(1)
+	go func() {
+		defer p.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.killSwitch.Activate(ctx, env.ID, reason, trigger); err != nil {
+			logger.Error("activate kill switch", "reason", reason, "error", err)
+			return
+		}
+		logger.Warn("kill switch activated", "reason", reason)
+	}()
+}
@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+// Stream sends a resolved request to the candidate models in streaming
+// mode and passes every chunk to emit. A failed attempt moves on as in
+// Complete until the first chunk reaches the client; after that failures
+// end the request. The relayed deltas, tool calls and the final usage
+// chunk are accumulated so the request can be metered once the stream
+// ends.
+func (p *Pipeline) Stream(ctx context.Context, r *Request, emit func(*model.ChatCompletionChunk) error) error {
+	// Usage is always requested upstream; only relay it when the client
+	// asked for it, as OpenAI does.
+	wantUsage := r.Body.StreamOptions != nil && r.Body.StreamOptions.IncludeUsage
+
+	return p.execute(ctx, r, func(a *attempt) *failure {
+		return p.streamAttempt(ctx, r, a, wantUsage, emit)
+	})
+}
+
+func (p *Pipeline) streamAttempt(ctx context.Context, r *Request, a *attempt, wantUsage bool, emit func(*model.ChatCompletionChunk) error) *failure {
+	upstream := *r.Body
+	upstream.Model = a.model.ModelID
+	upstream.Stream = true
+	upstream.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+
+	attemptCtx, span := p.startAttempt(a.ctx, r, operationChat, a.model, a.cfg)
+	stream, err := a.impl.SendStream(attemptCtx, &upstream, a.cfg)
+	if err != nil {
+		return p.failAttempt(r, span, a.err(err))
+	}
+	defer stream.Close()
+
+	acc := newStreamAccumulator()
+	status := statusSuccess
+	var streamErr *Error
+	var cause error
+	emitted := false
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cause = a.err(err)
+			status = statusError
+			streamErr = errUpstream("stream interrupted: %v", cause)
+			switch {
+			case errors.Is(context.Cause(ctx), ErrShutdown):
+				status = statusPartial
+				streamErr = newError(http.StatusServiceUnavailable, "api_error", "server_shutdown", "the gateway is shutting down; the stream was cut short")
+			case errors.Is(cause, context.DeadlineExceeded):
+				status = statusTimeout
+				streamErr = newError(http.StatusGatewayTimeout, "api_error", "provider_timeout", "provider stream timed out")
+			case errors.As(cause, new(*provider.ProviderError)):
+				status, streamErr = providerError(cause)
+				streamErr.Message = "stream interrupted: " + streamErr.Message
+			}
+			break
+		}
+		a.responding()
+
+		acc.add(chunk)
+		if !wantUsage {
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			chunk.Usage = nil
+		}
+		emitted = true
+		if err := emit(chunk); err != nil {
+			status = statusError
+			streamErr = errInvalidRequest("client_disconnected", "client disconnected before the stream completed")
+			break
+		}
+	}
+
+	var reasons []string
+	if acc.finishReason != "" {
+		reasons = []string{acc.finishReason}
+	}
+	endAttempt(span, streamErr, acc.id, acc.model, reasons, acc.usage)
+
+	rec := p.newRecord(r, status)
+	if streamErr == nil || emitted {
+		p.applyUsage(&rec, r, a.model, acc.usage, acc.outputText())
+		rec.ToolCallCount = acc.toolCallCount()
+	}
+	if streamErr != nil {
+		p.finish(r, withError(rec, status, streamErr))
+		return &failure{err: streamErr, cause: cause, final: emitted}
+	}
+	p.finish(r, rec)
+	return nil
+}
+
+// toolCallKey identifies a streamed tool call by choice and call index.
+type toolCallKey struct {
+	choice int
+	index  int
+}
+
+// streamAccumulator reassembles a streamed completion from its chunks.
+type streamAccumulator struct {
+	id           string
+	model        string
+	content      strings.Builder
+	toolCalls    map[toolCallKey]*model.ToolCall
+	order        []toolCallKey
+	finishReason string
+	usage        *model.Usage
+}
+
+func newStreamAccumulator() *streamAccumulator {
+	return &streamAccumulator{toolCalls: make(map[toolCallKey]*model.ToolCall)}
+}
+
+func (a *streamAccumulator) add(chunk *model.ChatCompletionChunk) {
+	if a.id == "" {
+		a.id = chunk.ID
+	}
+	if a.model == "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		usage := *chunk.Usage
+		a.usage = &usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			a.finishReason = *choice.FinishReason
+		}
+		if choice.Delta == nil {
+			continue
+		}
+		if text, ok := choice.Delta.Content.(string); ok {
+			a.content.WriteString(text)
+		}
+		for i, tc := range choice.Delta.ToolCalls {
+			key := toolCallKey{choice: choice.Index, index: i}
+			if tc.Index != nil {
+				key.index = *tc.Index
+			}
+			call, ok := a.toolCalls[key]
+			if !ok {
+				call = &model.ToolCall{Type: "function"}
+				a.toolCalls[key] = call
+				a.order = append(a.order, key)
+			}
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+}
+
+func (a *streamAccumulator) toolCallCount() int {
+	return len(a.toolCalls)
+}
+
+// outputText returns the generated text and tool call payloads, used to
+// estimate output tokens when the provider reports no usage.
+func (a *streamAccumulator) outputText() string {
+	var b strings.Builder
+	b.WriteString(a.content.String())
+	for _, key := range a.order {
+		call := a.toolCalls[key]
+		b.WriteString(call.Function.Name)
+		b.WriteString(call.Function.Arguments)
+	}
+	return b.String()
+}
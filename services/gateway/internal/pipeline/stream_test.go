@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func strPtr(s string) *string { return &s }
+
+func intPtr(n int) *int { return &n }
+
+func TestStreamAccumulator_ContentAndUsage(t *testing.T) {
+	acc := newStreamAccumulator()
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Role: "assistant", Content: "Hello"}},
+	}})
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Content: ", world"}, FinishReason: strPtr("stop")},
+	}})
+	acc.add(&model.ChatCompletionChunk{Usage: &model.Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}})
+
+	if got := acc.outputText(); got != "Hello, world" {
+		t.Errorf("outputText() = %q, want %q", got, "Hello, world")
+	}
+	if acc.finishReason != "stop" {
+		t.Errorf("finishReason = %q, want stop", acc.finishReason)
+	}
+	if acc.usage == nil || acc.usage.PromptTokens != 12 || acc.usage.CompletionTokens != 4 {
+		t.Errorf("unexpected usage: %+v", acc.usage)
+	}
+}
+
+func TestStreamAccumulator_ToolCallDeltas(t *testing.T) {
+	acc := newStreamAccumulator()
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{{Delta: &model.Message{ToolCalls: []model.ToolCall{
+		{Index: intPtr(0), ID: "call_1", Type: "function", Function: model.FunctionCall{Name: "get_weather"}},
+	}}}}})
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{{Delta: &model.Message{ToolCalls: []model.ToolCall{
+		{Index: intPtr(0), Function: model.FunctionCall{Arguments: `{"city":`}},
+	}}}}})
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{{Delta: &model.Message{ToolCalls: []model.ToolCall{
+		{Index: intPtr(0), Function: model.FunctionCall{Arguments: `"Paris"}`}},
+		{Index: intPtr(1), ID: "call_2", Function: model.FunctionCall{Name: "get_time", Arguments: `{}`}},
+	}}}}})
+
+	if acc.toolCallCount() != 2 {
+		t.Fatalf("toolCallCount() = %d, want 2", acc.toolCallCount())
+	}
+	first := acc.toolCalls[toolCallKey{choice: 0, index: 0}]
+	if first.ID != "call_1" || first.Function.Name != "get_weather" || first.Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("unexpected first tool call: %+v", first)
+	}
+	if got := acc.outputText(); got != `get_weather{"city":"Paris"}get_time{}` {
+		t.Errorf("outputText() = %q", got)
+	}
+}
+
+func TestStreamAccumulator_NoUsage(t *testing.T) {
+	acc := newStreamAccumulator()
+	acc.add(&model.ChatCompletionChunk{Choices: []model.Choice{{Delta: &model.Message{Content: "hi"}}}})
+	if acc.usage != nil {
+		t.Errorf("expected nil usage, got %+v", acc.usage)
+	}
+}
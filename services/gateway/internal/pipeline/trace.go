@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// GenAI operation names, see the OpenTelemetry GenAI semantic conventions.
+const (
+	operationChat       = "chat"
+	operationEmbeddings = "embeddings"
+)
+
+// startSpan starts an internal span for a pipeline stage.
+func (p *Pipeline) startSpan(ctx context.Context, name string, attrs ...tracing.Attr) (context.Context, *tracing.Span) {
+	return p.tracer.Start(ctx, name, tracing.KindInternal, attrs...)
+}
+
+// startAttempt starts the client span of one provider call, named
+// "{operation} {model}" as the GenAI conventions require.
+func (p *Pipeline) startAttempt(ctx context.Context, r *Request, operation string, m *model.ModelInfo, cfg provider.ProviderConfig) (context.Context, *tracing.Span) {
+	attrs := []tracing.Attr{
+		tracing.String("gen_ai.operation.name", operation),
+		tracing.String("gen_ai.request.model", m.ModelID),
+		tracing.Int("gateway.attempt_number", r.RC.AttemptNumber),
+	}
+	if prov := r.RC.Provider; prov != nil {
+		attrs = append(attrs,
+			tracing.String("gen_ai.system", prov.ProviderType),
+			tracing.String("gateway.provider", prov.Name))
+	}
+	if u, err := url.Parse(cfg.BaseURL); err == nil && u.Hostname() != "" {
+		attrs = append(attrs, tracing.String("server.address", u.Hostname()))
+	}
+	if body := r.Body; body != nil {
+		if body.MaxTokens != nil {
+			attrs = append(attrs, tracing.Int("gen_ai.request.max_tokens", *body.MaxTokens))
+		}
+		if body.Temperature != nil {
+			attrs = append(attrs, tracing.Float("gen_ai.request.temperature", *body.Temperature))
+		}
+		if body.TopP != nil {
+			attrs = append(attrs, tracing.Float("gen_ai.request.top_p", *body.TopP))
+		}
+	}
+	return p.tracer.Start(ctx, operation+" "+m.ModelID, tracing.KindClient, attrs...)
+}
+
+// endAttempt records the outcome of a provider call and ends its span.
+func endAttempt(span *tracing.Span, e *Error, responseID, responseModel string, finishReasons []string, usage *model.Usage) {
+	defer span.End()
+	if e != nil {
+		span.SetError(e.Code, e.Message)
+		return
+	}
+	if responseID != "" {
+		span.SetAttributes(tracing.String("gen_ai.response.id", responseID))
+	}
+	if responseModel != "" {
+		span.SetAttributes(tracing.String("gen_ai.response.model", responseModel))
+	}
+	if len(finishReasons) > 0 {
+		span.SetAttributes(tracing.Strings("gen_ai.response.finish_reasons", finishReasons))
+	}
+	if usage != nil {
+		span.SetAttributes(
+			tracing.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+			tracing.Int("gen_ai.usage.output_tokens", usage.CompletionTokens))
+	}
+}
+
+// traceOutcome records the metered outcome on the request's span.
+func traceOutcome(r *Request, rec *model.RequestRecord) {
+	span := r.span
+	route, modelID, provider := r.labels()
+	span.SetAttributes(
+		tracing.String("gateway.request_id", rec.RequestID),
+		tracing.String("gateway.environment_id", rec.EnvironmentID),
+		tracing.String("gateway.route", route),
+		tracing.String("gateway.provider", provider),
+		tracing.String("gateway.status", rec.Status),
+		tracing.String("gateway.action", rec.ActionTaken),
+		tracing.Float("gateway.cost_usd", rec.TotalCostUSD),
+		tracing.String("gen_ai.request.model", modelID),
+		tracing.Int("gen_ai.usage.input_tokens", rec.InputTokens),
+		tracing.Int("gen_ai.usage.output_tokens", rec.OutputTokens),
+	)
+	// The server span's status follows the HTTP status; the gateway's own
+	// error code is kept as an attribute.
+	if rec.ErrorCode != nil {
+		span.SetAttributes(tracing.String("gateway.error_code", *rec.ErrorCode))
+	}
+}
+
+func finishReasons(choices []model.Choice) []string {
+	var reasons []string
+	for _, c := range choices {
+		if c.FinishReason != nil && *c.FinishReason != "" {
+			reasons = append(reasons, *c.FinishReason)
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/openfive/gateway/internal/anthropic"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// anthropicVersion is the Messages API version the adapter is written
+// against. It can be overridden through the provider's headers.
+const anthropicVersion = "2023-06-01"
+
+// AnthropicProvider speaks the Anthropic Messages API natively, with
+// base URLs of the form https://api.anthropic.com/v1.
+type AnthropicProvider struct {
+	client *http.Client
+}
+
+func NewAnthropic(client *http.Client) *AnthropicProvider {
+	return &AnthropicProvider{client: client}
+}
+
+func (p *AnthropicProvider) Name() string { return "anthropic" }
+
+func (p *AnthropicProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
+	msgReq, err := anthropic.FromChatRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+	msgReq.Stream = false
+
+	httpReq, err := p.newRequest(ctx, "POST", "/messages", msgReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result anthropic.MessagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return anthropic.ToChatResponse(&result), nil
+}
+
+func (p *AnthropicProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
+	msgReq, err := anthropic.FromChatRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+	msgReq.Stream = true
+
+	httpReq, err := p.newRequest(ctx, "POST", "/messages", msgReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineBytes)
+
+	return &anthropicStreamReader{
+		scanner:    scanner,
+		body:       resp.Body,
+		translator: anthropic.NewChunkTranslator(),
+	}, nil
+}
+
+// Embed is not supported: Anthropic has no embeddings endpoint.
+func (p *AnthropicProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	return nil, fmt.Errorf("anthropic provider does not support embeddings")
+}
+
+// Probe lists the models of the endpoint, which needs a valid key but no
+// tokens.
+func (p *AnthropicProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	httpReq, err := p.newRequest(ctx, "GET", "/models", nil, cfg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp, respBody)
+	}
+	return nil
+}
+
+// newRequest builds an authenticated request to the Messages API. A nil
+// payload sends no body.
+func (p *AnthropicProvider) newRequest(ctx context.Context, method, path string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(cfg.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("x-api-key", cfg.APIKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return httpReq, nil
+}
+
+// anthropicStreamReader reads Messages API server-sent events and relays
+// them as chat completion chunks.
+type anthropicStreamReader struct {
+	scanner    *bufio.Scanner
+	body       io.ReadCloser
+	translator *anthropic.ChunkTranslator
+}
+
+func (r *anthropicStreamReader) Next() (*model.ChatCompletionChunk, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // event names are repeated in the data
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+
+		var ev anthropic.StreamEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			continue // skip malformed events
+		}
+		if ev.Type == "message_stop" {
+			return nil, io.EOF
+		}
+		if ev.Type == "error" && ev.Error != nil {
+			return nil, streamError(ev.Error.Type, ev.Error.Message)
+		}
+		chunk, err := r.translator.Translate(&ev)
+		if err != nil {
+			return nil, err
+		}
+		if chunk != nil {
+			return chunk, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *anthropicStreamReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfive/gateway/internal/anthropic"
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestAnthropic_Send(t *testing.T) {
+	var got anthropic.MessagesRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "sk-ant-test" || r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("auth headers = %q, %q", r.Header.Get("x-api-key"), r.Header.Get("anthropic-version"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet",
+			"content":[{"type":"text","text":"Hello"}],"stop_reason":"end_turn",
+			"usage":{"input_tokens":5,"output_tokens":2}}`)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropic(srv.Client())
+	resp, err := p.Send(context.Background(), &model.ChatCompletionRequest{
+		Model:    "claude-sonnet",
+		Messages: []model.Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL + "/v1", APIKey: "sk-ant-test"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got.Model != "claude-sonnet" || len(got.System) != 1 || len(got.Messages) != 1 || got.Stream {
+		t.Errorf("upstream request = %+v", got)
+	}
+	if resp.Choices[0].Message.Content != "Hello" || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+	if resp.Usage.TotalTokens != 7 {
+		t.Errorf("usage = %+v, want 7 total tokens", resp.Usage)
+	}
+}
+
+func TestAnthropic_SendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewAnthropic(srv.Client()).Send(context.Background(), &model.ChatCompletionRequest{
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Fatalf("err = %v, want a 429 provider error", err)
+	}
+}
+
+func TestAnthropic_SendStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropic.MessagesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("upstream request is not streaming")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.Join([]string{
+			"event: message_start",
+			`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet","usage":{"input_tokens":5,"output_tokens":1}}}`,
+			"",
+			"event: content_block_start",
+			`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			"",
+			"event: ping",
+			`data: {"type":"ping"}`,
+			"",
+			"event: content_block_delta",
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+			"",
+			"event: content_block_delta",
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+			"",
+			"event: content_block_stop",
+			`data: {"type":"content_block_stop","index":0}`,
+			"",
+			"event: message_delta",
+			`data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":2}}`,
+			"",
+			"event: message_stop",
+			`data: {"type":"message_stop"}`,
+			"",
+		}, "\n"))
+	}))
+	defer srv.Close()
+
+	stream, err := NewAnthropic(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	var last *model.ChatCompletionChunk
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if s, ok := chunk.Choices[0].Delta.Content.(string); ok {
+			text += s
+		}
+		last = chunk
+	}
+
+	if text != "Hello" {
+		t.Errorf("text = %q, want Hello", text)
+	}
+	if last == nil || *last.Choices[0].FinishReason != "length" || last.Usage.CompletionTokens != 2 {
+		t.Errorf("last chunk = %+v, want finish_reason length and usage", last)
+	}
+}
@@ -0,0 +1,254 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// azureAPIVersion is used when the provider metadata sets no api_version.
+const azureAPIVersion = "2024-10-21"
+
+// AzureOpenAIProvider calls Azure OpenAI deployments. The base URL is the
+// resource endpoint, e.g. https://my-resource.openai.azure.com, and the
+// provider metadata holds:
+//
+//	api_version  the data plane API version (default azureAPIVersion)
+//	deployments  an object mapping model IDs to deployment names; models
+//	             without an entry are assumed to be deployed under their
+//	             own ID
+type AzureOpenAIProvider struct {
+	client *http.Client
+}
+
+func NewAzureOpenAI(client *http.Client) *AzureOpenAIProvider {
+	return &AzureOpenAIProvider{client: client}
+}
+
+func (p *AzureOpenAIProvider) Name() string { return "azure_openai" }
+
+func (p *AzureOpenAIProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
+	httpReq, err := p.newRequest(ctx, "POST", azureDeploymentPath(req.Model, "/chat/completions", cfg), req, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, azureError(resp, respBody)
+	}
+
+	var result model.ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if err := azureCompletionFiltered(&result, respBody); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (p *AzureOpenAIProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
+	streamReq := *req
+	streamReq.Stream = true
+
+	httpReq, err := p.newRequest(ctx, "POST", azureDeploymentPath(req.Model, "/chat/completions", cfg), streamReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, azureError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineBytes)
+
+	return &sseReader{
+		scanner: scanner,
+		body:    resp.Body,
+	}, nil
+}
+
+func (p *AzureOpenAIProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	httpReq, err := p.newRequest(ctx, "POST", azureDeploymentPath(req.Model, "/embeddings", cfg), req, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, azureError(resp, respBody)
+	}
+
+	var result model.EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Probe lists the models available to the resource, which needs a valid
+// key but no tokens.
+func (p *AzureOpenAIProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	httpReq, err := p.newRequest(ctx, "GET", "/openai/models", nil, cfg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp, respBody)
+	}
+	return nil
+}
+
+// newRequest builds an authenticated request to the resource, adding the
+// api-version query parameter. A nil payload sends no body.
+func (p *AzureOpenAIProvider) newRequest(ctx context.Context, method, path string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	apiVersion := metadataString(cfg.Metadata, "api_version")
+	if apiVersion == "" {
+		apiVersion = azureAPIVersion
+	}
+	target := strings.TrimSuffix(cfg.BaseURL, "/") + path + "?api-version=" + url.QueryEscape(apiVersion)
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("api-key", cfg.APIKey)
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return httpReq, nil
+}
+
+// azureDeploymentPath returns the path of an operation on the deployment
+// serving modelID.
+func azureDeploymentPath(modelID, operation string, cfg ProviderConfig) string {
+	deployment := modelID
+	if deployments, ok := cfg.Metadata["deployments"].(map[string]interface{}); ok {
+		if name, _ := deployments[modelID].(string); name != "" {
+			deployment = name
+		}
+	}
+	return "/openai/deployments/" + url.PathEscape(deployment) + operation
+}
+
+func metadataString(metadata map[string]interface{}, key string) string {
+	s, _ := metadata[key].(string)
+	return s
+}
+
+// azureErrorBody is the error format of Azure OpenAI. Content filter
+// rejections carry code "content_filter" and the per-category results.
+type azureErrorBody struct {
+	Error struct {
+		Code       string `json:"code"`
+		Message    string `json:"message"`
+		Param      string `json:"param"`
+		InnerError *struct {
+			Code                string                         `json:"code"`
+			ContentFilterResult map[string]ContentFilterResult `json:"content_filter_result"`
+		} `json:"innererror"`
+	} `json:"error"`
+}
+
+// azureError classifies an error response, wrapping a ContentFilterError
+// for content filter rejections.
+func azureError(resp *http.Response, body []byte) error {
+	var parsed azureErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Code == "content_filter" {
+		cf := &ContentFilterError{Status: resp.StatusCode, Source: "prompt", Message: parsed.Error.Message}
+		if parsed.Error.InnerError != nil {
+			cf.Results = parsed.Error.InnerError.ContentFilterResult
+		}
+		return contentFilterError(cf)
+	}
+	return httpError(resp, body)
+}
+
+// azureCompletionFiltered returns a content filter error when every choice
+// was stopped by the content filter before producing any content. Partly
+// filtered completions are returned as they are, with finish_reason
+// content_filter.
+func azureCompletionFiltered(resp *model.ChatCompletionResponse, body []byte) error {
+	if len(resp.Choices) == 0 {
+		return nil
+	}
+	for _, c := range resp.Choices {
+		if c.FinishReason == nil || *c.FinishReason != "content_filter" {
+			return nil
+		}
+		if c.Message != nil && (c.Message.Content != nil && c.Message.Content != "" || len(c.Message.ToolCalls) > 0) {
+			return nil
+		}
+	}
+
+	var filtered struct {
+		Choices []struct {
+			ContentFilterResults map[string]ContentFilterResult `json:"content_filter_results"`
+		} `json:"choices"`
+	}
+	json.Unmarshal(body, &filtered)
+	cf := &ContentFilterError{Status: http.StatusOK, Source: "completion", Results: map[string]ContentFilterResult{}}
+	for _, c := range filtered.Choices {
+		for name, r := range c.ContentFilterResults {
+			if r.Filtered || cf.Results[name] == (ContentFilterResult{}) {
+				cf.Results[name] = r
+			}
+		}
+	}
+	return contentFilterError(cf)
+}
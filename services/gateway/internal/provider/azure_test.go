@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestAzureOpenAI_DeploymentURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/prod-4o/chat/completions" {
+			t.Errorf("path = %s, want the mapped deployment", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2025-01-01-preview" {
+			t.Errorf("api-version = %q", got)
+		}
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("auth headers = api-key %q, Authorization %q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",
+			"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	}))
+	defer srv.Close()
+
+	cfg := ProviderConfig{
+		BaseURL: srv.URL + "/",
+		APIKey:  "azure-key",
+		Metadata: map[string]interface{}{
+			"api_version": "2025-01-01-preview",
+			"deployments": map[string]interface{}{"gpt-4o": "prod-4o"},
+		},
+	}
+	resp, err := NewAzureOpenAI(srv.Client()).Send(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, cfg)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Hi" {
+		t.Errorf("content = %v", resp.Choices[0].Message.Content)
+	}
+}
+
+func TestAzureDeploymentPath_Defaults(t *testing.T) {
+	if got := azureDeploymentPath("gpt-4o-mini", "/embeddings", ProviderConfig{}); got != "/openai/deployments/gpt-4o-mini/embeddings" {
+		t.Errorf("path = %q, want the model ID as the deployment", got)
+	}
+}
+
+func TestAzureOpenAI_PromptFiltered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"The response was filtered","type":null,"param":"prompt","code":"content_filter","status":400,
+			"innererror":{"code":"ResponsibleAIPolicyViolation","content_filter_result":{
+				"hate":{"filtered":false,"severity":"safe"},
+				"violence":{"filtered":true,"severity":"high"},
+				"jailbreak":{"filtered":true,"detected":true}}}}}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewAzureOpenAI(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "..."}},
+	}, ProviderConfig{BaseURL: srv.URL})
+
+	var cf *ContentFilterError
+	if !errors.As(err, &cf) {
+		t.Fatalf("err = %v, want a ContentFilterError", err)
+	}
+	if cf.Status != http.StatusBadRequest || cf.Source != "prompt" {
+		t.Errorf("status, source = %d, %q", cf.Status, cf.Source)
+	}
+	if got := cf.Categories(); !reflect.DeepEqual(got, []string{"jailbreak", "violence"}) {
+		t.Errorf("categories = %v, want jailbreak and violence", got)
+	}
+}
+
+func TestAzureOpenAI_CompletionFiltered(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o",
+			"choices":[{"index":0,"message":{"role":"assistant","content":null},"finish_reason":"content_filter",
+				"content_filter_results":{"sexual":{"filtered":true,"severity":"medium"},"hate":{"filtered":false,"severity":"safe"}}}]}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewAzureOpenAI(srv.Client()).Send(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "..."}},
+	}, ProviderConfig{BaseURL: srv.URL})
+
+	var cf *ContentFilterError
+	if !errors.As(err, &cf) {
+		t.Fatalf("err = %v, want a ContentFilterError", err)
+	}
+	if cf.Source != "completion" || !reflect.DeepEqual(cf.Categories(), []string{"sexual"}) {
+		t.Errorf("source, categories = %q, %v", cf.Source, cf.Categories())
+	}
+}
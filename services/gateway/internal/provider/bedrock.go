@@ -0,0 +1,541 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openfive/gateway/internal/chat"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// BedrockProvider calls the Amazon Bedrock Converse API, with base URLs of
+// the form https://bedrock-runtime.us-east-1.amazonaws.com. Requests are
+// signed with SigV4 using the provider secret as credentials; see
+// parseAWSCredentials. The region is taken from the "region" metadata
+// key, or else from the base URL host.
+type BedrockProvider struct {
+	client *http.Client
+	// now is the signing clock; tests replace it.
+	now func() time.Time
+}
+
+func NewBedrock(client *http.Client) *BedrockProvider {
+	return &BedrockProvider{client: client, now: time.Now}
+}
+
+func (p *BedrockProvider) Name() string { return "bedrock" }
+
+func (p *BedrockProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
+	converse, err := toConverseRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+
+	httpReq, err := p.newRequest(ctx, req.Model, "/converse", converse, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result converseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return fromConverseResponse(&result, req.Model), nil
+}
+
+func (p *BedrockProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
+	converse, err := toConverseRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+
+	httpReq, err := p.newRequest(ctx, req.Model, "/converse-stream", converse, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	return &bedrockStreamReader{
+		decoder:   newEventStreamDecoder(resp.Body),
+		body:      resp.Body,
+		id:        "bedrock-" + newID(),
+		model:     req.Model,
+		created:   time.Now().Unix(),
+		toolIndex: make(chat.ToolCallIndex),
+	}, nil
+}
+
+// Embed is not supported: Bedrock embedding models each take their own
+// InvokeModel request format rather than Converse.
+func (p *BedrockProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	return nil, fmt.Errorf("bedrock provider does not support embeddings")
+}
+
+// newRequest builds a signed POST to an operation on a model.
+func (p *BedrockProvider) newRequest(ctx context.Context, modelID, operation string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	creds, err := parseAWSCredentials(cfg.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	region, err := bedrockRegion(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	// Model IDs and ARNs contain ':' and '/', which must be escaped
+	// within the path segment.
+	base := strings.TrimSuffix(cfg.BaseURL, "/")
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", base+"/model/"+awsEscape(modelID)+operation, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	signV4(httpReq, body, creds, region, "bedrock", p.now())
+	return httpReq, nil
+}
+
+// bedrockRegion returns the "region" metadata key, or the region in a
+// bedrock-runtime[-fips].<region>.amazonaws.com host.
+func bedrockRegion(cfg ProviderConfig) (string, error) {
+	if region := metadataString(cfg.Metadata, "region"); region != "" {
+		return region, nil
+	}
+	u, err := url.Parse(cfg.BaseURL)
+	if err == nil {
+		labels := strings.Split(u.Hostname(), ".")
+		if len(labels) >= 4 && strings.HasPrefix(labels[0], "bedrock-runtime") {
+			return labels[1], nil
+		}
+	}
+	return "", fmt.Errorf("bedrock region not set: add a region to the provider metadata")
+}
+
+// --- Wire types ---
+
+type converseRequest struct {
+	Messages        []converseMessage        `json:"messages"`
+	System          []converseContent        `json:"system,omitempty"`
+	InferenceConfig *converseInferenceConfig `json:"inferenceConfig,omitempty"`
+	ToolConfig      *converseToolConfig      `json:"toolConfig,omitempty"`
+}
+
+type converseMessage struct {
+	Role    string            `json:"role"`
+	Content []converseContent `json:"content"`
+}
+
+// converseContent is a content block; exactly one field is set.
+type converseContent struct {
+	Text       string              `json:"text,omitempty"`
+	Image      *converseImage      `json:"image,omitempty"`
+	ToolUse    *converseToolUse    `json:"toolUse,omitempty"`
+	ToolResult *converseToolResult `json:"toolResult,omitempty"`
+}
+
+type converseImage struct {
+	Format string `json:"format"`
+	Source struct {
+		Bytes string `json:"bytes"` // base64
+	} `json:"source"`
+}
+
+type converseToolUse struct {
+	ToolUseID string          `json:"toolUseId"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+}
+
+type converseToolResult struct {
+	ToolUseID string            `json:"toolUseId"`
+	Content   []converseContent `json:"content"`
+}
+
+type converseInferenceConfig struct {
+	MaxTokens     *int     `json:"maxTokens,omitempty"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type converseToolConfig struct {
+	Tools      []converseTool   `json:"tools"`
+	ToolChoice *json.RawMessage `json:"toolChoice,omitempty"`
+}
+
+type converseTool struct {
+	ToolSpec struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		InputSchema struct {
+			JSON interface{} `json:"json"`
+		} `json:"inputSchema"`
+	} `json:"toolSpec"`
+}
+
+type converseResponse struct {
+	Output struct {
+		Message converseMessage `json:"message"`
+	} `json:"output"`
+	StopReason string         `json:"stopReason"`
+	Usage      *converseUsage `json:"usage"`
+}
+
+type converseUsage struct {
+	InputTokens           int `json:"inputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+	CacheReadInputTokens  int `json:"cacheReadInputTokens"`
+	CacheWriteInputTokens int `json:"cacheWriteInputTokens"`
+}
+
+// --- Request translation ---
+
+// toConverseRequest translates a chat request. System and developer
+// messages become the system prompt and tool results toolResult blocks in
+// a user turn. Image URLs other than data URLs are dropped, as Converse
+// only takes inline bytes.
+func toConverseRequest(req *model.ChatCompletionRequest) (*converseRequest, error) {
+	out := &converseRequest{}
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			out.System = append(out.System, converseBlocks(m.Content, false)...)
+		case "user":
+			out.Messages = appendConverseTurn(out.Messages, "user", converseBlocks(m.Content, true))
+		case "assistant":
+			blocks := converseBlocks(m.Content, false)
+			for _, tc := range m.ToolCalls {
+				blocks = append(blocks, converseContent{ToolUse: &converseToolUse{
+					ToolUseID: tc.ID,
+					Name:      tc.Function.Name,
+					Input:     chat.JSONObject(tc.Function.Arguments),
+				}})
+			}
+			out.Messages = appendConverseTurn(out.Messages, "assistant", blocks)
+		case "tool":
+			result := converseBlocks(m.Content, false)
+			if len(result) == 0 {
+				result = []converseContent{{Text: "(empty)"}}
+			}
+			out.Messages = appendConverseTurn(out.Messages, "user", []converseContent{{ToolResult: &converseToolResult{
+				ToolUseID: m.ToolCallID,
+				Content:   result,
+			}}})
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", m.Role)
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, fmt.Errorf("messages must include a user or assistant turn")
+	}
+
+	inference := &converseInferenceConfig{
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: chat.StopList(req.Stop),
+	}
+	if inference.MaxTokens != nil || inference.Temperature != nil || inference.TopP != nil || len(inference.StopSequences) > 0 {
+		out.InferenceConfig = inference
+	}
+
+	if len(req.Tools) > 0 {
+		tc := &converseToolConfig{}
+		for _, t := range req.Tools {
+			var tool converseTool
+			tool.ToolSpec.Name = t.Function.Name
+			tool.ToolSpec.Description = t.Function.Description
+			tool.ToolSpec.InputSchema.JSON = t.Function.Parameters
+			if tool.ToolSpec.InputSchema.JSON == nil {
+				tool.ToolSpec.InputSchema.JSON = map[string]interface{}{"type": "object"}
+			}
+			tc.Tools = append(tc.Tools, tool)
+		}
+		tc.ToolChoice = converseToolChoice(req.ToolChoice)
+		out.ToolConfig = tc
+	}
+	return out, nil
+}
+
+// converseToolChoice maps tool_choice. Converse has no "none"; it and
+// "auto" leave the choice to the model.
+func converseToolChoice(choice interface{}) *json.RawMessage {
+	var raw json.RawMessage
+	switch c := choice.(type) {
+	case string:
+		if c == "required" {
+			raw = json.RawMessage(`{"any":{}}`)
+		}
+	case map[string]interface{}:
+		fn, _ := c["function"].(map[string]interface{})
+		if name, _ := fn["name"].(string); name != "" {
+			raw, _ = json.Marshal(map[string]interface{}{"tool": map[string]string{"name": name}})
+		}
+	}
+	if raw == nil {
+		return nil
+	}
+	return &raw
+}
+
+// appendConverseTurn adds blocks to the conversation, merging them into
+// the last message when it has the same role, as Converse requires user
+// and assistant turns to alternate.
+func appendConverseTurn(msgs []converseMessage, role string, blocks []converseContent) []converseMessage {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		msgs[n-1].Content = append(msgs[n-1].Content, blocks...)
+		return msgs
+	}
+	return append(msgs, converseMessage{Role: role, Content: blocks})
+}
+
+// converseBlocks converts chat content into text blocks and, when
+// withImages is set, image blocks.
+func converseBlocks(content interface{}, withImages bool) []converseContent {
+	var out []converseContent
+	for _, p := range chat.Parts(content, withImages) {
+		switch {
+		case p.Text != "":
+			out = append(out, converseContent{Text: p.Text})
+		case p.Data != "":
+			format := strings.TrimPrefix(p.MimeType, "image/")
+			if format == "jpg" {
+				format = "jpeg"
+			}
+			img := &converseImage{Format: format}
+			img.Source.Bytes = p.Data
+			out = append(out, converseContent{Image: img})
+		}
+	}
+	return out
+}
+
+// --- Response translation ---
+
+func fromConverseResponse(resp *converseResponse, modelID string) *model.ChatCompletionResponse {
+	msg := &model.Message{Role: "assistant"}
+	var text strings.Builder
+	for _, b := range resp.Output.Message.Content {
+		switch {
+		case b.ToolUse != nil:
+			args := string(b.ToolUse.Input)
+			if args == "" || args == "null" {
+				args = "{}"
+			}
+			msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+				ID:       b.ToolUse.ToolUseID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: b.ToolUse.Name, Arguments: args},
+			})
+		case b.Text != "":
+			text.WriteString(b.Text)
+		}
+	}
+	if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+		msg.Content = text.String()
+	}
+
+	finishReason := converseFinishReason(resp.StopReason)
+	return &model.ChatCompletionResponse{
+		ID:      "bedrock-" + newID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelID,
+		Choices: []model.Choice{{Index: 0, Message: msg, FinishReason: &finishReason}},
+		Usage:   converseChatUsage(resp.Usage),
+	}
+}
+
+// converseFinishReason maps a Converse stopReason onto an OpenAI
+// finish_reason.
+func converseFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens", "model_context_window_exceeded":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "guardrail_intervened", "content_filtered":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// converseChatUsage converts Converse usage. As with Anthropic,
+// inputTokens excludes the prompt tokens read from or written to the
+// cache; OpenAI counts them in prompt_tokens.
+func converseChatUsage(u *converseUsage) *model.Usage {
+	if u == nil {
+		return nil
+	}
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheWriteInputTokens
+	usage := &model.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens > 0 || u.CacheWriteInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:     u.CacheReadInputTokens,
+			CacheWriteTokens: u.CacheWriteInputTokens,
+		}
+	}
+	return usage
+}
+
+// converseStreamEvent is the payload of a ConverseStream event; which
+// fields are set depends on the :event-type header.
+type converseStreamEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             *struct {
+		ToolUse *struct {
+			ToolUseID string `json:"toolUseId"`
+			Name      string `json:"name"`
+		} `json:"toolUse"`
+	} `json:"start"`
+	Delta *struct {
+		Text    string `json:"text"`
+		ToolUse *struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+	} `json:"delta"`
+	StopReason string         `json:"stopReason"`
+	Usage      *converseUsage `json:"usage"`
+	Message    string         `json:"message"`
+}
+
+// bedrockStreamReader decodes ConverseStream event-stream messages into
+// chat completion chunks. The finish reason arrives with messageStop and
+// usage with the trailing metadata event, which is relayed as a chunk
+// without choices.
+type bedrockStreamReader struct {
+	decoder *eventStreamDecoder
+	body    io.ReadCloser
+	id      string
+	model   string
+	created int64
+
+	toolIndex chat.ToolCallIndex
+}
+
+func (r *bedrockStreamReader) Next() (*model.ChatCompletionChunk, error) {
+	for {
+		msg, err := r.decoder.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Headers[":message-type"] == "exception" || msg.Headers[":message-type"] == "error" {
+			var ev converseStreamEvent
+			json.Unmarshal(msg.Payload, &ev)
+			kind := msg.Headers[":exception-type"]
+			if kind == "" {
+				kind = msg.Headers[":error-code"]
+			}
+			return nil, streamError(kind, ev.Message)
+		}
+
+		var ev converseStreamEvent
+		if err := json.Unmarshal(msg.Payload, &ev); err != nil {
+			continue // skip malformed events
+		}
+		if chunk := r.translate(msg.Headers[":event-type"], &ev); chunk != nil {
+			return chunk, nil
+		}
+	}
+}
+
+func (r *bedrockStreamReader) translate(eventType string, ev *converseStreamEvent) *model.ChatCompletionChunk {
+	switch eventType {
+	case "messageStart":
+		return r.chunk(&model.Message{Role: "assistant", Content: ""}, nil)
+
+	case "contentBlockStart":
+		if ev.Start == nil || ev.Start.ToolUse == nil {
+			return nil
+		}
+		return r.chunk(r.toolIndex.Start(ev.ContentBlockIndex, ev.Start.ToolUse.ToolUseID, ev.Start.ToolUse.Name), nil)
+
+	case "contentBlockDelta":
+		if ev.Delta == nil {
+			return nil
+		}
+		if ev.Delta.ToolUse != nil {
+			delta := r.toolIndex.Arguments(ev.ContentBlockIndex, ev.Delta.ToolUse.Input)
+			if delta == nil {
+				return nil
+			}
+			return r.chunk(delta, nil)
+		}
+		if ev.Delta.Text != "" {
+			return r.chunk(&model.Message{Content: ev.Delta.Text}, nil)
+		}
+
+	case "messageStop":
+		finishReason := converseFinishReason(ev.StopReason)
+		return r.chunk(&model.Message{}, &finishReason)
+
+	case "metadata":
+		if usage := converseChatUsage(ev.Usage); usage != nil {
+			chunk := r.chunk(nil, nil)
+			chunk.Choices = []model.Choice{}
+			chunk.Usage = usage
+			return chunk
+		}
+	}
+	return nil
+}
+
+func (r *bedrockStreamReader) chunk(delta *model.Message, finishReason *string) *model.ChatCompletionChunk {
+	return &model.ChatCompletionChunk{
+		ID:      r.id,
+		Object:  "chat.completion.chunk",
+		Created: r.created,
+		Model:   r.model,
+		Choices: []model.Choice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+func (r *bedrockStreamReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// encodeEventStream frames a message with string headers in the AWS
+// event-stream encoding.
+func encodeEventStream(headers map[string]string, payload string) []byte {
+	var hdr bytes.Buffer
+	for name, value := range headers {
+		hdr.WriteByte(byte(len(name)))
+		hdr.WriteString(name)
+		hdr.WriteByte(7)
+		binary.Write(&hdr, binary.BigEndian, uint16(len(value)))
+		hdr.WriteString(value)
+	}
+
+	total := 12 + hdr.Len() + len(payload) + 4
+	msg := make([]byte, 0, total)
+	msg = binary.BigEndian.AppendUint32(msg, uint32(total))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(hdr.Len()))
+	msg = binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+	msg = append(msg, hdr.Bytes()...)
+	msg = append(msg, payload...)
+	return binary.BigEndian.AppendUint32(msg, crc32.ChecksumIEEE(msg))
+}
+
+func bedrockEvent(eventType, payload string) []byte {
+	return encodeEventStream(map[string]string{
+		":message-type": "event",
+		":event-type":   eventType,
+		":content-type": "application/json",
+	}, payload)
+}
+
+func newTestBedrock() *BedrockProvider {
+	p := NewBedrock(http.DefaultClient)
+	p.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	return p
+}
+
+func TestBedrock_Send(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/model/anthropic.claude-3-haiku-20240307-v1%3A0/converse" {
+			t.Errorf("path = %s", r.URL.EscapedPath())
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260301/eu-west-1/bedrock/aws4_request") {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "TOKEN" {
+			t.Errorf("X-Amz-Security-Token = %q", r.Header.Get("X-Amz-Security-Token"))
+		}
+
+		var body converseRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.System) != 1 || body.System[0].Text != "Be brief." {
+			t.Errorf("system = %+v", body.System)
+		}
+		if len(body.Messages) != 3 || body.Messages[2].Content[0].ToolResult == nil {
+			t.Errorf("messages = %+v", body.Messages)
+		}
+		if body.InferenceConfig == nil || *body.InferenceConfig.MaxTokens != 100 {
+			t.Errorf("inferenceConfig = %+v", body.InferenceConfig)
+		}
+
+		io.WriteString(w, `{"output":{"message":{"role":"assistant","content":[{"text":"Sunny."}]}},
+			"stopReason":"end_turn",
+			"usage":{"inputTokens":10,"outputTokens":2,"totalTokens":12,"cacheReadInputTokens":5}}`)
+	}))
+	defer srv.Close()
+
+	maxTokens := 100
+	resp, err := newTestBedrock().Send(context.Background(), &model.ChatCompletionRequest{
+		Model:     "anthropic.claude-3-haiku-20240307-v1:0",
+		MaxTokens: &maxTokens,
+		Messages: []model.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Weather?"},
+			{Role: "assistant", ToolCalls: []model.ToolCall{{ID: "t1", Type: "function", Function: model.FunctionCall{Name: "weather", Arguments: `{"city":"Oslo"}`}}}},
+			{Role: "tool", ToolCallID: "t1", Content: "sunny"},
+		},
+	}, ProviderConfig{
+		BaseURL:  srv.URL,
+		APIKey:   "AKID:SECRET:TOKEN",
+		Metadata: map[string]interface{}{"region": "eu-west-1"},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Sunny." || *resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("choice = %+v", resp.Choices[0])
+	}
+	if resp.Usage.PromptTokens != 15 || resp.Usage.TotalTokens != 17 || resp.Usage.PromptTokensDetails.CachedTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestBedrock_SendStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/model/amazon.nova-lite-v1:0/converse-stream" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		w.Write(bedrockEvent("messageStart", `{"role":"assistant"}`))
+		w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Let me check."}}`))
+		w.Write(bedrockEvent("contentBlockStop", `{"contentBlockIndex":0}`))
+		w.Write(bedrockEvent("contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"t1","name":"weather"}}}`))
+		w.Write(bedrockEvent("contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\":\"Oslo\"}"}}}`))
+		w.Write(bedrockEvent("contentBlockStop", `{"contentBlockIndex":1}`))
+		w.Write(bedrockEvent("messageStop", `{"stopReason":"tool_use"}`))
+		w.Write(bedrockEvent("metadata", `{"usage":{"inputTokens":20,"outputTokens":8,"totalTokens":28},"metrics":{"latencyMs":120}}`))
+	}))
+	defer srv.Close()
+
+	stream, err := newTestBedrock().SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "amazon.nova-lite-v1:0",
+		Messages: []model.Message{{Role: "user", Content: "Weather in Oslo?"}},
+	}, ProviderConfig{BaseURL: srv.URL, APIKey: `{"access_key_id":"AKID","secret_access_key":"SECRET"}`, Metadata: map[string]interface{}{"region": "us-east-1"}})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	var chunks []*model.ChatCompletionChunk
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(chunks) != 6 {
+		t.Fatalf("got %d chunks, want 6", len(chunks))
+	}
+	if chunks[1].Choices[0].Delta.Content != "Let me check." {
+		t.Errorf("text delta = %+v", chunks[1].Choices[0].Delta)
+	}
+	if tc := chunks[2].Choices[0].Delta.ToolCalls[0]; tc.ID != "t1" || tc.Function.Name != "weather" || *tc.Index != 0 {
+		t.Errorf("tool call start = %+v", tc)
+	}
+	if args := chunks[3].Choices[0].Delta.ToolCalls[0].Function.Arguments; args != `{"city":"Oslo"}` {
+		t.Errorf("arguments = %s", args)
+	}
+	if fr := chunks[4].Choices[0].FinishReason; fr == nil || *fr != "tool_calls" {
+		t.Errorf("finish reason = %v", fr)
+	}
+	if u := chunks[5].Usage; len(chunks[5].Choices) != 0 || u == nil || u.TotalTokens != 28 {
+		t.Errorf("usage chunk = %+v", chunks[5])
+	}
+}
+
+func TestBedrock_StreamException(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bedrockEvent("messageStart", `{"role":"assistant"}`))
+		w.Write(encodeEventStream(map[string]string{
+			":message-type":   "exception",
+			":exception-type": "throttlingException",
+		}, `{"message":"Too many requests"}`))
+	}))
+	defer srv.Close()
+
+	stream, err := newTestBedrock().SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "amazon.nova-lite-v1:0",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL, APIKey: "AKID:SECRET", Metadata: map[string]interface{}{"region": "us-east-1"}})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("first Next: %v", err)
+	}
+	_, err = stream.Next()
+	if err == nil || !strings.Contains(err.Error(), "throttlingException") {
+		t.Errorf("err = %v, want the exception type", err)
+	}
+}
+
+func TestBedrockRegion(t *testing.T) {
+	tests := []struct {
+		cfg  ProviderConfig
+		want string
+	}{
+		{ProviderConfig{BaseURL: "https://bedrock-runtime.ap-southeast-2.amazonaws.com"}, "ap-southeast-2"},
+		{ProviderConfig{BaseURL: "https://bedrock-runtime-fips.us-west-2.amazonaws.com"}, "us-west-2"},
+		{ProviderConfig{BaseURL: "https://bedrock-runtime.us-east-1.amazonaws.com", Metadata: map[string]interface{}{"region": "eu-central-1"}}, "eu-central-1"},
+	}
+	for _, tt := range tests {
+		got, err := bedrockRegion(tt.cfg)
+		if err != nil || got != tt.want {
+			t.Errorf("bedrockRegion(%s) = %q, %v, want %q", tt.cfg.BaseURL, got, err, tt.want)
+		}
+	}
+	if _, err := bedrockRegion(ProviderConfig{BaseURL: "http://localhost:8080"}); err == nil {
+		t.Error("expected an error without a region")
+	}
+}
+
+func TestEventStreamDecoder_Checksum(t *testing.T) {
+	msg := bedrockEvent("messageStart", `{"role":"assistant"}`)
+	msg[len(msg)-6] ^= 0xff // corrupt the payload
+
+	_, err := newEventStreamDecoder(bytes.NewReader(msg)).Next()
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("err = %v, want a checksum error", err)
+	}
+}
+
+func TestEventStreamDecoder_SkipsNonStringHeaders(t *testing.T) {
+	var hdr bytes.Buffer
+	hdr.WriteByte(3)
+	hdr.WriteString("seq")
+	hdr.WriteByte(4) // int
+	binary.Write(&hdr, binary.BigEndian, int32(7))
+	hdr.WriteByte(11)
+	hdr.WriteString(":event-type")
+	hdr.WriteByte(7)
+	binary.Write(&hdr, binary.BigEndian, uint16(4))
+	hdr.WriteString("ping")
+
+	headers, err := parseEventStreamHeaders(hdr.Bytes())
+	if err != nil {
+		t.Fatalf("parseEventStreamHeaders: %v", err)
+	}
+	if len(headers) != 1 || headers[":event-type"] != "ping" {
+		t.Errorf("headers = %v", headers)
+	}
+}
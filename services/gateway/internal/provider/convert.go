@@ -0,0 +1,13 @@
+package provider
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newID returns a random ID for responses whose API does not assign one.
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
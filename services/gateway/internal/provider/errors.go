@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentFilterResult is a provider's verdict for one content filter
+// category.
+type ContentFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Detected bool   `json:"detected,omitempty"`
+	Severity string `json:"severity,omitempty"`
+}
+
+// ContentFilterError reports a prompt or completion blocked by the
+// provider's content filter.
+type ContentFilterError struct {
+	Status int
+	// Source is "prompt" or "completion".
+	Source  string
+	Message string
+	Results map[string]ContentFilterResult
+}
+
+func (e *ContentFilterError) Error() string {
+	msg := fmt.Sprintf("%s blocked by the provider content filter", e.Source)
+	if categories := e.Categories(); len(categories) > 0 {
+		msg += " (" + strings.Join(categories, ", ") + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Categories returns the filtered categories, sorted.
+func (e *ContentFilterError) Categories() []string {
+	var out []string
+	for name, r := range e.Results {
+		if r.Filtered {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ErrorKind classifies why a provider call failed.
+type ErrorKind string
+
+const (
+	KindRateLimited   ErrorKind = "rate_limited"
+	KindOverloaded    ErrorKind = "overloaded"
+	KindContextLength ErrorKind = "context_length"
+	KindContentFilter ErrorKind = "content_filter"
+	KindAuth          ErrorKind = "auth"
+	KindBadRequest    ErrorKind = "bad_request"
+	KindTimeout       ErrorKind = "timeout"
+	KindNetwork       ErrorKind = "network"
+	// KindServer is any other provider-side failure.
+	KindServer ErrorKind = "server_error"
+)
+
+// ProviderError is a failed provider call, classified so callers can tell
+// which failures are worth retrying or sending to another provider.
+type ProviderError struct {
+	Kind ErrorKind
+	// Status is the HTTP status of the response; 0 for failures without
+	// one, such as transport errors and errors reported mid-stream.
+	Status int
+	// RetryAfter is how long the provider asked callers to wait; 0 when it
+	// did not say.
+	RetryAfter time.Duration
+	// Retryable is true when the same request may succeed if sent again.
+	Retryable bool
+	Message   string
+	// Err is the underlying error, if any: the transport error or the
+	// ContentFilterError.
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	msg := e.Message
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Status != 0 {
+		return fmt.Sprintf("provider error %d: %s", e.Status, msg)
+	}
+	return fmt.Sprintf("provider error (%s): %s", e.Kind, msg)
+}
+
+func (e *ProviderError) Unwrap() error { return e.Err }
+
+// httpError classifies a non-2xx response. body is the response body,
+// which is parsed for the error message and code of the OpenAI,
+// Anthropic, Gemini, Bedrock and Ollama error formats.
+func httpError(resp *http.Response, body []byte) *ProviderError {
+	message, code := errorDetails(body)
+	if code == "" {
+		code = resp.Header.Get("X-Amzn-Errortype")
+	}
+	kind, retryable := classifyError(resp.StatusCode, code, message)
+	return &ProviderError{
+		Kind:       kind,
+		Status:     resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header, time.Now()),
+		Retryable:  retryable,
+		Message:    message,
+	}
+}
+
+// streamError classifies an error event received mid-stream, where code
+// is the provider's error type, if it sent one.
+func streamError(code, message string) *ProviderError {
+	kind, retryable := classifyError(0, code, message)
+	if code != "" {
+		message = code + ": " + message
+	}
+	return &ProviderError{Kind: kind, Retryable: retryable, Message: message}
+}
+
+// transportError classifies a request that got no response. Cancellation
+// by the caller is not the provider's failure and is returned as a plain
+// error.
+func transportError(err error) error {
+	wrapped := fmt.Errorf("send request: %w", err)
+	if errors.Is(err, context.Canceled) {
+		return wrapped
+	}
+	kind := KindNetwork
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		kind = KindTimeout
+	}
+	return &ProviderError{Kind: kind, Retryable: true, Err: wrapped}
+}
+
+// contentFilterError wraps a content filter rejection, which the client
+// has to fix by changing the request.
+func contentFilterError(cf *ContentFilterError) *ProviderError {
+	return &ProviderError{Kind: KindContentFilter, Status: cf.Status, Message: cf.Error(), Err: cf}
+}
+
+// contextLengthPatterns are fragments of the messages providers return
+// when the prompt does not fit the model, which most of them report as a
+// plain bad request.
+var contextLengthPatterns = []string{
+	"context_length_exceeded",
+	"context length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"input is too long",
+	"too many input tokens",
+	"maximum number of tokens",
+}
+
+// classifyError maps a status, a provider error code and a message onto
+// an error kind. Codes decide for errors without a status.
+func classifyError(status int, code, message string) (ErrorKind, bool) {
+	code = strings.ToLower(code)
+	lower := strings.ToLower(message)
+	hasCode := func(fragments ...string) bool {
+		for _, f := range fragments {
+			if strings.Contains(code, f) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if status == 0 || status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge || status == http.StatusUnprocessableEntity {
+		for _, p := range contextLengthPatterns {
+			if strings.Contains(code, p) || strings.Contains(lower, p) {
+				return KindContextLength, false
+			}
+		}
+	}
+	switch {
+	case hasCode("insufficient_quota"):
+		// Out of credit: waiting does not help.
+		return KindRateLimited, false
+	case status == http.StatusTooManyRequests || hasCode("rate_limit", "throttl", "resource_exhausted", "too_many_requests"):
+		return KindRateLimited, true
+	case status == http.StatusServiceUnavailable || status == 529 || hasCode("overloaded", "unavailable"):
+		return KindOverloaded, true
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout || hasCode("timeout", "deadline_exceeded"):
+		return KindTimeout, true
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || hasCode("authentication", "permission", "access_denied", "unauthenticated", "invalid_api_key"),
+		strings.Contains(lower, "api key not valid"): // Gemini answers bad keys with a 400
+		return KindAuth, false
+	case status >= 500:
+		return KindServer, true
+	case status >= 400 || hasCode("invalid", "validation", "not_found", "request_too_large"):
+		return KindBadRequest, false
+	}
+	return KindServer, true
+}
+
+// errorDetails extracts the message and code of an error body. Bodies that
+// are not JSON are returned as the message.
+func errorDetails(body []byte) (message, code string) {
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"` // also Bedrock's "Message"
+		Type    string          `json:"__type"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return strings.TrimSpace(string(body)), ""
+	}
+
+	var nested struct {
+		Message string          `json:"message"`
+		Code    json.RawMessage `json:"code"`
+		Type    string          `json:"type"`
+		Status  string          `json:"status"`
+	}
+	var text string
+	switch {
+	case json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "":
+		// OpenAI, Anthropic and Gemini nest the error in an object.
+		var codeStr string
+		json.Unmarshal(nested.Code, &codeStr)
+		for _, c := range []string{codeStr, nested.Type, nested.Status} {
+			if c != "" {
+				return nested.Message, c
+			}
+		}
+		return nested.Message, ""
+	case json.Unmarshal(parsed.Error, &text) == nil && text != "":
+		// Ollama sends the message as a string.
+		return text, ""
+	case parsed.Message != "":
+		return parsed.Message, parsed.Type
+	}
+	return strings.TrimSpace(string(body)), ""
+}
+
+// retryAfter parses the wait a response asks for: retry-after-ms, or
+// Retry-After in seconds or as an HTTP date.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(v); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestHTTPError(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    int
+		header    http.Header
+		body      string
+		kind      ErrorKind
+		retryable bool
+		message   string
+	}{
+		{"openai rate limit", 429, http.Header{"Retry-After-Ms": {"1500"}},
+			`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, KindRateLimited, true, "Rate limit reached"},
+		{"openai quota", 429, nil,
+			`{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`, KindRateLimited, false, "You exceeded your current quota"},
+		{"openai context length", 400, nil,
+			`{"error":{"message":"This model's maximum context length is 8192 tokens","code":"context_length_exceeded"}}`, KindContextLength, false, "This model's maximum context length is 8192 tokens"},
+		{"anthropic overloaded", 529, nil,
+			`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, KindOverloaded, true, "Overloaded"},
+		{"anthropic prompt too long", 400, nil,
+			`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`, KindContextLength, false, "prompt is too long: 210000 tokens > 200000 maximum"},
+		{"gemini bad key", 400, nil,
+			`{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}`, KindAuth, false, "API key not valid"},
+		{"bedrock throttling", 429, http.Header{"X-Amzn-Errortype": {"ThrottlingException"}},
+			`{"message":"Too many requests, please wait before trying again."}`, KindRateLimited, true, "Too many requests, please wait before trying again."},
+		{"bedrock input too long", 400, nil,
+			`{"Message":"Input is too long for requested model."}`, KindContextLength, false, "Input is too long for requested model."},
+		{"ollama missing model", 404, nil,
+			`{"error":"model \"llama9\" not found, try pulling it first"}`, KindBadRequest, false, `model "llama9" not found, try pulling it first`},
+		{"auth", 401, nil, `{"error":{"message":"Incorrect API key provided"}}`, KindAuth, false, "Incorrect API key provided"},
+		{"gateway timeout", 504, nil, "upstream timed out", KindTimeout, true, "upstream timed out"},
+		{"server error", 500, nil, "<html>boom</html>", KindServer, true, "<html>boom</html>"},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.status, Header: c.header}
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+		e := httpError(resp, []byte(c.body))
+		if e.Kind != c.kind || e.Retryable != c.retryable || e.Status != c.status || e.Message != c.message {
+			t.Errorf("%s: got %s retryable=%v status=%d %q; want %s retryable=%v %q",
+				c.name, e.Kind, e.Retryable, e.Status, e.Message, c.kind, c.retryable, c.message)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{http.Header{"Retry-After": {"Sun, 01 Mar 2026 12:00:30 GMT"}}, 30 * time.Second},
+		{http.Header{"Retry-After": {"Sun, 01 Mar 2026 11:00:00 GMT"}}, 0},
+		{http.Header{"Retry-After": {"7"}, "Retry-After-Ms": {"250"}}, 250 * time.Millisecond},
+		{http.Header{"Retry-After": {"soon"}}, 0},
+		{http.Header{}, 0},
+	}
+	for _, c := range cases {
+		if got := retryAfter(c.header, now); got != c.want {
+			t.Errorf("retryAfter(%v) = %v, want %v", c.header, got, c.want)
+		}
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	var pe *ProviderError
+	err := transportError(context.DeadlineExceeded)
+	if !errors.As(err, &pe) || pe.Kind != KindTimeout || !pe.Retryable {
+		t.Errorf("deadline: err = %#v, want a retryable timeout", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("deadline: the cause is not kept")
+	}
+	if err := transportError(errors.New("connection refused")); !errors.As(err, &pe) || pe.Kind != KindNetwork {
+		t.Errorf("refused: err = %#v, want a network error", err)
+	}
+	if err := transportError(context.Canceled); errors.As(err, &pe) {
+		t.Errorf("canceled: err = %#v, want a plain error", err)
+	}
+}
+
+func TestOpenRouter_SendRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"Rate limit exceeded: free-models-per-min","code":429}}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewOpenRouter(srv.Client()).Send(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a ProviderError", err)
+	}
+	if pe.Kind != KindRateLimited || !pe.Retryable || pe.RetryAfter != 3*time.Second {
+		t.Errorf("err = %+v", pe)
+	}
+}
+
+func TestSSEReader_StreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		io.WriteString(w, "data: {\"error\":{\"code\":\"overloaded\",\"message\":\"Provider overloaded\"},\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"error\"}]}\n\n")
+	}))
+	defer srv.Close()
+
+	stream, err := NewOpenRouter(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("first chunk: %v", err)
+	}
+	_, err = stream.Next()
+	var pe *ProviderError
+	if !errors.As(err, &pe) || pe.Kind != KindOverloaded {
+		t.Errorf("err = %v, want an overloaded ProviderError", err)
+	}
+}
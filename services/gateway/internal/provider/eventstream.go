@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// maxEventStreamMessage bounds one event-stream message, as the AWS
+// services do.
+const maxEventStreamMessage = 16 * 1024 * 1024
+
+// eventStreamMessage is one message of the AWS binary event-stream
+// encoding (application/vnd.amazon.eventstream). Only string header
+// values are kept.
+type eventStreamMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// eventStreamDecoder reads messages framed as:
+//
+//	total length (4) | headers length (4) | prelude CRC (4) |
+//	headers | payload | message CRC (4)
+//
+// with big-endian lengths and CRC-32 (IEEE) checksums.
+type eventStreamDecoder struct {
+	r *bufio.Reader
+}
+
+func newEventStreamDecoder(r io.Reader) *eventStreamDecoder {
+	return &eventStreamDecoder{r: bufio.NewReader(r)}
+}
+
+// Next returns the next message, or io.EOF at a clean end of stream.
+func (d *eventStreamDecoder) Next() (*eventStreamMessage, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(d.r, prelude[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("event stream: truncated prelude")
+		}
+		return nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, errors.New("event stream: prelude checksum mismatch")
+	}
+	if total > maxEventStreamMessage || total < 16 || headersLen > total-16 {
+		return nil, fmt.Errorf("event stream: invalid message length %d", total)
+	}
+
+	msg := make([]byte, total)
+	copy(msg, prelude[:])
+	if _, err := io.ReadFull(d.r, msg[12:]); err != nil {
+		return nil, fmt.Errorf("event stream: truncated message: %w", err)
+	}
+	if crc32.ChecksumIEEE(msg[:total-4]) != binary.BigEndian.Uint32(msg[total-4:]) {
+		return nil, errors.New("event stream: message checksum mismatch")
+	}
+
+	headers, err := parseEventStreamHeaders(msg[12 : 12+headersLen])
+	if err != nil {
+		return nil, err
+	}
+	return &eventStreamMessage{Headers: headers, Payload: msg[12+headersLen : total-4]}, nil
+}
+
+// eventStreamValueSizes are the fixed sizes of non-string header values
+// by type.
+var eventStreamValueSizes = map[byte]int{
+	0: 0,  // true
+	1: 0,  // false
+	2: 1,  // byte
+	3: 2,  // short
+	4: 4,  // int
+	5: 8,  // long
+	8: 8,  // timestamp
+	9: 16, // uuid
+}
+
+func parseEventStreamHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 2+nameLen {
+			return nil, errors.New("event stream: truncated header")
+		}
+		name := string(b[1 : 1+nameLen])
+		valueType := b[1+nameLen]
+		b = b[2+nameLen:]
+
+		switch valueType {
+		case 6, 7: // bytes, string
+			if len(b) < 2 {
+				return nil, errors.New("event stream: truncated header")
+			}
+			n := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+n {
+				return nil, errors.New("event stream: truncated header")
+			}
+			if valueType == 7 {
+				headers[name] = string(b[2 : 2+n])
+			}
+			b = b[2+n:]
+		default:
+			size, ok := eventStreamValueSizes[valueType]
+			if !ok || len(b) < size {
+				return nil, fmt.Errorf("event stream: invalid header %q", name)
+			}
+			b = b[size:]
+		}
+	}
+	return headers, nil
+}
@@ -0,0 +1,745 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfive/gateway/internal/chat"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// GeminiProvider speaks the Gemini generateContent API natively, with
+// base URLs of the form https://generativelanguage.googleapis.com/v1beta.
+type GeminiProvider struct {
+	client *http.Client
+}
+
+func NewGemini(client *http.Client) *GeminiProvider {
+	return &GeminiProvider{client: client}
+}
+
+func (p *GeminiProvider) Name() string { return "gemini" }
+
+func (p *GeminiProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
+	genReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+
+	httpReq, err := p.newRequest(ctx, "POST", geminiModelPath(req.Model)+":generateContent", genReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return fromGeminiResponse(&result, req.Model), nil
+}
+
+func (p *GeminiProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
+	genReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+
+	httpReq, err := p.newRequest(ctx, "POST", geminiModelPath(req.Model)+":streamGenerateContent?alt=sse", genReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineBytes)
+
+	return &geminiStreamReader{
+		scanner:   scanner,
+		body:      resp.Body,
+		model:     req.Model,
+		id:        newID(),
+		created:   time.Now().Unix(),
+		toolCalls: make(map[int]int),
+	}, nil
+}
+
+// Embed runs the inputs through batchEmbedContents. Token array inputs
+// are not supported.
+func (p *GeminiProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	inputs, err := embeddingTexts(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	modelPath := geminiModelPath(req.Model)
+	batch := geminiEmbedRequest{Requests: make([]geminiEmbedContent, len(inputs))}
+	for i, text := range inputs {
+		batch.Requests[i] = geminiEmbedContent{
+			Model:                strings.TrimPrefix(modelPath, "/"),
+			Content:              geminiContent{Parts: []geminiPart{{Text: text}}},
+			OutputDimensionality: req.Dimensions,
+		}
+	}
+
+	httpReq, err := p.newRequest(ctx, "POST", modelPath+":batchEmbedContents", batch, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result geminiEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	out := &model.EmbeddingResponse{Object: "list", Model: req.Model, Data: make([]model.Embedding, len(result.Embeddings))}
+	for i, e := range result.Embeddings {
+		out.Data[i] = model.Embedding{Object: "embedding", Index: i, Embedding: e.Values}
+	}
+	return out, nil
+}
+
+// Probe lists the models of the endpoint, which needs a valid key but no
+// tokens.
+func (p *GeminiProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	httpReq, err := p.newRequest(ctx, "GET", "/models", nil, cfg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return transportError(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError(resp, respBody)
+	}
+	return nil
+}
+
+// newRequest builds an authenticated request to the Gemini API. A nil
+// payload sends no body.
+func (p *GeminiProvider) newRequest(ctx context.Context, method, path string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(cfg.BaseURL, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("x-goog-api-key", cfg.APIKey)
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return httpReq, nil
+}
+
+// geminiModelPath returns the resource path of a model, accepting IDs
+// with or without the "models/" prefix.
+func geminiModelPath(modelID string) string {
+	return "/models/" + strings.TrimPrefix(modelID, "models/")
+}
+
+// --- Wire types ---
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO, ANY or NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64    `json:"temperature,omitempty"`
+	TopP             *float64    `json:"topP,omitempty"`
+	MaxOutputTokens  *int        `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string    `json:"stopSequences,omitempty"`
+	CandidateCount   *int        `json:"candidateCount,omitempty"`
+	ResponseMimeType string      `json:"responseMimeType,omitempty"`
+	ResponseSchema   interface{} `json:"responseSchema,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate     `json:"candidates"`
+	UsageMetadata  *geminiUsage          `json:"usageMetadata,omitempty"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
+	ResponseID     string                `json:"responseId,omitempty"`
+	PromptFeedback *geminiPromptFeedback `json:"promptFeedback,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+}
+
+type geminiPromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type geminiEmbedRequest struct {
+	Requests []geminiEmbedContent `json:"requests"`
+}
+
+type geminiEmbedContent struct {
+	Model                string        `json:"model"`
+	Content              geminiContent `json:"content"`
+	OutputDimensionality *int          `json:"outputDimensionality,omitempty"`
+}
+
+type geminiEmbedResponse struct {
+	Embeddings []struct {
+		Values []float64 `json:"values"`
+	} `json:"embeddings"`
+}
+
+// --- Request translation ---
+
+// toGeminiRequest translates a chat request. System and developer
+// messages become the system instruction, assistant turns the "model"
+// role and tool results functionResponse parts in a user turn.
+func toGeminiRequest(req *model.ChatCompletionRequest) (*geminiRequest, error) {
+	out := &geminiRequest{}
+
+	// Tool results carry only the call ID; Gemini wants the function name.
+	callNames := make(map[string]string)
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			if out.SystemInstruction == nil {
+				out.SystemInstruction = &geminiContent{}
+			}
+			out.SystemInstruction.Parts = append(out.SystemInstruction.Parts, geminiParts(m.Content, false)...)
+		case "user":
+			out.Contents = appendGeminiTurn(out.Contents, "user", geminiParts(m.Content, true))
+		case "assistant":
+			parts := geminiParts(m.Content, false)
+			for _, tc := range m.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					Name: tc.Function.Name,
+					Args: chat.JSONObject(tc.Function.Arguments),
+				}})
+			}
+			out.Contents = appendGeminiTurn(out.Contents, "model", parts)
+		case "tool":
+			name := callNames[m.ToolCallID]
+			if name == "" {
+				name = m.Name
+			}
+			out.Contents = appendGeminiTurn(out.Contents, "user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: toolResponse(m.Content),
+			}}})
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", m.Role)
+		}
+	}
+	if len(out.Contents) == 0 {
+		return nil, fmt.Errorf("messages must include a user or assistant turn")
+	}
+
+	if len(req.Tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  geminiSchema(t.Function.Parameters),
+			})
+		}
+		out.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+	if req.ToolChoice != nil {
+		out.ToolConfig = geminiToolChoice(req.ToolChoice)
+	}
+
+	gen := &geminiGenerationConfig{
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxOutputTokens: req.MaxTokens,
+		StopSequences:   chat.StopList(req.Stop),
+		CandidateCount:  req.N,
+	}
+	if rf := req.ResponseFormat; rf != nil {
+		switch rf.Type {
+		case "json_object":
+			gen.ResponseMimeType = "application/json"
+		case "json_schema":
+			gen.ResponseMimeType = "application/json"
+			if spec, ok := normalizeJSON(rf.JSONSchema).(map[string]interface{}); ok {
+				gen.ResponseSchema = geminiSchema(spec["schema"])
+			}
+		}
+	}
+	out.GenerationConfig = gen
+	return out, nil
+}
+
+// appendGeminiTurn adds parts to the conversation, merging them into the
+// last content when it has the same role so parallel function responses
+// share one turn.
+func appendGeminiTurn(contents []geminiContent, role string, parts []geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiParts converts chat content into Gemini parts. Images are kept
+// only when withImages is set; inline images become inline data and the
+// others file data.
+func geminiParts(content interface{}, withImages bool) []geminiPart {
+	var out []geminiPart
+	for _, p := range chat.Parts(content, withImages) {
+		switch {
+		case p.Data != "":
+			out = append(out, geminiPart{InlineData: &geminiBlob{MimeType: p.MimeType, Data: p.Data}})
+		case p.URL != "":
+			out = append(out, geminiPart{FileData: &geminiFileData{MimeType: p.MimeType, FileURI: p.URL}})
+		default:
+			out = append(out, geminiPart{Text: p.Text})
+		}
+	}
+	return out
+}
+
+// toolResponse wraps a tool result for a functionResponse, which must be
+// an object. Results that are JSON objects are passed as they are.
+func toolResponse(content interface{}) json.RawMessage {
+	var text strings.Builder
+	for _, p := range chat.Parts(content, false) {
+		text.WriteString(p.Text)
+	}
+	if obj := chat.JSONObject(text.String()); string(obj) != "{}" {
+		return obj
+	}
+	out, _ := json.Marshal(map[string]string{"content": text.String()})
+	return out
+}
+
+func geminiToolChoice(choice interface{}) *geminiToolConfig {
+	cfg := geminiFunctionCallingConfig{Mode: "AUTO"}
+	switch c := choice.(type) {
+	case string:
+		switch c {
+		case "required":
+			cfg.Mode = "ANY"
+		case "none":
+			cfg.Mode = "NONE"
+		}
+	case map[string]interface{}:
+		fn, _ := c["function"].(map[string]interface{})
+		if name, _ := fn["name"].(string); name != "" {
+			cfg = geminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{name}}
+		}
+	}
+	return &geminiToolConfig{FunctionCallingConfig: cfg}
+}
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords the Gemini schema
+// subset rejects.
+var geminiUnsupportedSchemaKeys = []string{"$schema", "$id", "additionalProperties"}
+
+// geminiSchema converts a JSON Schema into the subset Gemini accepts by
+// dropping unsupported keywords at every level.
+func geminiSchema(schema interface{}) interface{} {
+	if schema == nil {
+		return nil
+	}
+	return stripSchema(normalizeJSON(schema))
+}
+
+func stripSchema(v interface{}) interface{} {
+	switch s := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(s))
+		for k, child := range s {
+			out[k] = stripSchema(child)
+		}
+		for _, k := range geminiUnsupportedSchemaKeys {
+			delete(out, k)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(s))
+		for i, child := range s {
+			out[i] = stripSchema(child)
+		}
+		return out
+	}
+	return v
+}
+
+// normalizeJSON round-trips a value through JSON so typed values can be
+// walked as maps and slices.
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+// --- Response translation ---
+
+// fromGeminiResponse translates a generateContent response. A prompt
+// blocked before any candidate was generated becomes a single empty
+// choice finished by content_filter.
+func fromGeminiResponse(resp *geminiResponse, modelID string) *model.ChatCompletionResponse {
+	id := resp.ResponseID
+	if id == "" {
+		id = newID()
+	}
+	out := &model.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   geminiModelName(resp, modelID),
+		Choices: []model.Choice{},
+		Usage:   geminiChatUsage(resp.UsageMetadata),
+	}
+
+	for _, c := range resp.Candidates {
+		msg := &model.Message{Role: "assistant"}
+		var text strings.Builder
+		for _, p := range c.Content.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				msg.ToolCalls = append(msg.ToolCalls, geminiToolCall(p.FunctionCall, id, c.Index, len(msg.ToolCalls)))
+			case p.Text != "" && !p.Thought:
+				text.WriteString(p.Text)
+			}
+		}
+		if text.Len() > 0 || len(msg.ToolCalls) == 0 {
+			msg.Content = text.String()
+		}
+		finishReason := geminiFinishReason(c.FinishReason, len(msg.ToolCalls) > 0)
+		out.Choices = append(out.Choices, model.Choice{Index: c.Index, Message: msg, FinishReason: &finishReason})
+	}
+
+	if len(out.Choices) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		finishReason := "content_filter"
+		out.Choices = append(out.Choices, model.Choice{
+			Message:      &model.Message{Role: "assistant", Content: ""},
+			FinishReason: &finishReason,
+		})
+	}
+	return out
+}
+
+func geminiModelName(resp *geminiResponse, modelID string) string {
+	if resp.ModelVersion != "" {
+		return resp.ModelVersion
+	}
+	return modelID
+}
+
+// geminiToolCall converts a function call. Gemini only assigns call IDs
+// on some models, so missing ones are derived from the response ID.
+func geminiToolCall(fc *geminiFunctionCall, responseID string, candidate, n int) model.ToolCall {
+	id := fc.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%s_%d_%d", responseID, candidate, n)
+	}
+	args := string(fc.Args)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return model.ToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: model.FunctionCall{Name: fc.Name, Arguments: args},
+	}
+}
+
+// geminiFinishReason maps a Gemini finishReason onto an OpenAI
+// finish_reason. Safety, recitation and blocklist stops are reported as
+// content_filter.
+func geminiFinishReason(reason string, hasToolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY", "LANGUAGE":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiChatUsage converts usageMetadata. Thinking tokens are billed as
+// output, and cached tokens are already part of promptTokenCount.
+func geminiChatUsage(u *geminiUsage) *model.Usage {
+	if u == nil {
+		return nil
+	}
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	usage := &model.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: completion,
+		TotalTokens:      u.PromptTokenCount + completion,
+	}
+	if u.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+	}
+	return usage
+}
+
+// embeddingTexts returns the string inputs of an embeddings request.
+func embeddingTexts(input interface{}) ([]string, error) {
+	switch in := input.(type) {
+	case string:
+		return []string{in}, nil
+	case []string:
+		return in, nil
+	case []interface{}:
+		out := make([]string, 0, len(in))
+		for _, v := range in {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("embedding inputs must be strings")
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("embedding inputs must be strings")
+}
+
+// geminiStreamReader reads streamGenerateContent server-sent events, each
+// a partial response, and relays them as chat completion chunks.
+type geminiStreamReader struct {
+	scanner *bufio.Scanner
+	body    io.ReadCloser
+	model   string
+	id      string
+	created int64
+	started bool
+
+	// toolCalls counts the tool calls relayed per candidate.
+	toolCalls map[int]int
+}
+
+func (r *geminiStreamReader) Next() (*model.ChatCompletionChunk, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if strings.Contains(data, `"error"`) {
+			// A stream that fails after it started ends with an event
+			// carrying an error object instead of candidates.
+			var failed struct {
+				Error json.RawMessage `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &failed) == nil && len(failed.Error) > 0 && string(failed.Error) != "null" {
+				message, code := errorDetails([]byte(data))
+				return nil, streamError(code, message)
+			}
+		}
+
+		var resp geminiResponse
+		if err := json.Unmarshal([]byte(data), &resp); err != nil {
+			continue // skip malformed events
+		}
+		if chunk := r.translate(&resp); chunk != nil {
+			return chunk, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *geminiStreamReader) translate(resp *geminiResponse) *model.ChatCompletionChunk {
+	if resp.ModelVersion != "" {
+		r.model = resp.ModelVersion
+	}
+	chunk := &model.ChatCompletionChunk{
+		ID:      r.id,
+		Object:  "chat.completion.chunk",
+		Created: r.created,
+		Model:   r.model,
+		Choices: []model.Choice{},
+	}
+
+	finished := false
+	for _, c := range resp.Candidates {
+		delta := &model.Message{}
+		if !r.started {
+			delta.Role = "assistant"
+		}
+		var text strings.Builder
+		for _, p := range c.Content.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				idx := r.toolCalls[c.Index]
+				r.toolCalls[c.Index]++
+				tc := geminiToolCall(p.FunctionCall, r.id, c.Index, idx)
+				tc.Index = &idx
+				delta.ToolCalls = append(delta.ToolCalls, tc)
+			case p.Text != "" && !p.Thought:
+				text.WriteString(p.Text)
+			}
+		}
+		if text.Len() > 0 {
+			delta.Content = text.String()
+		}
+
+		choice := model.Choice{Index: c.Index, Delta: delta}
+		if c.FinishReason != "" {
+			finishReason := geminiFinishReason(c.FinishReason, r.toolCalls[c.Index] > 0)
+			choice.FinishReason = &finishReason
+			finished = true
+		}
+		chunk.Choices = append(chunk.Choices, choice)
+	}
+	r.started = r.started || len(chunk.Choices) > 0
+
+	if len(chunk.Choices) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		finishReason := "content_filter"
+		chunk.Choices = append(chunk.Choices, model.Choice{Delta: &model.Message{Role: "assistant"}, FinishReason: &finishReason})
+		finished = true
+	}
+
+	// usageMetadata is cumulative; relay it with the final chunk.
+	if finished {
+		chunk.Usage = geminiChatUsage(resp.UsageMetadata)
+	}
+	if len(chunk.Choices) == 0 && chunk.Usage == nil {
+		return nil
+	}
+	return chunk
+}
+
+func (r *geminiStreamReader) Close() error {
+	return r.body.Close()
+}
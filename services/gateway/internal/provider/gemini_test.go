@@ -0,0 +1,259 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestToGeminiRequest(t *testing.T) {
+	maxTokens := 100
+	req := &model.ChatCompletionRequest{
+		Model:     "gemini-2.0-flash",
+		MaxTokens: &maxTokens,
+		Messages: []model.Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "Weather?"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:image/png;base64,iVBOR"}},
+			}},
+			{Role: "assistant", ToolCalls: []model.ToolCall{
+				{ID: "call_1", Type: "function", Function: model.FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}},
+			}},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		},
+		Tools: []model.Tool{{Type: "function", Function: model.FunctionDef{
+			Name: "weather",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+				"additionalProperties": false,
+			},
+		}}},
+		ToolChoice: "required",
+		ResponseFormat: &model.ResponseFormat{Type: "json_schema", JSONSchema: map[string]interface{}{
+			"name":   "answer",
+			"strict": true,
+			"schema": map[string]interface{}{"$schema": "http://json-schema.org/draft-07/schema#", "type": "object"},
+		}},
+	}
+
+	out, err := toGeminiRequest(req)
+	if err != nil {
+		t.Fatalf("toGeminiRequest: %v", err)
+	}
+
+	if out.SystemInstruction == nil || out.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("systemInstruction = %+v", out.SystemInstruction)
+	}
+	if len(out.Contents) != 3 {
+		t.Fatalf("got %d contents, want 3", len(out.Contents))
+	}
+	if out.Contents[0].Role != "user" || len(out.Contents[0].Parts) != 2 || out.Contents[0].Parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("user content = %+v", out.Contents[0])
+	}
+	if fc := out.Contents[1].Parts[0].FunctionCall; out.Contents[1].Role != "model" || fc == nil || string(fc.Args) != `{"city":"Paris"}` {
+		t.Errorf("model content = %+v", out.Contents[1])
+	}
+	fr := out.Contents[2].Parts[0].FunctionResponse
+	if fr == nil || fr.Name != "weather" || string(fr.Response) != `{"content":"sunny"}` {
+		t.Errorf("function response = %+v", fr)
+	}
+
+	params := out.Tools[0].FunctionDeclarations[0].Parameters.(map[string]interface{})
+	if _, ok := params["additionalProperties"]; ok {
+		t.Error("additionalProperties was not stripped from the tool parameters")
+	}
+	if out.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Errorf("function calling mode = %q, want ANY", out.ToolConfig.FunctionCallingConfig.Mode)
+	}
+
+	gen := out.GenerationConfig
+	if gen.ResponseMimeType != "application/json" || *gen.MaxOutputTokens != 100 {
+		t.Errorf("generationConfig = %+v", gen)
+	}
+	schema := gen.ResponseSchema.(map[string]interface{})
+	if schema["type"] != "object" || schema["$schema"] != nil {
+		t.Errorf("responseSchema = %v, want the schema without $schema", schema)
+	}
+}
+
+func TestFromGeminiResponse(t *testing.T) {
+	var resp geminiResponse
+	json.Unmarshal([]byte(`{
+		"candidates": [{"content": {"role": "model", "parts": [
+			{"text": "thinking...", "thought": true},
+			{"functionCall": {"name": "weather", "args": {"city": "Paris"}}}
+		]}, "finishReason": "STOP", "index": 0}],
+		"usageMetadata": {"promptTokenCount": 50, "candidatesTokenCount": 8, "thoughtsTokenCount": 4, "cachedContentTokenCount": 32},
+		"modelVersion": "gemini-2.0-flash-001",
+		"responseId": "resp_1"
+	}`), &resp)
+
+	out := fromGeminiResponse(&resp, "gemini-2.0-flash")
+	if out.ID != "resp_1" || out.Model != "gemini-2.0-flash-001" {
+		t.Errorf("id, model = %q, %q", out.ID, out.Model)
+	}
+	choice := out.Choices[0]
+	if *choice.FinishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", *choice.FinishReason)
+	}
+	if choice.Message.Content != nil || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID == "" {
+		t.Errorf("message = %+v, want one tool call and no text", choice.Message)
+	}
+
+	u := out.Usage
+	if u.PromptTokens != 50 || u.CompletionTokens != 12 || u.TotalTokens != 62 || u.PromptTokensDetails.CachedTokens != 32 {
+		t.Errorf("usage = %+v, want thoughts counted as completion tokens", u)
+	}
+}
+
+func TestGeminiFinishReason(t *testing.T) {
+	cases := []struct {
+		reason string
+		tools  bool
+		want   string
+	}{
+		{"STOP", false, "stop"},
+		{"STOP", true, "tool_calls"},
+		{"MAX_TOKENS", false, "length"},
+		{"SAFETY", false, "content_filter"},
+		{"RECITATION", false, "content_filter"},
+		{"PROHIBITED_CONTENT", false, "content_filter"},
+		{"OTHER", false, "stop"},
+	}
+	for _, c := range cases {
+		if got := geminiFinishReason(c.reason, c.tools); got != c.want {
+			t.Errorf("geminiFinishReason(%q, %v) = %q, want %q", c.reason, c.tools, got, c.want)
+		}
+	}
+}
+
+func TestFromGeminiResponse_BlockedPrompt(t *testing.T) {
+	resp := &geminiResponse{PromptFeedback: &geminiPromptFeedback{BlockReason: "SAFETY"}}
+	out := fromGeminiResponse(resp, "gemini-2.0-flash")
+	if len(out.Choices) != 1 || *out.Choices[0].FinishReason != "content_filter" {
+		t.Errorf("choices = %+v, want one content_filter choice", out.Choices)
+	}
+}
+
+func TestGemini_SendStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("url = %s", r.URL)
+		}
+		if r.Header.Get("x-goog-api-key") != "AIza-test" {
+			t.Errorf("x-goog-api-key = %q", r.Header.Get("x-goog-api-key"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.Join([]string{
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}]}`,
+			"",
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"index":0}]}`,
+			"",
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":""}]},"finishReason":"MAX_TOKENS","index":0}],"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`,
+			"",
+		}, "\n"))
+	}))
+	defer srv.Close()
+
+	stream, err := NewGemini(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL + "/v1beta", APIKey: "AIza-test"})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	var text string
+	var chunks []*model.ChatCompletionChunk
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if s, ok := chunk.Choices[0].Delta.Content.(string); ok {
+			text += s
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if text != "Hello" || len(chunks) != 3 {
+		t.Fatalf("text = %q over %d chunks, want Hello over 3", text, len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" {
+		t.Error("first chunk does not carry the assistant role")
+	}
+	last := chunks[2]
+	if *last.Choices[0].FinishReason != "length" || last.Usage == nil || last.Usage.TotalTokens != 6 {
+		t.Errorf("last chunk = %+v, want finish_reason length and usage", last)
+	}
+}
+
+func TestGemini_StreamErrorEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, strings.Join([]string{
+			`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}]}`,
+			"",
+			`data: {"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`,
+			"",
+		}, "\n"))
+	}))
+	defer srv.Close()
+
+	stream, err := NewGemini(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "gemini-2.0-flash",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL + "/v1beta", APIKey: "AIza-test"})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Next(); err != nil {
+		t.Fatalf("first Next: %v", err)
+	}
+	_, err = stream.Next()
+	var pe *ProviderError
+	if !errors.As(err, &pe) {
+		t.Fatalf("err = %v, want a ProviderError rather than the end of the stream", err)
+	}
+	if pe.Kind != KindRateLimited || !strings.Contains(pe.Message, "Resource has been exhausted") {
+		t.Errorf("error = %+v, want rate_limited with the upstream message", pe)
+	}
+}
+
+func TestGemini_Embed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req geminiEmbedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Requests) != 2 || req.Requests[0].Model != "models/text-embedding-004" {
+			t.Errorf("embed request = %+v", req)
+		}
+		io.WriteString(w, `{"embeddings":[{"values":[0.1,0.2]},{"values":[0.3,0.4]}]}`)
+	}))
+	defer srv.Close()
+
+	resp, err := NewGemini(srv.Client()).Embed(context.Background(), &model.EmbeddingRequest{
+		Model: "text-embedding-004",
+		Input: []interface{}{"a", "b"},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Data[1].Index != 1 {
+		t.Errorf("data = %+v", resp.Data)
+	}
+}
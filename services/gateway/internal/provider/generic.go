@@ -25,3 +25,11 @@ func (p *GenericProvider) Send(ctx context.Context, req *model.ChatCompletionReq
 func (p *GenericProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
 	return p.inner.SendStream(ctx, req, cfg)
 }
+
+func (p *GenericProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	return p.inner.Embed(ctx, req, cfg)
+}
+
+func (p *GenericProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	return p.inner.Probe(ctx, cfg)
+}
@@ -1,34 +1,630 @@
 package provider
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/openfive/gateway/internal/chat"
 	"github.com/openfive/gateway/internal/model"
 )
 
-// OllamaProvider reuses the OpenRouter implementation since Ollama
-// supports the OpenAI-compatible API at /v1/chat/completions.
+// ollamaContextWindow is assumed for discovered models whose context
+// length Ollama does not report.
+const ollamaContextWindow = 4096
+
+// OllamaProvider speaks Ollama's native API. The base URL is the server
+// root, e.g. http://localhost:11434; a trailing /v1, as used for the
+// OpenAI-compatible API, is ignored. The provider metadata may hold:
+//
+//	keep_alive     how long a model stays loaded after a request, e.g.
+//	               "30m", or -1 to keep it loaded
+//	options        model options sent with every request, e.g.
+//	               {"num_ctx": 8192}
+//	model_options  an object mapping model IDs to options that override
+//	               those in options
+//
+// Sampling parameters set on a request take precedence over both.
 type OllamaProvider struct {
-	inner *OpenRouterProvider
+	client *http.Client
 }
 
 func NewOllama(client *http.Client) *OllamaProvider {
-	return &OllamaProvider{inner: NewOpenRouter(client)}
+	return &OllamaProvider{client: client}
 }
 
 func (p *OllamaProvider) Name() string { return "ollama" }
 
 func (p *OllamaProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
-	if cfg.APIKey == "" {
-		cfg.APIKey = "ollama" // dummy key required by Ollama
+	chatReq, err := toOllamaRequest(req, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+
+	httpReq, err := p.newRequest(ctx, "POST", "/api/chat", chatReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
 	}
-	return p.inner.Send(ctx, req, cfg)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return fromOllamaResponse(&result, req.Model), nil
 }
 
 func (p *OllamaProvider) SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error) {
-	if cfg.APIKey == "" {
-		cfg.APIKey = "ollama"
+	chatReq, err := toOllamaRequest(req, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("translate request: %w", err)
+	}
+	chatReq.Stream = true
+
+	httpReq, err := p.newRequest(ctx, "POST", "/api/chat", chatReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineBytes)
+
+	return &ollamaStreamReader{
+		scanner: scanner,
+		body:    resp.Body,
+		id:      "ollama-" + newID(),
+		model:   req.Model,
+		created: time.Now().Unix(),
+	}, nil
+}
+
+func (p *OllamaProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	inputs, err := embeddingTexts(req.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	embedReq := ollamaEmbedRequest{
+		Model:      req.Model,
+		Input:      inputs,
+		Dimensions: req.Dimensions,
+		Options:    ollamaOptions(req.Model, cfg),
+		KeepAlive:  cfg.Metadata["keep_alive"],
+	}
+	httpReq, err := p.newRequest(ctx, "POST", "/api/embed", embedReq, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result ollamaEmbedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	out := &model.EmbeddingResponse{
+		Object: "list",
+		Model:  req.Model,
+		Data:   make([]model.Embedding, len(result.Embeddings)),
+		Usage:  &model.Usage{PromptTokens: result.PromptEvalCount, TotalTokens: result.PromptEvalCount},
+	}
+	for i, e := range result.Embeddings {
+		out.Data[i] = model.Embedding{Object: "embedding", Index: i, Embedding: e}
+	}
+	return out, nil
+}
+
+// Probe asks for the server version, which loads no model.
+func (p *OllamaProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	resp, err := p.get(ctx, "/api/version", cfg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListModels returns the models installed on the server, with the
+// context length and capabilities Ollama reports for each. Models that
+// cannot generate completions, such as embedding models, are left out.
+func (p *OllamaProvider) ListModels(ctx context.Context, cfg ProviderConfig) ([]model.ModelInfo, error) {
+	resp, err := p.get(ctx, "/api/tags", cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+
+	var models []model.ModelInfo
+	for _, t := range tags.Models {
+		info := model.ModelInfo{
+			ModelID:           ollamaModelID(t.Name),
+			DisplayName:       ollamaModelID(t.Name),
+			ContextWindow:     ollamaContextWindow,
+			SupportsStreaming: true,
+			SupportsJSONMode:  true,
+			IsActive:          true,
+		}
+		// Without details the model is still listed, as a plain text model.
+		if show, err := p.show(ctx, t.Name, cfg); err == nil {
+			if len(show.Capabilities) > 0 && !slices.Contains(show.Capabilities, "completion") {
+				continue
+			}
+			info.SupportsTools = slices.Contains(show.Capabilities, "tools")
+			info.SupportsVision = slices.Contains(show.Capabilities, "vision")
+			if n := show.contextLength(); n > 0 {
+				info.ContextWindow = n
+			}
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// LoadedModels returns the models currently loaded in memory, each under
+// both its full name and, for the latest tag, its bare name.
+func (p *OllamaProvider) LoadedModels(ctx context.Context, cfg ProviderConfig) ([]string, error) {
+	resp, err := p.get(ctx, "/api/ps", cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ps struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		return nil, fmt.Errorf("decode running models: %w", err)
+	}
+
+	var names []string
+	for _, m := range ps.Models {
+		names = append(names, m.Name)
+		if id := ollamaModelID(m.Name); id != m.Name {
+			names = append(names, id)
+		}
+	}
+	return names, nil
+}
+
+// show fetches the details of an installed model.
+func (p *OllamaProvider) show(ctx context.Context, name string, cfg ProviderConfig) (*ollamaShowResponse, error) {
+	httpReq, err := p.newRequest(ctx, "POST", "/api/show", map[string]string{"model": name}, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result ollamaShowResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode model details: %w", err)
+	}
+	return &result, nil
+}
+
+// get sends a GET request and returns the response if it succeeded; the
+// caller closes the body.
+func (p *OllamaProvider) get(ctx context.Context, path string, cfg ProviderConfig) (*http.Response, error) {
+	httpReq, err := p.newRequest(ctx, "GET", path, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+	return resp, nil
+}
+
+// newRequest builds a request to the Ollama server. Ollama needs no key,
+// but one is sent when configured, for servers behind an authenticating
+// proxy. A nil payload sends no body.
+func (p *OllamaProvider) newRequest(ctx context.Context, method, path string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	base := strings.TrimSuffix(strings.TrimSuffix(cfg.BaseURL, "/"), "/v1")
+	httpReq, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if cfg.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
 	}
-	return p.inner.SendStream(ctx, req, cfg)
+	return httpReq, nil
+}
+
+// ollamaModelID drops the implied ":latest" tag, so discovered models
+// match the names they are usually configured and requested under.
+func ollamaModelID(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+// --- Wire types ---
+
+type ollamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []ollamaMessage        `json:"messages"`
+	Tools     []model.Tool           `json:"tools,omitempty"`
+	Format    interface{}            `json:"format,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Stream    bool                   `json:"stream"`
+	KeepAlive interface{}            `json:"keep_alive,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+type ollamaEmbedRequest struct {
+	Model      string                 `json:"model"`
+	Input      []string               `json:"input"`
+	Dimensions *int                   `json:"dimensions,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	KeepAlive  interface{}            `json:"keep_alive,omitempty"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+type ollamaShowResponse struct {
+	Capabilities []string               `json:"capabilities"`
+	ModelInfo    map[string]interface{} `json:"model_info"`
+}
+
+// contextLength returns the "<architecture>.context_length" entry of the
+// model info, or 0.
+func (s *ollamaShowResponse) contextLength() int {
+	arch, _ := s.ModelInfo["general.architecture"].(string)
+	n, _ := s.ModelInfo[arch+".context_length"].(float64)
+	return int(n)
+}
+
+// --- Request translation ---
+
+// toOllamaRequest translates a chat request. Images are sent only when
+// given as data URLs, as Ollama takes inline base64 data.
+func toOllamaRequest(req *model.ChatCompletionRequest, cfg ProviderConfig) (*ollamaChatRequest, error) {
+	out := &ollamaChatRequest{
+		Model:     req.Model,
+		Options:   ollamaOptions(req.Model, cfg),
+		KeepAlive: cfg.Metadata["keep_alive"],
+	}
+
+	// Tool results carry only the call ID; Ollama wants the tool name.
+	callNames := make(map[string]string)
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role}
+		switch m.Role {
+		case "developer":
+			msg.Role = "system"
+		case "system", "user", "assistant":
+		case "tool":
+			msg.ToolName = callNames[m.ToolCallID]
+			if msg.ToolName == "" {
+				msg.ToolName = m.Name
+			}
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", m.Role)
+		}
+
+		var text strings.Builder
+		for _, part := range chat.Parts(m.Content, m.Role == "user") {
+			if part.Data != "" {
+				msg.Images = append(msg.Images, part.Data)
+				continue
+			}
+			text.WriteString(part.Text)
+		}
+		msg.Content = text.String()
+
+		for _, tc := range m.ToolCalls {
+			callNames[tc.ID] = tc.Function.Name
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = chat.JSONObject(tc.Function.Arguments)
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+
+	if req.Temperature != nil || req.TopP != nil || req.MaxTokens != nil || req.Stop != nil {
+		if out.Options == nil {
+			out.Options = make(map[string]interface{})
+		}
+		if req.Temperature != nil {
+			out.Options["temperature"] = *req.Temperature
+		}
+		if req.TopP != nil {
+			out.Options["top_p"] = *req.TopP
+		}
+		if req.MaxTokens != nil {
+			out.Options["num_predict"] = *req.MaxTokens
+		}
+		if stop := chat.StopList(req.Stop); len(stop) > 0 {
+			out.Options["stop"] = stop
+		}
+	}
+
+	// Ollama has no tool_choice; "none" is honoured by not offering tools.
+	if choice, _ := req.ToolChoice.(string); choice != "none" {
+		out.Tools = req.Tools
+	}
+
+	if rf := req.ResponseFormat; rf != nil {
+		switch rf.Type {
+		case "json_object":
+			out.Format = "json"
+		case "json_schema":
+			out.Format = "json"
+			if spec, ok := normalizeJSON(rf.JSONSchema).(map[string]interface{}); ok && spec["schema"] != nil {
+				out.Format = spec["schema"]
+			}
+		}
+	}
+	return out, nil
+}
+
+// ollamaOptions returns the options the provider metadata sets for a
+// model, or nil.
+func ollamaOptions(modelID string, cfg ProviderConfig) map[string]interface{} {
+	opts := make(map[string]interface{})
+	if base, ok := cfg.Metadata["options"].(map[string]interface{}); ok {
+		for k, v := range base {
+			opts[k] = v
+		}
+	}
+	if perModel, ok := cfg.Metadata["model_options"].(map[string]interface{}); ok {
+		if override, ok := perModel[modelID].(map[string]interface{}); ok {
+			for k, v := range override {
+				opts[k] = v
+			}
+		}
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return opts
+}
+
+// --- Response translation ---
+
+func fromOllamaResponse(resp *ollamaChatResponse, modelID string) *model.ChatCompletionResponse {
+	id := "ollama-" + newID()
+	msg := &model.Message{Role: "assistant"}
+	for i, tc := range resp.Message.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, ollamaChatToolCall(tc, id, i))
+	}
+	if resp.Message.Content != "" || len(msg.ToolCalls) == 0 {
+		msg.Content = resp.Message.Content
+	}
+
+	finishReason := ollamaFinishReason(resp.DoneReason, len(msg.ToolCalls) > 0)
+	return &model.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelID,
+		Choices: []model.Choice{{Index: 0, Message: msg, FinishReason: &finishReason}},
+		Usage:   ollamaChatUsage(resp),
+	}
+}
+
+// ollamaChatToolCall converts a tool call. Ollama assigns call IDs only in
+// recent versions, so missing ones are derived from the response ID.
+func ollamaChatToolCall(tc ollamaToolCall, responseID string, n int) model.ToolCall {
+	id := tc.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%s_%d", responseID, n)
+	}
+	args := string(tc.Function.Arguments)
+	if args == "" || args == "null" {
+		args = "{}"
+	}
+	return model.ToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: model.FunctionCall{Name: tc.Function.Name, Arguments: args},
+	}
+}
+
+func ollamaFinishReason(doneReason string, hasToolCalls bool) string {
+	if doneReason == "length" {
+		return "length"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+func ollamaChatUsage(resp *ollamaChatResponse) *model.Usage {
+	return &model.Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+		TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+	}
+}
+
+// ollamaStreamReader reads the newline-delimited JSON of a streamed
+// /api/chat response. The final object carries the finish reason and
+// token counts, which are relayed on the finishing chunk.
+type ollamaStreamReader struct {
+	scanner *bufio.Scanner
+	body    io.ReadCloser
+	id      string
+	model   string
+	created int64
+	started bool
+
+	// toolCalls counts the tool calls relayed so far.
+	toolCalls    int
+	hasToolCalls bool
+}
+
+func (r *ollamaStreamReader) Next() (*model.ChatCompletionChunk, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var resp ollamaChatResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			continue // skip malformed lines
+		}
+		if resp.Error != "" {
+			return nil, streamError("", resp.Error)
+		}
+		if chunk := r.translate(&resp); chunk != nil {
+			return chunk, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *ollamaStreamReader) translate(resp *ollamaChatResponse) *model.ChatCompletionChunk {
+	delta := &model.Message{}
+	if !r.started {
+		delta.Role = "assistant"
+		r.started = true
+	}
+	if resp.Message.Content != "" {
+		delta.Content = resp.Message.Content
+	}
+	for _, tc := range resp.Message.ToolCalls {
+		call := ollamaChatToolCall(tc, r.id, r.toolCalls)
+		index := r.toolCalls
+		call.Index = &index
+		delta.ToolCalls = append(delta.ToolCalls, call)
+		r.toolCalls++
+		r.hasToolCalls = true
+	}
+
+	chunk := &model.ChatCompletionChunk{
+		ID:      r.id,
+		Object:  "chat.completion.chunk",
+		Created: r.created,
+		Model:   r.model,
+		Choices: []model.Choice{{Index: 0, Delta: delta}},
+	}
+	if resp.Done {
+		finishReason := ollamaFinishReason(resp.DoneReason, r.hasToolCalls)
+		chunk.Choices[0].FinishReason = &finishReason
+		chunk.Usage = ollamaChatUsage(resp)
+		return chunk
+	}
+	if delta.Role == "" && delta.Content == nil && len(delta.ToolCalls) == 0 {
+		return nil
+	}
+	return chunk
+}
+
+func (r *ollamaStreamReader) Close() error {
+	return r.body.Close()
 }
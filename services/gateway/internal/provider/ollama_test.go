@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestOllama_Send(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+		var body ollamaChatRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Stream {
+			t.Error("stream = true for Send")
+		}
+		if body.KeepAlive != "30m" {
+			t.Errorf("keep_alive = %v", body.KeepAlive)
+		}
+		want := map[string]interface{}{"num_ctx": float64(32768), "num_gpu": float64(99), "temperature": 0.2, "num_predict": float64(50)}
+		if !reflect.DeepEqual(body.Options, want) {
+			t.Errorf("options = %v, want %v", body.Options, want)
+		}
+		if tool := body.Messages[2]; tool.Role != "tool" || tool.ToolName != "weather" || tool.Content != "sunny" {
+			t.Errorf("tool message = %+v", tool)
+		}
+		if args := string(body.Messages[1].ToolCalls[0].Function.Arguments); args != `{"city":"Oslo"}` {
+			t.Errorf("tool call arguments = %s, want an object", args)
+		}
+		io.WriteString(w, `{"model":"llama3.1","message":{"role":"assistant","content":"",
+			"tool_calls":[{"function":{"name":"forecast","arguments":{"days":3}}}]},
+			"done":true,"done_reason":"stop","prompt_eval_count":26,"eval_count":9}`)
+	}))
+	defer srv.Close()
+
+	temp, maxTokens := 0.2, 50
+	resp, err := NewOllama(srv.Client()).Send(context.Background(), &model.ChatCompletionRequest{
+		Model:       "llama3.1",
+		Temperature: &temp,
+		MaxTokens:   &maxTokens,
+		Messages: []model.Message{
+			{Role: "user", Content: "Weather in Oslo?"},
+			{Role: "assistant", ToolCalls: []model.ToolCall{{ID: "t1", Type: "function", Function: model.FunctionCall{Name: "weather", Arguments: `{"city":"Oslo"}`}}}},
+			{Role: "tool", ToolCallID: "t1", Content: "sunny"},
+		},
+	}, ProviderConfig{
+		BaseURL: srv.URL + "/v1",
+		Metadata: map[string]interface{}{
+			"keep_alive":    "30m",
+			"options":       map[string]interface{}{"num_ctx": 8192, "num_gpu": 99},
+			"model_options": map[string]interface{}{"llama3.1": map[string]interface{}{"num_ctx": 32768}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if *choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v", choice)
+	}
+	if tc := choice.Message.ToolCalls[0]; tc.ID == "" || tc.Function.Name != "forecast" || tc.Function.Arguments != `{"days":3}` {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.Usage.PromptTokens != 26 || resp.Usage.CompletionTokens != 9 || resp.Usage.TotalTokens != 35 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllama_SendStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"model":"llama3.1","message":{"role":"assistant","content":"Hel"},"done":false}
+{"model":"llama3.1","message":{"role":"assistant","content":"lo"},"done":false}
+{"model":"llama3.1","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":5,"eval_count":2}
+`)
+	}))
+	defer srv.Close()
+
+	stream, err := NewOllama(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "llama3.1",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	var chunks []*model.ChatCompletionChunk
+	for {
+		chunk, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	if d := chunks[0].Choices[0].Delta; d.Role != "assistant" || d.Content != "Hel" {
+		t.Errorf("first delta = %+v", d)
+	}
+	last := chunks[2]
+	if fr := last.Choices[0].FinishReason; fr == nil || *fr != "length" {
+		t.Errorf("finish reason = %v, want length", fr)
+	}
+	if last.Usage == nil || last.Usage.TotalTokens != 7 {
+		t.Errorf("usage = %+v", last.Usage)
+	}
+}
+
+func TestOllama_StreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"error":"model requires more system memory"}`+"\n")
+	}))
+	defer srv.Close()
+
+	stream, err := NewOllama(srv.Client()).SendStream(context.Background(), &model.ChatCompletionRequest{
+		Model:    "llama3.1:70b",
+		Messages: []model.Message{{Role: "user", Content: "Hi"}},
+	}, ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	defer stream.Close()
+
+	if _, err := stream.Next(); err == nil || err == io.EOF {
+		t.Errorf("err = %v, want the stream error", err)
+	}
+}
+
+func TestOllama_ListModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			io.WriteString(w, `{"models":[{"name":"llama3.2:latest"},{"name":"llava:13b"},{"name":"nomic-embed-text:latest"}]}`)
+		case "/api/show":
+			var body struct{ Model string }
+			json.NewDecoder(r.Body).Decode(&body)
+			switch body.Model {
+			case "llama3.2:latest":
+				io.WriteString(w, `{"capabilities":["completion","tools"],"model_info":{"general.architecture":"llama","llama.context_length":131072}}`)
+			case "llava:13b":
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				io.WriteString(w, `{"capabilities":["embedding"],"model_info":{"general.architecture":"nomic-bert"}}`)
+			}
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	models, err := NewOllama(srv.Client()).ListModels(context.Background(), ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("got %d models, want the embedding model left out: %+v", len(models), models)
+	}
+	if m := models[0]; m.ModelID != "llama3.2" || m.ContextWindow != 131072 || !m.SupportsTools {
+		t.Errorf("llama3.2 = %+v", m)
+	}
+	if m := models[1]; m.ModelID != "llava:13b" || m.ContextWindow != ollamaContextWindow || m.SupportsTools {
+		t.Errorf("llava = %+v, want defaults without details", m)
+	}
+}
+
+func TestOllama_LoadedModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ps" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		io.WriteString(w, `{"models":[{"name":"llama3.2:latest","size_vram":2000000000},{"name":"qwen2.5:7b"}]}`)
+	}))
+	defer srv.Close()
+
+	names, err := NewOllama(srv.Client()).LoadedModels(context.Background(), ProviderConfig{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatalf("LoadedModels: %v", err)
+	}
+	if want := []string{"llama3.2:latest", "llama3.2", "qwen2.5:7b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
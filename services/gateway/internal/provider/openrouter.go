@@ -24,33 +24,20 @@ func NewOpenRouter(client *http.Client) *OpenRouterProvider {
 func (p *OpenRouterProvider) Name() string { return "openrouter" }
 
 func (p *OpenRouterProvider) Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error) {
-	body, err := json.Marshal(req)
+	httpReq, err := p.newRequest(ctx, "/chat/completions", req, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", cfg.BaseURL+"/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
-	httpReq.Header.Set("HTTP-Referer", "https://openfive.dev")
-	httpReq.Header.Set("X-Title", "OpenFive Gateway")
-	for k, v := range cfg.Headers {
-		httpReq.Header.Set(k, v)
+		return nil, err
 	}
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, transportError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("provider error %d: %s", resp.StatusCode, string(respBody))
+		return nil, httpError(resp, respBody)
 	}
 
 	var result model.ChatCompletionResponse
@@ -65,41 +52,107 @@ func (p *OpenRouterProvider) SendStream(ctx context.Context, req *model.ChatComp
 	streamReq := *req
 	streamReq.Stream = true
 
-	body, err := json.Marshal(streamReq)
+	httpReq, err := p.newRequest(ctx, "/chat/completions", streamReq, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", cfg.BaseURL+"/chat/completions", bytes.NewReader(body))
+	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, transportError(err)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELineBytes)
+
+	return &sseReader{
+		scanner: scanner,
+		body:    resp.Body,
+	}, nil
+}
+
+func (p *OpenRouterProvider) Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error) {
+	httpReq, err := p.newRequest(ctx, "/embeddings", req, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, httpError(resp, respBody)
+	}
+
+	var result model.EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// Probe lists the models of the endpoint, which needs a valid key but no
+// tokens.
+func (p *OpenRouterProvider) Probe(ctx context.Context, cfg ProviderConfig) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", cfg.BaseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
 	httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
-	httpReq.Header.Set("HTTP-Referer", "https://openfive.dev")
-	httpReq.Header.Set("X-Title", "OpenFive Gateway")
 	for k, v := range cfg.Headers {
 		httpReq.Header.Set(k, v)
 	}
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return transportError(err)
 	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		defer resp.Body.Close()
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("provider error %d: %s", resp.StatusCode, string(respBody))
+		return httpError(resp, respBody)
 	}
+	return nil
+}
 
-	return &sseReader{
-		scanner: bufio.NewScanner(resp.Body),
-		body:    resp.Body,
-	}, nil
+// newRequest builds an authenticated JSON POST to an OpenAI-compatible endpoint.
+func (p *OpenRouterProvider) newRequest(ctx context.Context, path string, payload interface{}, cfg ProviderConfig) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", cfg.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	httpReq.Header.Set("HTTP-Referer", "https://openfive.dev")
+	httpReq.Header.Set("X-Title", "OpenFive Gateway")
+	for k, v := range cfg.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return httpReq, nil
 }
 
+// maxSSELineBytes bounds a single SSE line; large tool-call arguments can
+// exceed bufio.Scanner's 64KB default.
+const maxSSELineBytes = 1024 * 1024
+
 type sseReader struct {
 	scanner *bufio.Scanner
 	body    io.ReadCloser
@@ -120,6 +173,17 @@ func (r *sseReader) Next() (*model.ChatCompletionChunk, error) {
 		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
 			continue // skip malformed chunks
 		}
+		if strings.Contains(data, `"error"`) {
+			// Errors after the response has started arrive as an event
+			// with an error object in place of the choices.
+			var failed struct {
+				Error json.RawMessage `json:"error"`
+			}
+			if json.Unmarshal([]byte(data), &failed) == nil && len(failed.Error) > 0 && string(failed.Error) != "null" {
+				message, code := errorDetails([]byte(data))
+				return nil, streamError(code, message)
+			}
+		}
 		return &chunk, nil
 	}
 	if err := r.scanner.Err(); err != nil {
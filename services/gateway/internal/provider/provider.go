@@ -12,15 +12,41 @@ type Provider interface {
 	Name() string
 	Send(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (*model.ChatCompletionResponse, error)
 	SendStream(ctx context.Context, req *model.ChatCompletionRequest, cfg ProviderConfig) (StreamReader, error)
+	Embed(ctx context.Context, req *model.EmbeddingRequest, cfg ProviderConfig) (*model.EmbeddingResponse, error)
+}
+
+// Prober is implemented by providers that can check their endpoint is
+// reachable and accepts the configured credentials without running a
+// completion.
+type Prober interface {
+	Probe(ctx context.Context, cfg ProviderConfig) error
+}
+
+// ModelLister is implemented by self-hosted providers that can list the
+// models installed on them. Only the ModelID, DisplayName, ContextWindow
+// and capability fields of the returned models are set.
+type ModelLister interface {
+	ListModels(ctx context.Context, cfg ProviderConfig) ([]model.ModelInfo, error)
+}
+
+// LoadReporter is implemented by providers that load models into memory
+// on demand and can report which ones are loaded, so requests can avoid
+// waiting for a cold model.
+type LoadReporter interface {
+	LoadedModels(ctx context.Context, cfg ProviderConfig) ([]string, error)
 }
 
 // ProviderConfig holds per-request provider configuration.
 type ProviderConfig struct {
-	BaseURL   string
-	APIKey    string
-	ModelID   string
-	Headers   map[string]string
+	BaseURL string
+	APIKey  string
+	ModelID string
+	Headers map[string]string
+	// TimeoutMs is how long a call may wait for its response to start;
+	// the caller enforces it through the context it passes.
 	TimeoutMs int
+	// Metadata is the provider's metadata; see model.Provider.
+	Metadata map[string]interface{}
 }
 
 // StreamReader reads SSE chunks from a provider.
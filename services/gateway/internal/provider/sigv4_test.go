@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The vectors below are from the AWS Signature Version 4 test suite and
+// documentation.
+var testCreds = awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+func TestSignV4_GetVanilla(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	signV4(req, nil, testCreds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n %s\nwant\n %s", got, want)
+	}
+}
+
+func TestSignV4_QueryAndContentType(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, nil, testCreds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	got := req.Header.Get("Authorization")
+	if !strings.HasSuffix(got, "SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7") {
+		t.Errorf("Authorization = %s", got)
+	}
+}
+
+func TestSignV4_SessionToken(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/model/x/converse", nil)
+	creds := testCreds
+	creds.SessionToken = "token"
+	signV4(req, []byte("{}"), creds, "us-east-1", "bedrock", time.Now())
+
+	if req.Header.Get("X-Amz-Security-Token") != "token" {
+		t.Error("session token header not set")
+	}
+	if !strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Authorization = %s, want the token signed", req.Header.Get("Authorization"))
+	}
+}
+
+func TestCanonicalURI_EncodesTwice(t *testing.T) {
+	req, _ := http.NewRequest("POST", "https://bedrock-runtime.us-east-1.amazonaws.com/", nil)
+	req.URL.Path = "/model/anthropic.claude-v2:1/converse"
+	req.URL.RawPath = "/model/anthropic.claude-v2%3A1/converse"
+	if got := canonicalURI(req.URL); got != "/model/anthropic.claude-v2%253A1/converse" {
+		t.Errorf("canonicalURI = %q", got)
+	}
+}
+
+func TestParseAWSCredentials(t *testing.T) {
+	creds, err := parseAWSCredentials("AKID:SECRET:TOKEN")
+	if err != nil || creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "SECRET" || creds.SessionToken != "TOKEN" {
+		t.Errorf("colon form = %+v, %v", creds, err)
+	}
+	creds, err = parseAWSCredentials(`{"access_key_id":"AKID","secret_access_key":"SECRET"}`)
+	if err != nil || creds.AccessKeyID != "AKID" || creds.SessionToken != "" {
+		t.Errorf("JSON form = %+v, %v", creds, err)
+	}
+	if _, err := parseAWSCredentials("just-a-key"); err == nil {
+		t.Error("expected an error for a secret without a secret access key")
+	}
+}
@@ -0,0 +1,265 @@
+package responses
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfive/gateway/internal/chat"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// ToChatRequest translates a Responses API request into the
+// OpenAI-compatible request the pipeline runs on. history holds the
+// conversation of the response named by previous_response_id; instructions
+// are never carried over from it.
+func ToChatRequest(req *Request, history []model.Message) (*model.ChatCompletionRequest, error) {
+	if len(req.Input) == 0 {
+		return nil, fmt.Errorf("input must not be empty")
+	}
+
+	out := &model.ChatCompletionRequest{
+		Model:       req.Model,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxOutputTokens,
+		User:        req.User,
+	}
+
+	if req.Instructions != "" {
+		out.Messages = append(out.Messages, model.Message{Role: "system", Content: req.Instructions})
+	}
+	out.Messages = append(out.Messages, history...)
+	input, err := InputMessages(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	out.Messages = append(out.Messages, input...)
+
+	for _, t := range req.Tools {
+		if t.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type %q", t.Type)
+		}
+		out.Tools = append(out.Tools, model.Tool{
+			Type: "function",
+			Function: model.FunctionDef{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Parameters,
+			},
+		})
+	}
+	if req.ToolChoice != nil {
+		out.ToolChoice = toChatToolChoice(req.ToolChoice)
+	}
+
+	if req.Text != nil && req.Text.Format != nil {
+		switch f := req.Text.Format; f.Type {
+		case "json_object":
+			out.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		case "json_schema":
+			schema := map[string]interface{}{"name": f.Name, "schema": f.Schema}
+			if f.Strict != nil {
+				schema["strict"] = *f.Strict
+			}
+			out.ResponseFormat = &model.ResponseFormat{Type: "json_schema", JSONSchema: schema}
+		}
+	}
+
+	return out, nil
+}
+
+// InputMessages converts input items into chat messages. Consecutive
+// function_call items are folded into a single assistant message, and
+// developer messages become system messages.
+func InputMessages(items []InputItem) ([]model.Message, error) {
+	var out []model.Message
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			msg, err := inputMessage(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, msg)
+
+		case "function_call":
+			call := model.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			if n := len(out); n > 0 && out[n-1].Role == "assistant" {
+				out[n-1].ToolCalls = append(out[n-1].ToolCalls, call)
+			} else {
+				out = append(out, model.Message{Role: "assistant", ToolCalls: []model.ToolCall{call}})
+			}
+
+		case "function_call_output":
+			out = append(out, model.Message{Role: "tool", ToolCallID: item.CallID, Content: item.Output})
+
+		default:
+			return nil, fmt.Errorf("unsupported input item type %q", item.Type)
+		}
+	}
+	return out, nil
+}
+
+func inputMessage(item InputItem) (model.Message, error) {
+	role := item.Role
+	switch role {
+	case "developer":
+		role = "system"
+	case "user", "assistant", "system":
+	default:
+		return model.Message{}, fmt.Errorf("unsupported message role %q", item.Role)
+	}
+
+	var parts []interface{}
+	for _, p := range item.Content {
+		switch p.Type {
+		case "input_text", "output_text":
+			parts = append(parts, map[string]interface{}{"type": "text", "text": p.Text})
+		case "input_image":
+			image := map[string]interface{}{"url": p.ImageURL}
+			if p.Detail != "" {
+				image["detail"] = p.Detail
+			}
+			parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": image})
+		default:
+			return model.Message{}, fmt.Errorf("unsupported content type %q", p.Type)
+		}
+	}
+
+	// Only user messages may carry content parts in chat completions.
+	if role != "user" {
+		return model.Message{Role: role, Content: textOf(item.Content)}, nil
+	}
+	return model.Message{Role: role, Content: chat.PartsContent(parts)}, nil
+}
+
+// textOf concatenates the text parts of a content list.
+func textOf(c Content) string {
+	var b strings.Builder
+	for _, p := range c {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
+
+func toChatToolChoice(choice interface{}) interface{} {
+	switch c := choice.(type) {
+	case string:
+		return c
+	case map[string]interface{}:
+		if c["type"] == "function" {
+			return map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": c["name"]},
+			}
+		}
+	}
+	return "auto"
+}
+
+// OutputMessages converts output items back into chat messages so a
+// response can be continued through previous_response_id.
+func OutputMessages(items []OutputItem) []model.Message {
+	var msg *model.Message
+	for _, item := range items {
+		if msg == nil {
+			msg = &model.Message{Role: "assistant"}
+		}
+		switch item.Type {
+		case "message":
+			var text strings.Builder
+			for _, c := range item.Content {
+				text.WriteString(c.Text)
+			}
+			msg.Content = text.String()
+		case "function_call":
+			msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: model.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
+	}
+	if msg == nil {
+		return nil
+	}
+	return []model.Message{*msg}
+}
+
+// FromChatResponse translates a chat completion into a Responses API
+// response with the given id.
+func FromChatResponse(id string, resp *model.ChatCompletionResponse) *Response {
+	out := newResponse(id, resp.Model, resp.Created)
+	out.Status = "completed"
+
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		if msg := choice.Message; msg != nil {
+			if text, ok := msg.Content.(string); ok && text != "" {
+				out.Output = append(out.Output, messageItem(id, text))
+			}
+			for _, tc := range msg.ToolCalls {
+				out.Output = append(out.Output, functionCallItem(tc.ID, tc.Function.Name, tc.Function.Arguments))
+			}
+		}
+		if choice.FinishReason != nil {
+			out.Status, out.IncompleteDetails = status(*choice.FinishReason)
+		}
+	}
+
+	if resp.Usage != nil {
+		out.Usage = &Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+			TotalTokens:  resp.Usage.TotalTokens,
+		}
+	}
+	return out
+}
+
+func newResponse(id, modelName string, createdAt int64) *Response {
+	return &Response{
+		ID:        id,
+		Object:    "response",
+		CreatedAt: createdAt,
+		Model:     modelName,
+		Output:    []OutputItem{},
+	}
+}
+
+func messageItem(responseID, text string) OutputItem {
+	return OutputItem{
+		Type:    "message",
+		ID:      "msg_" + strings.TrimPrefix(responseID, "resp_"),
+		Status:  "completed",
+		Role:    "assistant",
+		Content: []OutputText{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+	}
+}
+
+func functionCallItem(callID, name, arguments string) OutputItem {
+	return OutputItem{
+		Type:      "function_call",
+		ID:        "fc_" + strings.TrimPrefix(callID, "call_"),
+		Status:    "completed",
+		CallID:    callID,
+		Name:      name,
+		Arguments: arguments,
+	}
+}
+
+// status maps an OpenAI finish_reason onto a response status.
+func status(finishReason string) (string, *IncompleteDetails) {
+	switch finishReason {
+	case "length":
+		return "incomplete", &IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		return "incomplete", &IncompleteDetails{Reason: "content_filter"}
+	}
+	return "completed", nil
+}
@@ -0,0 +1,148 @@
+package responses
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestRequest_StringInput(t *testing.T) {
+	var req Request
+	if err := json.Unmarshal([]byte(`{"model":"gpt-4o","input":"Hello"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ToChatRequest(&req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Messages) != 1 || body.Messages[0].Role != "user" || body.Messages[0].Content != "Hello" {
+		t.Errorf("messages = %+v, want a single user message", body.Messages)
+	}
+}
+
+func TestToChatRequest_ItemsAndInstructions(t *testing.T) {
+	raw := `{
+		"model": "gpt-4o",
+		"instructions": "Be brief.",
+		"input": [
+			{"role": "developer", "content": "Use metric units."},
+			{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "Weather?"}]},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"Rome\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "18C"},
+			{"type": "function_call_output", "call_id": "call_2", "output": "24C"}
+		],
+		"tools": [{"type": "function", "name": "get_weather", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"max_output_tokens": 256
+	}`
+	var req Request
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		t.Fatal(err)
+	}
+	history := []model.Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello!"}}
+	body, err := ToChatRequest(&req, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantRoles := []string{"system", "user", "assistant", "system", "user", "assistant", "tool", "tool"}
+	if len(body.Messages) != len(wantRoles) {
+		t.Fatalf("got %d messages, want %d: %+v", len(body.Messages), len(wantRoles), body.Messages)
+	}
+	for i, role := range wantRoles {
+		if body.Messages[i].Role != role {
+			t.Errorf("message %d role = %q, want %q", i, body.Messages[i].Role, role)
+		}
+	}
+	if body.Messages[0].Content != "Be brief." {
+		t.Errorf("instructions = %v", body.Messages[0].Content)
+	}
+	if body.Messages[4].Content != "Weather?" {
+		t.Errorf("single text part should collapse to a string, got %v", body.Messages[4].Content)
+	}
+	if calls := body.Messages[5].ToolCalls; len(calls) != 2 || calls[1].ID != "call_2" {
+		t.Errorf("function calls should fold into one assistant message, got %+v", calls)
+	}
+	if body.Messages[7].ToolCallID != "call_2" || body.Messages[7].Content != "24C" {
+		t.Errorf("tool message = %+v", body.Messages[7])
+	}
+	if len(body.Tools) != 1 || body.Tools[0].Function.Name != "get_weather" {
+		t.Errorf("tools = %+v", body.Tools)
+	}
+	if choice, ok := body.ToolChoice.(map[string]interface{}); !ok || choice["type"] != "function" {
+		t.Errorf("tool_choice = %v", body.ToolChoice)
+	}
+	if body.MaxTokens == nil || *body.MaxTokens != 256 {
+		t.Errorf("max_tokens = %v, want 256", body.MaxTokens)
+	}
+}
+
+func TestToChatRequest_JSONSchemaFormat(t *testing.T) {
+	strict := true
+	req := &Request{
+		Input: Input{{Role: "user", Content: Content{{Type: "input_text", Text: "x"}}}},
+		Text:  &TextConfig{Format: &TextFormat{Type: "json_schema", Name: "answer", Schema: map[string]interface{}{"type": "object"}, Strict: &strict}},
+	}
+	body, err := ToChatRequest(req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.ResponseFormat == nil || body.ResponseFormat.Type != "json_schema" {
+		t.Fatalf("response_format = %+v", body.ResponseFormat)
+	}
+	schema := body.ResponseFormat.JSONSchema.(map[string]interface{})
+	if schema["name"] != "answer" || schema["strict"] != true {
+		t.Errorf("json_schema = %v", schema)
+	}
+}
+
+func TestToChatRequest_Rejects(t *testing.T) {
+	cases := map[string]*Request{
+		"empty input":  {},
+		"unknown item": {Input: Input{{Type: "reasoning"}}},
+		"unknown role": {Input: Input{{Role: "critic", Content: Content{{Type: "input_text", Text: "x"}}}}},
+		"builtin tool": {Input: Input{{Role: "user"}}, Tools: []Tool{{Type: "web_search"}}},
+	}
+	for name, req := range cases {
+		if _, err := ToChatRequest(req, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestFromChatResponse(t *testing.T) {
+	finish := "length"
+	resp := FromChatResponse("resp_abc", &model.ChatCompletionResponse{
+		Model:   "gpt-4o",
+		Created: 100,
+		Choices: []model.Choice{{
+			Message: &model.Message{
+				Role:      "assistant",
+				Content:   "Let me check.",
+				ToolCalls: []model.ToolCall{{ID: "call_1", Function: model.FunctionCall{Name: "lookup", Arguments: "{}"}}},
+			},
+			FinishReason: &finish,
+		}},
+		Usage: &model.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+
+	if resp.Object != "response" || resp.Status != "incomplete" || resp.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("status = %q %+v", resp.Status, resp.IncompleteDetails)
+	}
+	if len(resp.Output) != 2 || resp.Output[0].Type != "message" || resp.Output[1].Type != "function_call" {
+		t.Fatalf("output = %+v", resp.Output)
+	}
+	if resp.Output[0].ID != "msg_abc" || resp.Output[1].CallID != "call_1" {
+		t.Errorf("item ids = %q, %q", resp.Output[0].ID, resp.Output[1].CallID)
+	}
+	if resp.Usage.InputTokens != 10 || resp.Usage.OutputTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+
+	msgs := OutputMessages(resp.Output)
+	if len(msgs) != 1 || msgs[0].Content != "Let me check." || len(msgs[0].ToolCalls) != 1 {
+		t.Errorf("output messages = %+v", msgs)
+	}
+}
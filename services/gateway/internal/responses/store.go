@@ -0,0 +1,84 @@
+package responses
+
+import (
+	"sync"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// Store keeps the conversation behind each stored response so that later
+// requests can continue it with previous_response_id. Conversations are
+// scoped to an environment and held in memory only, so chaining works
+// within a single gateway instance and until the TTL expires.
+type Store struct {
+	mu         sync.Mutex
+	entries    map[string]*storedResponse
+	maxEntries int
+	ttl        time.Duration
+}
+
+type storedResponse struct {
+	messages  []model.Message
+	expiresAt time.Time
+}
+
+// NewStore creates a Store holding at most maxEntries conversations for ttl.
+func NewStore(maxEntries int, ttl time.Duration) *Store {
+	return &Store{
+		entries:    make(map[string]*storedResponse),
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// Put records the full conversation of a response, excluding instructions.
+func (s *Store) Put(envID, responseID string, messages []model.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[envID+":"+responseID] = &storedResponse{
+		messages:  messages,
+		expiresAt: now.Add(s.ttl),
+	}
+}
+
+// Get returns the conversation of a stored response.
+func (s *Store) Get(envID, responseID string) ([]model.Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := envID + ":" + responseID
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry.messages, true
+}
+
+// evict drops expired entries, or the entry closest to expiry when none
+// have expired. Must be called with mu held.
+func (s *Store) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(s.entries) >= s.maxEntries && oldestKey != "" {
+		delete(s.entries, oldestKey)
+	}
+}
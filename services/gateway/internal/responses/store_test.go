@@ -0,0 +1,39 @@
+package responses
+
+import (
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func TestStore_ScopedByEnvironment(t *testing.T) {
+	s := NewStore(10, time.Hour)
+	s.Put("env-a", "resp_1", []model.Message{{Role: "user", Content: "hi"}})
+
+	if msgs, ok := s.Get("env-a", "resp_1"); !ok || len(msgs) != 1 {
+		t.Errorf("Get(env-a) = %v, %v", msgs, ok)
+	}
+	if _, ok := s.Get("env-b", "resp_1"); ok {
+		t.Error("responses must not be visible to other environments")
+	}
+}
+
+func TestStore_ExpiryAndCapacity(t *testing.T) {
+	s := NewStore(2, time.Hour)
+	s.Put("env", "resp_1", nil)
+	s.Put("env", "resp_2", nil)
+	s.Put("env", "resp_3", nil)
+	if len(s.entries) != 2 {
+		t.Errorf("store holds %d entries, want 2", len(s.entries))
+	}
+	if _, ok := s.Get("env", "resp_3"); !ok {
+		t.Error("newest entry should be kept")
+	}
+
+	s = NewStore(10, -time.Second)
+	s.Put("env", "resp_1", nil)
+	if _, ok := s.Get("env", "resp_1"); ok {
+		t.Error("expired entry should not be returned")
+	}
+}
@@ -0,0 +1,245 @@
+package responses
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// StreamTranslator converts chat completion chunks into Responses API
+// streaming events. Text and each tool call become output items, announced
+// with response.output_item.added, filled by text or argument deltas and
+// closed with response.output_item.done before response.completed.
+type StreamTranslator struct {
+	resp        *Response
+	inputTokens int
+
+	started bool
+	seq     int
+
+	// open is the index in resp.Output of the item receiving deltas, or -1.
+	open     int
+	text     strings.Builder
+	toolItem map[int]int // chat tool call index -> output index
+
+	finishReason string
+	usage        *model.Usage
+}
+
+// NewStreamTranslator creates a translator for the response with the given
+// id. inputTokens is reported until the provider's usage arrives.
+func NewStreamTranslator(id, modelName string, createdAt int64, inputTokens int) *StreamTranslator {
+	return &StreamTranslator{
+		resp:        newResponse(id, modelName, createdAt),
+		inputTokens: inputTokens,
+		open:        -1,
+		toolItem:    make(map[int]int),
+	}
+}
+
+// Translate returns the events for one chunk. Only the first choice is
+// relayed.
+func (t *StreamTranslator) Translate(chunk *model.ChatCompletionChunk) []Event {
+	events := t.start()
+	if chunk.Usage != nil {
+		usage := *chunk.Usage
+		t.usage = &usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if d := choice.Delta; d != nil {
+			if text, ok := d.Content.(string); ok && text != "" {
+				events = append(events, t.openMessage()...)
+				t.text.WriteString(text)
+				item := t.resp.Output[t.open]
+				events = append(events, t.event("response.output_text.delta", map[string]interface{}{
+					"item_id":       item.ID,
+					"output_index":  t.open,
+					"content_index": 0,
+					"delta":         text,
+				}))
+			}
+			for i, tc := range d.ToolCalls {
+				idx := i
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				events = append(events, t.openToolCall(idx, tc)...)
+				if tc.Function.Arguments == "" {
+					continue
+				}
+				out := t.toolItem[idx]
+				item := &t.resp.Output[out]
+				item.Arguments += tc.Function.Arguments
+				events = append(events, t.event("response.function_call_arguments.delta", map[string]interface{}{
+					"item_id":      item.ID,
+					"output_index": out,
+					"delta":        tc.Function.Arguments,
+				}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// Finish closes any open item and returns the terminal response event.
+func (t *StreamTranslator) Finish() []Event {
+	events := t.start()
+	events = append(events, t.closeItem()...)
+
+	t.resp.Status, t.resp.IncompleteDetails = status(t.finishReason)
+	usage := &Usage{InputTokens: t.inputTokens, TotalTokens: t.inputTokens}
+	if t.usage != nil {
+		usage = &Usage{
+			InputTokens:  t.usage.PromptTokens,
+			OutputTokens: t.usage.CompletionTokens,
+			TotalTokens:  t.usage.TotalTokens,
+		}
+	}
+	t.resp.Usage = usage
+
+	eventType := "response.completed"
+	if t.resp.Status == "incomplete" {
+		eventType = "response.incomplete"
+	}
+	return append(events, t.event(eventType, map[string]interface{}{"response": t.resp}))
+}
+
+// Error returns an error event for a stream that failed after it started.
+func (t *StreamTranslator) Error(code, message string) Event {
+	return t.event("error", map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"param":   nil,
+	})
+}
+
+// Response returns the response assembled so far. After Finish it is the
+// complete response.
+func (t *StreamTranslator) Response() *Response {
+	return t.resp
+}
+
+func (t *StreamTranslator) start() []Event {
+	if t.started {
+		return nil
+	}
+	t.started = true
+
+	snapshot := *t.resp
+	snapshot.Status = "in_progress"
+	return []Event{
+		t.event("response.created", map[string]interface{}{"response": snapshot}),
+		t.event("response.in_progress", map[string]interface{}{"response": snapshot}),
+	}
+}
+
+// openMessage starts the assistant message item unless it is already open.
+func (t *StreamTranslator) openMessage() []Event {
+	if t.open >= 0 && t.resp.Output[t.open].Type == "message" {
+		return nil
+	}
+	events := t.closeItem()
+
+	item := messageItem(t.resp.ID, "")
+	if n := len(t.resp.Output); n > 0 {
+		// Text after a tool call needs an id of its own.
+		item.ID = fmt.Sprintf("%s_%d", item.ID, n)
+	}
+	item.Status = "in_progress"
+	item.Content = []OutputText{}
+	t.text.Reset()
+
+	events = append(events, t.add(item))
+	return append(events, t.event("response.content_part.added", map[string]interface{}{
+		"item_id":       item.ID,
+		"output_index":  t.open,
+		"content_index": 0,
+		"part":          OutputText{Type: "output_text", Annotations: []interface{}{}},
+	}))
+}
+
+// openToolCall starts a function_call item the first time a tool call
+// index is seen.
+func (t *StreamTranslator) openToolCall(idx int, tc model.ToolCall) []Event {
+	if _, ok := t.toolItem[idx]; ok {
+		return nil
+	}
+	events := t.closeItem()
+
+	callID := tc.ID
+	if callID == "" {
+		callID = fmt.Sprintf("call_%s_%d", strings.TrimPrefix(t.resp.ID, "resp_"), idx)
+	}
+	item := functionCallItem(callID, tc.Function.Name, "")
+	item.Status = "in_progress"
+
+	events = append(events, t.add(item))
+	t.toolItem[idx] = t.open
+	return events
+}
+
+func (t *StreamTranslator) add(item OutputItem) Event {
+	t.resp.Output = append(t.resp.Output, item)
+	t.open = len(t.resp.Output) - 1
+	return t.event("response.output_item.added", map[string]interface{}{
+		"output_index": t.open,
+		"item":         item,
+	})
+}
+
+func (t *StreamTranslator) closeItem() []Event {
+	if t.open < 0 {
+		return nil
+	}
+	out := t.open
+	t.open = -1
+	item := &t.resp.Output[out]
+	item.Status = "completed"
+
+	var events []Event
+	switch item.Type {
+	case "message":
+		part := OutputText{Type: "output_text", Text: t.text.String(), Annotations: []interface{}{}}
+		item.Content = []OutputText{part}
+		events = append(events,
+			t.event("response.output_text.done", map[string]interface{}{
+				"item_id":       item.ID,
+				"output_index":  out,
+				"content_index": 0,
+				"text":          part.Text,
+			}),
+			t.event("response.content_part.done", map[string]interface{}{
+				"item_id":       item.ID,
+				"output_index":  out,
+				"content_index": 0,
+				"part":          part,
+			}),
+		)
+	case "function_call":
+		events = append(events, t.event("response.function_call_arguments.done", map[string]interface{}{
+			"item_id":      item.ID,
+			"output_index": out,
+			"arguments":    item.Arguments,
+		}))
+	}
+	return append(events, t.event("response.output_item.done", map[string]interface{}{
+		"output_index": out,
+		"item":         *item,
+	}))
+}
+
+// event builds an event, stamping its type and sequence number.
+func (t *StreamTranslator) event(eventType string, data map[string]interface{}) Event {
+	data["type"] = eventType
+	data["sequence_number"] = t.seq
+	t.seq++
+	return Event{Type: eventType, Data: data}
+}
@@ -0,0 +1,103 @@
+package responses
+
+import (
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func eventTypes(events []Event) []string {
+	types := make([]string, len(events))
+	for i, ev := range events {
+		types[i] = ev.Type
+	}
+	return types
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamTranslator_TextThenFunctionCall(t *testing.T) {
+	tr := NewStreamTranslator("resp_1", "gpt-4o", 100, 12)
+	idx := 0
+	finish := "tool_calls"
+
+	var events []Event
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Role: "assistant", Content: "Check"}},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Content: "ing"}},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{ToolCalls: []model.ToolCall{{Index: &idx, ID: "call_1", Function: model.FunctionCall{Name: "get_weather"}}}}},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{ToolCalls: []model.ToolCall{{Index: &idx, Function: model.FunctionCall{Arguments: `{"city":"Paris"}`}}}}, FinishReason: &finish},
+	}})...)
+	events = append(events, tr.Translate(&model.ChatCompletionChunk{Usage: &model.Usage{PromptTokens: 15, CompletionTokens: 9, TotalTokens: 24}})...)
+	events = append(events, tr.Finish()...)
+
+	want := []string{
+		"response.created", "response.in_progress",
+		"response.output_item.added", "response.content_part.added", "response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done", "response.output_item.done",
+		"response.completed",
+	}
+	if got := eventTypes(events); !equal(got, want) {
+		t.Fatalf("event sequence:\n got  %v\n want %v", got, want)
+	}
+	for i, ev := range events {
+		if ev.Data["sequence_number"] != i {
+			t.Errorf("event %d sequence_number = %v", i, ev.Data["sequence_number"])
+		}
+	}
+
+	resp := tr.Response()
+	if resp.Status != "completed" || len(resp.Output) != 2 {
+		t.Fatalf("response = %+v", resp)
+	}
+	if text := resp.Output[0].Content[0].Text; text != "Checking" {
+		t.Errorf("text = %q, want Checking", text)
+	}
+	call := resp.Output[1]
+	if call.CallID != "call_1" || call.Name != "get_weather" || call.Arguments != `{"city":"Paris"}` || call.Status != "completed" {
+		t.Errorf("function call = %+v", call)
+	}
+	if resp.Usage.InputTokens != 15 || resp.Usage.OutputTokens != 9 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestStreamTranslator_Incomplete(t *testing.T) {
+	tr := NewStreamTranslator("resp_2", "gpt-4o", 100, 7)
+	finish := "length"
+	tr.Translate(&model.ChatCompletionChunk{Choices: []model.Choice{
+		{Delta: &model.Message{Content: "partial"}, FinishReason: &finish},
+	}})
+	events := tr.Finish()
+
+	last := events[len(events)-1]
+	if last.Type != "response.incomplete" {
+		t.Errorf("terminal event = %q, want response.incomplete", last.Type)
+	}
+	if resp := tr.Response(); resp.IncompleteDetails == nil || resp.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("incomplete_details = %+v", resp.IncompleteDetails)
+	}
+	if tr.Response().Usage.InputTokens != 7 {
+		t.Errorf("estimated input tokens should be reported without provider usage")
+	}
+}
@@ -0,0 +1,154 @@
+package responses
+
+import (
+	"encoding/json"
+)
+
+// Request is the OpenAI Responses API request body.
+type Request struct {
+	Model              string      `json:"model"`
+	Input              Input       `json:"input"`
+	Instructions       string      `json:"instructions,omitempty"`
+	PreviousResponseID string      `json:"previous_response_id,omitempty"`
+	Tools              []Tool      `json:"tools,omitempty"`
+	ToolChoice         interface{} `json:"tool_choice,omitempty"`
+	Temperature        *float64    `json:"temperature,omitempty"`
+	TopP               *float64    `json:"top_p,omitempty"`
+	MaxOutputTokens    *int        `json:"max_output_tokens,omitempty"`
+	Stream             bool        `json:"stream,omitempty"`
+	Store              *bool       `json:"store,omitempty"`
+	Text               *TextConfig `json:"text,omitempty"`
+	User               string      `json:"user,omitempty"`
+}
+
+// Input is a list of input items. On the wire it may also be a plain
+// string, which decodes to a single user message.
+type Input []InputItem
+
+func (in *Input) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*in = Input{{Type: "message", Role: "user", Content: Content{{Type: "input_text", Text: text}}}}
+		return nil
+	}
+	var items []InputItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+	*in = items
+	return nil
+}
+
+// InputItem is a message, function_call or function_call_output item.
+// Items without a type are messages.
+type InputItem struct {
+	Type      string  `json:"type,omitempty"`
+	ID        string  `json:"id,omitempty"`
+	Role      string  `json:"role,omitempty"`
+	Content   Content `json:"content,omitempty"`
+	CallID    string  `json:"call_id,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Arguments string  `json:"arguments,omitempty"`
+	Output    string  `json:"output,omitempty"`
+}
+
+// Content is a list of content parts. On the wire it may also be a plain
+// string, which decodes to a single input_text part.
+type Content []ContentPart
+
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Content{{Type: "input_text", Text: text}}
+		return nil
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	*c = parts
+	return nil
+}
+
+// ContentPart is an input_text, input_image or output_text part.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Tool is a Responses API function tool; unlike chat completions the
+// function fields are not nested.
+type Tool struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+	Strict      *bool       `json:"strict,omitempty"`
+}
+
+type TextConfig struct {
+	Format *TextFormat `json:"format,omitempty"`
+}
+
+// TextFormat selects plain text, JSON mode or structured output.
+type TextFormat struct {
+	Type   string      `json:"type"` // text, json_object, json_schema
+	Name   string      `json:"name,omitempty"`
+	Schema interface{} `json:"schema,omitempty"`
+	Strict *bool       `json:"strict,omitempty"`
+}
+
+// Response is the Responses API response object.
+type Response struct {
+	ID                 string             `json:"id"`
+	Object             string             `json:"object"`
+	CreatedAt          int64              `json:"created_at"`
+	Status             string             `json:"status"`
+	Model              string             `json:"model"`
+	Output             []OutputItem       `json:"output"`
+	PreviousResponseID *string            `json:"previous_response_id"`
+	IncompleteDetails  *IncompleteDetails `json:"incomplete_details"`
+	Error              *Error             `json:"error"`
+	Usage              *Usage             `json:"usage"`
+}
+
+// OutputItem is an assistant message or a function call.
+type OutputItem struct {
+	Type      string       `json:"type"`
+	ID        string       `json:"id"`
+	Status    string       `json:"status"`
+	Role      string       `json:"role,omitempty"`
+	Content   []OutputText `json:"content,omitempty"`
+	CallID    string       `json:"call_id,omitempty"`
+	Name      string       `json:"name,omitempty"`
+	Arguments string       `json:"arguments,omitempty"`
+}
+
+type OutputText struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Event is a named server-sent event in the Responses streaming format.
+type Event struct {
+	Type string
+	Data map[string]interface{}
+}
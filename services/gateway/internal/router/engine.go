@@ -7,13 +7,41 @@ import (
 	"github.com/openfive/gateway/internal/model"
 )
 
+// Residency reports whether a model is loaded in its provider's memory.
+// known is false for providers that don't report it.
+type Residency interface {
+	Loaded(providerID, modelID string) (loaded, known bool)
+}
+
+// Circuits reports whether calls on a model should be skipped because its
+// circuit, or its provider's, is open.
+type Circuits interface {
+	Open(providerID, modelID string) bool
+}
+
 // Engine selects the best model for a request.
-type Engine struct{}
+type Engine struct {
+	residency Residency
+	circuits  Circuits
+}
 
 func NewEngine() *Engine {
 	return &Engine{}
 }
 
+// PreferLoaded makes the engine try models their provider reports as not
+// loaded only after the others, as a cold model can take tens of seconds
+// to load. Call it before the engine is used.
+func (e *Engine) PreferLoaded(r Residency) {
+	e.residency = r
+}
+
+// SkipOpen makes the engine leave out models whose circuit is open, unless
+// every eligible model's is. Call it before the engine is used.
+func (e *Engine) SkipOpen(c Circuits) {
+	e.circuits = c
+}
+
 // Select returns an ordered list of models to try (primary + fallbacks).
 func (e *Engine) Select(
 	req *model.ChatCompletionRequest,
@@ -36,19 +64,25 @@ func (e *Engine) Select(
 		}
 	}
 
-	// Step 3: If route has a fallback chain, resolve it
+	// Step 3: Leave out models whose circuit is open
+	filtered = e.skipOpen(filtered)
+
+	// Step 4: If route has a fallback chain, resolve it
 	if len(route.FallbackChain) > 0 {
-		return e.resolveChain(route.FallbackChain, filtered), nil
+		return e.loadedFirst(e.resolveChain(route.FallbackChain, filtered)), nil
 	}
 
-	// Step 4: Score and rank
+	// Step 5: Score and rank
 	scored := e.score(filtered, route)
 
-	// Step 5: Apply preferred model preference
+	// Step 6: Apply preferred model preference
 	if route.PreferredModel != nil {
 		scored = e.applyPreference(scored, *route.PreferredModel)
 	}
 
+	// Step 7: Move models that would have to be loaded first behind the rest
+	scored = e.loadedFirst(scored)
+
 	// Return top 3
 	if len(scored) > 3 {
 		scored = scored[:3]
@@ -193,3 +227,39 @@ func (e *Engine) applyPreference(models []model.ModelInfo, preferredID string) [
 	}
 	return models
 }
+
+// skipOpen removes the models whose circuit is open. When every model's
+// is, they are all kept: a call that may fail beats one certain to.
+func (e *Engine) skipOpen(models []model.ModelInfo) []model.ModelInfo {
+	if e.circuits == nil {
+		return models
+	}
+	var result []model.ModelInfo
+	for _, m := range models {
+		if !e.circuits.Open(m.ProviderID, m.ModelID) {
+			result = append(result, m)
+		}
+	}
+	if len(result) == 0 {
+		return models
+	}
+	return result
+}
+
+// loadedFirst moves the models known not to be loaded after the others,
+// keeping the order within each group.
+func (e *Engine) loadedFirst(models []model.ModelInfo) []model.ModelInfo {
+	if e.residency == nil {
+		return models
+	}
+	result := make([]model.ModelInfo, 0, len(models))
+	var cold []model.ModelInfo
+	for _, m := range models {
+		if loaded, known := e.residency.Loaded(m.ProviderID, m.ModelID); known && !loaded {
+			cold = append(cold, m)
+			continue
+		}
+		result = append(result, m)
+	}
+	return append(result, cold...)
+}
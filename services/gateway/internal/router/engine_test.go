@@ -1,6 +1,7 @@
 package router
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/openfive/gateway/internal/model"
@@ -301,3 +302,74 @@ func TestEngine_Select_LimitsToThree(t *testing.T) {
 		t.Errorf("expected max 3 results, got %d", len(result))
 	}
 }
+
+type fakeResidency map[string]bool
+
+func (f fakeResidency) Loaded(providerID, modelID string) (bool, bool) {
+	loaded, known := f[providerID+"/"+modelID]
+	return loaded, known
+}
+
+func TestEngine_Select_FallbackChainPrefersLoaded(t *testing.T) {
+	e := NewEngine()
+	e.PreferLoaded(fakeResidency{"ollama/llama3.1:70b": false, "ollama/llama3.2": true})
+	req := &model.ChatCompletionRequest{}
+	route := &model.Route{FallbackChain: []string{"big", "cloud", "small"}}
+	candidates := []model.ModelInfo{
+		{ID: "big", ProviderID: "ollama", ModelID: "llama3.1:70b", SupportsStreaming: true},
+		{ID: "cloud", ProviderID: "openai", ModelID: "gpt-4o-mini", SupportsStreaming: true},
+		{ID: "small", ProviderID: "ollama", ModelID: "llama3.2", SupportsStreaming: true},
+	}
+
+	result, err := e.Select(req, route, &model.Environment{}, candidates, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, m := range result {
+		ids = append(ids, m.ID)
+	}
+	if len(ids) != 3 || ids[0] != "cloud" || ids[1] != "small" || ids[2] != "big" {
+		t.Errorf("order = %v, want the cold model last", ids)
+	}
+}
+
+type fakeCircuits map[string]bool
+
+func (f fakeCircuits) Open(providerID, modelID string) bool {
+	return f[providerID] || f[providerID+"/"+modelID]
+}
+
+func TestEngine_Select_SkipsOpenCircuits(t *testing.T) {
+	e := NewEngine()
+	req := &model.ChatCompletionRequest{}
+	route := &model.Route{FallbackChain: []string{"a", "b", "c"}}
+	candidates := []model.ModelInfo{
+		{ID: "a", ProviderID: "openai", ModelID: "gpt-4o", SupportsStreaming: true},
+		{ID: "b", ProviderID: "anthropic", ModelID: "claude-sonnet", SupportsStreaming: true},
+		{ID: "c", ProviderID: "openai", ModelID: "gpt-4o-mini", SupportsStreaming: true},
+	}
+
+	tests := []struct {
+		open fakeCircuits
+		want []string
+	}{
+		{fakeCircuits{"openai/gpt-4o": true}, []string{"b", "c"}},
+		{fakeCircuits{"openai": true}, []string{"b"}},
+		{fakeCircuits{"openai": true, "anthropic": true}, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		e.SkipOpen(tt.open)
+		result, err := e.Select(req, route, &model.Environment{}, candidates, 100)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var ids []string
+		for _, m := range result {
+			ids = append(ids, m.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("open %v: selected %v, want %v", tt.open, ids, tt.want)
+		}
+	}
+}
@@ -11,28 +11,23 @@ import (
 )
 
 // Repairer attempts to fix invalid JSON output by re-calling a model.
-type Repairer struct {
-	registry *provider.Registry
-}
+type Repairer struct{}
 
-func NewRepairer(registry *provider.Registry) *Repairer {
-	return &Repairer{registry: registry}
+func NewRepairer() *Repairer {
+	return &Repairer{}
 }
 
-// Repair sends a repair prompt to fix invalid output.
+// Repair sends a repair prompt to fix invalid output. prov and cfg are the
+// connection the pipeline resolved for the provider, with cfg.ModelID
+// naming the repair model.
 func (r *Repairer) Repair(
 	ctx context.Context,
+	prov provider.Provider,
+	cfg provider.ProviderConfig,
 	originalOutput string,
 	validationErrors []string,
 	outputSchema interface{},
-	repairModel *model.ModelInfo,
-	repairProvider *model.Provider,
 ) (string, error) {
-	prov, ok := r.registry.Get(repairProvider.ProviderType)
-	if !ok {
-		return "", fmt.Errorf("repair provider type %q not found", repairProvider.ProviderType)
-	}
-
 	schemaJSON, _ := json.MarshalIndent(outputSchema, "", "  ")
 	errorsStr := strings.Join(validationErrors, "\n- ")
 
@@ -51,22 +46,13 @@ Return ONLY the corrected JSON. No explanations, no markdown, just valid JSON.`,
 		originalOutput, errorsStr, string(schemaJSON))
 
 	req := &model.ChatCompletionRequest{
-		Model: repairModel.ModelID,
+		Model: cfg.ModelID,
 		Messages: []model.Message{
 			{Role: "user", Content: repairPrompt},
 		},
 	}
 
-	apiKey := ""
-	if repairProvider.APIKeyEnc != nil {
-		apiKey = *repairProvider.APIKeyEnc // TODO: decrypt
-	}
-
-	resp, err := prov.Send(ctx, req, provider.ProviderConfig{
-		BaseURL: repairProvider.BaseURL,
-		APIKey:  apiKey,
-		ModelID: repairModel.ModelID,
-	})
+	resp, err := prov.Send(ctx, req, cfg)
 	if err != nil {
 		return "", fmt.Errorf("repair call failed: %w", err)
 	}
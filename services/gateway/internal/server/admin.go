@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openfive/gateway/internal/cache"
+)
+
+// adminAuth guards the admin API. A request must carry one of the
+// configured admin tokens as a bearer token; without any configured
+// token every request is refused.
+func (s *Server) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !s.isAdminToken(token) {
+			writeError(w, http.StatusUnauthorized, "authentication_error", "Invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) isAdminToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range s.adminTokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+type killSwitchState struct {
+	EnvironmentID string `json:"environment_id"`
+	Active        bool   `json:"active"`
+}
+
+// handleAdminKillSwitches lists the kill-switch state of every environment
+// this instance has served.
+func (s *Server) handleAdminKillSwitches(w http.ResponseWriter, r *http.Request) {
+	states := s.killSwitch.States()
+	out := make([]killSwitchState, 0, len(states))
+	for envID, active := range states {
+		out = append(out, killSwitchState{EnvironmentID: envID, Active: active})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":        out,
+		"activations": s.killSwitch.Activations(),
+	})
+}
+
+// handleAdminActivateKillSwitch turns the kill switch of an environment on.
+func (s *Server) handleAdminActivateKillSwitch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
+		return
+	}
+	if body.Reason == "" {
+		body.Reason = "activated through the admin API"
+	}
+
+	envID := r.PathValue("id")
+	trigger := map[string]interface{}{"source": "admin_api"}
+	if err := s.killSwitch.Activate(r.Context(), envID, body.Reason, trigger); err != nil {
+		s.logger.Error("admin kill switch activation failed", "environment_id", envID, "error", err)
+		writeError(w, http.StatusInternalServerError, "api_error", "Failed to activate kill switch")
+		return
+	}
+	s.logger.Warn("kill switch activated by admin", "environment_id", envID, "reason", body.Reason)
+	writeJSON(w, http.StatusOK, killSwitchState{EnvironmentID: envID, Active: true})
+}
+
+// handleAdminDeactivateKillSwitch turns the kill switch of an environment off.
+func (s *Server) handleAdminDeactivateKillSwitch(w http.ResponseWriter, r *http.Request) {
+	envID := r.PathValue("id")
+	if err := s.killSwitch.Deactivate(r.Context(), envID); err != nil {
+		s.logger.Error("admin kill switch deactivation failed", "environment_id", envID, "error", err)
+		writeError(w, http.StatusInternalServerError, "api_error", "Failed to deactivate kill switch")
+		return
+	}
+	s.logger.Warn("kill switch deactivated by admin", "environment_id", envID)
+	writeJSON(w, http.StatusOK, killSwitchState{EnvironmentID: envID, Active: false})
+}
+
+type cacheEntry struct {
+	Key            string    `json:"key"`
+	EnvironmentID  string    `json:"environment_id,omitempty"`
+	RouteID        string    `json:"route_id,omitempty"`
+	Route          string    `json:"route,omitempty"`
+	Model          string    `json:"model"`
+	Bytes          int       `json:"bytes"`
+	InputTokens    int       `json:"input_tokens"`
+	OutputTokens   int       `json:"output_tokens"`
+	CostUSD        float64   `json:"cost_usd"`
+	HitCount       int64     `json:"hit_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	LastAccessedAt time.Time `json:"last_accessed_at"`
+}
+
+// cacheFilter reads the environment_id and route query parameters.
+func cacheFilter(r *http.Request) cache.Filter {
+	q := r.URL.Query()
+	return cache.Filter{EnvironmentID: q.Get("environment_id"), Route: q.Get("route")}
+}
+
+// handleAdminCacheEntries lists cached responses, optionally narrowed to
+// an environment or route. Response bodies are not included.
+func (s *Server) handleAdminCacheEntries(w http.ResponseWriter, r *http.Request) {
+	entries := s.cache.Entries(cacheFilter(r))
+	out := make([]cacheEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, cacheEntry{
+			Key:            e.Key,
+			EnvironmentID:  e.Scope.EnvironmentID,
+			RouteID:        e.Scope.RouteID,
+			Route:          e.Scope.RouteSlug,
+			Model:          e.Model,
+			Bytes:          len(e.Response),
+			InputTokens:    e.InputTokens,
+			OutputTokens:   e.OutputTokens,
+			CostUSD:        e.CostUSD,
+			HitCount:       e.HitCount,
+			CreatedAt:      e.CreatedAt,
+			ExpiresAt:      e.ExpiresAt,
+			LastAccessedAt: e.LastAccessedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  out,
+		"stats": s.cache.GetStats(),
+	})
+}
+
+// handleAdminCachePurge removes cached responses. Without filters the
+// whole cache is flushed.
+func (s *Server) handleAdminCachePurge(w http.ResponseWriter, r *http.Request) {
+	f := cacheFilter(r)
+	removed := s.cache.Purge(f)
+	s.logger.Warn("cache purged by admin", "environment_id", f.EnvironmentID, "route", f.Route, "removed", removed)
+	writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+}
+
+type rateLimitBucket struct {
+	Key       string  `json:"key"`
+	Tokens    float64 `json:"tokens"`
+	Capacity  float64 `json:"capacity"`
+	PerMinute float64 `json:"per_minute"`
+}
+
+// handleAdminRateLimits dumps the token buckets and rejection counts.
+func (s *Server) handleAdminRateLimits(w http.ResponseWriter, r *http.Request) {
+	buckets := s.limiter.Buckets()
+	out := make([]rateLimitBucket, 0, len(buckets))
+	for _, b := range buckets {
+		out = append(out, rateLimitBucket{Key: b.Key, Tokens: b.Tokens, Capacity: b.Capacity, PerMinute: b.PerMinute})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":       out,
+		"rejections": s.limiter.Rejections(),
+	})
+}
+
+type anomalyWindow struct {
+	EnvironmentID string   `json:"environment_id"`
+	WindowSeconds float64  `json:"window_seconds"`
+	Samples       int      `json:"samples"`
+	TotalUSD      float64  `json:"total_usd"`
+	BaselineUSD   *float64 `json:"baseline_usd"`
+}
+
+// handleAdminAnomaly dumps the anomaly detector's cost windows.
+func (s *Server) handleAdminAnomaly(w http.ResponseWriter, r *http.Request) {
+	windows := s.anomaly.Windows()
+	out := make([]anomalyWindow, 0, len(windows))
+	for _, win := range windows {
+		out = append(out, anomalyWindow{
+			EnvironmentID: win.EnvironmentID,
+			WindowSeconds: win.Duration.Seconds(),
+			Samples:       win.Samples,
+			TotalUSD:      win.TotalUSD,
+			BaselineUSD:   win.BaselineUSD,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": out})
+}
+
+// handleAdminMeterFlush writes the buffered request records now instead
+// of at the next flush interval.
+func (s *Server) handleAdminMeterFlush(w http.ResponseWriter, r *http.Request) {
+	pending := s.meter.Pending()
+	written, failed := s.meter.Written(), s.meter.FlushErrors()
+	s.meter.Flush()
+	s.logger.Info("meter flushed by admin", "pending", pending)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pending": pending,
+		"written": s.meter.Written() - written,
+		"failed":  s.meter.FlushErrors() - failed,
+	})
+}
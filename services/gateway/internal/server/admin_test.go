@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/anomaly"
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+)
+
+func newAdminServer() (*Server, *cache.Cache) {
+	c := cache.New(cache.Config{MaxEntries: 100, TTL: time.Minute, Enabled: true})
+	limiter := budget.NewRateLimiter()
+	limiter.Allow("key:k1", 60)
+	detector := anomaly.NewDetector()
+	detector.Observe("env-1", 0.5, 3, time.Hour)
+
+	s := New(Options{
+		Cache:       c,
+		Limiter:     limiter,
+		Anomaly:     detector,
+		AdminTokens: []string{"", "secret"},
+	})
+	return s, c
+}
+
+func adminRequest(h http.Handler, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	s, _ := newAdminServer()
+	h := s.Handler()
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := adminRequest(h, http.MethodGet, "/internal/admin/ratelimits", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, rec.Code)
+		}
+	}
+	if rec := adminRequest(h, http.MethodGet, "/internal/admin/ratelimits", "secret"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestAdmin_ListAndPurgeCacheByRoute(t *testing.T) {
+	s, c := newAdminServer()
+	h := s.Handler()
+	c.SetScoped(cache.Scope{EnvironmentID: "env-1", RouteID: "r-1", RouteSlug: "support"}, "a", []byte("{}"), "gpt-4o", 10, 5, 0.01)
+	c.SetScoped(cache.Scope{EnvironmentID: "env-1", RouteID: "r-2", RouteSlug: "search"}, "b", []byte("{}"), "gpt-4o", 10, 5, 0.01)
+
+	rec := adminRequest(h, http.MethodGet, "/internal/admin/cache?environment_id=env-1&route=support", "secret")
+	var list struct {
+		Data []cacheEntry `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].Key != "a" || list.Data[0].Route != "support" || list.Data[0].Bytes != 2 {
+		t.Errorf("entries = %+v", list.Data)
+	}
+
+	rec = adminRequest(h, http.MethodDelete, "/internal/admin/cache?route=r-2", "secret")
+	var purged struct {
+		Removed int `json:"removed"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &purged)
+	if purged.Removed != 1 {
+		t.Errorf("removed = %d, want 1", purged.Removed)
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("entry of another route was purged")
+	}
+}
+
+func TestAdmin_DumpsRateLimitsAndAnomalyWindows(t *testing.T) {
+	s, _ := newAdminServer()
+	h := s.Handler()
+
+	rec := adminRequest(h, http.MethodGet, "/internal/admin/ratelimits", "secret")
+	var limits struct {
+		Data []rateLimitBucket `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &limits)
+	if len(limits.Data) != 1 || limits.Data[0].Key != "key:k1" || limits.Data[0].Capacity != 60 || limits.Data[0].Tokens >= 60 {
+		t.Errorf("buckets = %+v", limits.Data)
+	}
+
+	rec = adminRequest(h, http.MethodGet, "/internal/admin/anomaly", "secret")
+	var windows struct {
+		Data []anomalyWindow `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &windows)
+	if len(windows.Data) != 1 || windows.Data[0].TotalUSD != 0.5 || windows.Data[0].WindowSeconds != 3600 || windows.Data[0].BaselineUSD != nil {
+		t.Errorf("windows = %+v", windows.Data)
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openfive/gateway/internal/batch"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+const (
+	// batchRetryDelay is the initial backoff for batch lines turned away
+	// by a key, route or provider rate limit.
+	batchRetryDelay = 2 * time.Second
+	// maxUploadMemory is how much of an upload is buffered in memory
+	// before it spills to a temporary file.
+	maxUploadMemory = 32 << 20
+)
+
+// handleCreateFile accepts a multipart upload of a batch input file.
+func (s *Server) handleCreateFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, batch.MaxFileBytes+maxUploadMemory)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse multipart upload")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Missing file")
+		return
+	}
+	defer file.Close()
+	if header.Size > batch.MaxFileBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, "invalid_request_error", "File exceeds the 100 MB limit")
+		return
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to read file")
+		return
+	}
+
+	f, err := s.batches.CreateFile(ctx, key, header.Filename, r.FormValue("purpose"), content)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, batch.NewFileObject(f))
+}
+
+func (s *Server) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	f, err := s.batches.File(ctx, key, r.PathValue("id"), false)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, batch.NewFileObject(f))
+}
+
+func (s *Server) handleGetFileContent(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	f, err := s.batches.File(ctx, key, r.PathValue("id"), true)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.Content)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(f.Content)
+}
+
+type createBatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// handleCreateBatch starts a batch over an uploaded file. The route is
+// taken from the X-Route-Id header of this request and applies to every
+// line.
+func (s *Server) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	var req createBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+		return
+	}
+
+	b, err := s.batches.Create(ctx, key, routeSlug(r), req.InputFileID, req.Endpoint, req.CompletionWindow, req.Metadata)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, batch.NewObject(b))
+}
+
+func (s *Server) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	b, err := s.batches.Get(ctx, key, r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, batch.NewObject(b))
+}
+
+func (s *Server) handleListBatches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", "limit must be between 1 and 100")
+			return
+		}
+		limit = n
+	}
+
+	// One extra row tells whether another page follows.
+	batches, err := s.batches.List(ctx, key, r.URL.Query().Get("after"), limit+1)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	writeJSON(w, http.StatusOK, batch.NewList(batches, hasMore))
+}
+
+func (s *Server) handleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	b, err := s.batches.Cancel(ctx, key, r.PathValue("id"))
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, batch.NewObject(b))
+}
+
+func writeBatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, batch.ErrNotFound):
+		writeError(w, http.StatusNotFound, "invalid_request_error", err.Error())
+	case errors.Is(err, batch.ErrInvalid):
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "api_error", "Internal gateway error")
+	}
+}
+
+// BatchExecutor runs batch lines through the pipeline exactly as if they
+// had been sent to the matching endpoint, without streaming.
+// Every line is traced as a root span of its own.
+type BatchExecutor struct {
+	pipeline *pipeline.Pipeline
+	tracer   *tracing.Tracer
+}
+
+func NewBatchExecutor(p *pipeline.Pipeline, tracer *tracing.Tracer) *BatchExecutor {
+	return &BatchExecutor{pipeline: p, tracer: tracer}
+}
+
+func (e *BatchExecutor) Execute(ctx context.Context, key *model.APIKey, b *model.Batch, line *batch.Line) batch.Result {
+	ctx, span := e.tracer.Start(ctx, "batch "+line.URL, tracing.KindInternal,
+		tracing.String("gateway.batch_id", b.ID),
+		tracing.String("gateway.custom_id", line.CustomID))
+	defer span.End()
+	ctx = pipeline.WithBatchID(ctx, b.ID)
+	routeSlug := ""
+	if b.RouteSlug != nil {
+		routeSlug = *b.RouteSlug
+	}
+
+	var (
+		pr   *pipeline.Request
+		resp interface{}
+		err  error
+	)
+	switch line.URL {
+	case "/v1/chat/completions":
+		var body model.ChatCompletionRequest
+		if err := json.Unmarshal(line.Body, &body); err != nil {
+			return lineError(http.StatusBadRequest, "Failed to parse request body")
+		}
+		body.Stream = false
+		body.StreamOptions = nil
+		if pr, err = e.pipeline.Resolve(ctx, key, routeSlug, &body); err == nil {
+			resp, err = e.pipeline.Complete(ctx, pr)
+		}
+	case "/v1/embeddings":
+		var body model.EmbeddingRequest
+		if err := json.Unmarshal(line.Body, &body); err != nil {
+			return lineError(http.StatusBadRequest, "Failed to parse request body")
+		}
+		if pr, err = e.pipeline.ResolveEmbedding(ctx, key, routeSlug, &body); err == nil {
+			resp, err = e.pipeline.Embed(ctx, pr)
+		}
+	default:
+		return lineError(http.StatusNotFound, "Unsupported batch endpoint "+line.URL)
+	}
+
+	var res batch.Result
+	if pr != nil {
+		res.RequestID = pr.RC.RequestID
+	}
+	if err != nil {
+		res.StatusCode, res.Body = errorBody(err)
+		var pe *pipeline.Error
+		if errors.As(err, &pe) && pe.Code == "rate_limit_exceeded" {
+			res.RetryAfter = max(pe.RetryAfter, batchRetryDelay)
+		}
+		return res
+	}
+	res.StatusCode = http.StatusOK
+	res.Body = resp
+	return res
+}
+
+func lineError(status int, message string) batch.Result {
+	return batch.Result{
+		StatusCode: status,
+		Body: model.ErrorResponse{Error: model.ErrorDetail{
+			Message: message,
+			Type:    "invalid_request_error",
+		}},
+	}
+}
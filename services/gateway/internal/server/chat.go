@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+)
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	var req model.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+		return
+	}
+
+	pr, err := s.pipeline.Resolve(ctx, key, routeSlug(r), &req)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	w.Header().Set("X-Request-Id", pr.RC.RequestID)
+
+	if req.Stream {
+		s.streamChatCompletions(w, r, pr)
+		return
+	}
+
+	resp, err := s.pipeline.Complete(ctx, pr)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// streamChatCompletions relays a streamed completion as OpenAI-style SSE,
+// terminated by data: [DONE].
+func (s *Server) streamChatCompletions(w http.ResponseWriter, r *http.Request, pr *pipeline.Request) {
+	ctx, done := s.trackStream(r.Context())
+	defer done()
+	sw := newSSEWriter(w)
+	if err := s.pipeline.Stream(ctx, pr, sw.WriteChunk); err != nil {
+		if !sw.started {
+			writePipelineError(w, err)
+			return
+		}
+		sw.WriteError(err)
+		return
+	}
+	sw.Done()
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/openfive/gateway/internal/auth"
+)
+
+// withClientCert hands the verified client certificate of an mTLS
+// connection to authentication, which falls back to it when a request
+// carries no bearer key. Unverified certificates are ignored.
+func withClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			r = r.WithContext(auth.ContextWithClientCert(r.Context(), r.TLS.VerifiedChains[0][0]))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openfive/gateway/internal/pipeline"
+)
+
+// streamTracker keeps the in-flight streaming responses so that shutdown
+// can wait for them and cut off the ones that outlast the drain timeout.
+type streamTracker struct {
+	mu      sync.Mutex
+	next    uint64
+	cancels map[uint64]context.CancelCauseFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// trackStream derives the context a stream runs in. The returned function
+// must be called once the handler has written its last event.
+func (s *Server) trackStream(ctx context.Context) (context.Context, func()) {
+	t := &s.streams
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		// Streams resolved after the cut-off fail straight away.
+		cancel(pipeline.ErrShutdown)
+		return ctx, func() {}
+	}
+	if t.cancels == nil {
+		t.cancels = make(map[uint64]context.CancelCauseFunc)
+	}
+	id := t.next
+	t.next++
+	t.cancels[id] = cancel
+	t.wg.Add(1)
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.cancels, id)
+		t.mu.Unlock()
+		cancel(nil)
+		t.wg.Done()
+	}
+}
+
+// ActiveStreams returns the number of streaming responses in flight.
+func (s *Server) ActiveStreams() int {
+	s.streams.mu.Lock()
+	defer s.streams.mu.Unlock()
+	return len(s.streams.cancels)
+}
+
+// StopStreams cuts off every stream still in flight. Each one ends with a
+// final error event and is metered as partial. StopStreams returns the
+// number of streams cut off once their handlers have finished, or when ctx
+// ends.
+func (s *Server) StopStreams(ctx context.Context) int {
+	t := &s.streams
+	t.mu.Lock()
+	t.stopped = true
+	n := len(t.cancels)
+	for _, cancel := range t.cancels {
+		cancel(pipeline.ErrShutdown)
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return n
+}
+
+// Drain marks the instance as shutting down; /internal/ready answers 503
+// from then on so load balancers stop sending new requests.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/pipeline"
+)
+
+func TestStopStreams(t *testing.T) {
+	s := New(Options{})
+	ctx, done := s.trackStream(context.Background())
+	if s.ActiveStreams() != 1 {
+		t.Fatalf("ActiveStreams() = %d, want 1", s.ActiveStreams())
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		// The handler writes its final event before releasing the stream.
+		time.Sleep(10 * time.Millisecond)
+		done()
+		close(finished)
+	}()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if n := s.StopStreams(stopCtx); n != 1 {
+		t.Errorf("StopStreams() = %d, want 1", n)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("StopStreams returned before the stream handler finished")
+	}
+	if !errors.Is(context.Cause(ctx), pipeline.ErrShutdown) {
+		t.Errorf("cause = %v, want ErrShutdown", context.Cause(ctx))
+	}
+	if s.ActiveStreams() != 0 {
+		t.Errorf("ActiveStreams() = %d after stop, want 0", s.ActiveStreams())
+	}
+
+	// Streams starting after the cut-off are cancelled immediately.
+	late, lateDone := s.trackStream(context.Background())
+	defer lateDone()
+	if !errors.Is(context.Cause(late), pipeline.ErrShutdown) {
+		t.Errorf("late stream cause = %v, want ErrShutdown", context.Cause(late))
+	}
+}
+
+func TestStopStreams_CompletedStreamIsNotCut(t *testing.T) {
+	s := New(Options{})
+	ctx, done := s.trackStream(context.Background())
+	done()
+	if n := s.StopStreams(context.Background()); n != 0 {
+		t.Errorf("StopStreams() = %d, want 0", n)
+	}
+	if context.Cause(ctx) != context.Canceled {
+		t.Errorf("cause = %v, want context.Canceled", context.Cause(ctx))
+	}
+}
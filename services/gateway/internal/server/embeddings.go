@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	var req model.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+		return
+	}
+
+	pr, err := s.pipeline.ResolveEmbedding(ctx, key, routeSlug(r), &req)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	w.Header().Set("X-Request-Id", pr.RC.RequestID)
+
+	resp, err := s.pipeline.Embed(ctx, pr)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openfive/gateway/internal/anthropic"
+	"github.com/openfive/gateway/internal/model"
+)
+
+// handleMessages accepts Anthropic Messages API requests, runs them through
+// the chat pipeline and answers in the Anthropic format.
+func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := s.pipeline.Authenticate(ctx, anthropicAuthHeader(r))
+	if err != nil {
+		writeAnthropicError(w, err)
+		return
+	}
+
+	var req anthropic.MessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAnthropicJSONError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+		return
+	}
+	body, err := anthropic.ToChatRequest(&req)
+	if err != nil {
+		writeAnthropicJSONError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if body.Stream {
+		// The final usage chunk feeds message_delta.
+		body.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+
+	pr, err := s.pipeline.Resolve(ctx, key, routeSlug(r), body)
+	if err != nil {
+		writeAnthropicError(w, err)
+		return
+	}
+	w.Header().Set("X-Request-Id", pr.RC.RequestID)
+
+	if body.Stream {
+		ctx, done := s.trackStream(ctx)
+		defer done()
+		sw := newSSEWriter(w)
+		tr := anthropic.NewStreamTranslator("msg_"+pr.RC.RequestID, pr.RC.SelectedModel.ModelID, pr.RC.EstInputTokens)
+		err := s.pipeline.Stream(ctx, pr, func(chunk *model.ChatCompletionChunk) error {
+			return writeAnthropicEvents(sw, tr.Translate(chunk))
+		})
+		if err != nil {
+			if !sw.started {
+				writeAnthropicError(w, err)
+				return
+			}
+			_, body := anthropicErrorBody(err)
+			sw.writeEvent("error", body)
+			return
+		}
+		writeAnthropicEvents(sw, tr.Finish())
+		return
+	}
+
+	resp, err := s.pipeline.Complete(ctx, pr)
+	if err != nil {
+		writeAnthropicError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, anthropic.FromChatResponse(resp))
+}
+
+func writeAnthropicEvents(sw *sseWriter, events []anthropic.Event) error {
+	for _, ev := range events {
+		if err := sw.writeEvent(ev.Type, ev.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anthropicAuthHeader accepts the x-api-key header sent by Anthropic SDKs
+// as well as a regular bearer token.
+func anthropicAuthHeader(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		return h
+	}
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return "Bearer " + key
+	}
+	return ""
+}
+
+func writeAnthropicError(w http.ResponseWriter, err error) {
+	setRetryAfter(w, err)
+	status, body := anthropicErrorBody(err)
+	writeJSON(w, status, body)
+}
+
+func writeAnthropicJSONError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, anthropic.ErrorResponse{
+		Type:  "error",
+		Error: anthropic.ErrorDetail{Type: errType, Message: message},
+	})
+}
+
+// anthropicErrorBody maps a pipeline error onto the Anthropic error format.
+func anthropicErrorBody(err error) (int, anthropic.ErrorResponse) {
+	status, openai := errorBody(err)
+
+	errType := openai.Error.Type
+	switch errType {
+	case "insufficient_quota":
+		errType = "billing_error"
+	case "invalid_request_error", "authentication_error", "permission_error",
+		"not_found_error", "rate_limit_error":
+	default:
+		errType = "api_error"
+	}
+
+	return status, anthropic.ErrorResponse{
+		Type:  "error",
+		Error: anthropic.ErrorDetail{Type: errType, Message: openai.Error.Message},
+	}
+}
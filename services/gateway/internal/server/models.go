@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+)
+
+// handleModels lists the route slugs and concrete models the calling key
+// may use, with OpenFive extensions for context window, pricing and
+// capabilities.
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	routes, err := s.pipeline.Catalog(ctx, key)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, buildModelList(routes))
+}
+
+// buildModelList emits one entry per route followed by one entry per
+// distinct model reachable through those routes.
+func buildModelList(routes []pipeline.RouteModels) model.ModelList {
+	list := model.ModelList{Object: "list", Data: []model.ModelObject{}}
+	seen := make(map[string]bool)
+	var models []model.ModelInfo
+
+	for _, rm := range routes {
+		ext := &model.ModelExtensions{
+			Kind:        "route",
+			DisplayName: rm.Route.Name,
+		}
+		for _, m := range rm.Models {
+			ext.Models = append(ext.Models, m.ModelID)
+			if ext.ContextWindow == 0 || m.ContextWindow < ext.ContextWindow {
+				ext.ContextWindow = m.ContextWindow
+			}
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				models = append(models, m)
+			}
+		}
+		list.Data = append(list.Data, model.ModelObject{
+			ID:       rm.Route.Slug,
+			Object:   "model",
+			OwnedBy:  "openfive",
+			OpenFive: ext,
+		})
+	}
+
+	for _, m := range models {
+		list.Data = append(list.Data, model.ModelObject{
+			ID:      m.ModelID,
+			Object:  "model",
+			OwnedBy: "openfive",
+			OpenFive: &model.ModelExtensions{
+				Kind:            "model",
+				DisplayName:     m.DisplayName,
+				ContextWindow:   m.ContextWindow,
+				MaxOutputTokens: m.MaxOutputTokens,
+				Pricing: &model.ModelPricing{
+					InputPerM:  m.InputPricePerM,
+					OutputPerM: m.OutputPricePerM,
+				},
+				Capabilities: &model.ModelCapabilities{
+					Streaming: m.SupportsStreaming,
+					Tools:     m.SupportsTools,
+					Vision:    m.SupportsVision,
+					JSONMode:  m.SupportsJSONMode,
+				},
+			},
+		})
+	}
+
+	return list
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+)
+
+func TestBuildModelList_RoutesThenDistinctModels(t *testing.T) {
+	gpt := model.ModelInfo{ID: "m1", ModelID: "openai/gpt-4o", ContextWindow: 128000, InputPricePerM: 2.5, OutputPricePerM: 10, SupportsTools: true}
+	llama := model.ModelInfo{ID: "m2", ModelID: "meta/llama-3", ContextWindow: 8192}
+
+	list := buildModelList([]pipeline.RouteModels{
+		{Route: model.Route{Slug: "support", Name: "Support"}, Models: []model.ModelInfo{gpt, llama}},
+		{Route: model.Route{Slug: "summarize", Name: "Summarize"}, Models: []model.ModelInfo{gpt}},
+	})
+
+	if list.Object != "list" {
+		t.Errorf("Object = %q, want list", list.Object)
+	}
+	if len(list.Data) != 4 {
+		t.Fatalf("got %d entries, want 4", len(list.Data))
+	}
+
+	support := list.Data[0]
+	if support.ID != "support" || support.OpenFive.Kind != "route" {
+		t.Errorf("unexpected first entry: %+v", support)
+	}
+	if support.OpenFive.ContextWindow != 8192 {
+		t.Errorf("route context window = %d, want smallest model window 8192", support.OpenFive.ContextWindow)
+	}
+
+	m := list.Data[2]
+	if m.ID != "openai/gpt-4o" || m.OpenFive.Kind != "model" {
+		t.Errorf("unexpected model entry: %+v", m)
+	}
+	if m.OpenFive.Pricing.InputPerM != 2.5 || !m.OpenFive.Capabilities.Tools {
+		t.Errorf("unexpected model extensions: %+v", m.OpenFive)
+	}
+}
+
+func TestBuildModelList_EmptyIsNotNull(t *testing.T) {
+	list := buildModelList(nil)
+	if list.Data == nil {
+		t.Error("expected empty, non-nil data slice")
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// readyPingTimeout bounds the database ping of a readiness check, so a
+// hung connection fails the probe rather than timing it out.
+const readyPingTimeout = 2 * time.Second
+
+// Pinger checks a database connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Syncer reports when configuration was last loaded.
+type Syncer interface {
+	SyncedAt() time.Time
+}
+
+// Check outcomes. Only "failed" makes the instance not ready.
+const (
+	checkOK       = "ok"
+	checkDegraded = "degraded"
+	checkFailed   = "failed"
+)
+
+type readyCheck struct {
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"`
+	LatencyMs  *int64           `json:"latency_ms,omitempty"`
+	SyncedAt   *time.Time       `json:"synced_at,omitempty"`
+	Pending    *int             `json:"pending,omitempty"`
+	MaxPending *int             `json:"max_pending,omitempty"`
+	Providers  []providerStatus `json:"providers,omitempty"`
+}
+
+type providerStatus struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type readyResponse struct {
+	Status string                `json:"status"`
+	Checks map[string]readyCheck `json:"checks,omitempty"`
+}
+
+// handleReady reports whether this instance can serve traffic. Unlike
+// /internal/health, which only shows the process is alive, it checks the
+// database, the config snapshot, the meter backlog and the providers.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readyResponse{Status: "draining"})
+		return
+	}
+
+	checks := make(map[string]readyCheck)
+	if s.database != nil {
+		checks["database"] = s.checkDatabase(r.Context())
+	}
+	if s.configState != nil {
+		checks["config"] = s.checkConfig()
+	}
+	if s.meter != nil {
+		checks["meter"] = s.checkMeter()
+	}
+	if s.prober != nil {
+		checks["providers"] = s.checkProviders()
+	}
+
+	resp := readyResponse{Status: "ready", Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if c.Status == checkFailed {
+			resp.Status = "not_ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, resp)
+}
+
+func (s *Server) checkDatabase(ctx context.Context) readyCheck {
+	ctx, cancel := context.WithTimeout(ctx, readyPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := s.database.Ping(ctx)
+	latency := time.Since(start).Milliseconds()
+	if err != nil {
+		return readyCheck{Status: checkFailed, Error: err.Error(), LatencyMs: &latency}
+	}
+	return readyCheck{Status: checkOK, LatencyMs: &latency}
+}
+
+func (s *Server) checkConfig() readyCheck {
+	syncedAt := s.configState.SyncedAt()
+	if syncedAt.IsZero() {
+		return readyCheck{Status: checkFailed, Error: "config not loaded"}
+	}
+	return readyCheck{Status: checkOK, SyncedAt: &syncedAt}
+}
+
+// checkMeter fails when the records not yet written, including those kept
+// after failed writes, reach the backlog limit.
+func (s *Server) checkMeter() readyCheck {
+	pending := s.meter.Pending()
+	c := readyCheck{Status: checkOK, Pending: &pending}
+	if s.meterBacklogMax > 0 {
+		c.MaxPending = &s.meterBacklogMax
+		if pending >= s.meterBacklogMax {
+			c.Status = checkFailed
+			c.Error = "meter backlog above threshold"
+		}
+	}
+	return c
+}
+
+// checkProviders reports the probed providers, degraded when any is down.
+// It never fails readiness: a provider outage affects every instance
+// alike, and an instance that is up can still fall back or report the
+// failure cleanly.
+func (s *Server) checkProviders() readyCheck {
+	statuses := s.prober.Statuses()
+	c := readyCheck{Status: checkOK, Providers: make([]providerStatus, 0, len(statuses))}
+	for _, st := range statuses {
+		ps := providerStatus{
+			ID:        st.ID,
+			Name:      st.Name,
+			Type:      st.Type,
+			Status:    checkOK,
+			LatencyMs: st.Latency.Milliseconds(),
+			CheckedAt: st.CheckedAt,
+		}
+		if !st.OK {
+			ps.Status = checkFailed
+			ps.Error = st.Error
+			c.Status = checkDegraded
+		}
+		c.Providers = append(c.Providers, ps)
+	}
+	sort.Slice(c.Providers, func(i, j int) bool { return c.Providers[i].Name < c.Providers[j].Name })
+	return c
+}
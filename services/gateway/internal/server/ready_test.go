@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openfive/gateway/internal/health"
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/provider"
+)
+
+type fakePinger struct{ err error }
+
+func (f fakePinger) Ping(ctx context.Context) error { return f.err }
+
+type fakeSyncer struct{ at time.Time }
+
+func (f fakeSyncer) SyncedAt() time.Time { return f.at }
+
+// failingSink fails every write while down is set.
+type failingSink struct{ down atomic.Bool }
+
+func (f *failingSink) Write(ctx context.Context, rec *model.RequestRecord) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+type fakeProviders []model.Provider
+
+func (f fakeProviders) LoadProviders(ctx context.Context) ([]model.Provider, error) {
+	return f, nil
+}
+
+func getReady(t *testing.T, s *Server) (int, readyResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/ready", nil))
+	var resp readyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestReady(t *testing.T) {
+	s := New(Options{Database: fakePinger{}, ConfigState: fakeSyncer{at: time.Now()}})
+	code, resp := getReady(t, s)
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("status = %d %q, want 200 ready", code, resp.Status)
+	}
+	if resp.Checks["database"].Status != checkOK || resp.Checks["config"].Status != checkOK {
+		t.Errorf("checks = %+v", resp.Checks)
+	}
+	if _, ok := resp.Checks["providers"]; ok {
+		t.Error("providers check reported without a prober")
+	}
+}
+
+func TestReady_FailedDependency(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		check string
+	}{
+		{"database down", Options{Database: fakePinger{err: errors.New("connection refused")}}, "database"},
+		{"config not loaded", Options{ConfigState: fakeSyncer{}}, "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := getReady(t, New(tt.opts))
+			if code != http.StatusServiceUnavailable || resp.Status != "not_ready" {
+				t.Errorf("status = %d %q, want 503 not_ready", code, resp.Status)
+			}
+			if c := resp.Checks[tt.check]; c.Status != checkFailed || c.Error == "" {
+				t.Errorf("%s check = %+v, want failed with an error", tt.check, c)
+			}
+		})
+	}
+}
+
+func TestReady_Draining(t *testing.T) {
+	s := New(Options{Database: fakePinger{}})
+	s.Drain()
+	code, resp := getReady(t, s)
+	if code != http.StatusServiceUnavailable || resp.Status != "draining" {
+		t.Errorf("status = %d %q, want 503 draining", code, resp.Status)
+	}
+	// Liveness is unaffected.
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("health status = %d, want 200", rec.Code)
+	}
+}
+
+func TestReady_MeterBacklogFromFailedWrites(t *testing.T) {
+	sink := &failingSink{}
+	sink.down.Store(true)
+	w := meter.NewWriter(sink, 2, 60000, nil, nil)
+	defer w.Close()
+	s := New(Options{Meter: w, MeterBacklogMax: 4})
+
+	for i := 0; i < 4; i++ {
+		w.Record(model.RequestRecord{RequestID: "req"})
+	}
+	w.Flush()
+	code, resp := getReady(t, s)
+	if c := resp.Checks["meter"]; code != http.StatusServiceUnavailable || c.Status != checkFailed || *c.Pending != 4 {
+		t.Fatalf("status = %d, meter check = %+v; want 503 with the 4 unwritten records pending", code, c)
+	}
+
+	sink.down.Store(false)
+	w.Flush()
+	if code, resp := getReady(t, s); code != http.StatusOK || *resp.Checks["meter"].Pending != 0 {
+		t.Errorf("status = %d, meter check = %+v; want ready once the records are written", code, resp.Checks["meter"])
+	}
+	if w.Written() != 4 {
+		t.Errorf("written = %d, want the records kept after the failed writes", w.Written())
+	}
+}
+
+func TestReady_ProvidersDownStillReady(t *testing.T) {
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+	registry := provider.NewRegistry()
+	registry.Register(provider.NewGeneric(http.DefaultClient))
+	prober := health.NewProber(fakeProviders{
+		{ID: "p1", Name: "openai", ProviderType: "openai_compatible", BaseURL: unauthorized.URL, Status: "active"},
+	}, registry, "", time.Second, logging.Discard())
+	prober.ProbeAll(context.Background())
+
+	code, resp := getReady(t, New(Options{Prober: prober}))
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Errorf("status = %d %q, want 200 ready", code, resp.Status)
+	}
+	c := resp.Checks["providers"]
+	if c.Status != checkDegraded || len(c.Providers) != 1 || c.Providers[0].Status != checkFailed {
+		t.Errorf("providers check = %+v, want degraded with the failed provider", c)
+	}
+}
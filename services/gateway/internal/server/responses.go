@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/responses"
+)
+
+// handleResponses accepts OpenAI Responses API requests, runs them through
+// the chat pipeline and answers with a response object or its stream of
+// events. Responses are stored for previous_response_id chaining unless
+// the request sets store to false.
+func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	key, err := s.pipeline.Authenticate(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+
+	var req responses.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Failed to parse request body")
+		return
+	}
+
+	var history []model.Message
+	if req.PreviousResponseID != "" {
+		var ok bool
+		history, ok = s.stored.Get(key.EnvironmentID, req.PreviousResponseID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "invalid_request_error",
+				fmt.Sprintf("Previous response with id '%s' not found.", req.PreviousResponseID))
+			return
+		}
+	}
+
+	body, err := responses.ToChatRequest(&req, history)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	// The conversation to store, without the instructions.
+	conversation := body.Messages
+	if req.Instructions != "" {
+		conversation = conversation[1:]
+	}
+	conversation = append([]model.Message(nil), conversation...)
+	if body.Stream {
+		// The final usage chunk feeds response.completed.
+		body.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+
+	pr, err := s.pipeline.Resolve(ctx, key, routeSlug(r), body)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	w.Header().Set("X-Request-Id", pr.RC.RequestID)
+	id := "resp_" + pr.RC.RequestID
+
+	if body.Stream {
+		ctx, done := s.trackStream(ctx)
+		defer done()
+		sw := newSSEWriter(w)
+		tr := responses.NewStreamTranslator(id, pr.RC.SelectedModel.ModelID, time.Now().Unix(), pr.RC.EstInputTokens)
+		if req.PreviousResponseID != "" {
+			tr.Response().PreviousResponseID = &req.PreviousResponseID
+		}
+		err := s.pipeline.Stream(ctx, pr, func(chunk *model.ChatCompletionChunk) error {
+			return writeResponseEvents(sw, tr.Translate(chunk))
+		})
+		if err != nil {
+			if !sw.started {
+				writePipelineError(w, err)
+				return
+			}
+			_, body := errorBody(err)
+			code := body.Error.Code
+			if code == "" {
+				code = body.Error.Type
+			}
+			ev := tr.Error(code, body.Error.Message)
+			sw.writeEvent(ev.Type, ev.Data)
+			return
+		}
+		events := tr.Finish()
+		s.storeResponse(&req, key.EnvironmentID, conversation, tr.Response())
+		writeResponseEvents(sw, events)
+		return
+	}
+
+	chat, err := s.pipeline.Complete(ctx, pr)
+	if err != nil {
+		writePipelineError(w, err)
+		return
+	}
+	resp := responses.FromChatResponse(id, chat)
+	if req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &req.PreviousResponseID
+	}
+	s.storeResponse(&req, key.EnvironmentID, conversation, resp)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// storeResponse records the conversation up to and including resp, before
+// the client can see resp's id and chain from it.
+func (s *Server) storeResponse(req *responses.Request, envID string, conversation []model.Message, resp *responses.Response) {
+	if req.Store != nil && !*req.Store {
+		return
+	}
+	s.stored.Put(envID, resp.ID, append(conversation, responses.OutputMessages(resp.Output)...))
+}
+
+func writeResponseEvents(sw *sseWriter, events []responses.Event) error {
+	for _, ev := range events {
+		if err := sw.writeEvent(ev.Type, ev.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
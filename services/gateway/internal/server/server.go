@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/openfive/gateway/internal/anomaly"
+	"github.com/openfive/gateway/internal/batch"
+	"github.com/openfive/gateway/internal/budget"
+	"github.com/openfive/gateway/internal/cache"
+	"github.com/openfive/gateway/internal/health"
+	"github.com/openfive/gateway/internal/logging"
+	"github.com/openfive/gateway/internal/meter"
+	"github.com/openfive/gateway/internal/metrics"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+	"github.com/openfive/gateway/internal/responses"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// Limits for responses kept for previous_response_id chaining.
+const (
+	storedResponsesMax = 10000
+	storedResponsesTTL = time.Hour
+)
+
+// Options holds the components a Server is assembled from.
+type Options struct {
+	Pipeline *pipeline.Pipeline
+	Batches  *batch.Service
+	Metrics  *metrics.Gateway
+	Tracer   *tracing.Tracer
+	Logger   *slog.Logger
+
+	// Live state exposed through the admin API.
+	Cache      *cache.Cache
+	Limiter    *budget.RateLimiter
+	Anomaly    *anomaly.Detector
+	KillSwitch *anomaly.KillSwitch
+	Meter      *meter.Writer
+	// AdminTokens are the bearer tokens accepted on /internal/admin/*.
+	// Empty values are ignored.
+	AdminTokens []string
+
+	// Dependencies checked by /internal/ready; nil ones are skipped.
+	Database    Pinger
+	ConfigState Syncer
+	Prober      *health.Prober
+	// MeterBacklogMax is the number of unflushed meter records above
+	// which the instance reports not ready. Zero disables the limit.
+	MeterBacklogMax int
+}
+
+// Server exposes the gateway's HTTP API on top of the request pipeline.
+type Server struct {
+	pipeline *pipeline.Pipeline
+	batches  *batch.Service
+	metrics  *metrics.Gateway
+	tracer   *tracing.Tracer
+	logger   *slog.Logger
+	stored   *responses.Store
+
+	cache       *cache.Cache
+	limiter     *budget.RateLimiter
+	anomaly     *anomaly.Detector
+	killSwitch  *anomaly.KillSwitch
+	meter       *meter.Writer
+	adminTokens []string
+
+	database        Pinger
+	configState     Syncer
+	prober          *health.Prober
+	meterBacklogMax int
+	draining        atomic.Bool
+	streams         streamTracker
+}
+
+func New(opts Options) *Server {
+	logger := opts.Logger
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	return &Server{
+		pipeline:    opts.Pipeline,
+		batches:     opts.Batches,
+		metrics:     opts.Metrics,
+		tracer:      opts.Tracer,
+		logger:      logger,
+		stored:      responses.NewStore(storedResponsesMax, storedResponsesTTL),
+		cache:       opts.Cache,
+		limiter:     opts.Limiter,
+		anomaly:     opts.Anomaly,
+		killSwitch:  opts.KillSwitch,
+		meter:       opts.Meter,
+		adminTokens: opts.AdminTokens,
+
+		database:        opts.Database,
+		configState:     opts.ConfigState,
+		prober:          opts.Prober,
+		meterBacklogMax: opts.MeterBacklogMax,
+	}
+}
+
+// Handler returns an http.Handler with all gateway endpoints registered.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// POST /v1/chat/completions - main proxy endpoint
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+
+	// POST /v1/embeddings - embeddings proxy
+	mux.HandleFunc("POST /v1/embeddings", s.handleEmbeddings)
+
+	// POST /v1/messages - Anthropic Messages API compatibility
+	mux.HandleFunc("POST /v1/messages", s.handleMessages)
+
+	// POST /v1/responses - OpenAI Responses API
+	mux.HandleFunc("POST /v1/responses", s.handleResponses)
+
+	// Files and Batches APIs - background batch execution
+	mux.HandleFunc("POST /v1/files", s.handleCreateFile)
+	mux.HandleFunc("GET /v1/files/{id}", s.handleGetFile)
+	mux.HandleFunc("GET /v1/files/{id}/content", s.handleGetFileContent)
+	mux.HandleFunc("POST /v1/batches", s.handleCreateBatch)
+	mux.HandleFunc("GET /v1/batches", s.handleListBatches)
+	mux.HandleFunc("GET /v1/batches/{id}", s.handleGetBatch)
+	mux.HandleFunc("POST /v1/batches/{id}/cancel", s.handleCancelBatch)
+
+	// GET /v1/models - list virtual models
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+
+	// Liveness, GET and POST
+	mux.HandleFunc("POST /internal/health", s.handleHealth)
+	mux.HandleFunc("GET /internal/health", s.handleHealth)
+
+	// Readiness - dependency checks, 503 while draining
+	mux.HandleFunc("GET /internal/ready", s.handleReady)
+
+	// Admin API - act on this instance's live state during an incident
+	mux.HandleFunc("GET /internal/admin/killswitch", s.adminAuth(s.handleAdminKillSwitches))
+	mux.HandleFunc("POST /internal/admin/environments/{id}/killswitch", s.adminAuth(s.handleAdminActivateKillSwitch))
+	mux.HandleFunc("DELETE /internal/admin/environments/{id}/killswitch", s.adminAuth(s.handleAdminDeactivateKillSwitch))
+	mux.HandleFunc("GET /internal/admin/cache", s.adminAuth(s.handleAdminCacheEntries))
+	mux.HandleFunc("DELETE /internal/admin/cache", s.adminAuth(s.handleAdminCachePurge))
+	mux.HandleFunc("GET /internal/admin/ratelimits", s.adminAuth(s.handleAdminRateLimits))
+	mux.HandleFunc("GET /internal/admin/anomaly", s.adminAuth(s.handleAdminAnomaly))
+	mux.HandleFunc("POST /internal/admin/meter/flush", s.adminAuth(s.handleAdminMeterFlush))
+
+	// GET /metrics - Prometheus scrape endpoint
+	mux.Handle("GET /metrics", s.metrics.Handler())
+
+	// The client certificate is attached before tracing, as a request
+	// replaced inside traced would not carry the pattern the mux matched.
+	return withClientCert(s.traced(mux))
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// routeSlug returns the route requested through the X-Route-Id header,
+// falling back to X-Feature.
+func routeSlug(r *http.Request) string {
+	if slug := r.Header.Get("X-Route-Id"); slug != "" {
+		return slug
+	}
+	return r.Header.Get("X-Feature")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, model.ErrorResponse{
+		Error: model.ErrorDetail{
+			Message: message,
+			Type:    errType,
+		},
+	})
+}
+
+// writePipelineError renders an error returned by the pipeline.
+func writePipelineError(w http.ResponseWriter, err error) {
+	setRetryAfter(w, err)
+	status, body := errorBody(err)
+	writeJSON(w, status, body)
+}
+
+// setRetryAfter relays the wait a provider asked for, rounded up to whole
+// seconds.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var pe *pipeline.Error
+	if errors.As(err, &pe) && pe.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((pe.RetryAfter+time.Second-1)/time.Second)))
+	}
+}
+
+// errorBody maps an error onto an HTTP status and OpenAI error body.
+// Errors that did not originate in the pipeline become a generic 500.
+func errorBody(err error) (int, model.ErrorResponse) {
+	var pe *pipeline.Error
+	if !errors.As(err, &pe) {
+		return http.StatusInternalServerError, model.ErrorResponse{
+			Error: model.ErrorDetail{
+				Message: "Internal gateway error",
+				Type:    "api_error",
+			},
+		}
+	}
+	return pe.Status, model.ErrorResponse{
+		Error: model.ErrorDetail{
+			Message: pe.Message,
+			Type:    pe.Type,
+			Code:    pe.Code,
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/openfive/gateway/internal/model"
+)
+
+// sseWriter relays chunks to the client as server-sent events, flushing
+// after every event. Headers are sent lazily so that errors raised before
+// the first chunk can still be returned as a regular JSON response.
+type sseWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (s *sseWriter) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	h := s.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+
+	// Streams may outlive the server's WriteTimeout.
+	_ = s.rc.SetWriteDeadline(time.Time{})
+}
+
+// WriteChunk sends a chat completion chunk as an unnamed data event.
+func (s *sseWriter) WriteChunk(chunk *model.ChatCompletionChunk) error {
+	return s.writeEvent("", chunk)
+}
+
+// WriteError sends an error event in the OpenAI error format.
+func (s *sseWriter) WriteError(err error) error {
+	_, body := errorBody(err)
+	return s.writeEvent("", body)
+}
+
+// Done terminates an OpenAI-style stream.
+func (s *sseWriter) Done() error {
+	s.start()
+	if _, err := fmt.Fprint(s.w, "data: [DONE]\n\n"); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) writeEvent(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.start()
+	if event != "" {
+		if _, err := fmt.Fprintf(s.w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
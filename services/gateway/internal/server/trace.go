@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+// traced starts a server span for every API request, continuing the
+// caller's trace when a traceparent header is present. Health checks and
+// scrapes are not traced.
+func (s *Server) traced(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := s.tracer.Start(ctx, r.Method+" "+r.URL.Path, tracing.KindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("user_agent.original", r.UserAgent()))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(sw, r)
+
+		// The mux records the matched pattern on the request.
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			if _, route, ok := strings.Cut(r.Pattern, " "); ok {
+				span.SetAttributes(tracing.String("http.route", route))
+			}
+		}
+		span.SetAttributes(tracing.Int("http.response.status_code", sw.status))
+		if sw.status >= 500 {
+			span.SetError(strconv.Itoa(sw.status), http.StatusText(sw.status))
+		}
+	})
+}
+
+// statusWriter records the response status. Unwrap keeps flushing and
+// deadlines available to http.ResponseController.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	w.wroteHeader = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openfive/gateway/internal/auth"
+	"github.com/openfive/gateway/internal/model"
+	"github.com/openfive/gateway/internal/pipeline"
+	"github.com/openfive/gateway/internal/tracing"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*tracing.SpanData
+}
+
+func (r *spanRecorder) Export(s *tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// noKeys finds no API key, by hash or by certificate.
+type noKeys struct{}
+
+func (noKeys) FindByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return nil, errors.New("not found")
+}
+
+func (noKeys) FindByPreviousHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	return nil, errors.New("not found")
+}
+
+func (noKeys) FindByCertIdentity(ctx context.Context, identity string) (*model.APIKey, error) {
+	return nil, errors.New("not found")
+}
+
+func TestTraced_ClientCertRequestNamedByRoute(t *testing.T) {
+	rec := &spanRecorder{}
+	tracer := tracing.NewTracer(rec)
+	s := New(Options{
+		Pipeline: pipeline.New(pipeline.Options{Auth: auth.NewAuthenticator(noKeys{}), Tracer: tracer}),
+		Tracer:   tracer,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/batches/batch_123", nil)
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing-agent"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "client certificate is not mapped") {
+		t.Errorf("body = %s, want the certificate to reach authentication", w.Body.String())
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	var server *tracing.SpanData
+	for _, span := range rec.spans {
+		if span.Kind == tracing.KindServer {
+			server = span
+		}
+	}
+	if server == nil {
+		t.Fatal("no server span exported")
+	}
+	if server.Name != "GET /v1/batches/{id}" {
+		t.Errorf("span name = %q, want the matched pattern", server.Name)
+	}
+	route := ""
+	for _, a := range server.Attrs {
+		if a.Key == "http.route" {
+			route, _ = a.Value.(string)
+		}
+	}
+	if route != "/v1/batches/{id}" {
+		t.Errorf("http.route = %q, want /v1/batches/{id}", route)
+	}
+}
@@ -31,6 +31,27 @@ func (e *Estimator) EstimateInput(messages []model.Message) int {
 	return total
 }
 
+// EstimateEmbeddingInput estimates the tokens of an embeddings input, which
+// may be a string, an array of strings, or pre-tokenized integer arrays.
+func (e *Estimator) EstimateEmbeddingInput(input interface{}) int {
+	switch v := input.(type) {
+	case string:
+		return e.countTokens(v)
+	case []interface{}:
+		total := 0
+		for _, item := range v {
+			switch t := item.(type) {
+			case float64:
+				total++ // a single token ID
+			default:
+				total += e.EstimateEmbeddingInput(t)
+			}
+		}
+		return total
+	}
+	return 0
+}
+
 // EstimateOutput estimates output tokens using max_tokens or a heuristic.
 func (e *Estimator) EstimateOutput(req *model.ChatCompletionRequest, modelMaxOutput *int, inputTokens int) int {
 	if req.MaxTokens != nil {
@@ -46,6 +67,12 @@ func (e *Estimator) EstimateOutput(req *model.ChatCompletionRequest, modelMaxOut
 	return est
 }
 
+// EstimateText estimates the number of tokens in generated text, used when
+// a provider does not report usage for a streamed response.
+func (e *Estimator) EstimateText(text string) int {
+	return e.countTokens(text)
+}
+
 // EstimateCost estimates the cost in USD for a request.
 func (e *Estimator) EstimateCost(inputTokens, outputTokens int, inputPricePerM, outputPricePerM float64) float64 {
 	inputCost := float64(inputTokens) / 1_000_000 * inputPricePerM
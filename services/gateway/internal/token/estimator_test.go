@@ -122,6 +122,37 @@ func TestEstimator_EstimateInput_WithToolCalls(t *testing.T) {
 	}
 }
 
+func TestEstimator_EstimateText(t *testing.T) {
+	e := NewEstimator()
+	got := e.EstimateText("The quick brown fox jumps over the lazy dog.")
+	if got != 11 {
+		t.Errorf("EstimateText(44 chars) = %d, want 11", got)
+	}
+}
+
+func TestEstimator_EstimateEmbeddingInput(t *testing.T) {
+	e := NewEstimator()
+	tests := []struct {
+		name  string
+		input interface{}
+		want  int
+	}{
+		{"string", "abcdefgh", 2},
+		{"string array", []interface{}{"abcd", "abcdefgh"}, 3},
+		{"token array", []interface{}{float64(101), float64(2023), float64(102)}, 3},
+		{"nested token arrays", []interface{}{
+			[]interface{}{float64(1), float64(2)},
+			[]interface{}{float64(3)},
+		}, 3},
+		{"nil", nil, 0},
+	}
+	for _, tc := range tests {
+		if got := e.EstimateEmbeddingInput(tc.input); got != tc.want {
+			t.Errorf("%s: EstimateEmbeddingInput() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
 func TestEstimator_EstimateCost(t *testing.T) {
 	e := NewEstimator()
 	// 1000 input tokens at $3/M, 500 output tokens at $15/M
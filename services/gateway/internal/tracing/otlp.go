@@ -0,0 +1,322 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scopeName is the instrumentation scope reported with every span.
+	scopeName = "github.com/openfive/gateway"
+
+	queueSize     = 2048
+	maxExportSize = 512
+	exportEvery   = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// OTLPConfig configures the OTLP/HTTP exporter.
+type OTLPConfig struct {
+	// Endpoint is the full traces URL, e.g. http://localhost:4318/v1/traces.
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	Environment string
+}
+
+// OTLPExporter batches spans and posts them as OTLP/HTTP JSON. Spans are
+// dropped when the queue is full rather than blocking requests.
+type OTLPExporter struct {
+	cfg    OTLPConfig
+	client *http.Client
+	logger *slog.Logger
+
+	queue   chan *SpanData
+	flushCh chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	stopOnce sync.Once
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+func NewOTLPExporter(cfg OTLPConfig, client *http.Client, logger *slog.Logger) *OTLPExporter {
+	e := &OTLPExporter{
+		cfg:     cfg,
+		client:  client,
+		logger:  logger,
+		queue:   make(chan *SpanData, queueSize),
+		flushCh: make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// Export queues a finished span.
+func (e *OTLPExporter) Export(span *SpanData) {
+	select {
+	case e.queue <- span:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (e *OTLPExporter) Dropped() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Flush exports every queued span.
+func (e *OTLPExporter) Flush() {
+	ack := make(chan struct{})
+	select {
+	case e.flushCh <- ack:
+		<-ack
+	case <-e.stopped:
+	}
+}
+
+// Shutdown exports the remaining spans and stops the exporter, giving up
+// when ctx ends.
+func (e *OTLPExporter) Shutdown(ctx context.Context) {
+	e.stopOnce.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+	}
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(exportEvery)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, maxExportSize)
+	send := func() {
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = batch[:0]
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case span := <-e.queue:
+				batch = append(batch, span)
+				if len(batch) == maxExportSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) == maxExportSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case ack := <-e.flushCh:
+			drain()
+			close(ack)
+		case <-e.done:
+			drain()
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []*SpanData) {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		e.logger.Error("encode spans", "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		e.logger.Error("export spans", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		e.logger.Warn("export spans", "spans", len(spans), "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		e.logger.Warn("export spans", "spans", len(spans), "status", resp.StatusCode, "body", strings.TrimSpace(string(msg)))
+	}
+}
+
+// OTLP/JSON payload, see opentelemetry-proto's trace service. Trace and
+// span IDs are hex encoded and 64-bit integers are strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+func (e *OTLPExporter) encode(spans []*SpanData) otlpRequest {
+	resource := []otlpKeyValue{keyValue(String("service.name", e.cfg.ServiceName))}
+	if e.cfg.Environment != "" {
+		resource = append(resource, keyValue(String("deployment.environment.name", e.cfg.Environment)))
+	}
+
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			TraceState:        s.Context.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: s.Status, Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attrs {
+			span.Attributes = append(span.Attributes, keyValue(a))
+		}
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: out}},
+	}}}
+}
+
+func keyValue(a Attr) otlpKeyValue {
+	return otlpKeyValue{Key: a.Key, Value: value(a.Value)}
+}
+
+func value(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	case []string:
+		arr := &otlpArrayValue{Values: make([]otlpValue, len(v))}
+		for i, s := range v {
+			arr.Values[i] = value(s)
+		}
+		return otlpValue{ArrayValue: arr}
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+// ParseHeaders parses OTEL_EXPORTER_OTLP_HEADERS: comma separated
+// key=value pairs with URL-encoded values.
+func ParseHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = unescaped
+		}
+		headers[k] = strings.TrimSpace(v)
+	}
+	return headers
+}
@@ -0,0 +1,192 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind values as defined by OTLP.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// StatusCode values as defined by OTLP.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attr is a span attribute. Value is a string, bool, int, int64, float64
+// or []string.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attr           { return Attr{Key: key, Value: value} }
+func Int(key string, value int) Attr          { return Attr{Key: key, Value: int64(value)} }
+func Int64(key string, value int64) Attr      { return Attr{Key: key, Value: value} }
+func Float(key string, value float64) Attr    { return Attr{Key: key, Value: value} }
+func Bool(key string, value bool) Attr        { return Attr{Key: key, Value: value} }
+func Strings(key string, value []string) Attr { return Attr{Key: key, Value: value} }
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(span *SpanData)
+}
+
+// Tracer starts spans and hands the sampled ones to an exporter. A nil
+// *Tracer, or one without an exporter, still creates and propagates span
+// contexts but records nothing.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Start starts a span as a child of the span in ctx, or of the remote span
+// context extracted from the incoming request, or as a new root.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attr) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := &Span{sc: sc}
+	if t != nil && t.exporter != nil && sc.Sampled {
+		span.exporter = t.exporter
+		span.data = &SpanData{
+			Context: sc,
+			Name:    name,
+			Kind:    kind,
+			Start:   time.Now(),
+			Attrs:   append([]Attr(nil), attrs...),
+		}
+		if parent.IsValid() {
+			span.data.Parent = parent.SpanID
+		}
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// SpanData is a finished span as handed to the exporter.
+type SpanData struct {
+	Context       SpanContext
+	Parent        SpanID
+	Name          string
+	Kind          SpanKind
+	Start         time.Time
+	End           time.Time
+	Attrs         []Attr
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is an operation in a trace. All methods are safe on a nil or
+// non-recording span.
+type Span struct {
+	sc       SpanContext
+	exporter Exporter
+
+	mu    sync.Mutex
+	data  *SpanData
+	ended bool
+}
+
+// SpanContext returns the span's identity. A nil span has none.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// IsRecording reports whether the span will be exported.
+func (s *Span) IsRecording() bool {
+	return s != nil && s.data != nil
+}
+
+// SetName renames the span, for names only known once the work is done.
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if !s.ended {
+		s.data.Name = name
+	}
+	s.mu.Unlock()
+}
+
+// SetAttributes adds attributes, replacing earlier values of the same key.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for _, a := range attrs {
+		replaced := false
+		for i := range s.data.Attrs {
+			if s.data.Attrs[i].Key == a.Key {
+				s.data.Attrs[i] = a
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attrs = append(s.data.Attrs, a)
+		}
+	}
+}
+
+// SetError marks the span as failed. errType is recorded as error.type.
+func (s *Span) SetError(errType, message string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.SetAttributes(String("error.type", errType))
+	s.mu.Lock()
+	if !s.ended {
+		s.data.Status = StatusError
+		s.data.StatusMessage = message
+	}
+	s.mu.Unlock()
+}
+
+// End finishes the span and exports it. Later calls, and changes made
+// after it, do nothing.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := *s.data
+	s.mu.Unlock()
+	s.exporter.Export(&data)
+}
@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recorder struct {
+	spans []*SpanData
+}
+
+func (r *recorder) Export(s *SpanData) { r.spans = append(r.spans, s) }
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok {
+		t.Fatal("valid traceparent rejected")
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("ids = %s %s", sc.TraceID, sc.SpanID)
+	}
+	if !sc.Sampled || !sc.Remote {
+		t.Errorf("sampled = %v, remote = %v", sc.Sampled, sc.Remote)
+	}
+	if got := sc.Traceparent(); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Traceparent() = %q", got)
+	}
+
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Error("future version with extra fields rejected")
+	}
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, h := range invalid {
+		if _, ok := ParseTraceparent(h); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", h)
+		}
+	}
+}
+
+func TestStart_ContinuesRemoteTrace(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewTracer(rec)
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Extract(context.Background(), h)
+
+	ctx, server := tracer.Start(ctx, "POST /v1/chat/completions", KindServer)
+	_, child := tracer.Start(ctx, "gateway.auth", KindInternal, String("k", "v"))
+	child.SetError("auth", "bad key")
+	child.End()
+	child.SetName("ignored after End")
+	server.End()
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	c, s := rec.spans[0], rec.spans[1]
+	if s.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent.String() != "00f067aa0ba902b7" {
+		t.Errorf("server span not a child of the remote span: %s %s", s.Context.TraceID, s.Parent)
+	}
+	if c.Context.TraceID != s.Context.TraceID || c.Parent != s.Context.SpanID {
+		t.Error("child span not a child of the server span")
+	}
+	if c.Name != "gateway.auth" || c.Status != StatusError || c.StatusMessage != "bad key" {
+		t.Errorf("child = %q %v %q", c.Name, c.Status, c.StatusMessage)
+	}
+}
+
+func TestStart_UnsampledAndNilTracer(t *testing.T) {
+	rec := &recorder{}
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx := Extract(context.Background(), h)
+
+	_, span := NewTracer(rec).Start(ctx, "unsampled", KindServer)
+	span.End()
+	if span.IsRecording() || len(rec.spans) != 0 {
+		t.Error("unsampled span recorded")
+	}
+
+	var tracer *Tracer
+	_, root := tracer.Start(context.Background(), "root", KindInternal)
+	root.SetAttributes(Int("n", 1))
+	root.End()
+	if !root.SpanContext().IsValid() {
+		t.Error("nil tracer did not generate a span context")
+	}
+}
+
+func TestTransport_InjectsTraceparent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(TraceparentHeader)
+	}))
+	defer srv.Close()
+
+	ctx, span := NewTracer(nil).Start(context.Background(), "chat", KindClient)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got != span.SpanContext().Traceparent() {
+		t.Errorf("traceparent = %q, want %q", got, span.SpanContext().Traceparent())
+	}
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("caller's request was modified")
+	}
+}
+
+func TestOTLPExporter_PostsJSON(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint:    srv.URL + "/v1/traces",
+		Headers:     ParseHeaders("Authorization=Bearer%20abc, x-team = core"),
+		ServiceName: "openfive-gateway",
+	}, srv.Client(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, span := NewTracer(exporter).Start(context.Background(), "chat gpt-4o", KindClient,
+		String("gen_ai.request.model", "gpt-4o"), Int("gen_ai.usage.input_tokens", 12))
+	span.End()
+	exporter.Flush()
+
+	var req otlpRequest
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer abc" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "chat gpt-4o" || spans[0].Kind != KindClient {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if spans[0].TraceID != span.SpanContext().TraceID.String() {
+		t.Errorf("traceId = %s", spans[0].TraceID)
+	}
+	attrs := spans[0].Attributes
+	if len(attrs) != 2 || attrs[1].Value.IntValue == nil || *attrs[1].Value.IntValue != "12" {
+		t.Errorf("attributes = %+v", attrs)
+	}
+	if svc := req.ResourceSpans[0].Resource.Attributes[0]; *svc.Value.StringValue != "openfive-gateway" {
+		t.Errorf("service.name = %s", *svc.Value.StringValue)
+	}
+
+	exporter.Shutdown(context.Background())
+}
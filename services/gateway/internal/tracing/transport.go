@@ -0,0 +1,21 @@
+package tracing
+
+import "net/http"
+
+// Transport propagates the active span to outgoing requests through the
+// traceparent and tracestate headers.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if SpanContextFromContext(req.Context()).IsValid() {
+		req = req.Clone(req.Context())
+		Inject(req.Context(), req.Header)
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,211 @@
+// Package upgrade replaces the running gateway with a new binary without
+// closing its listening socket. On Upgrade the process starts a copy of
+// its executable that inherits the listener, waits for it to report
+// ready, and leaves the caller to drain its own connections.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envInherit marks a process started by Upgrade. The listener and the
+// ready pipe are passed as the first two extra files, fds 3 and 4.
+const envInherit = "GATEWAY_UPGRADE_INHERIT"
+
+const (
+	listenerFD = 3
+	readyFD    = 4
+)
+
+// Upgrader hands the listening socket over to a new process.
+type Upgrader struct {
+	pidFile      string
+	readyTimeout time.Duration
+	inherited    bool
+	// argv is the command the new process runs, os.Args by default.
+	argv []string
+
+	mu        sync.Mutex
+	ln        net.Listener
+	upgrading bool
+}
+
+// New returns an Upgrader. pidFile, when set, is rewritten with the PID of
+// whichever process is serving so supervisors can follow the upgrade.
+// readyTimeout bounds how long Upgrade waits for the new process.
+func New(pidFile string, readyTimeout time.Duration) *Upgrader {
+	return &Upgrader{
+		pidFile:      pidFile,
+		readyTimeout: readyTimeout,
+		inherited:    os.Getenv(envInherit) != "",
+		argv:         os.Args,
+	}
+}
+
+// Inherited reports whether this process was started by Upgrade.
+func (u *Upgrader) Inherited() bool {
+	return u.inherited
+}
+
+// Listen returns the listener inherited from the previous process, or a
+// new TCP listener on addr.
+func (u *Upgrader) Listen(addr string) (net.Listener, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+	if u.inherited {
+		f := os.NewFile(listenerFD, "inherited-listener")
+		ln, err = net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherit listener: %w", err)
+		}
+	} else {
+		ln, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u.mu.Lock()
+	u.ln = ln
+	u.mu.Unlock()
+	return ln, nil
+}
+
+// Ready records this process as the one serving: it writes the PID file
+// and, when started by Upgrade, tells the previous process to drain.
+func (u *Upgrader) Ready() error {
+	if u.pidFile != "" {
+		if err := writePIDFile(u.pidFile); err != nil {
+			return fmt.Errorf("write pid file: %w", err)
+		}
+	}
+	if !u.inherited {
+		return nil
+	}
+	f := os.NewFile(readyFD, "upgrade-ready")
+	defer f.Close()
+	if _, err := f.Write([]byte{1}); err != nil {
+		return fmt.Errorf("notify previous process: %w", err)
+	}
+	return nil
+}
+
+// Upgrade starts a new process of the current executable with the same
+// arguments, handing it the listener, and returns its PID once it is
+// ready. On error the new process is killed and this one keeps serving.
+func (u *Upgrader) Upgrade() (int, error) {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return 0, errors.New("upgrade already in progress")
+	}
+	ln := u.ln
+	u.upgrading = true
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	filer, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return 0, fmt.Errorf("listener %T cannot be handed over", ln)
+	}
+	lnFile, err := filer.File()
+	if err != nil {
+		return 0, fmt.Errorf("duplicate listener: %w", err)
+	}
+	defer lnFile.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		readyW.Close()
+		return 0, fmt.Errorf("find executable: %w", err)
+	}
+	cmd := exec.Command(exe, u.argv[1:]...)
+	cmd.Env = append(withoutInherit(os.Environ()), envInherit+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{lnFile, readyW}
+	err = cmd.Start()
+	// Only the new process may hold the write end, so that its exit
+	// unblocks the read below.
+	readyW.Close()
+	if err != nil {
+		return 0, fmt.Errorf("start new process: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	timer := time.NewTimer(u.readyTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-ready:
+		if err == nil {
+			return cmd.Process.Pid, nil
+		}
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new process failed before becoming ready: %w", err)
+	case err := <-exited:
+		return 0, fmt.Errorf("new process exited before becoming ready: %v", err)
+	case <-timer.C:
+		cmd.Process.Kill()
+		return 0, fmt.Errorf("new process not ready after %s", u.readyTimeout)
+	}
+}
+
+func withoutInherit(env []string) []string {
+	out := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, envInherit+"=") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// writePIDFile replaces the file atomically so a supervisor never reads a
+// partial PID.
+func writePIDFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(strconv.Itoa(os.Getpid()) + "\n"); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
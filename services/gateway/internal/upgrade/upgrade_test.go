@@ -0,0 +1,103 @@
+package upgrade
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess is the new process started by the upgrade tests. It
+// serves "new" on the inherited listener.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv("UPGRADE_TEST_HELPER")
+	if mode == "" {
+		t.Skip("only runs as the upgraded process")
+	}
+	if mode == "fail" {
+		os.Exit(1)
+	}
+	u := New(os.Getenv("UPGRADE_TEST_PID_FILE"), time.Second)
+	ln, err := u.Listen("")
+	if err != nil {
+		os.Exit(2)
+	}
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "new")
+	}))
+	if err := u.Ready(); err != nil {
+		os.Exit(3)
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func newTestUpgrader(t *testing.T, mode string) *Upgrader {
+	t.Helper()
+	t.Setenv("UPGRADE_TEST_HELPER", mode)
+	u := New("", 10*time.Second)
+	u.argv = []string{os.Args[0], "-test.run=^TestHelperProcess$"}
+	return u
+}
+
+func TestUpgrade_HandsOverListener(t *testing.T) {
+	u := newTestUpgrader(t, "serve")
+	pidFile := filepath.Join(t.TempDir(), "gateway.pid")
+	t.Setenv("UPGRADE_TEST_PID_FILE", pidFile)
+
+	ln, err := u.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	pid, err := u.Upgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	// The old process stops accepting; the socket stays open in the new one.
+	ln.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("request after handover: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "new" {
+		t.Errorf("body = %q, want served by the new process", body)
+	}
+
+	written, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(written)); got != strconv.Itoa(pid) {
+		t.Errorf("pid file = %q, want %d", got, pid)
+	}
+}
+
+func TestUpgrade_NewProcessFails(t *testing.T) {
+	u := newTestUpgrader(t, "fail")
+	ln, err := u.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if _, err := u.Upgrade(); err == nil {
+		t.Fatal("Upgrade succeeded although the new process exited")
+	}
+	// The old listener is untouched and a later upgrade may be attempted.
+	if u.upgrading {
+		t.Error("upgrade still marked in progress")
+	}
+}